@@ -54,8 +54,21 @@ func enc(data interface{}) []byte {
 // value was stored in the cache, or an error, if the value was not found,
 // expired, or could not be decoded into val.
 func (c *Cache) Get(key string, val interface{}) (uint64, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	return c.get(key, val, false)
+}
+
+// GetStale is like Get, but returns the value at the key even if it has
+// expired, as long as it hasn't been evicted to make room for other values.
+// Use it when fresh data can't be retrieved.
+func (c *Cache) GetStale(key string, val interface{}) (uint64, error) {
+	return c.get(key, val, true)
+}
+
+func (c *Cache) get(key string, val interface{}, allowExpired bool) (uint64, error) {
+	// lru.Cache.Get updates the recently used list, so this needs a write
+	// lock.
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	cacheVal, ok := c.c.Get(key)
 	if !ok {
 		c.Debug("cache miss", "key", key)
@@ -66,9 +79,10 @@ func (c *Cache) Get(key string, val interface{}) (uint64, error) {
 		c.Warn("Invalid value in cache", "val", cacheVal, "key", key)
 		return 0, errors.New("could not cast value to expiringBits")
 	}
-	if now, expires := monotime.Now(), e.Set+e.Timeout; now > expires {
+	// Expired values are left in the cache for GetStale; the LRU evicts
+	// them when it needs room.
+	if now, expires := monotime.Now(), e.Set+e.Timeout; now > expires && !allowExpired {
 		c.Debug("found expired value in cache", "key", key, "expired_ago", time.Duration(now-expires))
-		c.c.Remove(key)
 		return 0, expired
 	}
 	reader, err := gzip.NewReader(bytes.NewReader(e.Bits))
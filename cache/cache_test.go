@@ -57,3 +57,24 @@ func TestExpiredValueNotFound(t *testing.T) {
 		t.Errorf("retrieved message page from cache, it should have expired: %#v", err)
 	}
 }
+
+func TestGetStale(t *testing.T) {
+	t.Parallel()
+	mp := new(twilio.MessagePage)
+	if err := json.Unmarshal(test.MessageBody, mp); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCache(1, test.NullLogger)
+	c.Set("npuri", mp, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	mp2 := new(twilio.MessagePage)
+	if _, err := c.Get("npuri", mp2); err != expired {
+		t.Fatalf("expected Get to return expired, got %v", err)
+	}
+	if _, err := c.GetStale("npuri", mp2); err != nil {
+		t.Fatalf("expected GetStale to return the expired value, got %v", err)
+	}
+	if !reflect.DeepEqual(mp, mp2) {
+		t.Errorf("structs were not deep equal")
+	}
+}
@@ -0,0 +1,222 @@
+// The logrole_passwd command manages the users in a Basic Auth password file.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	flag.Usage = func() {
+		os.Stderr.WriteString(`logrole_passwd
+
+Manage the users in a Basic Auth password file (basic_auth_password_file in
+your config). The file is compatible with "htpasswd -B". A running server
+picks up changes within a few seconds.
+
+Usage:
+  logrole_passwd [flags] add <user>      Add a user
+  logrole_passwd [flags] rotate <user>   Change an existing user's password
+  logrole_passwd [flags] remove <user>   Remove a user
+  logrole_passwd [flags] list            List users
+
+The new password is read from the first line of stdin, unless you pass
+--generate to create a random password, which is printed to stdout.
+
+Flags:
+`)
+		flag.PrintDefaults()
+	}
+}
+
+// op is a change to a password file.
+type op int
+
+const (
+	opAdd op = iota
+	opRotate
+	opRemove
+)
+
+// update returns the contents of a password file after applying the op for
+// user. Other lines, including comments, are preserved.
+func update(data []byte, o op, user string, hash []byte) ([]byte, error) {
+	out := new(bytes.Buffer)
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, user+":") {
+			found = true
+			switch o {
+			case opAdd:
+				return nil, fmt.Errorf("User %s already exists; use rotate to change their password", user)
+			case opRotate:
+				fmt.Fprintf(out, "%s:%s\n", user, hash)
+			}
+			continue
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found && o != opAdd {
+		return nil, fmt.Errorf("User %s not found", user)
+	}
+	if o == opAdd {
+		fmt.Fprintf(out, "%s:%s\n", user, hash)
+	}
+	// Make sure we wrote a file the server can read.
+	if _, err := config.ParsePasswordFile(bytes.NewReader(out.Bytes())); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// listUsers returns the users in the password file, sorted.
+func listUsers(r io.Reader) ([]string, error) {
+	hashes, err := config.ParsePasswordFile(r)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]string, 0, len(hashes))
+	for user := range hashes {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	pass := strings.TrimRight(line, "\r\n")
+	if pass == "" {
+		return "", errors.New("Empty password; pass a password on stdin or use --generate")
+	}
+	return pass, nil
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// writeFile replaces the file at path, so the server never reads a partially
+// written file.
+func writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".logrole-passwd-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func checkErr(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logrole_passwd: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	file := flag.String("file", "htpasswd", "Path to the password file")
+	cost := flag.Int("cost", bcrypt.DefaultCost, "bcrypt cost for new passwords")
+	generate := flag.Bool("generate", false, "Generate a random password and print it")
+	flag.Parse()
+	if flag.NArg() == 1 {
+		switch flag.Arg(0) {
+		case "version":
+			fmt.Fprintf(os.Stderr, "logrole version %s\n", server.Version)
+			os.Exit(2)
+		case "help":
+			flag.Usage()
+			os.Exit(2)
+		case "list":
+			f, err := os.Open(*file)
+			checkErr(err)
+			users, err := listUsers(f)
+			checkErr(err)
+			for _, user := range users {
+				fmt.Println(user)
+			}
+			return
+		}
+	}
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	user := flag.Arg(1)
+	if user == "" || strings.ContainsAny(user, ":\r\n") {
+		checkErr(fmt.Errorf("Invalid user name %q", user))
+	}
+	var o op
+	switch flag.Arg(0) {
+	case "add":
+		o = opAdd
+	case "rotate":
+		o = opRotate
+	case "remove":
+		o = opRemove
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", flag.Arg(0))
+		os.Exit(2)
+	}
+	data, err := ioutil.ReadFile(*file)
+	if err != nil && !(os.IsNotExist(err) && o == opAdd) {
+		checkErr(err)
+	}
+	var hash []byte
+	var pass string
+	if o != opRemove {
+		if *generate {
+			pass, err = generatePassword()
+		} else {
+			pass, err = readPassword(os.Stdin)
+		}
+		checkErr(err)
+		hash, err = bcrypt.GenerateFromPassword([]byte(pass), *cost)
+		checkErr(err)
+	}
+	data, err = update(data, o, user, hash)
+	checkErr(err)
+	checkErr(writeFile(*file, data))
+	if *generate && o != opRemove {
+		fmt.Println(pass)
+	}
+}
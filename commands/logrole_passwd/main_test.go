@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const hashA = "$2a$04$abcdefghijklmnopqrstuu5BoQm6a0K0v8yQa3rYQmZ3XfV2xK1hS"
+const hashB = "$2a$04$zyxwvutsrqponmlkjihgfeZ2kY8q2b6Xq1l1H0j7nQm0dQe0lH9K"
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+	data := []byte("# the team\nalice:" + hashA + "\n")
+	out, err := update(data, opAdd, "bob", []byte(hashB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# the team\nalice:" + hashA + "\nbob:" + hashB + "\n"
+	if string(out) != want {
+		t.Errorf("add: got %q, want %q", out, want)
+	}
+	if _, err := update(out, opAdd, "bob", []byte(hashB)); err == nil {
+		t.Error("expected error adding an existing user")
+	}
+	out, err = update(out, opRotate, "alice", []byte(hashB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "# the team\nalice:" + hashB + "\nbob:" + hashB + "\n"
+	if string(out) != want {
+		t.Errorf("rotate: got %q, want %q", out, want)
+	}
+	out, err = update(out, opRemove, "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "# the team\nbob:" + hashB + "\n"
+	if string(out) != want {
+		t.Errorf("remove: got %q, want %q", out, want)
+	}
+	if _, err := update(out, opRemove, "carol", nil); err == nil {
+		t.Error("expected error removing a missing user")
+	}
+	// "al" is a prefix of "alice" but shouldn't match it.
+	if _, err := update([]byte("alice:"+hashA+"\n"), opRotate, "al", []byte(hashB)); err == nil {
+		t.Error("expected error rotating a missing user")
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	t.Parallel()
+	data := "# the team\ncarol:" + hashA + "\nalice:" + hashB + "\nbob:" + hashA + "\n"
+	users, err := listUsers(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(users, ","); got != "alice,bob,carol" {
+		t.Errorf("listUsers: got %q, want %q", got, "alice,bob,carol")
+	}
+}
@@ -0,0 +1,343 @@
+// The logrole_policy command checks a policy file before you deploy it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/server"
+)
+
+func init() {
+	flag.Usage = func() {
+		os.Stderr.WriteString(`logrole_policy
+
+Check a policy file (policy_file in your config) before you deploy it.
+
+Usage:
+  logrole_policy [flags] validate                Check that the file is valid
+  logrole_policy [flags] show [user]             Print each user's permissions
+  logrole_policy [flags] can <user> view <field> Check whether a user can see
+                                                 a field, e.g. MessageBody
+  logrole_policy diff <old> <new>                Show which users gain or lose
+                                                 permissions
+
+Permissions are shown after defaults are applied, so omitted permissions are
+true, and permissions that depend on another permission (like
+can_view_message_body on can_view_messages) are false if it is.
+
+Exit codes: 0 if the file is valid, the user can see the field, or the files
+grant the same permissions; 1 if not; 2 if the command couldn't run.
+
+Flags:
+`)
+		flag.PrintDefaults()
+	}
+}
+
+// defaultID is shown in place of a user id for users who aren't listed in
+// any group, and get the default group's permissions.
+const defaultID = "(anyone else)"
+
+// describe returns the settings that determine what u can see, keyed by
+// name.
+func describe(u *config.User) map[string]string {
+	d := make(map[string]string)
+	for name, can := range u.Permissions() {
+		d[name] = strconv.FormatBool(can)
+	}
+	us := u.Settings()
+	d["group"] = u.Group()
+	switch us.MaxResourceAge {
+	case 0:
+		d["max_resource_age"] = "default"
+	case config.DefaultMaxResourceAge:
+		// Set by the "omitted means true" defaults.
+		d["max_resource_age"] = "unlimited"
+	default:
+		d["max_resource_age"] = us.MaxResourceAge.String()
+	}
+	if us.MinResourceAge == 0 {
+		d["min_resource_age"] = "default"
+	} else {
+		d["min_resource_age"] = us.MinResourceAge.String()
+	}
+	d["message_from_mask"] = us.MessageFromMask.String()
+	d["message_to_mask"] = us.MessageToMask.String()
+	d["call_from_mask"] = us.CallFromMask.String()
+	d["call_to_mask"] = us.CallToMask.String()
+	d["redact_message_bodies"] = strconv.FormatBool(us.RedactMessageBodies)
+	d["scoped"] = strconv.FormatBool(u.IsScoped())
+	if scope := u.Scope(); scope != nil {
+		d["scope_phone_numbers"] = list(scope.PhoneNumbers)
+		d["scope_phone_number_prefixes"] = list(scope.PhoneNumberPrefixes)
+		d["scope_messaging_service_sids"] = list(scope.MessagingServiceSids)
+	} else {
+		d["scope_phone_numbers"] = "any"
+		d["scope_phone_number_prefixes"] = "any"
+		d["scope_messaging_service_sids"] = "any"
+	}
+	if subnets := u.IPSubnets(); len(subnets) > 0 {
+		strs := make([]string, len(subnets))
+		for i, n := range subnets {
+			strs[i] = n.String()
+		}
+		d["ip_subnets"] = list(strs)
+	} else {
+		d["ip_subnets"] = "any"
+	}
+	if hours := u.AllowedHours(); hours != "" {
+		d["allowed_hours"] = hours
+	} else {
+		d["allowed_hours"] = "any"
+	}
+	d["require_mfa"] = strconv.FormatBool(u.RequiresMFA())
+	d["break_glass"] = strconv.FormatBool(u.BreakGlass() != nil)
+	if rl := u.RateLimit(); rl != nil {
+		d["rate_limit"] = rl.String()
+	} else {
+		d["rate_limit"] = "default"
+	}
+	return d
+}
+
+// list returns vals sorted and separated by commas, or "none" if vals is
+// empty.
+func list(vals []string) string {
+	if len(vals) == 0 {
+		return "none"
+	}
+	sorted := append([]string(nil), vals...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// policyUsers returns the users listed in the policy, and the default group,
+// if there is one.
+func policyUsers(p *config.Policy) map[string]*config.User {
+	users := p.Users()
+	if u, ok := p.DefaultGroupUser(); ok {
+		users[defaultID] = u
+	}
+	return users
+}
+
+func show(w io.Writer, p *config.Policy, id string) error {
+	users := policyUsers(p)
+	if id != "" {
+		u, _, err := p.Lookup(id)
+		if err != nil {
+			return err
+		}
+		users = map[string]*config.User{id: u}
+	}
+	ids := make([]string, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\n", id)
+		d := describe(users[id])
+		for _, k := range sortedKeys(d) {
+			fmt.Fprintf(w, "  %s: %s\n", k, d[k])
+		}
+	}
+	return nil
+}
+
+// permissionName converts a field like "MessageBody" or "message_body" to
+// the name of the permission that controls it, like "can_view_message_body".
+func permissionName(verb, field string) (string, error) {
+	names := make(map[string]bool)
+	for _, name := range config.PermissionNames() {
+		names[name] = true
+	}
+	if names[field] {
+		return field, nil
+	}
+	var snake []rune
+	for i, r := range field {
+		if unicode.IsUpper(r) {
+			if i > 0 && !unicode.IsUpper(rune(field[i-1])) {
+				snake = append(snake, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		snake = append(snake, r)
+	}
+	name := "can_" + verb + "_" + string(snake)
+	if names[name] {
+		return name, nil
+	}
+	return "", fmt.Errorf("Unknown field %q; try one of %s", field, strings.Join(config.PermissionNames(), ", "))
+}
+
+func can(w io.Writer, p *config.Policy, id, verb, field string) (bool, error) {
+	name, err := permissionName(verb, field)
+	if err != nil {
+		return false, err
+	}
+	u, found, err := p.Lookup(id)
+	if err != nil {
+		fmt.Fprintf(w, "no: %v\n", err)
+		return false, nil
+	}
+	group := "group " + u.Group()
+	if !found {
+		group = "default group " + u.Group()
+	}
+	if reason := u.WhyNot(name); reason != "" {
+		fmt.Fprintf(w, "no: %s (%s)\n", reason, group)
+		return false, nil
+	}
+	fmt.Fprintf(w, "yes: %s (%s)\n", name, group)
+	return true, nil
+}
+
+// diff returns a line for each user whose settings differ between the
+// policies.
+func diff(oldPolicy, newPolicy *config.Policy) []string {
+	oldUsers, newUsers := policyUsers(oldPolicy), policyUsers(newPolicy)
+	ids := make(map[string]bool)
+	for id := range oldUsers {
+		ids[id] = true
+	}
+	for id := range newUsers {
+		ids[id] = true
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	var lines []string
+	for _, id := range sorted {
+		o, n := lookup(oldUsers, id), lookup(newUsers, id)
+		switch {
+		case o == nil && n == nil:
+			continue
+		case o == nil:
+			lines = append(lines, fmt.Sprintf("%s: can now log in (group %s)", id, n.Group()))
+			continue
+		case n == nil:
+			lines = append(lines, fmt.Sprintf("%s: can no longer log in", id))
+			continue
+		}
+		od, nd := describe(o), describe(n)
+		var changes []string
+		for _, k := range sortedKeys(od) {
+			switch {
+			case od[k] == nd[k]:
+			case od[k] == "false" && nd[k] == "true":
+				changes = append(changes, "+"+k)
+			case od[k] == "true" && nd[k] == "false":
+				changes = append(changes, "-"+k)
+			default:
+				changes = append(changes, fmt.Sprintf("%s: %s -> %s", k, od[k], nd[k]))
+			}
+		}
+		if len(changes) > 0 {
+			lines = append(lines, id+": "+strings.Join(changes, ", "))
+		}
+	}
+	return lines
+}
+
+// lookup returns the permissions id gets. Users who aren't listed get the
+// default group, if there is one.
+func lookup(users map[string]*config.User, id string) *config.User {
+	if u, ok := users[id]; ok {
+		return u
+	}
+	if u, ok := users[defaultID]; ok && id != defaultID {
+		return u
+	}
+	return nil
+}
+
+func checkErr(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logrole_policy: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+func loadPolicy(path string) *config.Policy {
+	p, err := config.LoadPolicy(path)
+	checkErr(err)
+	return p
+}
+
+func main() {
+	file := flag.String("file", "policy.yml", "Path to the policy file")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	switch flag.Arg(0) {
+	case "version":
+		fmt.Fprintf(os.Stderr, "logrole version %s\n", server.Version)
+		os.Exit(2)
+	case "help":
+		flag.Usage()
+		os.Exit(2)
+	case "validate":
+		if _, err := config.LoadPolicy(*file); err != nil {
+			fmt.Fprintf(os.Stderr, "logrole_policy: %s is invalid: %v\n", *file, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid\n", *file)
+	case "show":
+		if flag.NArg() > 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		checkErr(show(os.Stdout, loadPolicy(*file), flag.Arg(1)))
+	case "can":
+		if flag.NArg() != 4 || (flag.Arg(2) != "view" && flag.Arg(2) != "play") {
+			flag.Usage()
+			os.Exit(2)
+		}
+		ok, err := can(os.Stdout, loadPolicy(*file), flag.Arg(1), flag.Arg(2), flag.Arg(3))
+		checkErr(err)
+		if !ok {
+			os.Exit(1)
+		}
+	case "diff":
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		lines := diff(loadPolicy(flag.Arg(1)), loadPolicy(flag.Arg(2)))
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		if len(lines) > 0 {
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", flag.Arg(0))
+		os.Exit(2)
+	}
+}
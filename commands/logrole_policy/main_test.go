@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/logrole/config"
+)
+
+const oldPolicy = `
+- name: support
+  users:
+      - alice@example.com
+  permissions:
+      can_view_message_body: false
+- name: everyone
+  default: true
+  permissions:
+      can_view_messages: false
+`
+
+const newPolicy = `
+- name: support
+  users:
+      - alice@example.com
+  permissions:
+      can_view_message_body: true
+      can_view_calls: false
+      max_resource_age: 24h
+- name: finance
+  users:
+      - bob@example.com
+  permissions:
+      can_view_messages: true
+`
+
+func loadTestPolicy(t *testing.T, data string) *config.Policy {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "logrole-policy-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.yml")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := config.LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCan(t *testing.T) {
+	t.Parallel()
+	p := loadTestPolicy(t, oldPolicy)
+	tests := []struct {
+		id, verb, field string
+		want            bool
+	}{
+		{"alice@example.com", "view", "MessageBody", false},
+		{"alice@example.com", "view", "Messages", true},
+		{"alice@example.com", "view", "CallbackURLs", true},
+		{"alice@example.com", "play", "Recordings", true},
+		// Falls back to the default group.
+		{"carol@example.com", "view", "can_view_message_from", false},
+	}
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		got, err := can(buf, p, tt.id, tt.verb, tt.field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("can %s %s %s: got %t, want %t (%s)", tt.id, tt.verb, tt.field, got, tt.want, buf.String())
+		}
+	}
+	buf := new(bytes.Buffer)
+	can(buf, p, "carol@example.com", "view", "MessageFrom")
+	if !strings.Contains(buf.String(), "can_view_messages is off") {
+		t.Errorf("expected the answer to explain why, got %q", buf.String())
+	}
+	if _, err := can(buf, p, "alice@example.com", "view", "Nonsense"); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	lines := diff(loadTestPolicy(t, oldPolicy), loadTestPolicy(t, newPolicy))
+	want := []string{
+		"(anyone else): can no longer log in",
+		"alice@example.com: -can_view_call_from, -can_view_call_price, -can_view_call_to, -can_view_calls, +can_view_message_body, max_resource_age: unlimited -> 24h0m0s",
+		"bob@example.com: +can_view_media, +can_view_message_body, +can_view_message_from, +can_view_message_price, +can_view_message_to, +can_view_messages, +can_view_num_media, group: everyone -> finance",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diff:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	if lines := diff(loadTestPolicy(t, oldPolicy), loadTestPolicy(t, oldPolicy)); len(lines) != 0 {
+		t.Errorf("expected no differences, got %v", lines)
+	}
+}
+
+const scopedPolicy = `
+- name: support
+  users:
+      - alice@example.com
+  scope:
+      phone_numbers:
+          - "+14105551234"
+  ip_subnets:
+      - 10.0.0.0/8
+  allowed_hours:
+      start: "09:00"
+      end: "17:00"
+`
+
+const widerScopedPolicy = `
+- name: support
+  users:
+      - alice@example.com
+  scope:
+      phone_numbers:
+          - "+14105551234"
+      phone_number_prefixes:
+          - "+1415"
+  ip_subnets:
+      - 10.0.0.0/8
+      - 192.168.0.0/16
+`
+
+func TestDiffAccessRestrictions(t *testing.T) {
+	t.Parallel()
+	lines := diff(loadTestPolicy(t, scopedPolicy), loadTestPolicy(t, widerScopedPolicy))
+	want := "alice@example.com: allowed_hours: between 09:00 and 17:00 UTC -> any, ip_subnets: 10.0.0.0/8 -> 10.0.0.0/8,192.168.0.0/16, scope_phone_number_prefixes: none -> +1415"
+	if len(lines) != 1 || lines[0] != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", strings.Join(lines, "\n"), want)
+	}
+}
@@ -3,12 +3,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	log "github.com/inconshreveable/log15"
@@ -22,6 +25,9 @@ import (
 
 var logger log.Logger
 
+// How long to wait for the error reporter to send queued errors on shutdown.
+const flushTimeout = 5 * time.Second
+
 func init() {
 	flag.Usage = func() {
 		os.Stderr.WriteString(`Logrole: a faster, finer-grained Twilio log viewer
@@ -88,21 +94,85 @@ func main() {
 		os.Exit(2)
 	}
 	s.CacheCommonQueries()
+	s.WatchAlerts()
 	publicMux := http.NewServeMux()
 	publicMux.Handle("/", s)
-	publicServer := http.Server{
+	publicServer := &http.Server{
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		Handler:      publicMux,
+		TLSConfig:    settings.TLSConfig,
 	}
+	servers := []*http.Server{publicServer}
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", c.Port))
 	if err != nil {
 		logger.Error("Error listening", "err", err, "port", c.Port)
 		os.Exit(2)
 	}
+	var redirectListener net.Listener
+	if c.HTTPRedirectPort != "" {
+		redirectListener, err = net.Listen("tcp", fmt.Sprintf(":%s", c.HTTPRedirectPort))
+		if err != nil {
+			logger.Error("Error listening", "err", err, "port", c.HTTPRedirectPort)
+			os.Exit(2)
+		}
+	}
 	go func(p string) {
 		time.Sleep(30 * time.Millisecond)
-		logger.Info("Started server", "port", p, "public_host", settings.PublicHost)
+		logger.Info("Started server", "port", p, "public_host", settings.PublicHost, "tls", settings.TLSConfig != nil)
 	}(c.Port)
-	publicServer.Serve(listener)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	serveErr := make(chan error, 2)
+	go func() {
+		if settings.TLSConfig != nil {
+			// The certificate comes from TLSConfig.GetCertificate.
+			serveErr <- publicServer.ServeTLS(listener, "", "")
+		} else {
+			serveErr <- publicServer.Serve(listener)
+		}
+	}()
+	if redirectListener != nil {
+		redirectServer := &http.Server{
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			Handler:      server.RedirectToHTTPS(c.Port),
+		}
+		servers = append(servers, redirectServer)
+		go func() {
+			serveErr <- redirectServer.Serve(redirectListener)
+		}()
+		logger.Info("Redirecting HTTP requests to HTTPS", "port", c.HTTPRedirectPort)
+	}
+	select {
+	case err := <-serveErr:
+		logger.Error("Error serving requests", "err", err)
+		s.Shutdown(context.Background())
+		os.Exit(1)
+	case sig := <-sigs:
+		logger.Info("Shutting down", "signal", sig, "delay", settings.ShutdownDelay, "timeout", settings.ShutdownTimeout)
+	}
+	shutdown(servers, s, settings)
+}
+
+// shutdown stops the server without cutting off in-flight requests. It
+// reports that the server isn't ready for settings.ShutdownDelay, so load
+// balancers stop sending new requests, then waits up to
+// settings.ShutdownTimeout for in-flight requests to finish.
+func shutdown(servers []*http.Server, s *server.Server, settings *config.Settings) {
+	s.Drain()
+	time.Sleep(settings.ShutdownDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancel()
+	for _, hs := range servers {
+		if err := hs.Shutdown(ctx); err != nil {
+			logger.Warn("Couldn't finish in-flight requests", "err", err)
+		}
+	}
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer flushCancel()
+	if err := s.Shutdown(flushCtx); err != nil {
+		logger.Warn("Couldn't send queued errors", "err", err)
+	}
+	logger.Info("Shut down server")
 }
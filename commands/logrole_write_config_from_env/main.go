@@ -28,6 +28,18 @@ Supported environment variables are:
 
 PORT                   Port to listen on
 PUBLIC_HOST            Host your users will browse to to see the site
+TLS_CERT_FILE          Serve HTTPS with this certificate file...
+TLS_KEY_FILE           ...and this private key file
+HTTP_REDIRECT_PORT     Redirect HTTP requests on this port to HTTPS
+IP_SUBNETS             Comma-separated list of subnets allowed to visit the site
+TRUSTED_PROXIES        Comma-separated list of subnets of your load balancers.
+                       Forwarding headers are only trusted from these proxies.
+TRUSTED_PROXY_HEADER   "x-forwarded-for" (default) or "forwarded"; the header
+                       your load balancers add the client's address to
+IP_SUBNETS_FAIL_CLOSED "true" to deny access when the client IP is unknown
+SHUTDOWN_DELAY         How long to report "not ready" before draining
+                       requests on shutdown (example "5s")
+SHUTDOWN_TIMEOUT       How long to wait for in-flight requests on shutdown
 
 TWILIO_ACCOUNT_SID     Account SID for your Twilio account
 TWILIO_AUTH_TOKEN      Auth token
@@ -43,16 +55,33 @@ PAGE_SIZE              How many resources to fetch/display on each page
 SECRET_KEY             64 byte hex key - generate with "openssl rand -hex 32"
 MAX_RESOURCE_AGE       How long resources should be visible for - "720h" to
                        hide anything older than 30 days
+MIN_RESOURCE_AGE       How old resources must be before they're visible -
+                       "24h" to hide anything from the last day
 SHOW_MEDIA_BY_DEFAULT  "false" to hide images behind a toggle when a user
                        browses to a MMS message.
 
-AUTH_SCHEME            "basic", "noop", or "google"
+AUTH_SCHEME            "basic", "noop", "header", "google", or "saml"
 BASIC_AUTH_USER        For basic auth, the username
 BASIC_AUTH_PASSWORD    For basic auth, the password
+BASIC_AUTH_PASSWORD_FILE For basic auth, a htpasswd file with bcrypt hashes
+BASIC_AUTH_MFA_FILE    For basic auth, log in with a form and keep two-factor
+                       secrets in this file
+AUTH_HEADER            For header auth, the header with the user's identity
+AUTH_GROUPS_HEADER     For header auth, the header with the user's groups
+AUTH_LOGOUT_URL        For header auth, where to send users who log out
 GOOGLE_CLIENT_ID       For Google OAuth
 GOOGLE_CLIENT_SECRET   For Google OAuth
 GOOGLE_ALLOWED_DOMAINS Comma separated list of domains to allow to
                        authenticate. If empty or omitted, all domains allowed.
+SAML_IDP_METADATA_FILE For SAML, the identity provider's metadata XML file
+SAML_USER_ATTRIBUTE    For SAML, the attribute with the user's identity.
+                       Defaults to the NameID.
+SAML_GROUPS_ATTRIBUTE  For SAML, the attribute with the user's groups
+SESSION_STORE          For Google, SAML or form logins, "memory" or "file" to
+                       store logins on the server so they can be revoked
+SESSION_FILE           For the "file" session store, where to save sessions
+SESSION_MAX_AGE        How long a login lasts, for example "336h"
+SESSION_IDLE_TIMEOUT   Log out users who are idle this long, for example "8h"
 
 ERROR_REPORTER         "sentry", empty, or register your own.
 ERROR_REPORTER_TOKEN   Token for the error reporter.
@@ -117,7 +146,15 @@ func writeConfig(b *bytes.Buffer, e environment) {
 	var ok bool
 	ok = writeVal(b, e, "PORT", "port") || ok
 	ok = writeVal(b, e, "PUBLIC_HOST", "public_host") || ok
+	ok = writeVal(b, e, "TLS_CERT_FILE", "tls_cert_file") || ok
+	ok = writeVal(b, e, "TLS_KEY_FILE", "tls_key_file") || ok
+	ok = writeVal(b, e, "HTTP_REDIRECT_PORT", "http_redirect_port") || ok
 	ok = writeCommaSeparatedVal(b, e, "IP_SUBNETS", "ip_subnets") || ok
+	ok = writeVal(b, e, "IP_SUBNETS_FAIL_CLOSED", "ip_subnets_fail_closed") || ok
+	ok = writeCommaSeparatedVal(b, e, "TRUSTED_PROXIES", "trusted_proxies") || ok
+	ok = writeVal(b, e, "TRUSTED_PROXY_HEADER", "trusted_proxy_header") || ok
+	ok = writeVal(b, e, "SHUTDOWN_DELAY", "shutdown_delay") || ok
+	ok = writeVal(b, e, "SHUTDOWN_TIMEOUT", "shutdown_timeout") || ok
 	if ok {
 		b.WriteByte('\n')
 		ok = false
@@ -139,6 +176,7 @@ func writeConfig(b *bytes.Buffer, e environment) {
 	}
 	ok = writeVal(b, e, "SECRET_KEY", "secret_key") || ok
 	ok = writeVal(b, e, "MAX_RESOURCE_AGE", "max_resource_age") || ok
+	ok = writeVal(b, e, "MIN_RESOURCE_AGE", "min_resource_age") || ok
 	ok = writeVal(b, e, "SHOW_MEDIA_BY_DEFAULT", "show_media_by_default") || ok
 	if ok {
 		b.WriteByte('\n')
@@ -147,9 +185,21 @@ func writeConfig(b *bytes.Buffer, e environment) {
 	ok = writeVal(b, e, "AUTH_SCHEME", "auth_scheme") || ok
 	ok = writeVal(b, e, "BASIC_AUTH_USER", "basic_auth_user") || ok
 	ok = writeVal(b, e, "BASIC_AUTH_PASSWORD", "basic_auth_password") || ok
+	ok = writeVal(b, e, "BASIC_AUTH_PASSWORD_FILE", "basic_auth_password_file") || ok
+	ok = writeVal(b, e, "BASIC_AUTH_MFA_FILE", "basic_auth_mfa_file") || ok
+	ok = writeVal(b, e, "AUTH_HEADER", "auth_header") || ok
+	ok = writeVal(b, e, "AUTH_GROUPS_HEADER", "auth_groups_header") || ok
+	ok = writeVal(b, e, "AUTH_LOGOUT_URL", "auth_logout_url") || ok
 	ok = writeVal(b, e, "GOOGLE_CLIENT_ID", "google_client_id") || ok
 	ok = writeVal(b, e, "GOOGLE_CLIENT_SECRET", "google_client_secret") || ok
 	ok = writeCommaSeparatedVal(b, e, "GOOGLE_ALLOWED_DOMAINS", "google_allowed_domains") || ok
+	ok = writeVal(b, e, "SAML_IDP_METADATA_FILE", "saml_idp_metadata_file") || ok
+	ok = writeVal(b, e, "SAML_USER_ATTRIBUTE", "saml_user_attribute") || ok
+	ok = writeVal(b, e, "SAML_GROUPS_ATTRIBUTE", "saml_groups_attribute") || ok
+	ok = writeVal(b, e, "SESSION_STORE", "session_store") || ok
+	ok = writeVal(b, e, "SESSION_FILE", "session_file") || ok
+	ok = writeVal(b, e, "SESSION_MAX_AGE", "session_max_age") || ok
+	ok = writeVal(b, e, "SESSION_IDLE_TIMEOUT", "session_idle_timeout") || ok
 	if ok {
 		b.WriteByte('\n')
 		ok = false
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// AllowedHours restricts a group to a window of time on particular days.
+type AllowedHours struct {
+	// An IANA timezone name, like "America/New_York". Defaults to UTC.
+	Timezone string `yaml:"timezone,omitempty"`
+	// Days of the week the group can use the site, like "mon" or "tuesday".
+	// Defaults to every day.
+	Days []string `yaml:"days,omitempty"`
+	// The start and end of the window in 24-hour time, like "09:00" and
+	// "17:30". If End is earlier than Start, the window ends the next day.
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// hoursWindow is a parsed AllowedHours.
+type hoursWindow struct {
+	loc *time.Location
+	// nil means every day.
+	days map[time.Weekday]bool
+	// minutes since midnight
+	start, end int
+	desc       string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use 24-hour time like \"09:00\"", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (a *AllowedHours) parse() (*hoursWindow, error) {
+	if a == nil {
+		return nil, nil
+	}
+	hw := &hoursWindow{loc: time.UTC}
+	if a.Timezone != "" {
+		loc, err := time.LoadLocation(a.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", a.Timezone)
+		}
+		hw.loc = loc
+	}
+	var err error
+	if hw.start, err = parseClock(a.Start); err != nil {
+		return nil, err
+	}
+	if hw.end, err = parseClock(a.End); err != nil {
+		return nil, err
+	}
+	if hw.start == hw.end {
+		return nil, fmt.Errorf("start and end are both %s", a.Start)
+	}
+	if len(a.Days) > 0 {
+		hw.days = make(map[time.Weekday]bool, len(a.Days))
+		for _, day := range a.Days {
+			wd, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("unknown day of the week %q", day)
+			}
+			hw.days[wd] = true
+		}
+	}
+	desc := "between " + a.Start + " and " + a.End + " " + hw.loc.String()
+	if hw.days != nil {
+		names := make([]string, 0, len(hw.days))
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			if hw.days[wd] {
+				names = append(names, wd.String()[:3])
+			}
+		}
+		desc = strings.Join(names, ", ") + " " + desc
+	}
+	hw.desc = desc
+	return hw, nil
+}
+
+func (hw *hoursWindow) onDay(wd time.Weekday) bool {
+	return hw.days == nil || hw.days[wd]
+}
+
+// contains reports whether t falls inside the window.
+func (hw *hoursWindow) contains(t time.Time) bool {
+	t = t.In(hw.loc)
+	min := t.Hour()*60 + t.Minute()
+	if hw.start < hw.end {
+		return min >= hw.start && min < hw.end && hw.onDay(t.Weekday())
+	}
+	// The window wraps past midnight; the morning part belongs to the window
+	// that started the day before.
+	if min >= hw.start {
+		return hw.onDay(t.Weekday())
+	}
+	if min < hw.end {
+		return hw.onDay((t.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+func parseSubnets(subnets []string) ([]*net.IPNet, error) {
+	if len(subnets) == 0 {
+		return nil, nil
+	}
+	nets := make([]*net.IPNet, len(subnets))
+	for i, s := range subnets {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets[i] = n
+	}
+	return nets, nil
+}
+
+func validateAccess(g *Group) error {
+	if _, err := parseSubnets(g.IPSubnets); err != nil {
+		return fmt.Errorf("Group %s has an invalid IP subnet: %v", g.Name, err)
+	}
+	if _, err := g.AllowedHours.parse(); err != nil {
+		return fmt.Errorf("Group %s has invalid allowed_hours: %v", g.Name, err)
+	}
+	return nil
+}
+
+// IPSubnets returns the subnets the user can sign in from. If empty, the
+// user can sign in from anywhere.
+func (u *User) IPSubnets() []*net.IPNet {
+	return u.ipSubnets
+}
+
+// AllowedHours describes when the user can use the site, for example "Mon,
+// Tue between 09:00 and 17:00 UTC", or returns the empty string if the user
+// can use it at any time.
+func (u *User) AllowedHours() string {
+	if u.hours == nil {
+		return ""
+	}
+	return u.hours.desc
+}
+
+// CheckAccess returns an error describing why the user can't use the site
+// from the given IP address at the given time, or nil if they can. ip may be
+// nil if the user's IP address is unknown.
+func (u *User) CheckAccess(ip net.IP, now time.Time) error {
+	if len(u.ipSubnets) > 0 {
+		if ip == nil {
+			return fmt.Errorf("Members of the %s group can only sign in from approved networks, and we couldn't determine your IP address", u.group)
+		}
+		found := false
+		for _, n := range u.ipSubnets {
+			if n.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Members of the %s group can only sign in from approved networks. Your IP address (%s) is not on an approved network", u.group, ip)
+		}
+	}
+	if u.hours != nil && !u.hours.contains(now) {
+		return fmt.Errorf("Members of the %s group can only use this site %s", u.group, u.hours.desc)
+	}
+	return nil
+}
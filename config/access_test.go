@@ -0,0 +1,115 @@
+package config
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAllowedHours(t *testing.T) {
+	t.Parallel()
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+	hw, err := (&AllowedHours{
+		Timezone: "America/New_York",
+		Days:     []string{"mon", "Tuesday", "wed", "thu", "fri"},
+		Start:    "09:00",
+		End:      "17:30",
+	}).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2017, 3, 6, 9, 0, 0, 0, ny), true},   // Monday
+		{time.Date(2017, 3, 6, 17, 29, 0, 0, ny), true}, // Monday
+		{time.Date(2017, 3, 6, 17, 30, 0, 0, ny), false},
+		{time.Date(2017, 3, 6, 8, 59, 0, 0, ny), false},
+		{time.Date(2017, 3, 4, 12, 0, 0, 0, ny), false}, // Saturday
+		// 14:00 UTC is 09:00 in New York
+		{time.Date(2017, 3, 6, 14, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		if got := hw.contains(tt.t); got != tt.want {
+			t.Errorf("contains(%v): got %t, want %t", tt.t, got, tt.want)
+		}
+	}
+	if hw.desc != "Mon, Tue, Wed, Thu, Fri between 09:00 and 17:30 America/New_York" {
+		t.Errorf("bad description: %q", hw.desc)
+	}
+}
+
+func TestAllowedHoursOvernight(t *testing.T) {
+	t.Parallel()
+	hw, err := (&AllowedHours{Days: []string{"fri"}, Start: "22:00", End: "06:00"}).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hw.contains(time.Date(2017, 3, 10, 23, 0, 0, 0, time.UTC)) { // Friday
+		t.Error("expected Friday night to be allowed")
+	}
+	if !hw.contains(time.Date(2017, 3, 11, 5, 0, 0, 0, time.UTC)) { // Saturday
+		t.Error("expected Saturday morning to be allowed")
+	}
+	if hw.contains(time.Date(2017, 3, 10, 5, 0, 0, 0, time.UTC)) { // Friday
+		t.Error("expected Friday morning to be denied")
+	}
+}
+
+func TestInvalidGroupAccessRejected(t *testing.T) {
+	t.Parallel()
+	groups := []*Group{
+		{Name: "contractors", IPSubnets: []string{"10.8.0.0"}},
+		{Name: "contractors", AllowedHours: &AllowedHours{Start: "9am", End: "17:00"}},
+		{Name: "contractors", AllowedHours: &AllowedHours{Timezone: "Mars/Olympus", Start: "09:00", End: "17:00"}},
+		{Name: "contractors", AllowedHours: &AllowedHours{Days: []string{"funday"}, Start: "09:00", End: "17:00"}},
+	}
+	for _, g := range groups {
+		if err := validatePolicy(&Policy{g}); err == nil {
+			t.Errorf("expected error for group %#v, got nil", g)
+		}
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	t.Parallel()
+	p := &Policy{&Group{
+		Name:         "contractors",
+		Users:        []string{"test@example.com"},
+		IPSubnets:    []string{"10.8.0.0/16"},
+		AllowedHours: &AllowedHours{Start: "09:00", End: "17:00"},
+	}}
+	if err := validatePolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Group() != "contractors" {
+		t.Errorf("expected group to be contractors, got %q", u.Group())
+	}
+	noon := time.Date(2017, 3, 6, 12, 0, 0, 0, time.UTC)
+	if err := u.CheckAccess(net.ParseIP("10.8.1.2"), noon); err != nil {
+		t.Errorf("expected access, got %v", err)
+	}
+	err = u.CheckAccess(net.ParseIP("192.0.2.1"), noon)
+	if err == nil || !strings.Contains(err.Error(), "approved networks") {
+		t.Errorf("expected network error, got %v", err)
+	}
+	if err := u.CheckAccess(nil, noon); err == nil {
+		t.Error("expected unknown IP address to be denied")
+	}
+	err = u.CheckAccess(net.ParseIP("10.8.1.2"), noon.Add(8*time.Hour))
+	if err == nil || !strings.Contains(err.Error(), "between 09:00 and 17:00 UTC") {
+		t.Errorf("expected hours error, got %v", err)
+	}
+	if err := DefaultUser.CheckAccess(nil, noon); err != nil {
+		t.Errorf("expected DefaultUser to have no restrictions, got %v", err)
+	}
+}
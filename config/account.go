@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// AccountConfig describes an additional Twilio account to show in the UI,
+// usually a subaccount of the main account.
+type AccountConfig struct {
+	Sid string `yaml:"account_sid"`
+	// If AuthToken is empty, the account must be a subaccount of the main
+	// account; we look up its credentials with the main account's credentials
+	// when the server starts.
+	AuthToken string `yaml:"auth_token,omitempty"`
+	// Shown in the account switcher. Defaults to the FriendlyName of the
+	// account in Twilio, or the Sid.
+	FriendlyName string `yaml:"friendly_name,omitempty"`
+}
+
+// An Account is a Twilio account whose resources can be viewed in the UI.
+type Account struct {
+	Sid          string
+	FriendlyName string
+	Client       *twilio.Client
+}
+
+var accountSidRx = regexp.MustCompile("^AC[a-f0-9]{32}$")
+
+// How long to wait for Twilio when looking up subaccount credentials.
+var accountLookupTimeout = 10 * time.Second
+
+// newAccount creates an Account from the given configuration. If ac has no
+// AuthToken, the account's credentials are retrieved from Twilio using the
+// parent client. The account's client is created with network.
+func newAccount(ac AccountConfig, parent *twilio.Client, network *TwilioNetwork) (*Account, error) {
+	if !accountSidRx.MatchString(ac.Sid) {
+		return nil, fmt.Errorf("Invalid account sid %q in twilio_accounts", ac.Sid)
+	}
+	name := ac.FriendlyName
+	token := ac.AuthToken
+	if token == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), accountLookupTimeout)
+		defer cancel()
+		acct, err := parent.Accounts.Get(ctx, ac.Sid)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't retrieve credentials for account %s: %v", ac.Sid, err)
+		}
+		token = acct.AuthToken
+		if name == "" {
+			name = acct.FriendlyName
+		}
+	}
+	if name == "" {
+		name = ac.Sid
+	}
+	return &Account{
+		Sid:          ac.Sid,
+		FriendlyName: name,
+		Client:       network.NewClient(ac.Sid, token),
+	}, nil
+}
+
+var accountKey ctxVar = 1
+
+// WithAccount returns a copy of ctx that requests resources from the given
+// Account.
+func WithAccount(ctx context.Context, a *Account) context.Context {
+	return context.WithValue(ctx, accountKey, a)
+}
+
+// GetAccount returns the Account stored in ctx, if one exists.
+func GetAccount(ctx context.Context) (*Account, bool) {
+	a, ok := ctx.Value(accountKey).(*Account)
+	return a, ok && a != nil
+}
@@ -2,12 +2,11 @@ package config
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/subtle"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -58,6 +57,25 @@ type BasicAuthAuthenticator struct {
 	Passwords map[string]string
 	Policy    *Policy
 	mu        sync.Mutex
+	// bcrypt hashes loaded from a password file. Checked for users that
+	// aren't in Passwords.
+	hashes map[string][]byte
+	// The last password that matched each user's hash; see checkHash.
+	verified map[string][sha256.Size]byte
+
+	// If set, users log in with a form instead of Basic Auth, and can set up
+	// two-factor authentication. Call EnableLoginForm to set it.
+	MFA *MFAStore
+	log.Logger
+	AllowUnencryptedTraffic bool
+	// If non-nil, logins with the form are stored on the server.
+	Sessions SessionStore
+	// How long a login lasts; DefaultSessionMaxAge if zero.
+	SessionMaxAge time.Duration
+	// Logins that aren't used for this long expire. Only enforced if
+	// Sessions is set.
+	SessionIdleTimeout time.Duration
+	secretKey          *[32]byte
 }
 
 func NewBasicAuthAuthenticator(realm string) *BasicAuthAuthenticator {
@@ -95,6 +113,9 @@ func (b *BasicAuthAuthenticator) AddUserPassword(key string, password string) {
 // are used. If no policy is present, config.DefaultUser is returned for
 // authenticated users.
 func (b *BasicAuthAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
+	if b.MFA != nil {
+		return b.authenticateForm(w, r)
+	}
 	// Implementation mostly taken from handlers/lib.go:BasicAuth. Would be
 	// nice to figure out how a way to reuse that code instead of copying it.
 	user, pass, ok := r.BasicAuth()
@@ -102,8 +123,12 @@ func (b *BasicAuthAuthenticator) Authenticate(w http.ResponseWriter, r *http.Req
 		rest.Unauthorized(w, r, b.Realm)
 		return nil, &rest.Error{Title: "No Basic Auth"}
 	}
-	serverPass, ok := b.Passwords[user]
-	if !ok {
+	b.mu.Lock()
+	serverPass, isPlain := b.Passwords[user]
+	hash, isHashed := b.hashes[user]
+	policy := b.Policy
+	b.mu.Unlock()
+	if !isPlain && !isHashed {
 		var err *rest.Error
 		if user == "" {
 			rest.Unauthorized(w, r, b.Realm)
@@ -117,7 +142,13 @@ func (b *BasicAuthAuthenticator) Authenticate(w http.ResponseWriter, r *http.Req
 		}
 		return nil, err
 	}
-	if subtle.ConstantTimeCompare([]byte(pass), []byte(serverPass)) != 1 {
+	var valid bool
+	if isPlain {
+		valid = subtle.ConstantTimeCompare([]byte(pass), []byte(serverPass)) == 1
+	} else {
+		valid = b.checkHash(user, hash, pass)
+	}
+	if !valid {
 		err := &rest.Error{
 			Title:    fmt.Sprintf("Incorrect password for user %s", user),
 			ID:       "incorrect_password",
@@ -126,12 +157,10 @@ func (b *BasicAuthAuthenticator) Authenticate(w http.ResponseWriter, r *http.Req
 		rest.Forbidden(w, r, err)
 		return nil, err
 	}
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	if b.Policy == nil {
+	if policy == nil {
 		return DefaultUser, nil
 	} else {
-		u, _, err := b.Policy.Lookup(user)
+		u, _, err := policy.Lookup(user)
 		if err != nil {
 			rest.Unauthorized(w, r, b.Realm)
 			return nil, &rest.Error{Title: "User not found"}
@@ -141,6 +170,11 @@ func (b *BasicAuthAuthenticator) Authenticate(w http.ResponseWriter, r *http.Req
 }
 
 func (b *BasicAuthAuthenticator) Logout(w http.ResponseWriter, r *http.Request) {
+	if b.MFA != nil {
+		b.cookies().logout(w, r)
+		http.Redirect(w, r, "/", 302)
+		return
+	}
 	// There's apparently no good way to do this.
 	// http://stackoverflow.com/a/449914/329700
 }
@@ -151,10 +185,18 @@ type GoogleAuthenticator struct {
 	Conf                    *oauth2.Config
 	RenderLogin             func(http.ResponseWriter, *http.Request, string)
 	RenderLogout            func(http.ResponseWriter, *http.Request)
-	allowedDomains          []string
-	secretKey               *[32]byte
-	policy                  *Policy
-	mu                      sync.Mutex
+	// If set, logins are recorded in Sessions and can be revoked before they
+	// expire. Otherwise a login cookie is valid until it expires.
+	Sessions SessionStore
+	// How long a login lasts. Defaults to DefaultSessionMaxAge.
+	SessionMaxAge time.Duration
+	// If nonzero, logins that aren't used for this long expire. Only
+	// enforced if Sessions is set.
+	SessionIdleTimeout time.Duration
+	allowedDomains     []string
+	secretKey          *[32]byte
+	policy             *Policy
+	mu                 sync.Mutex
 }
 
 // NewGoogleAuthenticator creates a new GoogleAuthenticator that can
@@ -182,53 +224,22 @@ func NewGoogleAuthenticator(logger log.Logger, clientID string, clientSecret str
 	}
 }
 
-type state struct {
-	CurrentURL string
-	Time       time.Time
-}
-
 type OAuthAuthenticator interface {
 	URL(http.ResponseWriter, *http.Request) string
 }
 
 func (g *GoogleAuthenticator) URL(w http.ResponseWriter, r *http.Request) string {
-	var uri string
-	if g := r.URL.Query().Get("g"); g != "" {
-		// prevent open redirect by only using the Path part
-		u, err := url.Parse(g)
-		if err == nil {
-			uri = u.Path
-		} else {
-			uri = r.URL.RequestURI()
-		}
-	} else {
-		uri = r.URL.RequestURI()
-	}
-	st := state{
-		CurrentURL: uri,
-		Time:       time.Now().UTC(),
-	}
-	bits, err := json.Marshal(st)
+	encoded, err := encodeState(newState(r), g.secretKey)
 	if err != nil {
 		rest.ServerError(w, r, err)
 		return ""
 	}
-	encoded := services.OpaqueByte(bits, g.secretKey)
 	return g.Conf.AuthCodeURL(encoded)
 }
 
-const AuthTimeout = 1 * time.Hour
-
 func (g *GoogleAuthenticator) validState(encrypted string) (string, bool) {
-	b, err := services.UnopaqueByte(encrypted, g.secretKey)
-	if err != nil {
-		return "", false
-	}
-	st := new(state)
-	if err := json.Unmarshal(b, st); err != nil {
-		return "", false
-	}
-	if time.Since(st.Time) > AuthTimeout {
+	st, ok := decodeState(encrypted, g.secretKey)
+	if !ok {
 		return "", false
 	}
 	return st.CurrentURL, true
@@ -236,32 +247,14 @@ func (g *GoogleAuthenticator) validState(encrypted string) (string, bool) {
 
 const GoogleTimeout = 5 * time.Second
 
-type token struct {
-	ID     string
-	Expiry time.Time
-}
-
-func newToken(id string) *token {
-	return &token{
-		ID:     id,
-		Expiry: time.Now().UTC().Add(14 * 24 * time.Hour),
-	}
-}
-
-func (g *GoogleAuthenticator) newCookie(id string) *http.Cookie {
-	t := newToken(id)
-	b, err := json.Marshal(t)
-	if err != nil {
-		panic(err)
-	}
-	text := services.OpaqueByte(b, g.secretKey)
-	return &http.Cookie{
-		Name:     "token",
-		Value:    text,
-		Path:     "/",
-		Secure:   g.AllowUnencryptedTraffic == false,
-		Expires:  t.Expiry,
-		HttpOnly: true,
+func (g *GoogleAuthenticator) cookies() *loginCookies {
+	return &loginCookies{
+		Logger:      g.Logger,
+		secretKey:   g.secretKey,
+		secure:      g.AllowUnencryptedTraffic == false,
+		sessions:    g.Sessions,
+		maxAge:      g.SessionMaxAge,
+		idleTimeout: g.SessionIdleTimeout,
 	}
 }
 
@@ -309,7 +302,11 @@ func (g *GoogleAuthenticator) handleGoogleCallback(w http.ResponseWriter, r *htt
 		rest.Forbidden(w, r, restErr)
 		return lookupErr
 	}
-	cookie := g.newCookie(u.Email)
+	cookie, err := g.cookies().newCookie(r, &token{ID: u.Email})
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return err
+	}
 	http.SetCookie(w, cookie)
 	http.Redirect(w, r, currentURL, 302)
 	return errors.New("redirected, make another request")
@@ -331,36 +328,15 @@ func (g *GoogleAuthenticator) permitted(id string) error {
 	return nil
 }
 
-var MustLogin = errors.New("Need to login")
-
 func (g *GoogleAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
 	if r.URL.Path == "/auth/callback" {
 		err := g.handleGoogleCallback(w, r)
 		return nil, err
 	}
 	// Check if the request has a valid cookie, if so allow it.
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		return nil, MustLogin
-	}
-	val, err := services.UnopaqueByte(cookie.Value, g.secretKey)
+	t, err := g.cookies().authenticate(w, r)
 	if err != nil {
-		// need a 400 bad request here
-		return nil, MustLogin
-	}
-	t := new(token)
-	if err := json.Unmarshal(val, t); err != nil {
-		return nil, MustLogin
-	}
-	if t.Expiry.Before(time.Now().UTC()) {
-		// TODO logout
-		return nil, MustLogin
-	}
-	// if you got to this point you have a valid login cookie, don't show you
-	// the login page.
-	if r.URL.Path == "/login" {
-		http.Redirect(w, r, "/", 302)
-		return nil, errors.New("redirected logged in user to homepage")
+		return nil, err
 	}
 	u, err := g.lookupUser(t.ID)
 	if err != nil {
@@ -411,13 +387,9 @@ func (g *GoogleAuthenticator) SetPolicy(p *Policy) {
 	g.mu.Unlock()
 }
 
+// Logout clears the login cookie and, if sessions are stored, ends the
+// session so the cookie can't be used again.
 func (g *GoogleAuthenticator) Logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Secure:   g.AllowUnencryptedTraffic == false,
-		HttpOnly: true,
-		MaxAge:   -1,
-		Path:     "/",
-	})
+	g.cookies().logout(w, r)
 	http.Redirect(w, r, "/", 302)
 }
@@ -21,9 +21,12 @@ func TestLoggedInAuthenticates(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 	a := NewGoogleAuthenticator(NullLogger, "", "", "http://localhost", nil, key)
-	cookie := a.newCookie("user@example.com")
+	cookie, err := a.cookies().newCookie(req, &token{ID: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
 	req.AddCookie(cookie)
-	_, err := a.Authenticate(w, req)
+	_, err = a.Authenticate(w, req)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -37,7 +40,10 @@ func TestUnknownUserWithValidDomainAllowed(t *testing.T) {
 	w := httptest.NewRecorder()
 	a := NewGoogleAuthenticator(NullLogger, "", "", "http://localhost", []string{"example.com"}, key)
 	a.SetPolicy(&Policy{})
-	cookie := a.newCookie("user@example.com")
+	cookie, err := a.cookies().newCookie(req, &token{ID: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
 	req.AddCookie(cookie)
 	u, err := a.Authenticate(w, req)
 	if err != nil {
@@ -82,7 +88,10 @@ func TestGoogleAuth(t *testing.T) {
 		w := httptest.NewRecorder()
 		a := NewGoogleAuthenticator(NullLogger, "", "", "http://localhost", tt.domains, key)
 		a.SetPolicy(tt.policy)
-		cookie := a.newCookie(tt.id)
+		cookie, err := a.cookies().newCookie(req, &token{ID: tt.id})
+		if err != nil {
+			t.Fatal(err)
+		}
 		req.AddCookie(cookie)
 		user, err := a.Authenticate(w, req)
 		if tt.err == "" && err != nil {
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBreakGlassDuration is the longest a break-glass elevation lasts if
+// the group doesn't set max_duration.
+const DefaultBreakGlassDuration = time.Hour
+
+// Users have to explain why they need elevated access in at least this many
+// characters.
+const minJustificationLength = 10
+
+// BreakGlass lets a group's users temporarily give themselves permissions
+// their group doesn't have, for example to read one conversation during an
+// incident. Every elevation is logged and reported.
+type BreakGlass struct {
+	// The permissions users can elevate, for example
+	// "can_view_message_body".
+	Permissions []string `yaml:"permissions"`
+	// The longest an elevation can last. Defaults to
+	// DefaultBreakGlassDuration.
+	MaxDuration time.Duration `yaml:"max_duration,omitempty"`
+}
+
+// elevatablePermissions are the permissions that can be granted by breaking
+// the glass. Granting a phone number permission also removes any mask on the
+// number, and granting can_view_message_body turns off redaction.
+var elevatablePermissions = map[string]func(u *User){
+	"can_view_num_media":        func(u *User) { u.canViewNumMedia = true },
+	"can_view_messages":         func(u *User) { u.canViewMessages = true },
+	"can_view_message_from":     func(u *User) { u.canViewMessageFrom = true; u.messageFromMask = Mask{} },
+	"can_view_message_to":       func(u *User) { u.canViewMessageTo = true; u.messageToMask = Mask{} },
+	"can_view_message_body":     func(u *User) { u.canViewMessageBody = true; u.redactMessageBodies = false },
+	"can_view_message_price":    func(u *User) { u.canViewMessagePrice = true },
+	"can_view_media":            func(u *User) { u.canViewMedia = true },
+	"can_view_calls":            func(u *User) { u.canViewCalls = true },
+	"can_view_call_from":        func(u *User) { u.canViewCallFrom = true; u.callFromMask = Mask{} },
+	"can_view_call_to":          func(u *User) { u.canViewCallTo = true; u.callToMask = Mask{} },
+	"can_view_call_price":       func(u *User) { u.canViewCallPrice = true },
+	"can_view_num_recordings":   func(u *User) { u.canViewNumRecordings = true },
+	"can_play_recordings":       func(u *User) { u.canPlayRecordings = true },
+	"can_view_recording_price":  func(u *User) { u.canViewRecordingPrice = true },
+	"can_view_conferences":      func(u *User) { u.canViewConferences = true },
+	"can_view_alerts":           func(u *User) { u.canViewAlerts = true },
+	"can_view_callback_urls":    func(u *User) { u.canViewCallbackURLs = true },
+	"can_view_rooms":            func(u *User) { u.canViewRooms = true },
+	"can_play_video_recordings": func(u *User) { u.canPlayVideoRecordings = true },
+}
+
+func validateBreakGlass(g *Group) error {
+	bg := g.BreakGlass
+	if bg == nil {
+		return nil
+	}
+	if len(bg.Permissions) == 0 {
+		return fmt.Errorf("Group %s has break_glass set, but no permissions to elevate", g.Name)
+	}
+	for _, p := range bg.Permissions {
+		if _, ok := elevatablePermissions[p]; !ok {
+			return fmt.Errorf("Group %s has an unknown break_glass permission: %s", g.Name, p)
+		}
+	}
+	if bg.MaxDuration < 0 {
+		return fmt.Errorf("Group %s has a negative break_glass max_duration", g.Name)
+	}
+	return nil
+}
+
+func (bg *BreakGlass) maxDuration() time.Duration {
+	if bg.MaxDuration == 0 {
+		return DefaultBreakGlassDuration
+	}
+	return bg.MaxDuration
+}
+
+// An Elevation is a user's temporary grant of extra permissions.
+type Elevation struct {
+	UserID        string
+	Group         string
+	Permissions   []string
+	Justification string
+	Start         time.Time
+	Expires       time.Time
+}
+
+// Active returns true if the elevation hasn't expired.
+func (e *Elevation) Active(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+func (e *Elevation) String() string {
+	return fmt.Sprintf("%s (group %s) elevated %s until %s: %q", e.UserID, e.Group,
+		strings.Join(e.Permissions, ", "), e.Expires.Format(time.RFC3339), e.Justification)
+}
+
+// ElevationStore keeps the active break-glass elevations in memory. When
+// the server restarts, every elevation ends.
+type ElevationStore struct {
+	mu         sync.Mutex
+	elevations map[string]*Elevation
+	now        func() time.Time
+}
+
+func NewElevationStore() *ElevationStore {
+	return &ElevationStore{
+		elevations: make(map[string]*Elevation),
+		now:        time.Now,
+	}
+}
+
+// Get returns the user's active elevation, if they have one.
+func (s *ElevationStore) Get(userID string) (*Elevation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.elevations[userID]
+	if !ok {
+		return nil, false
+	}
+	if !e.Active(s.now()) {
+		delete(s.elevations, userID)
+		return nil, false
+	}
+	return e, true
+}
+
+// Elevate grants u the given permissions for d, if u's group allows it. The
+// caller should log and report the returned Elevation.
+func (s *ElevationStore) Elevate(u *User, permissions []string, d time.Duration, justification string) (*Elevation, error) {
+	bg := u.BreakGlass()
+	if bg == nil || u.ID() == "" {
+		return nil, errors.New("Your group can't request elevated access")
+	}
+	justification = strings.TrimSpace(justification)
+	if len(justification) < minJustificationLength {
+		return nil, fmt.Errorf("Please explain why you need elevated access (at least %d characters)", minJustificationLength)
+	}
+	if d <= 0 || d > bg.maxDuration() {
+		return nil, fmt.Errorf("Elevated access can last between 1 minute and %s", bg.maxDuration())
+	}
+	if len(permissions) == 0 {
+		return nil, errors.New("Please choose at least one permission")
+	}
+	allowed := make(map[string]bool, len(bg.Permissions))
+	for _, p := range bg.Permissions {
+		allowed[p] = true
+	}
+	perms := make([]string, 0, len(permissions))
+	seen := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		if !allowed[p] {
+			return nil, fmt.Errorf("Your group can't elevate %s", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	sort.Strings(perms)
+	now := s.now().UTC()
+	e := &Elevation{
+		UserID:        u.ID(),
+		Group:         u.Group(),
+		Permissions:   perms,
+		Justification: justification,
+		Start:         now,
+		Expires:       now.Add(d),
+	}
+	s.mu.Lock()
+	s.elevations[u.ID()] = e
+	s.mu.Unlock()
+	return e, nil
+}
+
+// End ends the user's elevation early, and returns it.
+func (s *ElevationStore) End(userID string) (*Elevation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.elevations[userID]
+	delete(s.elevations, userID)
+	return e, ok
+}
+
+// BreakGlass returns the break-glass settings for the user's group, or nil
+// if the group can't request elevated access.
+func (u *User) BreakGlass() *BreakGlass {
+	return u.breakGlass
+}
+
+// Allows returns true if bg still lets users elevate every permission in e.
+// An elevation outlives a policy reload, so this is checked before it's
+// applied.
+func (bg *BreakGlass) Allows(e *Elevation) bool {
+	if bg == nil {
+		return false
+	}
+	for _, p := range e.Permissions {
+		allowed := false
+		for _, q := range bg.Permissions {
+			if p == q {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Elevation returns the elevation that's applied to the user, or nil.
+func (u *User) Elevation() *Elevation {
+	return u.elevation
+}
+
+// WithElevation returns a copy of u with the permissions in e. u is not
+// modified.
+func (u *User) WithElevation(e *Elevation) *User {
+	elevated := *u
+	for _, p := range e.Permissions {
+		if grant, ok := elevatablePermissions[p]; ok {
+			grant(&elevated)
+		}
+	}
+	elevated.elevation = e
+	return &elevated
+}
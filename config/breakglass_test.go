@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBreakGlassUser(t *testing.T) *User {
+	t.Helper()
+	policy := &Policy{&Group{
+		Name:  "support",
+		Users: []string{"alice"},
+		BreakGlass: &BreakGlass{
+			Permissions: []string{"can_view_message_body", "can_view_call_from"},
+			MaxDuration: 30 * time.Minute,
+		},
+		Permissions: &UserSettings{CanViewMessages: true, RedactMessageBodies: true},
+	}}
+	if err := validatePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	u, ok, err := policy.Lookup("alice")
+	if err != nil || !ok {
+		t.Fatalf("couldn't find alice: %v", err)
+	}
+	return u
+}
+
+func TestElevateValidates(t *testing.T) {
+	t.Parallel()
+	u := newBreakGlassUser(t)
+	s := NewElevationStore()
+	reason := "Incident 42: customer can't receive messages"
+	tests := []struct {
+		name          string
+		user          *User
+		permissions   []string
+		d             time.Duration
+		justification string
+	}{
+		{"ineligible", NewUser(AllUserSettings()), []string{"can_view_message_body"}, time.Minute, reason},
+		{"short justification", u, []string{"can_view_message_body"}, time.Minute, "  because "},
+		{"too long", u, []string{"can_view_message_body"}, time.Hour, reason},
+		{"no permissions", u, nil, time.Minute, reason},
+		{"not allowed", u, []string{"can_play_recordings"}, time.Minute, reason},
+	}
+	for _, tt := range tests {
+		if _, err := s.Elevate(tt.user, tt.permissions, tt.d, tt.justification); err == nil {
+			t.Errorf("%s: expected an error, got nil", tt.name)
+		}
+	}
+	if _, ok := s.Get("alice"); ok {
+		t.Error("expected no elevation after failed attempts")
+	}
+}
+
+func TestWithElevation(t *testing.T) {
+	t.Parallel()
+	u := newBreakGlassUser(t)
+	s := NewElevationStore()
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	e, err := s.Elevate(u, []string{"can_view_message_body", "can_view_message_body"}, 10*time.Minute, "Incident 42: checking what was sent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Permissions) != 1 || e.UserID != "alice" || e.Group != "support" {
+		t.Errorf("unexpected elevation: %s", e)
+	}
+	elevated := u.WithElevation(e)
+	if !elevated.CanViewMessageBody() || elevated.RedactMessageBodies() {
+		t.Error("expected the elevated user to see unredacted message bodies")
+	}
+	if elevated.CanViewCallFrom() {
+		t.Error("expected only the requested permissions to be granted")
+	}
+	if u.CanViewMessageBody() || u.Elevation() != nil {
+		t.Error("WithElevation modified the original user")
+	}
+	if _, ok := s.Get("alice"); !ok {
+		t.Fatal("expected an active elevation")
+	}
+	now = now.Add(10 * time.Minute)
+	if _, ok := s.Get("alice"); ok {
+		t.Error("expected the elevation to expire")
+	}
+}
+
+func TestValidateBreakGlass(t *testing.T) {
+	t.Parallel()
+	policy := &Policy{&Group{
+		Name:        "support",
+		BreakGlass:  &BreakGlass{Permissions: []string{"can_manage_sessions"}},
+		Permissions: &UserSettings{},
+	}}
+	err := validatePolicy(policy)
+	if err == nil || !strings.Contains(err.Error(), "can_manage_sessions") {
+		t.Errorf("expected an unknown permission error, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/services"
+)
+
+var MustLogin = errors.New("Need to login")
+
+// How long a user has to finish logging in with an identity provider.
+const AuthTimeout = 1 * time.Hour
+
+// state records where a user was before we sent them to an identity provider
+// to log in. It's encrypted and sent along with the login request.
+type state struct {
+	CurrentURL string
+	Time       time.Time
+	// The ID of the SAML AuthnRequest, if any.
+	RequestID string `json:",omitempty"`
+	// The user who entered their password on the login form, and still has
+	// to enter a two-factor code.
+	User string `json:",omitempty"`
+}
+
+// newState returns a state that sends the user back to the page they were
+// trying to view - or the page in the "g" query parameter, on the login
+// page.
+func newState(r *http.Request) *state {
+	var uri string
+	if g := r.URL.Query().Get("g"); g != "" {
+		// prevent open redirect by only using the Path part
+		u, err := url.Parse(g)
+		if err == nil {
+			uri = u.Path
+		} else {
+			uri = r.URL.RequestURI()
+		}
+	} else {
+		uri = r.URL.RequestURI()
+	}
+	return &state{
+		CurrentURL: uri,
+		Time:       time.Now().UTC(),
+	}
+}
+
+func encodeState(st *state, secretKey *[32]byte) (string, error) {
+	bits, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+	return services.OpaqueByte(bits, secretKey), nil
+}
+
+// decodeState decrypts a state, and reports whether it's valid and recent.
+func decodeState(encrypted string, secretKey *[32]byte) (*state, bool) {
+	b, err := services.UnopaqueByte(encrypted, secretKey)
+	if err != nil {
+		return nil, false
+	}
+	st := new(state)
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, false
+	}
+	if time.Since(st.Time) > AuthTimeout {
+		return nil, false
+	}
+	return st, true
+}
+
+// token is the contents of the encrypted login cookie.
+type token struct {
+	ID     string
+	Expiry time.Time
+	// Groups the identity provider says the user belongs to, if any.
+	Groups []string `json:",omitempty"`
+	// The ID of the server-side session, if sessions are stored.
+	Session string `json:",omitempty"`
+	// True if the user entered a two-factor code when they logged in.
+	MFA bool `json:",omitempty"`
+}
+
+// loginCookies issues and checks the encrypted "token" cookie that records a
+// login, and the server-side session behind it, if sessions are stored.
+type loginCookies struct {
+	log.Logger
+	secretKey   *[32]byte
+	secure      bool
+	sessions    SessionStore
+	maxAge      time.Duration
+	idleTimeout time.Duration
+}
+
+// newCookie returns a login cookie for t, which should have the user's ID
+// set. If sessions are stored, a new session is created as well.
+func (c *loginCookies) newCookie(r *http.Request, t *token) (*http.Cookie, error) {
+	maxAge := c.maxAge
+	if maxAge <= 0 {
+		maxAge = DefaultSessionMaxAge
+	}
+	now := time.Now().UTC()
+	t.Expiry = now.Add(maxAge)
+	if c.sessions != nil {
+		sess := &Session{
+			ID:          newSessionID(),
+			UserID:      t.ID,
+			UserAgent:   r.UserAgent(),
+			Created:     now,
+			LastSeen:    now,
+			Expires:     t.Expiry,
+			IdleTimeout: c.idleTimeout,
+		}
+		if err := c.sessions.Put(sess); err != nil {
+			return nil, err
+		}
+		t.Session = sess.ID
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	text := services.OpaqueByte(b, c.secretKey)
+	return &http.Cookie{
+		Name:     "token",
+		Value:    text,
+		Path:     "/",
+		Secure:   c.secure,
+		Expires:  t.Expiry,
+		HttpOnly: true,
+	}, nil
+}
+
+// readToken decrypts the login cookie in r.
+func (c *loginCookies) readToken(r *http.Request) (*token, error) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		return nil, err
+	}
+	val, err := services.UnopaqueByte(cookie.Value, c.secretKey)
+	if err != nil {
+		return nil, err
+	}
+	t := new(token)
+	if err := json.Unmarshal(val, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// checkSession returns MustLogin if the session in t has expired or been
+// revoked, and records that the session was used.
+func (c *loginCookies) checkSession(t *token) error {
+	if t.Session == "" {
+		// Issued before sessions were stored.
+		return MustLogin
+	}
+	sess, err := c.sessions.Get(t.Session)
+	if err != nil {
+		return MustLogin
+	}
+	if sess.UserID != t.ID {
+		c.Warn("Session belongs to a different user", "session_user", sess.UserID, "id", t.ID)
+		return MustLogin
+	}
+	now := time.Now().UTC()
+	if now.Sub(sess.LastSeen) >= sessionTouchInterval {
+		sess.LastSeen = now
+		if err := c.sessions.Put(sess); err != nil {
+			c.Warn("Couldn't update session", "id", t.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+// authenticate returns the token in the request's login cookie, or
+// MustLogin if there's no valid login. Logged in users who visit the login
+// page are redirected to the homepage.
+func (c *loginCookies) authenticate(w http.ResponseWriter, r *http.Request) (*token, error) {
+	t, err := c.readToken(r)
+	if err != nil {
+		return nil, MustLogin
+	}
+	if t.Expiry.Before(time.Now().UTC()) {
+		c.clear(w)
+		return nil, MustLogin
+	}
+	if c.sessions != nil {
+		if err := c.checkSession(t); err != nil {
+			c.clear(w)
+			return nil, err
+		}
+	}
+	// if you got to this point you have a valid login cookie, don't show you
+	// the login page.
+	if r.URL.Path == "/login" {
+		http.Redirect(w, r, "/", 302)
+		return nil, errors.New("redirected logged in user to homepage")
+	}
+	return t, nil
+}
+
+func (c *loginCookies) clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Secure:   c.secure,
+		HttpOnly: true,
+		MaxAge:   -1,
+		Path:     "/",
+	})
+}
+
+// logout clears the login cookie and, if sessions are stored, ends the
+// session so the cookie can't be used again.
+func (c *loginCookies) logout(w http.ResponseWriter, r *http.Request) {
+	if c.sessions != nil {
+		if t, err := c.readToken(r); err == nil && t.Session != "" {
+			if err := c.sessions.Delete(t.Session); err != nil {
+				c.Warn("Couldn't delete session", "id", t.ID, "err", err)
+			}
+		}
+	}
+	c.clear(w)
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// permissionParents are the permissions that are hidden whenever another
+// permission is off; you can't see a message's body if you can't see
+// messages.
+var permissionParents = map[string]string{
+	"can_view_num_media":        "can_view_messages",
+	"can_view_message_from":     "can_view_messages",
+	"can_view_message_to":       "can_view_messages",
+	"can_view_message_body":     "can_view_messages",
+	"can_view_message_price":    "can_view_messages",
+	"can_view_media":            "can_view_messages",
+	"can_view_call_from":        "can_view_calls",
+	"can_view_call_to":          "can_view_calls",
+	"can_view_call_price":       "can_view_calls",
+	"can_play_video_recordings": "can_view_rooms",
+}
+
+// permissionMasks are the phone number permissions that are also hidden by
+// a "hide" mask, and the name of the mask setting.
+var permissionMasks = map[string]struct {
+	name string
+	mask func(u *User) Mask
+}{
+	"can_view_message_from": {"message_from_mask", (*User).MessageFromMask},
+	"can_view_message_to":   {"message_to_mask", (*User).MessageToMask},
+	"can_view_call_from":    {"call_from_mask", (*User).CallFromMask},
+	"can_view_call_to":      {"call_to_mask", (*User).CallToMask},
+}
+
+// Settings returns the permissions the user actually has, including any
+// break-glass elevation. Permissions hidden by a parent permission or a
+// "hide" mask are reported as off.
+func (u *User) Settings() *UserSettings {
+	return &UserSettings{
+		CanViewNumMedia:        u.CanViewNumMedia(),
+		CanViewMessages:        u.CanViewMessages(),
+		CanViewMessageFrom:     u.CanViewMessageFrom(),
+		CanViewMessageTo:       u.CanViewMessageTo(),
+		CanViewMessageBody:     u.CanViewMessageBody(),
+		CanViewMessagePrice:    u.CanViewMessagePrice(),
+		CanViewMedia:           u.CanViewMedia(),
+		CanViewCalls:           u.CanViewCalls(),
+		CanViewCallFrom:        u.CanViewCallFrom(),
+		CanViewCallTo:          u.CanViewCallTo(),
+		CanViewCallPrice:       u.CanViewCallPrice(),
+		CanViewNumRecordings:   u.CanViewNumRecordings(),
+		CanPlayRecordings:      u.CanPlayRecordings(),
+		CanViewRecordingPrice:  u.CanViewRecordingPrice(),
+		CanViewConferences:     u.CanViewConferences(),
+		CanViewAlerts:          u.CanViewAlerts(),
+		CanViewCallbackURLs:    u.CanViewCallbackURLs(),
+		CanViewRooms:           u.CanViewRooms(),
+		CanPlayVideoRecordings: u.CanPlayVideoRecordings(),
+		CanManageSessions:      u.CanManageSessions(),
+		MessageFromMask:        u.messageFromMask,
+		MessageToMask:          u.messageToMask,
+		CallFromMask:           u.callFromMask,
+		CallToMask:             u.callToMask,
+		RedactMessageBodies:    u.redactMessageBodies,
+		MaxResourceAge:         u.maxResourceAge,
+		MinResourceAge:         u.minResourceAge,
+	}
+}
+
+// permissionChecks are the accessors for each permission. Permissions are
+// named after their UserSettings field in YAML, for example
+// "can_view_message_body".
+var permissionChecks = map[string]func(u *User) bool{
+	"can_view_num_media":        (*User).CanViewNumMedia,
+	"can_view_messages":         (*User).CanViewMessages,
+	"can_view_message_from":     (*User).CanViewMessageFrom,
+	"can_view_message_to":       (*User).CanViewMessageTo,
+	"can_view_message_body":     (*User).CanViewMessageBody,
+	"can_view_message_price":    (*User).CanViewMessagePrice,
+	"can_view_media":            (*User).CanViewMedia,
+	"can_view_calls":            (*User).CanViewCalls,
+	"can_view_call_from":        (*User).CanViewCallFrom,
+	"can_view_call_to":          (*User).CanViewCallTo,
+	"can_view_call_price":       (*User).CanViewCallPrice,
+	"can_view_num_recordings":   (*User).CanViewNumRecordings,
+	"can_play_recordings":       (*User).CanPlayRecordings,
+	"can_view_recording_price":  (*User).CanViewRecordingPrice,
+	"can_view_conferences":      (*User).CanViewConferences,
+	"can_view_alerts":           (*User).CanViewAlerts,
+	"can_view_callback_urls":    (*User).CanViewCallbackURLs,
+	"can_view_rooms":            (*User).CanViewRooms,
+	"can_play_video_recordings": (*User).CanPlayVideoRecordings,
+	"can_manage_sessions":       (*User).CanManageSessions,
+}
+
+// PermissionNames returns the names of every permission, sorted.
+func PermissionNames() []string {
+	names := make([]string, 0, len(permissionChecks))
+	for name := range permissionChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Permissions returns the user's permissions, keyed by name.
+func (u *User) Permissions() map[string]bool {
+	perms := make(map[string]bool, len(permissionChecks))
+	for name, check := range permissionChecks {
+		perms[name] = check(u)
+	}
+	return perms
+}
+
+// Can returns true if the user has the named permission. It panics if the
+// permission doesn't exist.
+func (u *User) Can(permission string) bool {
+	check, ok := permissionChecks[permission]
+	if !ok {
+		panic("unknown permission " + permission)
+	}
+	return check(u)
+}
+
+// WhyNot explains why the user doesn't have the named permission, or returns
+// the empty string if they do.
+func (u *User) WhyNot(permission string) string {
+	if u.Can(permission) {
+		return ""
+	}
+	if parent, ok := permissionParents[permission]; ok && !u.Can(parent) {
+		return fmt.Sprintf("%s is off, which also turns off %s", parent, permission)
+	}
+	if m, ok := permissionMasks[permission]; ok && m.mask(u).Mode == MaskHide {
+		return fmt.Sprintf("%s is set to hide", m.name)
+	}
+	return fmt.Sprintf("%s is off", permission)
+}
+
+// MaxResourceAge returns the oldest resource the user can view, given the
+// global max_resource_age. The user's own setting takes precedence. Zero
+// means there's no limit.
+func (u *User) MaxResourceAge(globalMaxAge time.Duration) time.Duration {
+	if u.maxResourceAge != 0 {
+		return u.maxResourceAge
+	}
+	return globalMaxAge
+}
+
+// WhyTooOld explains why the user can't view a resource created at
+// createdAt, or returns the empty string if they can.
+func (u *User) WhyTooOld(createdAt time.Time, globalMaxAge time.Duration) string {
+	if u.CanViewResource(createdAt, globalMaxAge) {
+		return ""
+	}
+	if u.maxResourceAge != 0 {
+		return fmt.Sprintf("It's older than your group's max_resource_age (%s)", u.maxResourceAge)
+	}
+	return fmt.Sprintf("It's older than the max_resource_age (%s)", globalMaxAge)
+}
+
+// WhyTooNew explains why the user can't view a resource created at
+// createdAt yet, or returns the empty string if they can.
+func (u *User) WhyTooNew(createdAt time.Time, globalMinAge time.Duration) string {
+	if !u.IsTooNew(createdAt, globalMinAge) {
+		return ""
+	}
+	if u.minResourceAge != 0 {
+		return fmt.Sprintf("It's newer than your group's min_resource_age (%s)", u.minResourceAge)
+	}
+	return fmt.Sprintf("It's newer than the min_resource_age (%s)", globalMinAge)
+}
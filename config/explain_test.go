@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhyNot(t *testing.T) {
+	t.Parallel()
+	us := AllUserSettings()
+	us.CanViewCalls = false
+	us.CanViewMessageBody = false
+	us.MessageToMask = Mask{Mode: MaskHide}
+	u := NewUser(us)
+	tests := []struct {
+		permission string
+		reason     string
+	}{
+		{"can_view_messages", ""},
+		{"can_view_message_body", "can_view_message_body is off"},
+		{"can_view_message_to", "message_to_mask is set to hide"},
+		{"can_view_call_from", "can_view_calls is off, which also turns off can_view_call_from"},
+		{"can_view_calls", "can_view_calls is off"},
+	}
+	for _, tt := range tests {
+		if reason := u.WhyNot(tt.permission); reason != tt.reason {
+			t.Errorf("WhyNot(%q): got %q, want %q", tt.permission, reason, tt.reason)
+		}
+	}
+	for name, can := range u.Permissions() {
+		if can != (u.WhyNot(name) == "") {
+			t.Errorf("%s: Can and WhyNot disagree", name)
+		}
+	}
+	if u.Settings().CanViewCallFrom {
+		t.Error("expected effective settings to turn off can_view_call_from")
+	}
+}
+
+func TestWhyTooOld(t *testing.T) {
+	t.Parallel()
+	u := NewUser(&UserSettings{MaxResourceAge: time.Hour})
+	if reason := u.WhyTooOld(time.Now().Add(-30*time.Minute), 24*time.Hour); reason != "" {
+		t.Errorf("expected a recent resource to be visible, got %q", reason)
+	}
+	if reason := u.WhyTooOld(time.Now().Add(-2*time.Hour), 24*time.Hour); reason != "It's older than your group's max_resource_age (1h0m0s)" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+	if got := NewUser(nil).MaxResourceAge(24 * time.Hour); got != 24*time.Hour {
+		t.Errorf("expected the global max age, got %v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/kevinburke/rest"
+)
+
+// DefaultAuthHeader is the header HeaderAuthenticator reads the user's
+// identity from, if no other header is configured. oauth2-proxy and several
+// other authenticating proxies set it.
+const DefaultAuthHeader = "X-Forwarded-Email"
+
+// HeaderAuthenticator trusts an authenticating reverse proxy (oauth2-proxy,
+// Pomerium, an identity-aware proxy, etc) to identify users. The proxy sends
+// the user's identity in a header, which is only accepted on requests made
+// directly by one of the trusted proxies.
+//
+// Users are looked up in the policy by their identity. If they aren't listed
+// in a group, but the proxy sends a groups header that names a policy group,
+// they get that group's permissions; otherwise the default group is used.
+// If no Policy has been set, DefaultUser is returned for all users.
+type HeaderAuthenticator struct {
+	// The header containing the user's identity.
+	Header string
+	// If set, the header containing a comma-separated list of the user's
+	// groups.
+	GroupsHeader string
+	// Where to redirect users after they log out. Defaults to "/".
+	LogoutURL string
+
+	trusted []*net.IPNet
+	policy  *Policy
+	mu      sync.Mutex
+}
+
+// NewHeaderAuthenticator creates a HeaderAuthenticator that reads the user's
+// identity from header (or DefaultAuthHeader, if header is empty) on
+// requests from the trusted subnets.
+func NewHeaderAuthenticator(header string, trusted []*net.IPNet) *HeaderAuthenticator {
+	if header == "" {
+		header = DefaultAuthHeader
+	}
+	return &HeaderAuthenticator{
+		Header:  header,
+		trusted: trusted,
+	}
+}
+
+func (h *HeaderAuthenticator) SetPolicy(p *Policy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = p
+}
+
+// fromTrustedProxy reports whether the request was made directly by one of
+// the trusted proxies.
+func (h *HeaderAuthenticator) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range h.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HeaderAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
+	if !h.fromTrustedProxy(r) {
+		err := &rest.Error{
+			Title: "Requests must come through the authenticating proxy",
+			ID:    "untrusted_proxy",
+		}
+		rest.Forbidden(w, r, err)
+		return nil, err
+	}
+	id := strings.TrimSpace(r.Header.Get(h.Header))
+	if id == "" {
+		err := &rest.Error{
+			Title: "The authenticating proxy didn't send a " + h.Header + " header",
+			ID:    "missing_identity",
+		}
+		rest.Forbidden(w, r, err)
+		return nil, err
+	}
+	h.mu.Lock()
+	policy := h.policy
+	h.mu.Unlock()
+	if policy == nil {
+		return DefaultUser, nil
+	}
+	var groups []string
+	if h.GroupsHeader != "" {
+		for _, g := range strings.Split(r.Header.Get(h.GroupsHeader), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+	u, err := policy.lookupWithGroups(id, groups)
+	if err != nil {
+		rerr := &rest.Error{Title: err.Error(), ID: "user_not_found"}
+		rest.Forbidden(w, r, rerr)
+		return nil, rerr
+	}
+	return u, nil
+}
+
+// Logout redirects to the LogoutURL, which should end the user's session
+// with the proxy.
+func (h *HeaderAuthenticator) Logout(w http.ResponseWriter, r *http.Request) {
+	dest := h.LogoutURL
+	if dest == "" {
+		dest = "/"
+	}
+	http.Redirect(w, r, dest, http.StatusFound)
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestHeaderAuthenticator(t *testing.T) *HeaderAuthenticator {
+	_, n, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHeaderAuthenticator("", []*net.IPNet{n})
+	h.GroupsHeader = "X-Forwarded-Groups"
+	h.SetPolicy(&Policy{
+		&Group{Name: "eng", Users: []string{"eng@example.com"}, Permissions: AllUserSettings()},
+		&Group{Name: "support", Permissions: AllUserSettings()},
+		&Group{Name: "everyone", Default: true, Permissions: AllUserSettings()},
+	})
+	return h
+}
+
+func TestHeaderAuthenticator(t *testing.T) {
+	t.Parallel()
+	h := newTestHeaderAuthenticator(t)
+	tests := []struct {
+		remoteAddr string
+		email      string
+		groups     string
+		wantGroup  string
+		wantCode   int
+	}{
+		{"10.1.2.3:5678", "eng@example.com", "support", "eng", 200},
+		{"10.1.2.3:5678", "new@example.com", "sales, support", "support", 200},
+		{"10.1.2.3:5678", "new@example.com", "", "everyone", 200},
+		{"10.1.2.3:5678", "", "", "", 403},
+		{"192.0.2.1:5678", "eng@example.com", "", "", 403},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.email != "" {
+			req.Header.Set("X-Forwarded-Email", tt.email)
+		}
+		if tt.groups != "" {
+			req.Header.Set("X-Forwarded-Groups", tt.groups)
+		}
+		w := httptest.NewRecorder()
+		u, err := h.Authenticate(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s from %s: expected code %d, got %d", tt.email, tt.remoteAddr, tt.wantCode, w.Code)
+		}
+		if tt.wantGroup == "" {
+			if err == nil {
+				t.Errorf("%s from %s: expected error, got nil", tt.email, tt.remoteAddr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s from %s: unexpected error %v", tt.email, tt.remoteAddr, err)
+			continue
+		}
+		if u.Group() != tt.wantGroup {
+			t.Errorf("%s from %s: expected group %s, got %s", tt.email, tt.remoteAddr, tt.wantGroup, u.Group())
+		}
+	}
+}
+
+func TestHeaderAuthRequiresTrustedProxies(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{
+		AccountSid: "AC123",
+		AuthToken:  "123",
+		AuthScheme: "header",
+	}
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Error("expected error configuring header auth without trusted proxies, got nil")
+	}
+	c.TrustedProxies = []string{"10.0.0.0/8"}
+	settings, err := NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := settings.Authenticator.(*HeaderAuthenticator); !ok {
+		t.Errorf("expected a HeaderAuthenticator, got %T", settings.Authenticator)
+	}
+}
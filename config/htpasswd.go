@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// How often to check the password file for changes.
+var passwordFileInterval = 5 * time.Second
+
+// ParsePasswordFile parses an htpasswd-style file, with one "user:hash" pair
+// per line, and returns a map of users to password hashes. Blank lines and
+// lines starting with "#" are ignored. Only bcrypt hashes are supported;
+// create them with "htpasswd -B" or the logrole_passwd command.
+func ParsePasswordFile(r io.Reader) (map[string][]byte, error) {
+	hashes := make(map[string][]byte)
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", lineno)
+		}
+		if !strings.HasPrefix(parts[1], "$2") {
+			return nil, fmt.Errorf("line %d: password for %s is not a bcrypt hash", lineno, parts[0])
+		}
+		if _, ok := hashes[parts[0]]; ok {
+			return nil, fmt.Errorf("line %d: user %s appears twice in the file", lineno, parts[0])
+		}
+		hashes[parts[0]] = []byte(parts[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// SetPasswordHashes replaces the bcrypt password hashes used to authenticate
+// users. Users in the Passwords map are checked first.
+func (b *BasicAuthAuthenticator) SetPasswordHashes(hashes map[string][]byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hashes = hashes
+	b.verified = make(map[string][sha256.Size]byte)
+}
+
+// LoadPasswordFile replaces the password hashes with the contents of the
+// htpasswd file at path.
+func (b *BasicAuthAuthenticator) LoadPasswordFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hashes, err := ParsePasswordFile(f)
+	if err != nil {
+		return fmt.Errorf("Couldn't parse password file %s: %v", path, err)
+	}
+	b.SetPasswordHashes(hashes)
+	return nil
+}
+
+// WatchPasswordFile reloads the password file at path whenever its
+// modification time changes. If the new file can't be parsed, the previous
+// passwords are kept. WatchPasswordFile runs until a value is sent on done, or done is closed.
+func (b *BasicAuthAuthenticator) WatchPasswordFile(l log.Logger, path string, interval time.Duration, done <-chan bool) {
+	var lastMod time.Time
+	if fi, err := os.Stat(path); err == nil {
+		lastMod = fi.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			l.Warn("Couldn't check password file", "path", path, "err", err)
+			continue
+		}
+		if fi.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = fi.ModTime()
+		if err := b.LoadPasswordFile(path); err != nil {
+			l.Error("Couldn't reload password file, keeping the old passwords", "path", path, "err", err)
+			continue
+		}
+		l.Info("Reloaded password file", "path", path)
+	}
+}
+
+func verifiedKey(hash []byte, password string) [sha256.Size]byte {
+	return sha256.Sum256(append(append(hash[:len(hash):len(hash)], 0), password...))
+}
+
+// checkHash reports whether password matches the user's bcrypt hash.
+// Browsers send the password with every request, and bcrypt is slow on
+// purpose, so we remember the last password that matched.
+func (b *BasicAuthAuthenticator) checkHash(user string, hash []byte, password string) bool {
+	key := verifiedKey(hash, password)
+	b.mu.Lock()
+	prev, ok := b.verified[user]
+	b.mu.Unlock()
+	if ok && subtle.ConstantTimeCompare(prev[:], key[:]) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	b.mu.Lock()
+	// Don't cache a hash that was replaced while we were checking it.
+	if current, ok := b.hashes[user]; ok && bytes.Equal(current, hash) {
+		if b.verified == nil {
+			b.verified = make(map[string][sha256.Size]byte)
+		}
+		b.verified[user] = key
+	}
+	b.mu.Unlock()
+	return true
+}
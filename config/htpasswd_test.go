@@ -0,0 +1,97 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParsePasswordFile(t *testing.T) {
+	t.Parallel()
+	hashes, err := ParsePasswordFile(strings.NewReader("# comment\n\nalice:$2y$05$abc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hashes["alice"]) != "$2y$05$abc" {
+		t.Errorf("bad hash for alice: %q", hashes["alice"])
+	}
+	for _, bad := range []string{"alice", "alice:{SHA}abc", "alice:$2y$05$abc\nalice:$2y$05$def"} {
+		if _, err := ParsePasswordFile(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error parsing %q, got nil", bad)
+		}
+	}
+}
+
+func hashPassword(t *testing.T, pass string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func basicAuthCode(b *BasicAuthAuthenticator, user, pass string) (*User, int) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth(user, pass)
+	u, _ := b.Authenticate(w, req)
+	return u, w.Code
+}
+
+func TestPasswordFileReloads(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-htpasswd-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "htpasswd")
+	if err := ioutil.WriteFile(path, []byte("alice:"+hashPassword(t, "secret")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBasicAuthAuthenticator("logrole")
+	b.SetPolicy(&Policy{&Group{Name: "support", Users: []string{"alice", "bob"}, Permissions: AllUserSettings()}})
+	if err := b.LoadPasswordFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if u, code := basicAuthCode(b, "alice", "secret"); u == nil {
+		t.Fatalf("expected alice to authenticate, got %d", code)
+	} else if u.Group() != "support" {
+		t.Errorf("expected alice to be mapped through the policy, got group %q", u.Group())
+	}
+	if _, code := basicAuthCode(b, "alice", "wrong"); code != 403 {
+		t.Errorf("expected wrong password to get 403, got %d", code)
+	}
+	done := make(chan bool, 1)
+	defer func() { done <- true }()
+	go b.WatchPasswordFile(NullLogger, path, 10*time.Millisecond, done)
+	// Make sure the modification time changes.
+	time.Sleep(20 * time.Millisecond)
+	contents := "bob:" + hashPassword(t, "hunter2") + "\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Second)
+	os.Chtimes(path, future, future)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		u, _ := basicAuthCode(b, "bob", "hunter2")
+		if u != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("password file was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if u, _ := basicAuthCode(b, "alice", "secret"); u != nil {
+		t.Error("expected alice to be removed after reload")
+	}
+}
+
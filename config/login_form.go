@@ -0,0 +1,304 @@
+package config
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+)
+
+// The login form posts passwords to LoginPath, and two-factor codes to
+// MFALoginPath. Users set up two-factor authentication at MFAPath.
+const LoginPath = "/login"
+const MFALoginPath = "/login/mfa"
+const MFAPath = "/mfa"
+
+// Steps of the login form.
+const (
+	LoginStepPassword = "password"
+	LoginStepCode     = "code"
+)
+
+// How long a user has to enter their two-factor code after entering their
+// password.
+const mfaLoginTimeout = 5 * time.Minute
+
+// The cookie that remembers a user who entered their password, until they
+// enter their code.
+const mfaLoginCookie = "mfa_login"
+
+// A LoginError is returned by Authenticate when the user needs to fill out
+// the login form. If their last attempt failed, Message says why.
+type LoginError struct {
+	// LoginStepPassword or LoginStepCode.
+	Step    string
+	Message string
+}
+
+func (e *LoginError) Error() string {
+	if e.Message == "" {
+		return MustLogin.Error()
+	}
+	return e.Message
+}
+
+var errWrongPassword = &LoginError{
+	Step:    LoginStepPassword,
+	Message: "Username or password are invalid. Please double check your credentials",
+}
+
+// EnableLoginForm makes b log users in with a form on the login page instead
+// of with Basic Auth, so users who have set up two-factor authentication can
+// be asked for a code. Enrollments are kept in mfa.
+func (b *BasicAuthAuthenticator) EnableLoginForm(l log.Logger, mfa *MFAStore, secretKey *[32]byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Logger = l
+	b.MFA = mfa
+	b.secretKey = secretKey
+}
+
+func (b *BasicAuthAuthenticator) cookies() *loginCookies {
+	return &loginCookies{
+		Logger:      b.Logger,
+		secretKey:   b.secretKey,
+		secure:      !b.AllowUnencryptedTraffic,
+		sessions:    b.Sessions,
+		maxAge:      b.SessionMaxAge,
+		idleTimeout: b.SessionIdleTimeout,
+	}
+}
+
+// validPassword reports whether pass is the password for user.
+func (b *BasicAuthAuthenticator) validPassword(user string, pass string) bool {
+	b.mu.Lock()
+	serverPass, isPlain := b.Passwords[user]
+	hash, isHashed := b.hashes[user]
+	b.mu.Unlock()
+	switch {
+	case isPlain:
+		return subtle.ConstantTimeCompare([]byte(pass), []byte(serverPass)) == 1
+	case isHashed:
+		return b.checkHash(user, hash, pass)
+	default:
+		return false
+	}
+}
+
+// hasPassword reports whether user can still log in; users who are removed
+// from the password file are logged out.
+func (b *BasicAuthAuthenticator) hasPassword(user string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, isPlain := b.Passwords[user]
+	_, isHashed := b.hashes[user]
+	return isPlain || isHashed
+}
+
+func (b *BasicAuthAuthenticator) lookupUser(id string) (*User, error) {
+	b.mu.Lock()
+	policy := b.Policy
+	b.mu.Unlock()
+	if policy == nil {
+		// The MFA page needs to know who the user is.
+		u := *DefaultUser
+		u.id = id
+		return &u, nil
+	}
+	u, _, err := policy.Lookup(id)
+	return u, err
+}
+
+// authenticateForm is Authenticate for users who log in with the login form.
+func (b *BasicAuthAuthenticator) authenticateForm(w http.ResponseWriter, r *http.Request) (*User, error) {
+	if r.Method == "POST" && r.URL.Path == LoginPath {
+		return nil, b.handlePassword(w, r)
+	}
+	if r.Method == "POST" && r.URL.Path == MFALoginPath {
+		return nil, b.handleCode(w, r)
+	}
+	c := b.cookies()
+	t, err := c.authenticate(w, r)
+	if err == MustLogin {
+		return nil, b.loginPrompt(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !b.hasPassword(t.ID) {
+		c.clear(w)
+		return nil, b.loginPrompt(r)
+	}
+	if b.MFA.Enrolled(t.ID) && !t.MFA {
+		// Logged in before they set up two-factor authentication, maybe on
+		// another computer.
+		c.logout(w, r)
+		return nil, b.loginPrompt(r)
+	}
+	u, err := b.lookupUser(t.ID)
+	if err != nil {
+		c.clear(w)
+		return nil, &LoginError{Step: LoginStepPassword, Message: err.Error()}
+	}
+	if u.RequiresMFA() && !t.MFA && r.URL.Path != MFAPath {
+		http.Redirect(w, r, MFAPath, http.StatusSeeOther)
+		return nil, errors.New("user has to set up two-factor authentication")
+	}
+	return u, nil
+}
+
+// loginPrompt returns the step of the login form the user is on.
+func (b *BasicAuthAuthenticator) loginPrompt(r *http.Request) error {
+	if _, ok := b.pendingLogin(r); ok {
+		return &LoginError{Step: LoginStepCode}
+	}
+	return &LoginError{Step: LoginStepPassword}
+}
+
+// pendingLogin returns the state saved when the user entered their password,
+// if they did so recently.
+func (b *BasicAuthAuthenticator) pendingLogin(r *http.Request) (*state, bool) {
+	cookie, err := r.Cookie(mfaLoginCookie)
+	if err != nil {
+		return nil, false
+	}
+	st, ok := decodeState(cookie.Value, b.secretKey)
+	if !ok || st.User == "" || time.Since(st.Time) > mfaLoginTimeout {
+		return nil, false
+	}
+	return st, true
+}
+
+func (b *BasicAuthAuthenticator) setPendingLogin(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     mfaLoginCookie,
+		Value:    value,
+		Path:     LoginPath,
+		MaxAge:   maxAge,
+		Secure:   !b.AllowUnencryptedTraffic,
+		HttpOnly: true,
+	})
+}
+
+// handlePassword checks the username and password on the login form. Users
+// who have set up two-factor authentication are asked for a code; everyone
+// else is logged in.
+func (b *BasicAuthAuthenticator) handlePassword(w http.ResponseWriter, r *http.Request) error {
+	user := r.PostFormValue("user")
+	pass := r.PostFormValue("password")
+	if user == "" || !b.validPassword(user, pass) {
+		b.Info("Failed login", "user", user)
+		return errWrongPassword
+	}
+	if _, err := b.lookupUser(user); err != nil {
+		return &LoginError{Step: LoginStepPassword, Message: err.Error()}
+	}
+	st := newState(r)
+	if b.MFA.Enrolled(user) {
+		st.User = user
+		encoded, err := encodeState(st, b.secretKey)
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return err
+		}
+		b.setPendingLogin(w, encoded, int(mfaLoginTimeout/time.Second))
+		http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+		return errors.New("asked user for a two-factor code")
+	}
+	return b.login(w, r, &token{ID: user}, st.CurrentURL)
+}
+
+// handleCode checks the two-factor code on the login form.
+func (b *BasicAuthAuthenticator) handleCode(w http.ResponseWriter, r *http.Request) error {
+	st, ok := b.pendingLogin(r)
+	if !ok {
+		return &LoginError{
+			Step:    LoginStepPassword,
+			Message: "Your login expired. Please enter your password again",
+		}
+	}
+	if err := b.MFA.Verify(st.User, r.PostFormValue("code")); err != nil {
+		if err != ErrInvalidMFACode && err != ErrMFALocked {
+			rest.ServerError(w, r, err)
+			return err
+		}
+		b.Info("Incorrect two-factor code", "user", st.User)
+		return &LoginError{Step: LoginStepCode, Message: err.Error()}
+	}
+	b.setPendingLogin(w, "", -1)
+	return b.login(w, r, &token{ID: st.User, MFA: true}, st.CurrentURL)
+}
+
+// login sets the login cookie for t and sends the user to the page they
+// were trying to view.
+func (b *BasicAuthAuthenticator) login(w http.ResponseWriter, r *http.Request, t *token, next string) error {
+	cookie, err := b.cookies().newCookie(r, t)
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return err
+	}
+	http.SetCookie(w, cookie)
+	b.Info("Logged in user", "user", t.ID, "mfa", t.MFA)
+	if next == "" || next == LoginPath || next == MFALoginPath {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+	return errors.New("redirected user after login")
+}
+
+// EnrollMFA turns on two-factor authentication for the logged in user, once
+// they enter a code for secret, and logs them in again so their login
+// counts as a two-factor login. It returns the user's recovery codes.
+func (b *BasicAuthAuthenticator) EnrollMFA(w http.ResponseWriter, r *http.Request, u *User, secret string, code string) ([]string, error) {
+	codes, err := b.MFA.Enroll(u.ID(), secret, code)
+	if err != nil {
+		return nil, err
+	}
+	c := b.cookies()
+	c.logout(w, r)
+	cookie, err := c.newCookie(r, &token{ID: u.ID(), MFA: true})
+	if err != nil {
+		return nil, err
+	}
+	http.SetCookie(w, cookie)
+	b.Info("User set up two-factor authentication", "user", u.ID())
+	return codes, nil
+}
+
+// NewRecoveryCodes replaces the logged in user's recovery codes, after
+// checking a code from their authenticator app.
+func (b *BasicAuthAuthenticator) NewRecoveryCodes(u *User, code string) ([]string, error) {
+	codes, err := b.MFA.NewRecoveryCodes(u.ID(), code)
+	if err != nil {
+		return nil, err
+	}
+	b.Info("User generated new recovery codes", "user", u.ID())
+	return codes, nil
+}
+
+// DisableMFA turns off two-factor authentication for the logged in user,
+// after checking their code. Users whose group requires two-factor
+// authentication can't turn it off.
+func (b *BasicAuthAuthenticator) DisableMFA(w http.ResponseWriter, r *http.Request, u *User, code string) error {
+	if u.RequiresMFA() {
+		return ErrMFARequired
+	}
+	if err := b.MFA.Verify(u.ID(), code); err != nil {
+		return err
+	}
+	if err := b.MFA.Delete(u.ID()); err != nil {
+		return err
+	}
+	c := b.cookies()
+	c.logout(w, r)
+	cookie, err := c.newCookie(r, &token{ID: u.ID()})
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, cookie)
+	b.Info("User turned off two-factor authentication", "user", u.ID())
+	return nil
+}
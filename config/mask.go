@@ -0,0 +1,196 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kevinburke/nacl"
+)
+
+// MaskMode describes how much of a value a user can see.
+type MaskMode int
+
+const (
+	// MaskFull shows the whole value.
+	MaskFull MaskMode = iota
+	// MaskHide hides the value, as if the user did not have permission to
+	// view it.
+	MaskHide
+	// MaskLastDigits shows only the last few characters of the value.
+	MaskLastDigits
+	// MaskPseudonym replaces the value with a stable identifier, so users can
+	// tell that two resources share a value without seeing the value.
+	MaskPseudonym
+)
+
+// A Mask describes how to display a phone number to a user. The zero value
+// shows the whole number.
+type Mask struct {
+	Mode MaskMode
+	// The number of characters to show, for MaskLastDigits.
+	Digits int
+}
+
+// Used in place of masked characters.
+const maskChar = "•"
+
+// Masked phone numbers in pseudonym mode start with this prefix.
+const pseudonymPrefix = "anon-"
+
+var lastDigitsRx = regexp.MustCompile(`^last-(\d+)$`)
+
+// ParseMask parses a mask from its configuration value: "full", "hide",
+// "pseudonym", or "last-N" to show the last N digits.
+func ParseMask(s string) (Mask, error) {
+	switch s {
+	case "", "full":
+		return Mask{Mode: MaskFull}, nil
+	case "hide":
+		return Mask{Mode: MaskHide}, nil
+	case "pseudonym":
+		return Mask{Mode: MaskPseudonym}, nil
+	}
+	if match := lastDigitsRx.FindStringSubmatch(s); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 {
+			return Mask{}, fmt.Errorf("Invalid mask %q: must show at least one digit", s)
+		}
+		return Mask{Mode: MaskLastDigits, Digits: n}, nil
+	}
+	return Mask{}, fmt.Errorf(`Invalid mask %q: use "full", "hide", "pseudonym" or "last-N"`, s)
+}
+
+func (m Mask) String() string {
+	switch m.Mode {
+	case MaskHide:
+		return "hide"
+	case MaskLastDigits:
+		return "last-" + strconv.Itoa(m.Digits)
+	case MaskPseudonym:
+		return "pseudonym"
+	default:
+		return "full"
+	}
+}
+
+func (m *Mask) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	mask, err := ParseMask(s)
+	if err != nil {
+		return err
+	}
+	*m = mask
+	return nil
+}
+
+func (m Mask) MarshalYAML() (interface{}, error) {
+	return m.String(), nil
+}
+
+// IsMasked reports whether val was returned by Permission.Mask with a mode
+// other than MaskFull.
+func IsMasked(val string) bool {
+	return strings.Contains(val, maskChar) || strings.HasPrefix(val, pseudonymPrefix)
+}
+
+// DefaultRedactionPatterns match credit card numbers, US Social Security
+// numbers and one-time passcodes. If a pattern has a capture group, only the
+// first group is redacted.
+var DefaultRedactionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+	regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	regexp.MustCompile(`(?i)\b(?:code|passcode|otp|pin)\b\D{0,20}?\b(\d{4,8})\b`),
+}
+
+const redacted = "[redacted]"
+
+// Used to derive pseudonyms if SetPseudonymKey is never called.
+var defaultPseudonymKey = nacl.NewKey()
+
+var pseudonymEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Mask applies m to val.
+func (p *Permission) Mask(m Mask, val string) string {
+	switch m.Mode {
+	case MaskHide:
+		return ""
+	case MaskLastDigits:
+		n := utf8.RuneCountInString(val)
+		if n <= m.Digits {
+			return strings.Repeat(maskChar, n)
+		}
+		runes := []rune(val)
+		return strings.Repeat(maskChar, n-m.Digits) + string(runes[n-m.Digits:])
+	case MaskPseudonym:
+		key := p.pseudonymKey
+		if key == nil {
+			key = defaultPseudonymKey
+		}
+		mac := hmac.New(sha256.New, key[:])
+		mac.Write([]byte(val))
+		sum := pseudonymEncoding.EncodeToString(mac.Sum(nil)[:5])
+		return pseudonymPrefix + strings.ToLower(sum)
+	default:
+		return val
+	}
+}
+
+// Redact replaces any text in body that matches one of the redaction
+// patterns.
+func (p *Permission) Redact(body string) string {
+	patterns := p.redactionPatterns
+	if patterns == nil {
+		patterns = DefaultRedactionPatterns
+	}
+	for _, rx := range patterns {
+		if rx.NumSubexp() == 0 {
+			body = rx.ReplaceAllLiteralString(body, redacted)
+			continue
+		}
+		var buf strings.Builder
+		last := 0
+		for _, loc := range rx.FindAllStringSubmatchIndex(body, -1) {
+			if loc[2] < 0 {
+				continue
+			}
+			buf.WriteString(body[last:loc[2]])
+			buf.WriteString(redacted)
+			last = loc[3]
+		}
+		buf.WriteString(body[last:])
+		body = buf.String()
+	}
+	return body
+}
+
+// DerivePseudonymKey returns the key to derive pseudonyms with, for a
+// server with the given secret key. The secret key also encrypts cookies and
+// CSRF tokens, so it isn't used directly.
+func DerivePseudonymKey(secretKey *[32]byte) *[32]byte {
+	mac := hmac.New(sha256.New, secretKey[:])
+	mac.Write([]byte("pseudonym"))
+	key := new([32]byte)
+	copy(key[:], mac.Sum(nil))
+	return key
+}
+
+// SetPseudonymKey sets the key used to derive pseudonyms for masked values.
+// Pseudonyms are stable as long as the key doesn't change.
+func (p *Permission) SetPseudonymKey(key *[32]byte) {
+	p.pseudonymKey = key
+}
+
+// SetRedactionPatterns sets the patterns to redact from message bodies. If
+// rxs is nil, DefaultRedactionPatterns are used.
+func (p *Permission) SetRedactionPatterns(rxs []*regexp.Regexp) {
+	p.redactionPatterns = rxs
+}
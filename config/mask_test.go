@@ -0,0 +1,122 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/nacl"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestUnmarshalMasks(t *testing.T) {
+	yml := []byte(`
+message_from_mask: last-4
+message_to_mask: pseudonym
+call_to_mask: hide
+redact_message_bodies: true
+`)
+	us := new(UserSettings)
+	if err := yaml.Unmarshal(yml, us); err != nil {
+		t.Fatal(err)
+	}
+	if us.MessageFromMask != (Mask{Mode: MaskLastDigits, Digits: 4}) {
+		t.Errorf("expected last-4 mask, got %v", us.MessageFromMask)
+	}
+	if us.MessageToMask.Mode != MaskPseudonym {
+		t.Errorf("expected pseudonym mask, got %v", us.MessageToMask)
+	}
+	if us.CallFromMask.Mode != MaskFull {
+		t.Errorf("expected omitted mask to be full, got %v", us.CallFromMask)
+	}
+	if !us.RedactMessageBodies {
+		t.Errorf("expected RedactMessageBodies to be true")
+	}
+	u := NewUser(us)
+	if u.CanViewCallTo() {
+		t.Errorf("hidden call recipient should not be viewable")
+	}
+	if !u.CanViewMessageFrom() {
+		t.Errorf("masked message sender should be viewable")
+	}
+	if err := yaml.Unmarshal([]byte("message_from_mask: last-0"), us); err == nil {
+		t.Errorf("expected error for last-0 mask, got nil")
+	}
+	if err := yaml.Unmarshal([]byte("message_from_mask: partial"), us); err == nil {
+		t.Errorf("expected error for unknown mask, got nil")
+	}
+}
+
+func TestMask(t *testing.T) {
+	t.Parallel()
+	p := NewPermission(time.Hour)
+	if got := p.Mask(Mask{}, "+14105551234"); got != "+14105551234" {
+		t.Errorf("full mask: got %q", got)
+	}
+	got := p.Mask(Mask{Mode: MaskLastDigits, Digits: 4}, "+14105551234")
+	if got != "••••••••1234" {
+		t.Errorf("last-4 mask: got %q", got)
+	}
+	if !IsMasked(got) {
+		t.Errorf("expected %q to be masked", got)
+	}
+	key := new([32]byte)
+	p.SetPseudonymKey(key)
+	a := p.Mask(Mask{Mode: MaskPseudonym}, "+14105551234")
+	b := p.Mask(Mask{Mode: MaskPseudonym}, "+14105551234")
+	c := p.Mask(Mask{Mode: MaskPseudonym}, "+14105551235")
+	if a != b {
+		t.Errorf("pseudonyms should be stable, got %q and %q", a, b)
+	}
+	if a == c {
+		t.Errorf("different numbers should have different pseudonyms, got %q", a)
+	}
+	if !strings.HasPrefix(a, pseudonymPrefix) || !IsMasked(a) || strings.Contains(a, "1234") {
+		t.Errorf("bad pseudonym %q", a)
+	}
+	if IsMasked("+14105551234") {
+		t.Errorf("phone number should not be masked")
+	}
+}
+
+func TestDerivePseudonymKey(t *testing.T) {
+	t.Parallel()
+	secretKey := nacl.NewKey()
+	key := DerivePseudonymKey(secretKey)
+	if *key == *secretKey {
+		t.Error("expected the pseudonym key to differ from the secret key")
+	}
+	if *DerivePseudonymKey(secretKey) != *key {
+		t.Error("expected the pseudonym key to be stable")
+	}
+	if *DerivePseudonymKey(nacl.NewKey()) == *key {
+		t.Error("expected different secret keys to give different pseudonym keys")
+	}
+}
+
+var redactTests = []struct {
+	in   string
+	want string
+}{
+	{"Your card 4111 1111 1111 1111 was charged", "Your card [redacted] was charged"},
+	{"SSN on file: 078-05-1120.", "SSN on file: [redacted]."},
+	{"Your verification code is 482913", "Your verification code is [redacted]"},
+	{"Your PIN: 1234. Call +14105551234 for help", "Your PIN: [redacted]. Call +14105551234 for help"},
+	{"See you at 10:30", "See you at 10:30"},
+}
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+	p := NewPermission(time.Hour)
+	for _, tt := range redactTests {
+		if got := p.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	p.SetRedactionPatterns([]*regexp.Regexp{regexp.MustCompile(`order (\d+)`)})
+	in := "Your order 5512 shipped, code 482913"
+	if got := p.Redact(in); got != "Your order [redacted] shipped, code 482913" {
+		t.Errorf("Redact(%q) with custom pattern: got %q", in, got)
+	}
+}
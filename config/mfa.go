@@ -0,0 +1,417 @@
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/kevinburke/logrole/services"
+)
+
+// The issuer authenticator apps show next to a user's Logrole codes.
+const mfaIssuer = "Logrole"
+
+// TOTP codes change every mfaPeriod. We accept the codes before and after the
+// current one, in case the user's clock is off or they were slow to type.
+const mfaPeriod = 30 * time.Second
+const mfaSkew = 1
+
+// TOTP codes are mfaDigits long, and secrets are mfaSecretSize random bytes,
+// the defaults every authenticator app supports.
+const mfaDigits = 6
+const mfaSecretSize = 20
+
+// How many recovery codes a user gets when they enroll.
+const recoveryCodeCount = 10
+
+// After mfaMaxFailures incorrect codes in mfaLockout, we stop checking a
+// user's codes until mfaLockout has passed, so codes can't be guessed.
+const mfaMaxFailures = 10
+const mfaLockout = 15 * time.Minute
+
+var ErrInvalidMFACode = errors.New("That code is incorrect, or it has already been used. Please try again")
+var ErrMFALocked = errors.New("Too many incorrect codes. Please wait a few minutes and try again")
+var ErrMFARequired = errors.New("Your group requires two-factor authentication, so you can't turn it off")
+
+// An MFAEnrollment holds a user's TOTP secret and recovery codes.
+type MFAEnrollment struct {
+	Secret string
+	// SHA-256 hashes of the recovery codes that haven't been used yet.
+	RecoveryCodes []string
+	Created       time.Time
+	// The time step of the last code that was accepted; a code can't be used
+	// twice.
+	LastStep int64
+}
+
+type mfaFailures struct {
+	count int
+	first time.Time
+}
+
+// MFAStore keeps users' TOTP secrets and recovery codes in a file. The file
+// is encrypted with the secret key, so changing the secret key means every
+// user has to enroll again.
+type MFAStore struct {
+	path      string
+	secretKey *[32]byte
+	mu        sync.Mutex
+	users     map[string]*MFAEnrollment
+	failures  map[string]*mfaFailures
+	now       func() time.Time
+}
+
+// NewMFAStore loads the enrollments saved at path. The file is created the
+// first time a user enrolls.
+func NewMFAStore(path string, secretKey *[32]byte) (*MFAStore, error) {
+	s := &MFAStore{
+		path:      path,
+		secretKey: secretKey,
+		users:     make(map[string]*MFAEnrollment),
+		failures:  make(map[string]*mfaFailures),
+		now:       time.Now,
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return s, nil
+	}
+	plaintext, err := services.UnopaqueByte(string(bytes.TrimSpace(data)), secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't decrypt %s; has the secret key changed? %v", path, err)
+	}
+	if err := json.Unmarshal(plaintext, &s.users); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Enrolled returns true if the user has set up two-factor authentication.
+func (s *MFAStore) Enrolled(user string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[user]
+	return ok
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes the user has.
+func (s *MFAStore) RecoveryCodesLeft(user string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.users[user]
+	if !ok {
+		return 0
+	}
+	return len(e.RecoveryCodes)
+}
+
+// Enroll turns on two-factor authentication for user, once they've proven
+// they added secret to their authenticator app by entering a code. It
+// returns the user's recovery codes, which aren't stored anywhere.
+func (s *MFAStore) Enroll(user string, secret string, code string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(secret, normalizeCode(code), s.now())
+	if !ok {
+		s.fail(user)
+		return nil, ErrInvalidMFACode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	s.users[user] = &MFAEnrollment{
+		Secret:        secret,
+		RecoveryCodes: hashes,
+		Created:       s.now().UTC(),
+		LastStep:      step,
+	}
+	delete(s.failures, user)
+	return codes, s.save()
+}
+
+// Verify checks a TOTP code or an unused recovery code for user. Recovery
+// codes can only be used once.
+func (s *MFAStore) Verify(user string, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.users[user]
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	if err := s.checkLockout(user); err != nil {
+		return err
+	}
+	code = normalizeCode(code)
+	if step, ok := matchTOTP(e.Secret, code, s.now()); ok && step > e.LastStep {
+		e.LastStep = step
+		delete(s.failures, user)
+		return s.save()
+	}
+	hash := hashRecoveryCode(code)
+	for i, h := range e.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			e.RecoveryCodes = append(e.RecoveryCodes[:i:i], e.RecoveryCodes[i+1:]...)
+			delete(s.failures, user)
+			return s.save()
+		}
+	}
+	s.fail(user)
+	return ErrInvalidMFACode
+}
+
+// NewRecoveryCodes replaces the user's recovery codes with new ones, after
+// checking a TOTP code from their authenticator app. Recovery codes aren't
+// accepted, so someone who only has a recovery code, or a session, can't
+// keep getting around the second factor.
+func (s *MFAStore) NewRecoveryCodes(user string, code string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.users[user]
+	if !ok {
+		return nil, fmt.Errorf("%s hasn't set up two-factor authentication", user)
+	}
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(e.Secret, normalizeCode(code), s.now())
+	if !ok || step <= e.LastStep {
+		s.fail(user)
+		return nil, ErrInvalidMFACode
+	}
+	e.LastStep = step
+	delete(s.failures, user)
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	e.RecoveryCodes = hashes
+	return codes, s.save()
+}
+
+// Delete turns off two-factor authentication for user.
+func (s *MFAStore) Delete(user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, user)
+	return s.save()
+}
+
+// checkLockout returns ErrMFALocked if there have been too many incorrect
+// codes for user recently. Call it with s.mu held.
+func (s *MFAStore) checkLockout(user string) error {
+	f, ok := s.failures[user]
+	if !ok {
+		return nil
+	}
+	if s.now().Sub(f.first) >= mfaLockout {
+		delete(s.failures, user)
+		return nil
+	}
+	if f.count >= mfaMaxFailures {
+		return ErrMFALocked
+	}
+	return nil
+}
+
+// fail records an incorrect code. Call it with s.mu held.
+func (s *MFAStore) fail(user string) {
+	f, ok := s.failures[user]
+	if !ok {
+		f = &mfaFailures{first: s.now()}
+		s.failures[user] = f
+	}
+	f.count++
+}
+
+// save encrypts the enrollments and writes them to the file. Call it with
+// s.mu held.
+func (s *MFAStore) save() error {
+	data, err := json.Marshal(s.users)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, ".logrole-mfa-", []byte(services.OpaqueByte(data, s.secretKey)))
+}
+
+// matchTOTP reports whether code is a valid code for secret around now, and
+// returns the time step it was generated for.
+func matchTOTP(secret string, code string, now time.Time) (int64, bool) {
+	if len(code) != mfaDigits {
+		return 0, false
+	}
+	for i := -mfaSkew; i <= mfaSkew; i++ {
+		t := now.Add(time.Duration(i) * mfaPeriod)
+		expected, err := TOTPCode(secret, t)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / int64(mfaPeriod/time.Second), true
+		}
+	}
+	return 0, false
+}
+
+// TOTPCode returns the RFC 6238 code for the base32-encoded secret at t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeMFASecret(secret)
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(mfaPeriod/time.Second)))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
+
+var mfaSecretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// decodeMFASecret decodes a base32 secret, in whatever case and with or
+// without padding.
+func decodeMFASecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.TrimSpace(secret), "="))
+	key, err := mfaSecretEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, errors.New("Invalid TOTP secret")
+	}
+	return key, nil
+}
+
+// normalizeCode removes the spaces and dashes people type in codes.
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.Replace(code, " ", "", -1)
+	return strings.Replace(code, "-", "", -1)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns a set of random recovery codes, formatted like
+// "abcde-fghij", and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryEncoding.EncodeToString(b)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// An MFAKey is a new TOTP secret for a user to add to their authenticator
+// app.
+type MFAKey struct {
+	account string
+	secret  string
+}
+
+// NewMFAKey generates a TOTP secret for user.
+func NewMFAKey(user string) (*MFAKey, error) {
+	b := make([]byte, mfaSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &MFAKey{account: user, secret: mfaSecretEncoding.EncodeToString(b)}, nil
+}
+
+// ParseMFAKey parses the otpauth:// URL of a key.
+func ParseMFAKey(rawurl string) (*MFAKey, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	secret := u.Query().Get("secret")
+	if u.Scheme != "otpauth" || u.Host != "totp" || secret == "" {
+		return nil, errors.New("Not a TOTP key URL")
+	}
+	if _, err := decodeMFASecret(secret); err != nil {
+		return nil, err
+	}
+	account := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(account, ":"); i >= 0 {
+		account = account[i+1:]
+	}
+	return &MFAKey{account: account, secret: secret}, nil
+}
+
+// Secret returns the base32-encoded secret, for users who can't scan the QR
+// code.
+func (k *MFAKey) Secret() string {
+	return k.secret
+}
+
+// URL returns the otpauth:// URL encoded in the QR code.
+func (k *MFAKey) URL() string {
+	v := url.Values{}
+	v.Set("secret", k.secret)
+	v.Set("issuer", mfaIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", strconv.Itoa(mfaDigits))
+	v.Set("period", strconv.Itoa(int(mfaPeriod/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + mfaIssuer + ":" + k.account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// PNG returns a size x size QR code that authenticator apps can scan.
+func (k *MFAKey) PNG(size int) ([]byte, error) {
+	code, err := qr.Encode(k.URL(), qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	img, err := barcode.Scale(code, size, size)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
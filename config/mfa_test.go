@@ -0,0 +1,365 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/nacl"
+)
+
+func newTestMFAStore(t *testing.T, key *[32]byte) (*MFAStore, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "logrole-mfa-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewMFAStore(filepath.Join(dir, "mfa"), key)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func enrollTestUser(t *testing.T, s *MFAStore, user string) (string, []string) {
+	t.Helper()
+	k, err := NewMFAKey(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := TOTPCode(k.Secret(), s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.Enroll(user, k.Secret(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k.Secret(), codes
+}
+
+func TestMFAStoreEncryptsFile(t *testing.T) {
+	t.Parallel()
+	key := nacl.NewKey()
+	s, cleanup := newTestMFAStore(t, key)
+	defer cleanup()
+	secret, _ := enrollTestUser(t, s, "alice")
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(secret)) || bytes.Contains(data, []byte("alice")) {
+		t.Errorf("MFA file contains plaintext: %s", data)
+	}
+	s2, err := NewMFAStore(s.path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s2.Enrolled("alice") {
+		t.Error("expected alice to be enrolled after reloading the file")
+	}
+	if _, err := NewMFAStore(s.path, nacl.NewKey()); err == nil {
+		t.Error("expected an error loading the file with a different key")
+	}
+}
+
+func TestMFAVerify(t *testing.T) {
+	t.Parallel()
+	s, cleanup := newTestMFAStore(t, nacl.NewKey())
+	defer cleanup()
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	secret, _ := enrollTestUser(t, s, "alice")
+	// The code used to enroll can't be used again.
+	code, _ := TOTPCode(secret, now)
+	if err := s.Verify("alice", code); err != ErrInvalidMFACode {
+		t.Errorf("expected the enrollment code to be rejected, got %v", err)
+	}
+	now = now.Add(mfaPeriod)
+	code, _ = TOTPCode(secret, now)
+	if err := s.Verify("alice", code); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify("alice", code); err != ErrInvalidMFACode {
+		t.Errorf("expected a reused code to be rejected, got %v", err)
+	}
+	if err := s.Verify("bob", code); err != ErrInvalidMFACode {
+		t.Errorf("expected an unenrolled user to be rejected, got %v", err)
+	}
+}
+
+func TestMFARecoveryCodesWorkOnce(t *testing.T) {
+	t.Parallel()
+	s, cleanup := newTestMFAStore(t, nacl.NewKey())
+	defer cleanup()
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	secret, codes := enrollTestUser(t, s, "alice")
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+	if err := s.Verify("alice", strings.ToUpper(codes[3])); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify("alice", codes[3]); err != ErrInvalidMFACode {
+		t.Errorf("expected a used recovery code to be rejected, got %v", err)
+	}
+	if n := s.RecoveryCodesLeft("alice"); n != recoveryCodeCount-1 {
+		t.Errorf("expected %d recovery codes left, got %d", recoveryCodeCount-1, n)
+	}
+	if _, err := s.NewRecoveryCodes("alice", codes[4]); err != ErrInvalidMFACode {
+		t.Errorf("expected a recovery code not to make new recovery codes, got %v", err)
+	}
+	now = now.Add(mfaPeriod)
+	code, _ := TOTPCode(secret, now)
+	newCodes, err := s.NewRecoveryCodes("alice", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify("alice", codes[0]); err != ErrInvalidMFACode {
+		t.Errorf("expected an old recovery code to be rejected, got %v", err)
+	}
+	if err := s.Verify("alice", newCodes[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMFALockout(t *testing.T) {
+	t.Parallel()
+	s, cleanup := newTestMFAStore(t, nacl.NewKey())
+	defer cleanup()
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	secret, _ := enrollTestUser(t, s, "alice")
+	for i := 0; i < mfaMaxFailures; i++ {
+		if err := s.Verify("alice", "000000"); err != ErrInvalidMFACode {
+			t.Fatalf("attempt %d: expected ErrInvalidMFACode, got %v", i, err)
+		}
+	}
+	now = now.Add(mfaPeriod)
+	code, _ := TOTPCode(secret, now)
+	if err := s.Verify("alice", code); err != ErrMFALocked {
+		t.Fatalf("expected ErrMFALocked, got %v", err)
+	}
+	if _, err := s.NewRecoveryCodes("alice", code); err != ErrMFALocked {
+		t.Fatalf("expected ErrMFALocked for new recovery codes, got %v", err)
+	}
+	now = now.Add(mfaLockout)
+	code, _ = TOTPCode(secret, now)
+	if err := s.Verify("alice", code); err != nil {
+		t.Errorf("expected the lockout to end, got %v", err)
+	}
+}
+
+func newTestLoginForm(t *testing.T, policy *Policy) (*BasicAuthAuthenticator, func()) {
+	t.Helper()
+	key := nacl.NewKey()
+	s, cleanup := newTestMFAStore(t, key)
+	b := NewBasicAuthAuthenticator("logrole")
+	b.AddUserPassword("alice", "hunter2")
+	b.AllowUnencryptedTraffic = true
+	b.SetPolicy(policy)
+	b.EnableLoginForm(NullLogger, s, key)
+	return b, cleanup
+}
+
+func postForm(path string, vals url.Values, cookies ...*http.Cookie) *http.Request {
+	req := httptest.NewRequest("POST", path, strings.NewReader(vals.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func getCookie(t *testing.T, w *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %s cookie in response", name)
+	return nil
+}
+
+func TestLoginFormPassword(t *testing.T) {
+	t.Parallel()
+	b, cleanup := newTestLoginForm(t, nil)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	_, err := b.Authenticate(w, httptest.NewRequest("GET", "/messages", nil))
+	if lerr, ok := err.(*LoginError); !ok || lerr.Step != LoginStepPassword {
+		t.Fatalf("expected to be asked for a password, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	_, err = b.Authenticate(w, postForm("/login?g=/calls", url.Values{"user": {"alice"}, "password": {"wrong"}}))
+	if err != errWrongPassword {
+		t.Fatalf("expected errWrongPassword, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	b.Authenticate(w, postForm("/login?g=/calls", url.Values{"user": {"alice"}, "password": {"hunter2"}}))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/calls" {
+		t.Fatalf("expected redirect to /calls, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	req := httptest.NewRequest("GET", "/calls", nil)
+	req.AddCookie(getCookie(t, w, "token"))
+	u, err := b.Authenticate(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID() != "alice" {
+		t.Errorf("expected to log in as alice, got %q", u.ID())
+	}
+}
+
+func TestLoginFormAsksForCode(t *testing.T) {
+	t.Parallel()
+	b, cleanup := newTestLoginForm(t, nil)
+	defer cleanup()
+	// Logged in before setting up two-factor authentication.
+	w := httptest.NewRecorder()
+	b.Authenticate(w, postForm("/login", url.Values{"user": {"alice"}, "password": {"hunter2"}}))
+	oldCookie := getCookie(t, w, "token")
+	secret, _ := enrollTestUser(t, b.MFA, "alice")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(oldCookie)
+	if _, err := b.Authenticate(httptest.NewRecorder(), req); err == nil {
+		t.Fatal("expected a login from before enrollment to be rejected")
+	}
+
+	w = httptest.NewRecorder()
+	b.Authenticate(w, postForm("/login?g=/alerts", url.Values{"user": {"alice"}, "password": {"hunter2"}}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect to the code form, got %d", w.Code)
+	}
+	pending := getCookie(t, w, mfaLoginCookie)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "token" {
+			t.Fatal("should not log in before entering a code")
+		}
+	}
+	req = httptest.NewRequest("GET", "/login", nil)
+	req.AddCookie(pending)
+	_, err := b.Authenticate(httptest.NewRecorder(), req)
+	if lerr, ok := err.(*LoginError); !ok || lerr.Step != LoginStepCode {
+		t.Fatalf("expected to be asked for a code, got %v", err)
+	}
+
+	_, err = b.Authenticate(httptest.NewRecorder(), postForm("/login/mfa", url.Values{"code": {"000000"}}, pending))
+	if lerr, ok := err.(*LoginError); !ok || lerr.Step != LoginStepCode || lerr.Message == "" {
+		t.Fatalf("expected an incorrect code error, got %v", err)
+	}
+
+	code, _ := TOTPCode(secret, time.Now().Add(mfaPeriod))
+	w = httptest.NewRecorder()
+	b.Authenticate(w, postForm("/login/mfa", url.Values{"code": {code}}, pending))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/alerts" {
+		t.Fatalf("expected redirect to /alerts, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	req = httptest.NewRequest("GET", "/alerts", nil)
+	req.AddCookie(getCookie(t, w, "token"))
+	if _, err := b.Authenticate(httptest.NewRecorder(), req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireMFARedirectsToEnrollment(t *testing.T) {
+	t.Parallel()
+	policy := &Policy{&Group{
+		Name:        "support",
+		Users:       []string{"alice"},
+		RequireMFA:  true,
+		Permissions: &UserSettings{},
+	}}
+	b, cleanup := newTestLoginForm(t, policy)
+	defer cleanup()
+	w := httptest.NewRecorder()
+	b.Authenticate(w, postForm("/login", url.Values{"user": {"alice"}, "password": {"hunter2"}}))
+	cookie := getCookie(t, w, "token")
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/messages", nil)
+	req.AddCookie(cookie)
+	if _, err := b.Authenticate(w, req); err == nil {
+		t.Fatal("expected an unenrolled user to be stopped")
+	}
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != MFAPath {
+		t.Fatalf("expected redirect to %s, got %d %q", MFAPath, w.Code, w.Header().Get("Location"))
+	}
+
+	req = httptest.NewRequest("GET", MFAPath, nil)
+	req.AddCookie(cookie)
+	u, err := b.Authenticate(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID() != "alice" || !u.RequiresMFA() {
+		t.Errorf("expected alice to require MFA, got id %q", u.ID())
+	}
+	if err := b.DisableMFA(httptest.NewRecorder(), req, u, ""); err != ErrMFARequired {
+		t.Errorf("expected ErrMFARequired, got %v", err)
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	t.Parallel()
+	// The SHA-1 test vectors from RFC 6238, truncated to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("TOTPCode at %d: got %q, want %q", tt.unix, code, tt.code)
+		}
+	}
+	if _, err := TOTPCode("not base32!", time.Now()); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestParseMFAKey(t *testing.T) {
+	t.Parallel()
+	k, err := NewMFAKey("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(k.URL(), "otpauth://totp/Logrole:alice?") {
+		t.Errorf("unexpected key URL %q", k.URL())
+	}
+	parsed, err := ParseMFAKey(k.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Secret() != k.Secret() || parsed.URL() != k.URL() {
+		t.Errorf("parsed key %q doesn't match %q", parsed.URL(), k.URL())
+	}
+	for _, u := range []string{"https://example.com", "otpauth://hotp/Logrole:alice?secret=" + k.Secret(), "otpauth://totp/Logrole:alice"} {
+		if _, err := ParseMFAKey(u); err == nil {
+			t.Errorf("expected an error parsing %q", u)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"time"
+
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// DefaultAlertInterval is how often to check for new alerts if
+// alert_notifications doesn't set an interval.
+const DefaultAlertInterval = 30 * time.Second
+
+// DefaultAlertCooldown is the shortest time between two notifications for
+// the same rule, account and error code, if the rule doesn't set a
+// cooldown.
+const DefaultAlertCooldown = 15 * time.Minute
+
+// AlertNotifications configures notifications about new Twilio alerts, for
+// example a broken webhook.
+type AlertNotifications struct {
+	// How often to check for new alerts. Defaults to 30 seconds.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	Rules    []*AlertRule  `yaml:"rules"`
+	Sinks    []*AlertSink  `yaml:"sinks"`
+}
+
+// An AlertRule decides which new alerts to send notifications about. An
+// alert matches a rule if it matches every filter the rule sets.
+type AlertRule struct {
+	Name string `yaml:"name"`
+	// Match alerts with any of these error codes, log levels or resource
+	// sids. If empty, alerts aren't filtered.
+	ErrorCodes   []twilio.Code     `yaml:"error_codes,omitempty"`
+	LogLevels    []twilio.LogLevel `yaml:"log_levels,omitempty"`
+	ResourceSids []string          `yaml:"resource_sids,omitempty"`
+	// Only send a notification once there are Threshold matching alerts
+	// with the same error code in Window. Threshold defaults to 1; if it's
+	// more than 1, Window is required.
+	Threshold int           `yaml:"threshold,omitempty"`
+	Window    time.Duration `yaml:"window,omitempty"`
+	// Wait at least this long between notifications for the same account
+	// and error code. Alerts that match in the meantime are sent in the next
+	// notification. Defaults to 15 minutes.
+	Cooldown time.Duration `yaml:"cooldown,omitempty"`
+	// The names of the sinks to send notifications to.
+	Sinks []string `yaml:"sinks"`
+}
+
+// MinAlerts returns the number of matching alerts needed to send a
+// notification.
+func (r *AlertRule) MinAlerts() int {
+	if r.Threshold > 1 {
+		return r.Threshold
+	}
+	return 1
+}
+
+// CooldownPeriod returns the shortest time between two notifications for
+// the same account and error code.
+func (r *AlertRule) CooldownPeriod() time.Duration {
+	if r.Cooldown > 0 {
+		return r.Cooldown
+	}
+	return DefaultAlertCooldown
+}
+
+// Matches reports whether a matches every filter in r.
+func (r *AlertRule) Matches(a *twilio.Alert) bool {
+	if len(r.ErrorCodes) > 0 {
+		found := false
+		for _, code := range r.ErrorCodes {
+			if a.ErrorCode == code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.LogLevels) > 0 {
+		found := false
+		for _, level := range r.LogLevels {
+			if a.LogLevel == level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ResourceSids) > 0 {
+		found := false
+		for _, sid := range r.ResourceSids {
+			if a.ResourceSid == sid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// The kinds of AlertSink.
+const (
+	// POSTs the notification as JSON to URL.
+	SinkWebhook = "webhook"
+	// POSTs the notification to a Slack (or Slack-compatible) incoming
+	// webhook at URL.
+	SinkSlack = "slack"
+	// Emails the notification to To through SMTPServer.
+	SinkEmail = "email"
+)
+
+// An AlertSink is somewhere to send notifications.
+type AlertSink struct {
+	Name string `yaml:"name"`
+	// "webhook", "slack" or "email".
+	Type string `yaml:"type"`
+	// For webhook and slack sinks.
+	URL string `yaml:"url,omitempty"`
+	// For email sinks: the SMTP server's host and port, and the username and
+	// password to log in with, if it needs them.
+	SMTPServer   string   `yaml:"smtp_server,omitempty"`
+	SMTPUsername string   `yaml:"smtp_username,omitempty"`
+	SMTPPassword string   `yaml:"smtp_password,omitempty"`
+	From         string   `yaml:"from,omitempty"`
+	To           []string `yaml:"to,omitempty"`
+}
+
+func (s *AlertSink) validate() error {
+	switch s.Type {
+	case SinkWebhook, SinkSlack:
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("sink %s needs an absolute http or https url", s.Name)
+		}
+	case SinkEmail:
+		if _, _, err := net.SplitHostPort(s.SMTPServer); err != nil {
+			return fmt.Errorf("sink %s needs an smtp_server like smtp.example.com:587", s.Name)
+		}
+		if _, err := mail.ParseAddress(s.From); err != nil {
+			return fmt.Errorf("sink %s has an invalid from address: %v", s.Name, err)
+		}
+		if len(s.To) == 0 {
+			return fmt.Errorf("sink %s needs at least one to address", s.Name)
+		}
+		for _, to := range s.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return fmt.Errorf("sink %s has an invalid to address %q: %v", s.Name, to, err)
+			}
+		}
+	default:
+		return fmt.Errorf("sink %s has unknown type %q; use webhook, slack or email", s.Name, s.Type)
+	}
+	return nil
+}
+
+func (an *AlertNotifications) validate() error {
+	if an == nil {
+		return nil
+	}
+	if an.Interval < 0 {
+		return errors.New("interval must be positive")
+	}
+	if len(an.Rules) == 0 {
+		return errors.New("at least one rule is required")
+	}
+	sinks := make(map[string]bool, len(an.Sinks))
+	for _, s := range an.Sinks {
+		if s.Name == "" {
+			return errors.New("every sink needs a name")
+		}
+		if sinks[s.Name] {
+			return fmt.Errorf("sink %s appears twice", s.Name)
+		}
+		sinks[s.Name] = true
+		if err := s.validate(); err != nil {
+			return err
+		}
+	}
+	rules := make(map[string]bool, len(an.Rules))
+	for _, r := range an.Rules {
+		if r.Name == "" {
+			return errors.New("every rule needs a name")
+		}
+		if rules[r.Name] {
+			return fmt.Errorf("rule %s appears twice", r.Name)
+		}
+		rules[r.Name] = true
+		for _, level := range r.LogLevels {
+			switch level {
+			case twilio.LogLevelError, twilio.LogLevelWarning, twilio.LogLevelNotice, twilio.LogLevelDebug:
+			default:
+				return fmt.Errorf("rule %s has unknown log level %q", r.Name, level)
+			}
+		}
+		if r.Threshold < 0 || r.Window < 0 || r.Cooldown < 0 {
+			return fmt.Errorf("rule %s: threshold, window and cooldown must be positive", r.Name)
+		}
+		if r.Threshold > 1 && r.Window == 0 {
+			return fmt.Errorf("rule %s has a threshold, so it needs a window", r.Name)
+		}
+		if len(r.Sinks) == 0 {
+			return fmt.Errorf("rule %s needs at least one sink", r.Name)
+		}
+		for _, name := range r.Sinks {
+			if !sinks[name] {
+				return fmt.Errorf("rule %s uses unknown sink %s", r.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// PollInterval returns how often to check for new alerts.
+func (an *AlertNotifications) PollInterval() time.Duration {
+	if an.Interval > 0 {
+		return an.Interval
+	}
+	return DefaultAlertInterval
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+func TestAlertRuleMatches(t *testing.T) {
+	t.Parallel()
+	r := &AlertRule{
+		ErrorCodes: []twilio.Code{11200, 11205},
+		LogLevels:  []twilio.LogLevel{twilio.LogLevelError},
+	}
+	tests := []struct {
+		alert *twilio.Alert
+		want  bool
+	}{
+		{&twilio.Alert{ErrorCode: 11200, LogLevel: twilio.LogLevelError}, true},
+		{&twilio.Alert{ErrorCode: 11205, LogLevel: twilio.LogLevelError}, true},
+		{&twilio.Alert{ErrorCode: 30003, LogLevel: twilio.LogLevelError}, false},
+		{&twilio.Alert{ErrorCode: 11200, LogLevel: twilio.LogLevelWarning}, false},
+	}
+	for _, tt := range tests {
+		if got := r.Matches(tt.alert); got != tt.want {
+			t.Errorf("Matches(%d, %s): got %t, want %t", tt.alert.ErrorCode, tt.alert.LogLevel, got, tt.want)
+		}
+	}
+	r = &AlertRule{ResourceSids: []string{"PN123"}}
+	if !r.Matches(&twilio.Alert{ResourceSid: "PN123"}) || r.Matches(&twilio.Alert{ResourceSid: "PN456"}) {
+		t.Error("expected resource_sids to match exactly")
+	}
+}
+
+func TestAlertNotificationsValidation(t *testing.T) {
+	t.Parallel()
+	webhook := &AlertSink{Name: "hook", Type: SinkWebhook, URL: "https://example.com/hook"}
+	rule := func(r *AlertRule) *AlertRule {
+		r.Name = "webhooks"
+		if r.Sinks == nil {
+			r.Sinks = []string{"hook"}
+		}
+		return r
+	}
+	tests := []struct {
+		an  *AlertNotifications
+		err string
+	}{
+		{&AlertNotifications{Sinks: []*AlertSink{webhook}}, "at least one rule"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{Sinks: []string{"pager"}})}, Sinks: []*AlertSink{webhook}}, "unknown sink pager"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{Threshold: 5})}, Sinks: []*AlertSink{webhook}}, "needs a window"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{LogLevels: []twilio.LogLevel{"fatal"}})}, Sinks: []*AlertSink{webhook}}, "unknown log level"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{})}, Sinks: []*AlertSink{{Name: "hook", Type: SinkSlack, URL: "/hook"}}}, "absolute http or https url"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{})}, Sinks: []*AlertSink{{Name: "hook", Type: SinkEmail, SMTPServer: "smtp.example.com", From: "logrole@example.com", To: []string{"ops@example.com"}}}}, "smtp_server"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{})}, Sinks: []*AlertSink{{Name: "hook", Type: SinkEmail, SMTPServer: "smtp.example.com:587", From: "logrole@example.com"}}}, "at least one to address"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{})}, Sinks: []*AlertSink{{Name: "hook", Type: "pager"}}}, "unknown type"},
+		{&AlertNotifications{Rules: []*AlertRule{rule(&AlertRule{}), rule(&AlertRule{})}, Sinks: []*AlertSink{webhook}}, "appears twice"},
+	}
+	for i, tt := range tests {
+		err := tt.an.validate()
+		if err == nil {
+			t.Errorf("%d: expected an error containing %q, got nil", i, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%d: expected an error containing %q, got %v", i, tt.err, err)
+		}
+	}
+	ok := &AlertNotifications{
+		Rules: []*AlertRule{rule(&AlertRule{Threshold: 5, Window: 10 * time.Minute})},
+		Sinks: []*AlertSink{webhook},
+	}
+	if err := ok.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ok.PollInterval() != DefaultAlertInterval || ok.Rules[0].CooldownPeriod() != DefaultAlertCooldown {
+		t.Error("expected the default interval and cooldown")
+	}
+}
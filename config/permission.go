@@ -6,7 +6,13 @@ package config
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
 	"time"
+
+	"github.com/kevinburke/rest"
+	yaml "gopkg.in/yaml.v2"
 )
 
 type Group struct {
@@ -14,6 +20,118 @@ type Group struct {
 	Name        string        `yaml:"name"`
 	Default     bool          `yaml:"default,omitempty"`
 	Users       []string      `yaml:"users"`
+	// Sids of the Twilio accounts this group can view. If empty, the group
+	// can view every configured account.
+	Accounts []string `yaml:"accounts,omitempty"`
+	// Restricts the group to messages and calls involving particular phone
+	// numbers or messaging services. If nil, the group can view all messages
+	// and calls.
+	Scope *Scope `yaml:"scope,omitempty"`
+	// Subnets the group's users can sign in from. If empty, users can sign
+	// in from anywhere (subject to the global ip_subnets setting).
+	IPSubnets []string `yaml:"ip_subnets,omitempty"`
+	// If set, the group's users can only use the site during these hours.
+	AllowedHours *AllowedHours `yaml:"allowed_hours,omitempty"`
+	// If true, the group's users have to set up two-factor authentication
+	// before they can use the site. Only supported for Basic Auth users who
+	// log in with the login form.
+	RequireMFA bool `yaml:"require_mfa,omitempty"`
+	// If set, the group's users can temporarily give themselves extra
+	// permissions in an emergency.
+	BreakGlass *BreakGlass `yaml:"break_glass,omitempty"`
+	// If set, limits how often the group's users can load pages, instead of
+	// the global user_rate_limit.
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty"`
+}
+
+// A Scope restricts a user to messages and calls that involve particular
+// phone numbers or messaging services. A resource is visible if any of its
+// phone numbers or its messaging service matches.
+type Scope struct {
+	// Phone numbers in E.164 format, for example "+14105551234".
+	PhoneNumbers []string `yaml:"phone_numbers,omitempty"`
+	// Phone number prefixes, for example "+1415" for all San Francisco
+	// numbers.
+	PhoneNumberPrefixes []string `yaml:"phone_number_prefixes,omitempty"`
+	// Sids of messaging services; messages sent through these services are
+	// visible.
+	MessagingServiceSids []string `yaml:"messaging_service_sids,omitempty"`
+}
+
+func (s *Scope) empty() bool {
+	return s == nil || len(s.PhoneNumbers) == 0 && len(s.PhoneNumberPrefixes) == 0 && len(s.MessagingServiceSids) == 0
+}
+
+// Matches returns true if the messaging service sid or any of the given
+// phone numbers is in the scope. Numbers that aren't in E.164 format, like
+// "client:alice", never match.
+func (s *Scope) Matches(messagingServiceSid string, numbers ...string) bool {
+	if messagingServiceSid != "" {
+		for _, sid := range s.MessagingServiceSids {
+			if sid == messagingServiceSid {
+				return true
+			}
+		}
+	}
+	for _, num := range numbers {
+		if !e164Rx.MatchString(num) {
+			continue
+		}
+		for _, pn := range s.PhoneNumbers {
+			if pn == num {
+				return true
+			}
+		}
+		for _, pfx := range s.PhoneNumberPrefixes {
+			if strings.HasPrefix(num, pfx) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var e164Rx = regexp.MustCompile(`^\+[0-9]+$`)
+var messagingServiceSidRx = regexp.MustCompile("^MG[a-f0-9]{32}$")
+
+func validateScope(s *Scope) error {
+	if s == nil {
+		return nil
+	}
+	if s.empty() {
+		return errors.New("scope is defined but lists no phone numbers, prefixes or messaging services")
+	}
+	for _, pn := range s.PhoneNumbers {
+		if !e164Rx.MatchString(pn) {
+			return fmt.Errorf("phone number %q is not in E.164 format (e.g. +14105551234)", pn)
+		}
+	}
+	for _, pfx := range s.PhoneNumberPrefixes {
+		if !e164Rx.MatchString(pfx) {
+			return fmt.Errorf("phone number prefix %q should be a plus sign followed by digits (e.g. +1415)", pfx)
+		}
+	}
+	for _, sid := range s.MessagingServiceSids {
+		if !messagingServiceSidRx.MatchString(sid) {
+			return fmt.Errorf("invalid messaging service sid: %s", sid)
+		}
+	}
+	return nil
+}
+
+// user returns a User with the group's permissions.
+func (g *Group) user() *User {
+	u := NewUser(g.Permissions)
+	u.group = g.Name
+	u.accounts = g.Accounts
+	u.scope = g.Scope
+	// Errors are caught by validatePolicy.
+	u.ipSubnets, _ = parseSubnets(g.IPSubnets)
+	u.hours, _ = g.AllowedHours.parse()
+	u.requireMFA = g.RequireMFA
+	u.breakGlass = g.BreakGlass
+	u.rateLimit = g.RateLimit
+	return u
 }
 
 type PolicyPolicy struct {
@@ -52,6 +170,22 @@ func (p *Policy) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// LoadPolicy reads the policy file at path, and checks that it's valid.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(Policy)
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	if err := validatePolicy(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
 // Lookup finds the User with the given id. If no user with that name is found,
 // but a default group is defined, a user from that group is returned. The
 // boolean is true if a user was found directly by id. Otherwise returns an
@@ -66,7 +200,9 @@ func (p *Policy) Lookup(id string) (*User, bool, error) {
 	for _, group := range *p {
 		for _, user := range group.Users {
 			if user == id {
-				return NewUser(group.Permissions), true, nil
+				u := group.user()
+				u.id = id
+				return u, true, nil
 			}
 		}
 		if group.Default == true {
@@ -74,11 +210,48 @@ func (p *Policy) Lookup(id string) (*User, bool, error) {
 		}
 	}
 	if defaultGroup != nil {
-		return NewUser(defaultGroup.Permissions), false, nil
+		u := defaultGroup.user()
+		u.id = id
+		return u, false, nil
 	}
 	return nil, false, fmt.Errorf("User %s not found in the policy, and no default configured", id)
 }
 
+// lookupWithGroups finds the User with the given id. If the id isn't listed
+// in any group, the first of groups that names a policy group is used, and
+// then the default group.
+func (p *Policy) lookupWithGroups(id string, groups []string) (*User, error) {
+	u, found, err := p.Lookup(id)
+	if found {
+		return u, nil
+	}
+	for _, name := range groups {
+		for _, group := range *p {
+			if group.Name == name {
+				u := group.user()
+				u.id = id
+				return u, nil
+			}
+		}
+	}
+	return u, err
+}
+
+// DefaultGroupUser returns a User in the policy's default group, which is
+// used for anyone who isn't listed in a group. The boolean is false if the
+// policy doesn't have a default group.
+func (p *Policy) DefaultGroupUser() (*User, bool) {
+	if p == nil {
+		return nil, false
+	}
+	for _, group := range *p {
+		if group.Default {
+			return group.user(), true
+		}
+	}
+	return nil, false
+}
+
 // Users returns a map of all Users defined in the policy. Users assumes the
 // Policy is valid.
 func (p *Policy) Users() map[string]*User {
@@ -88,7 +261,7 @@ func (p *Policy) Users() map[string]*User {
 	}
 	for _, group := range *p {
 		for _, user := range group.Users {
-			users[user] = NewUser(group.Permissions)
+			users[user] = group.user()
 		}
 	}
 	return users
@@ -96,6 +269,11 @@ func (p *Policy) Users() map[string]*User {
 
 type Permission struct {
 	maxResourceAge time.Duration
+	minResourceAge time.Duration
+	// Used to derive pseudonyms for masked phone numbers.
+	pseudonymKey *[32]byte
+	// Redacted from message bodies for users with RedactMessageBodies set.
+	redactionPatterns []*regexp.Regexp
 }
 
 func validatePolicy(p *Policy) error {
@@ -127,18 +305,75 @@ func validatePolicy(p *Policy) error {
 			}
 			users[user] = true
 		}
+		for _, sid := range group.Accounts {
+			if !accountSidRx.MatchString(sid) {
+				return fmt.Errorf("Group %s has an invalid account sid: %s", group.Name, sid)
+			}
+		}
+		if err := validateScope(group.Scope); err != nil {
+			return fmt.Errorf("Group %s has an invalid scope: %v", group.Name, err)
+		}
+		if err := validateAccess(group); err != nil {
+			return err
+		}
+		if err := validateBreakGlass(group); err != nil {
+			return err
+		}
+		if err := validateResourceAges(group); err != nil {
+			return err
+		}
+		if err := validateRateLimit(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateResourceAges(g *Group) error {
+	us := g.Permissions
+	if us == nil {
+		return nil
+	}
+	if us.MinResourceAge < 0 {
+		return fmt.Errorf("Group %s has a negative min_resource_age", g.Name)
+	}
+	if us.MinResourceAge > 0 && us.MaxResourceAge > 0 && us.MinResourceAge >= us.MaxResourceAge {
+		return fmt.Errorf("Group %s has a min_resource_age (%s) that isn't less than its max_resource_age (%s), so it can't see anything", g.Name, us.MinResourceAge, us.MaxResourceAge)
 	}
 	return nil
 }
 
 // ErrTooOld is returned for a resource that's more than MaxResourceAge old.
 var ErrTooOld = errors.New("Cannot access this resource because its age exceeds the viewable limit")
+
+// ErrTooNew is returned for a resource that's less than MinResourceAge old.
+var ErrTooNew = errors.New("Cannot access this resource because it is too recent")
 var PermissionDenied = errors.New("You do not have permission to access that information")
 
+// ErrOutOfScope is returned for a resource outside of the user's Scope. It
+// looks the same as the error for a resource that doesn't exist, so users
+// can't find out that hidden resources exist.
+var ErrOutOfScope = &rest.Error{
+	Title:  "The requested resource was not found",
+	Status: 404,
+}
+
 func (p *Permission) MaxResourceAge() time.Duration {
 	return p.maxResourceAge
 }
 
+// MinResourceAge returns the age resources have to reach before they can be
+// viewed. Zero means new resources can be viewed.
+func (p *Permission) MinResourceAge() time.Duration {
+	return p.minResourceAge
+}
+
+// SetMinResourceAge hides resources that are newer than age, for users who
+// don't set their own min_resource_age.
+func (p *Permission) SetMinResourceAge(age time.Duration) {
+	p.minResourceAge = age
+}
+
 func NewPermission(maxResourceAge time.Duration) *Permission {
 	return &Permission{
 		maxResourceAge: maxResourceAge,
@@ -3,6 +3,7 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -138,6 +139,21 @@ var policyTests = []struct {
 		&Group{Name: "1", Default: true, Users: []string{"foo"}},
 		&Group{Name: "2", Default: false, Users: []string{"two"}},
 	}, err: ""},
+	{p: &Policy{
+		&Group{Name: "analysts", Users: []string{"foo"}, Permissions: &UserSettings{
+			MinResourceAge: 48 * time.Hour,
+			MaxResourceAge: 24 * time.Hour,
+		}},
+	},
+		err: "Group analysts has a min_resource_age (48h0m0s) that isn't less than its max_resource_age (24h0m0s), so it can't see anything"},
+	{p: &Policy{
+		&Group{Name: "scripts", Users: []string{"foo"}, RateLimit: &RateLimit{Rate: 0}},
+	},
+		err: "Group scripts has an invalid rate_limit: rate must be a positive number, got 0"},
+	{p: &Policy{
+		&Group{Name: "scripts", Users: []string{"foo"}, RateLimit: &RateLimit{Rate: 1, Burst: -1}},
+	},
+		err: "Group scripts has an invalid rate_limit: burst must be positive, got -1"},
 }
 
 func TestValidatePolicy(t *testing.T) {
@@ -158,3 +174,84 @@ func TestValidatePolicy(t *testing.T) {
 		}
 	}
 }
+
+var accountsPolicy = []byte(`
+- name: support
+  accounts:
+    - AC58f1e8f2b1c6b88ca90a012a4be0c279
+  users:
+    - test@example.com
+- name: eng
+  users:
+    - eng@example.com
+`)
+
+func TestGroupAccounts(t *testing.T) {
+	t.Parallel()
+	var p Policy
+	if err := yaml.Unmarshal(accountsPolicy, &p); err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePolicy(&p); err != nil {
+		t.Fatal(err)
+	}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.CanViewAccount("AC58f1e8f2b1c6b88ca90a012a4be0c279") {
+		t.Error("expected support user to view their subaccount")
+	}
+	if u.CanViewAccount("AC8bcd23dbb4ac9ea4aac7a9bde1b9d4d8") {
+		t.Error("expected support user to be unable to view another account")
+	}
+	eng, _, err := p.Lookup("eng@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eng.CanViewAccount("AC8bcd23dbb4ac9ea4aac7a9bde1b9d4d8") {
+		t.Error("expected group without accounts to view every account")
+	}
+}
+
+func TestInvalidGroupAccountRejected(t *testing.T) {
+	t.Parallel()
+	p := &Policy{
+		&Group{Name: "support", Accounts: []string{"AC123"}},
+	}
+	err := validatePolicy(p)
+	if err == nil {
+		t.Fatal("expected validatePolicy to error, got nil")
+	}
+	if !strings.Contains(err.Error(), "invalid account sid") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestScopeMatches(t *testing.T) {
+	t.Parallel()
+	s := &Scope{
+		PhoneNumbers:        []string{"+14105551234"},
+		PhoneNumberPrefixes: []string{"+1415"},
+	}
+	tests := []struct {
+		numbers []string
+		want    bool
+	}{
+		{[]string{"+14105551234"}, true},
+		{[]string{"+19253920364", "+14155550000"}, true},
+		{[]string{"+19253920364"}, false},
+		{[]string{"client:+1415"}, false},
+	}
+	for _, tt := range tests {
+		if got := s.Matches("", tt.numbers...); got != tt.want {
+			t.Errorf("Matches(%v): got %t, want %t", tt.numbers, got, tt.want)
+		}
+	}
+	if err := validateScope(&Scope{PhoneNumbers: []string{"410-555-1234"}}); err == nil {
+		t.Error("expected invalid phone number to be rejected")
+	}
+	if err := validateScope(&Scope{}); err == nil {
+		t.Error("expected empty scope to be rejected")
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"math"
+)
+
+// A RateLimit is a token bucket: requests are allowed at Rate per second on
+// average, in bursts of up to Burst requests.
+type RateLimit struct {
+	// Requests per second. Use a fraction for limits slower than one request
+	// a second, for example 0.5 for one request every two seconds.
+	Rate float64 `yaml:"rate"`
+	// The most requests allowed at once. Defaults to Rate, rounded up.
+	Burst int `yaml:"burst,omitempty"`
+}
+
+func (rl *RateLimit) validate() error {
+	if rl == nil {
+		return nil
+	}
+	if rl.Rate <= 0 || math.IsInf(rl.Rate, 0) || math.IsNaN(rl.Rate) {
+		return fmt.Errorf("rate must be a positive number, got %v", rl.Rate)
+	}
+	if rl.Burst < 0 {
+		return fmt.Errorf("burst must be positive, got %d", rl.Burst)
+	}
+	return nil
+}
+
+// BurstSize returns the most requests allowed at once.
+func (rl *RateLimit) BurstSize() int {
+	if rl.Burst > 0 {
+		return rl.Burst
+	}
+	return int(math.Ceil(rl.Rate))
+}
+
+func (rl *RateLimit) String() string {
+	return fmt.Sprintf("%v/s, burst %d", rl.Rate, rl.BurstSize())
+}
+
+func validateRateLimit(g *Group) error {
+	if err := g.RateLimit.validate(); err != nil {
+		return fmt.Errorf("Group %s has an invalid rate_limit: %v", g.Name, err)
+	}
+	return nil
+}
+
+// RateLimit returns the rate limit for the user's group, or nil if the group
+// doesn't set one.
+func (u *User) RateLimit() *RateLimit {
+	return u.rateLimit
+}
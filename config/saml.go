@@ -0,0 +1,599 @@
+package config
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// The paths of the SAML endpoints. Give the metadata URL to your identity
+// provider.
+const (
+	SAMLMetadataPath = "/auth/saml/metadata"
+	SAMLACSPath      = "/auth/saml/acs"
+)
+
+const (
+	samlProtocolNS  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	samlRedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlPOSTBinding     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer          = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// How far apart our clock and the identity provider's clock can be.
+const samlClockSkew = 3 * time.Minute
+
+// IdPMetadata is the information we need about a SAML identity provider.
+type IdPMetadata struct {
+	EntityID string
+	// Where to send users to log in, with the HTTP-Redirect binding.
+	SSOURL string
+	// Certificates the identity provider signs responses with.
+	Certificates []*x509.Certificate
+}
+
+type idpEntityDescriptor struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	IDPSSO   []struct {
+		KeyDescriptors []struct {
+			Use          string   `xml:"use,attr"`
+			Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+		} `xml:"KeyDescriptor"`
+		SSOServices []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"SingleSignOnService"`
+	} `xml:"IDPSSODescriptor"`
+}
+
+var whitespaceRx = regexp.MustCompile(`\s+`)
+
+// ParseIdPMetadata parses the metadata XML your identity provider publishes
+// for logrole. The metadata must contain a single EntityDescriptor with an
+// IDPSSODescriptor.
+func ParseIdPMetadata(data []byte) (*IdPMetadata, error) {
+	var ed idpEntityDescriptor
+	if err := xml.Unmarshal(data, &ed); err != nil {
+		return nil, fmt.Errorf("Couldn't parse IdP metadata: %v", err)
+	}
+	if len(ed.IDPSSO) == 0 {
+		return nil, errors.New("IdP metadata has no IDPSSODescriptor")
+	}
+	md := &IdPMetadata{EntityID: ed.EntityID}
+	for _, desc := range ed.IDPSSO {
+		for _, svc := range desc.SSOServices {
+			if svc.Binding == samlRedirectBinding && md.SSOURL == "" {
+				md.SSOURL = svc.Location
+			}
+		}
+		for _, kd := range desc.KeyDescriptors {
+			if kd.Use != "" && kd.Use != "signing" {
+				continue
+			}
+			for _, c := range kd.Certificates {
+				der, err := base64.StdEncoding.DecodeString(whitespaceRx.ReplaceAllString(c, ""))
+				if err != nil {
+					return nil, fmt.Errorf("Couldn't decode IdP certificate: %v", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("Couldn't parse IdP certificate: %v", err)
+				}
+				md.Certificates = append(md.Certificates, cert)
+			}
+		}
+	}
+	if md.SSOURL == "" {
+		return nil, errors.New("IdP metadata has no SingleSignOnService with the HTTP-Redirect binding")
+	}
+	if len(md.Certificates) == 0 {
+		return nil, errors.New("IdP metadata has no signing certificates")
+	}
+	return md, nil
+}
+
+// LoadIdPMetadata reads IdP metadata from the file at path.
+func LoadIdPMetadata(path string) (*IdPMetadata, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIdPMetadata(data)
+}
+
+// SAMLAuthenticator logs users in with a SAML 2.0 identity provider (Okta,
+// OneLogin, ADFS, etc). Logrole is the service provider: users are sent to
+// the identity provider with the HTTP-Redirect binding, and it posts a
+// signed assertion back to SAMLACSPath. After that, logins work the same as
+// with GoogleAuthenticator.
+//
+// Users are looked up in the policy by their NameID, or the UserAttribute if
+// it's set. If they aren't listed in a group, the first value of the
+// GroupsAttribute that names a policy group is used, and then the default
+// group. If no Policy has been set, DefaultUser is returned for all users.
+type SAMLAuthenticator struct {
+	log.Logger
+	AllowUnencryptedTraffic bool
+	// Our entity ID. Defaults to the URL of the metadata endpoint.
+	EntityID string
+	// The attribute containing the user's id. If empty, the assertion's
+	// NameID is used.
+	UserAttribute string
+	// The attribute containing the names of the user's groups, if any.
+	GroupsAttribute string
+	// See GoogleAuthenticator.
+	Sessions           SessionStore
+	SessionMaxAge      time.Duration
+	SessionIdleTimeout time.Duration
+
+	idp       *IdPMetadata
+	baseURL   string
+	secretKey *[32]byte
+	policy    *Policy
+	mu        sync.Mutex
+	// Assertion IDs we've accepted, and when they expire; an assertion can
+	// only be used once.
+	seen map[string]time.Time
+	// Used in tests.
+	now func() time.Time
+}
+
+// NewSAMLAuthenticator creates a SAMLAuthenticator for the site at baseURL
+// (like "https://logrole.example.com") that logs users in with idp.
+func NewSAMLAuthenticator(logger log.Logger, idp *IdPMetadata, baseURL string, secretKey *[32]byte) *SAMLAuthenticator {
+	return &SAMLAuthenticator{
+		Logger:    logger,
+		EntityID:  baseURL + SAMLMetadataPath,
+		idp:       idp,
+		baseURL:   baseURL,
+		secretKey: secretKey,
+		seen:      make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+func (s *SAMLAuthenticator) SetPolicy(p *Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+}
+
+func (s *SAMLAuthenticator) acsURL() string {
+	return s.baseURL + SAMLACSPath
+}
+
+func (s *SAMLAuthenticator) cookies() *loginCookies {
+	return &loginCookies{
+		Logger:      s.Logger,
+		secretKey:   s.secretKey,
+		secure:      s.AllowUnencryptedTraffic == false,
+		sessions:    s.Sessions,
+		maxAge:      s.SessionMaxAge,
+		idleTimeout: s.SessionIdleTimeout,
+	}
+}
+
+type spEntityDescriptor struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	SPSSO    struct {
+		AuthnRequestsSigned        bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned       bool   `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupportEnumeration string `xml:"protocolSupportEnumeration,attr"`
+		ACS                        struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+			Index    int    `xml:"index,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// Metadata returns our service provider metadata.
+func (s *SAMLAuthenticator) Metadata() ([]byte, error) {
+	ed := spEntityDescriptor{EntityID: s.EntityID}
+	ed.SPSSO.WantAssertionsSigned = true
+	ed.SPSSO.ProtocolSupportEnumeration = samlProtocolNS
+	ed.SPSSO.ACS.Binding = samlPOSTBinding
+	ed.SPSSO.ACS.Location = s.acsURL()
+	ed.SPSSO.ACS.Index = 1
+	b, err := xml.MarshalIndent(ed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      struct {
+		XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+}
+
+func newSAMLID() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	// IDs can't start with a number.
+	return "id-" + hex.EncodeToString(b)
+}
+
+// URL returns the identity provider URL that starts a login, using the
+// HTTP-Redirect binding.
+func (s *SAMLAuthenticator) URL(w http.ResponseWriter, r *http.Request) string {
+	req := authnRequest{
+		ID:                          newSAMLID(),
+		Version:                     "2.0",
+		IssueInstant:                s.now().UTC().Format(time.RFC3339),
+		Destination:                 s.idp.SSOURL,
+		AssertionConsumerServiceURL: s.acsURL(),
+		ProtocolBinding:             samlPOSTBinding,
+	}
+	req.Issuer.Value = s.EntityID
+	body, err := xml.Marshal(req)
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	fw, _ := flate.NewWriter(buf, flate.DefaultCompression)
+	fw.Write(body)
+	fw.Close()
+	st := newState(r)
+	st.RequestID = req.ID
+	relayState, err := encodeState(st, s.secretKey)
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return ""
+	}
+	q := url.Values{}
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	q.Set("RelayState", relayState)
+	sep := "?"
+	if strings.Contains(s.idp.SSOURL, "?") {
+		sep = "&"
+	}
+	return s.idp.SSOURL + sep + q.Encode()
+}
+
+type samlResponse struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		Code struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+}
+
+type samlAssertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Issuer  string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID        string `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		Confirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				InResponseTo string    `xml:"InResponseTo,attr"`
+				Recipient    string    `xml:"Recipient,attr"`
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *struct {
+		NotBefore    time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+		Audiences    []string  `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction>Audience"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	Attributes []struct {
+		Name         string   `xml:"Name,attr"`
+		FriendlyName string   `xml:"FriendlyName,attr"`
+		Values       []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement>Attribute"`
+}
+
+// attribute returns the values of the attribute with the given Name or
+// FriendlyName.
+func (a *samlAssertion) attribute(name string) []string {
+	for _, attr := range a.Attributes {
+		if attr.Name == name || attr.FriendlyName == name {
+			return attr.Values
+		}
+	}
+	return nil
+}
+
+func unmarshalElement(el *etree.Element, v interface{}) error {
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+	b, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(b, v)
+}
+
+// verifiedAssertion finds the assertion in a SAML response and checks its
+// signature. Either the assertion or the whole response must be signed by
+// the identity provider. Only the signed XML is returned, so nothing added
+// to the response after it was signed can affect the result.
+func (s *SAMLAuthenticator) verifiedAssertion(root *etree.Element) (*etree.Element, error) {
+	var assertions int
+	var assertion *etree.Element
+	err := etreeutils.NSFindIterate(root, samlAssertionNS, "Assertion", func(ctx etreeutils.NSContext, el *etree.Element) error {
+		assertions++
+		var err error
+		assertion, err = etreeutils.NSDetatch(ctx, el)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if assertions != 1 {
+		if enc, _ := etreeutils.NSFindOne(root, samlAssertionNS, "EncryptedAssertion"); enc != nil {
+			return nil, errors.New("Encrypted assertions are not supported")
+		}
+		return nil, fmt.Errorf("Expected one assertion in the SAML response, got %d", assertions)
+	}
+	vctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: s.idp.Certificates})
+	vctx.Clock = dsig.NewFakeClockAt(s.now())
+	signed, err := vctx.Validate(assertion)
+	if err == nil {
+		return signed, nil
+	}
+	if err != dsig.ErrMissingSignature {
+		return nil, fmt.Errorf("Invalid assertion signature: %v", err)
+	}
+	// The assertion isn't signed, so the response must be.
+	signedResponse, err := vctx.Validate(root)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid response signature: %v", err)
+	}
+	assertion, err = etreeutils.NSSelectOne(signedResponse, samlAssertionNS, "Assertion")
+	if err != nil {
+		return nil, err
+	}
+	if assertion == nil {
+		return nil, errors.New("No assertion in the signed response")
+	}
+	return assertion, nil
+}
+
+// parseResponse checks a base64 encoded SAML response, which should answer
+// the AuthnRequest with the given ID, and returns the assertion in it.
+func (s *SAMLAuthenticator) parseResponse(encoded string, requestID string) (*samlAssertion, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't decode SAML response: %v", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("Couldn't parse SAML response: %v", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("Empty SAML response")
+	}
+	resp := new(samlResponse)
+	if err := xml.Unmarshal(data, resp); err != nil {
+		return nil, fmt.Errorf("Couldn't parse SAML response: %v", err)
+	}
+	if resp.Status.Code.Value != samlStatusSuccess {
+		return nil, fmt.Errorf("The identity provider couldn't log you in (status %s)", resp.Status.Code.Value)
+	}
+	if resp.Destination != "" && resp.Destination != s.acsURL() {
+		return nil, fmt.Errorf("SAML response was sent to %s, not %s", resp.Destination, s.acsURL())
+	}
+	if resp.InResponseTo != "" && resp.InResponseTo != requestID {
+		return nil, errors.New("SAML response doesn't match the login request")
+	}
+	el, err := s.verifiedAssertion(root)
+	if err != nil {
+		return nil, err
+	}
+	a := new(samlAssertion)
+	if err := unmarshalElement(el, a); err != nil {
+		return nil, fmt.Errorf("Couldn't parse SAML assertion: %v", err)
+	}
+	if err := s.checkAssertion(a, requestID); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// checkAssertion checks that a (signed) assertion was issued by our identity
+// provider, for us, in response to our request, and is valid right now.
+func (s *SAMLAuthenticator) checkAssertion(a *samlAssertion, requestID string) error {
+	now := s.now()
+	if s.idp.EntityID != "" && a.Issuer != s.idp.EntityID {
+		return fmt.Errorf("Assertion was issued by %s, not %s", a.Issuer, s.idp.EntityID)
+	}
+	if a.ID == "" {
+		return errors.New("Assertion has no ID")
+	}
+	if a.Conditions != nil {
+		c := a.Conditions
+		if !c.NotBefore.IsZero() && now.Add(samlClockSkew).Before(c.NotBefore) {
+			return errors.New("Assertion is not valid yet")
+		}
+		if !c.NotOnOrAfter.IsZero() && !now.Add(-samlClockSkew).Before(c.NotOnOrAfter) {
+			return errors.New("Assertion has expired")
+		}
+		if len(c.Audiences) > 0 {
+			found := false
+			for _, aud := range c.Audiences {
+				if aud == s.EntityID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("Assertion is for %s, not %s", strings.Join(c.Audiences, ", "), s.EntityID)
+			}
+		}
+	}
+	var expires time.Time
+	for _, sc := range a.Subject.Confirmations {
+		d := sc.Data
+		if sc.Method != samlBearer || d.Recipient != s.acsURL() || d.InResponseTo != requestID {
+			continue
+		}
+		if d.NotOnOrAfter.IsZero() || !now.Add(-samlClockSkew).Before(d.NotOnOrAfter) {
+			continue
+		}
+		expires = d.NotOnOrAfter
+		break
+	}
+	if expires.IsZero() {
+		return errors.New("Assertion has no valid bearer subject confirmation for this login")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, exp := range s.seen {
+		if now.After(exp.Add(samlClockSkew)) {
+			delete(s.seen, id)
+		}
+	}
+	if _, ok := s.seen[a.ID]; ok {
+		return errors.New("Assertion has already been used")
+	}
+	s.seen[a.ID] = expires
+	return nil
+}
+
+func (s *SAMLAuthenticator) handleACS(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		rest.NotAllowed(w, r)
+		return errors.New("SAML responses must be POSTed")
+	}
+	if err := r.ParseForm(); err != nil {
+		rest.BadRequest(w, r, &rest.Error{Title: err.Error()})
+		return err
+	}
+	st, ok := decodeState(r.PostForm.Get("RelayState"), s.secretKey)
+	if !ok || st.RequestID == "" {
+		// Either an old login, or the identity provider started the login
+		// instead of us; start again.
+		http.Redirect(w, r, "/login", 302)
+		return errors.New("invalid state")
+	}
+	a, err := s.parseResponse(r.PostForm.Get("SAMLResponse"), st.RequestID)
+	if err != nil {
+		s.Warn("Invalid SAML response", "err", err)
+		rerr := &rest.Error{Title: err.Error(), ID: "invalid_saml_response"}
+		rest.Forbidden(w, r, rerr)
+		return rerr
+	}
+	id := a.Subject.NameID
+	if s.UserAttribute != "" {
+		id = ""
+		if vals := a.attribute(s.UserAttribute); len(vals) > 0 {
+			id = strings.TrimSpace(vals[0])
+		}
+	}
+	if id == "" {
+		rerr := &rest.Error{Title: "The identity provider didn't say who you are", ID: "missing_identity"}
+		rest.Forbidden(w, r, rerr)
+		return rerr
+	}
+	var groups []string
+	if s.GroupsAttribute != "" {
+		for _, g := range a.attribute(s.GroupsAttribute) {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+	if _, err := s.lookupUser(id, groups); err != nil {
+		rerr := &rest.Error{Title: err.Error(), ID: "user_not_found"}
+		rest.Forbidden(w, r, rerr)
+		return rerr
+	}
+	cookie, err := s.cookies().newCookie(r, &token{ID: id, Groups: groups})
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return err
+	}
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, st.CurrentURL, 302)
+	return errors.New("redirected, make another request")
+}
+
+func (s *SAMLAuthenticator) lookupUser(id string, groups []string) (*User, error) {
+	s.mu.Lock()
+	policy := s.policy
+	s.mu.Unlock()
+	if policy == nil {
+		return DefaultUser, nil
+	}
+	return policy.lookupWithGroups(id, groups)
+}
+
+func (s *SAMLAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
+	switch r.URL.Path {
+	case SAMLMetadataPath:
+		md, err := s.Metadata()
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return nil, err
+		}
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		w.Write(md)
+		return nil, errors.New("served SAML metadata")
+	case SAMLACSPath:
+		return nil, s.handleACS(w, r)
+	}
+	t, err := s.cookies().authenticate(w, r)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.lookupUser(t.ID, t.Groups)
+	if err != nil {
+		// The user was removed from the policy after they logged in.
+		s.Warn("User not found in policy", "id", t.ID, "err", err)
+		s.cookies().clear(w)
+		return nil, MustLogin
+	}
+	return u, nil
+}
+
+// Logout clears the login cookie, and ends the session if sessions are
+// stored. Users stay logged in to the identity provider.
+func (s *SAMLAuthenticator) Logout(w http.ResponseWriter, r *http.Request) {
+	s.cookies().logout(w, r)
+	http.Redirect(w, r, "/", 302)
+}
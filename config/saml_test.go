@@ -0,0 +1,374 @@
+package config
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/kevinburke/nacl"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const testSPURL = "https://logrole.example.com"
+
+// testIdP is a fixture SAML identity provider.
+type testIdP struct {
+	entityID string
+	cert     *x509.Certificate
+	key      *rsa.PrivateKey
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdP{entityID: "https://idp.example.com/metadata", cert: cert, key: key}
+}
+
+func (idp *testIdP) metadata() []byte {
+	return []byte(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + idp.entityID + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data>
+          <ds:X509Certificate>` + base64.StdEncoding.EncodeToString(idp.cert.Raw) + `</ds:X509Certificate>
+        </ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`)
+}
+
+type assertionOpts struct {
+	nameID       string
+	groups       []string
+	audience     string
+	inResponseTo string
+	expires      time.Time
+	// Sign the response instead of the assertion.
+	signResponse bool
+	unsigned     bool
+}
+
+// response returns a base64 encoded SAML response.
+func (idp *testIdP) response(t *testing.T, o assertionOpts) string {
+	t.Helper()
+	now := time.Now().UTC()
+	if o.expires.IsZero() {
+		o.expires = now.Add(5 * time.Minute)
+	}
+	if o.audience == "" {
+		o.audience = testSPURL + SAMLMetadataPath
+	}
+	var attrs string
+	for _, g := range o.groups {
+		attrs += `<saml:AttributeValue>` + g + `</saml:AttributeValue>`
+	}
+	assertion := fmt.Sprintf(`<saml:Assertion xmlns:saml="%[1]s" ID="%[2]s" Version="2.0" IssueInstant="%[3]s">
+<saml:Issuer>%[4]s</saml:Issuer>
+<saml:Subject>
+  <saml:NameID>%[5]s</saml:NameID>
+  <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+    <saml:SubjectConfirmationData InResponseTo="%[6]s" Recipient="%[7]s" NotOnOrAfter="%[8]s"/>
+  </saml:SubjectConfirmation>
+</saml:Subject>
+<saml:Conditions NotBefore="%[3]s" NotOnOrAfter="%[8]s">
+  <saml:AudienceRestriction><saml:Audience>%[9]s</saml:Audience></saml:AudienceRestriction>
+</saml:Conditions>
+<saml:AttributeStatement>
+  <saml:Attribute Name="groups">%[10]s</saml:Attribute>
+</saml:AttributeStatement>
+</saml:Assertion>`, samlAssertionNS, newSAMLID(), now.Format(time.RFC3339),
+		idp.entityID, o.nameID, o.inResponseTo, testSPURL+SAMLACSPath,
+		o.expires.Format(time.RFC3339), o.audience, attrs)
+	adoc := etree.NewDocument()
+	if err := adoc.ReadFromString(assertion); err != nil {
+		t.Fatal(err)
+	}
+	ctx := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{
+		Certificate: [][]byte{idp.cert.Raw},
+		PrivateKey:  idp.key,
+	}))
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	ael := adoc.Root()
+	if !o.unsigned && !o.signResponse {
+		signed, err := ctx.SignEnveloped(ael)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ael = signed
+	}
+	resp := etree.NewElement("samlp:Response")
+	resp.CreateAttr("xmlns:samlp", samlProtocolNS)
+	resp.CreateAttr("ID", newSAMLID())
+	resp.CreateAttr("Version", "2.0")
+	resp.CreateAttr("InResponseTo", o.inResponseTo)
+	resp.CreateAttr("Destination", testSPURL+SAMLACSPath)
+	status := resp.CreateElement("samlp:Status").CreateElement("samlp:StatusCode")
+	status.CreateAttr("Value", samlStatusSuccess)
+	resp.AddChild(ael)
+	if o.signResponse {
+		signed, err := ctx.SignEnveloped(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp = signed
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(resp)
+	b, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func newTestSAMLAuthenticator(t *testing.T, idp *testIdP) *SAMLAuthenticator {
+	t.Helper()
+	md, err := ParseIdPMetadata(idp.metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewSAMLAuthenticator(NullLogger, md, testSPURL, nacl.NewKey())
+	a.GroupsAttribute = "groups"
+	return a
+}
+
+// startLogin returns the AuthnRequest ID and RelayState for a login that
+// started at path.
+func startLogin(t *testing.T, a *SAMLAuthenticator, path string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	u, err := url.Parse(a.URL(httptest.NewRecorder(), req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "idp.example.com" || u.Path != "/sso" {
+		t.Fatalf("expected a redirect to the IdP, got %s", u)
+	}
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ar authnRequest
+	if err := xml.Unmarshal(body, &ar); err != nil {
+		t.Fatal(err)
+	}
+	if ar.AssertionConsumerServiceURL != testSPURL+SAMLACSPath {
+		t.Errorf("wrong ACS URL: %s", ar.AssertionConsumerServiceURL)
+	}
+	return ar.ID, u.Query().Get("RelayState")
+}
+
+func postResponse(a *SAMLAuthenticator, response, relayState string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	form.Set("SAMLResponse", response)
+	form.Set("RelayState", relayState)
+	req := httptest.NewRequest("POST", SAMLACSPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	a.Authenticate(w, req)
+	return w
+}
+
+func TestSAMLLogin(t *testing.T) {
+	t.Parallel()
+	idp := newTestIdP(t)
+	a := newTestSAMLAuthenticator(t, idp)
+	a.SetPolicy(&Policy{
+		&Group{Name: "support", Permissions: &UserSettings{CanViewCalls: true}},
+		&Group{Name: "eng", Permissions: AllUserSettings()},
+	})
+	id, relayState := startLogin(t, a, "/calls")
+	w := postResponse(a, idp.response(t, assertionOpts{
+		nameID:       "alice@example.com",
+		groups:       []string{"unknown", "support"},
+		inResponseTo: id,
+	}), relayState)
+	if w.Code != 302 {
+		t.Fatalf("expected a 302, got %d: %s", w.Code, w.Body.String())
+	}
+	if loc := w.Header().Get("Location"); loc != "/calls" {
+		t.Errorf("expected redirect to /calls, got %s", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a login cookie, got %v", cookies)
+	}
+	req := httptest.NewRequest("GET", "/calls", nil)
+	req.AddCookie(cookies[0])
+	u, err := a.Authenticate(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Group() != "support" {
+		t.Errorf("expected user in the support group, got %q", u.Group())
+	}
+}
+
+func TestSAMLSignedResponse(t *testing.T) {
+	t.Parallel()
+	idp := newTestIdP(t)
+	a := newTestSAMLAuthenticator(t, idp)
+	id, relayState := startLogin(t, a, "/")
+	w := postResponse(a, idp.response(t, assertionOpts{
+		nameID:       "alice@example.com",
+		inResponseTo: id,
+		signResponse: true,
+	}), relayState)
+	if w.Code != 302 {
+		t.Fatalf("expected a 302, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSAMLRejectsReplay(t *testing.T) {
+	t.Parallel()
+	idp := newTestIdP(t)
+	a := newTestSAMLAuthenticator(t, idp)
+	id, relayState := startLogin(t, a, "/")
+	resp := idp.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: id})
+	if w := postResponse(a, resp, relayState); w.Code != 302 {
+		t.Fatalf("expected a 302, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postResponse(a, resp, relayState); w.Code != 403 {
+		t.Errorf("expected a replayed assertion to get a 403, got %d", w.Code)
+	}
+}
+
+func TestSAMLRejectsInvalidResponses(t *testing.T) {
+	t.Parallel()
+	idp := newTestIdP(t)
+	other := newTestIdP(t)
+	a := newTestSAMLAuthenticator(t, idp)
+	tests := []struct {
+		name string
+		resp func(id string) string
+	}{
+		{"unsigned", func(id string) string {
+			return idp.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: id, unsigned: true})
+		}},
+		{"signed by another IdP", func(id string) string {
+			other.entityID = idp.entityID
+			return other.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: id})
+		}},
+		{"wrong audience", func(id string) string {
+			return idp.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: id, audience: "https://other.example.com"})
+		}},
+		{"expired", func(id string) string {
+			return idp.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: id, expires: time.Now().Add(-time.Hour)})
+		}},
+		{"different request", func(id string) string {
+			return idp.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: "id-other"})
+		}},
+		{"tampered", func(id string) string {
+			b, _ := base64.StdEncoding.DecodeString(idp.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: id}))
+			b = bytes.Replace(b, []byte("alice@example.com"), []byte("admin@example.com"), 1)
+			return base64.StdEncoding.EncodeToString(b)
+		}},
+	}
+	for _, tt := range tests {
+		id, relayState := startLogin(t, a, "/")
+		w := postResponse(a, tt.resp(id), relayState)
+		if w.Code != 403 {
+			t.Errorf("%s: expected a 403, got %d", tt.name, w.Code)
+		}
+	}
+}
+
+func TestSAMLRejectsWrappedAssertion(t *testing.T) {
+	t.Parallel()
+	idp := newTestIdP(t)
+	a := newTestSAMLAuthenticator(t, idp)
+	id, relayState := startLogin(t, a, "/")
+	b, err := base64.StdEncoding.DecodeString(idp.response(t, assertionOpts{nameID: "alice@example.com", inResponseTo: id}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(b); err != nil {
+		t.Fatal(err)
+	}
+	resp := doc.Root()
+	signed := resp.SelectElement("Assertion")
+	if signed == nil {
+		t.Fatal("response has no assertion")
+	}
+	// The attacker copies the signed assertion, drops the signature, swaps
+	// in their own NameID and hides the original assertion inside it.
+	outer := signed.Copy()
+	outer.RemoveChild(outer.SelectElement("Signature"))
+	outer.FindElement("./Subject/NameID").SetText("admin@example.com")
+	outer.CreateElement("saml:Advice").AddChild(signed)
+	resp.AddChild(outer)
+
+	vctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: []*x509.Certificate{idp.cert},
+	})
+	if _, err := vctx.Validate(outer); err == nil {
+		t.Fatal("validated an assertion whose signature belongs to a nested element")
+	}
+	b, err = doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := postResponse(a, base64.StdEncoding.EncodeToString(b), relayState); w.Code != 403 {
+		t.Errorf("expected a wrapped assertion to get a 403, got %d", w.Code)
+	}
+}
+
+func TestSAMLMetadata(t *testing.T) {
+	t.Parallel()
+	a := newTestSAMLAuthenticator(t, newTestIdP(t))
+	req := httptest.NewRequest("GET", SAMLMetadataPath, nil)
+	w := httptest.NewRecorder()
+	a.Authenticate(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `entityID="`+testSPURL+SAMLMetadataPath+`"`) {
+		t.Errorf("expected metadata to contain our entity ID, got %s", body)
+	}
+	if !strings.Contains(body, `Location="`+testSPURL+SAMLACSPath+`"`) {
+		t.Errorf("expected metadata to contain the ACS URL, got %s", body)
+	}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSessionMaxAge is how long a login lasts, if no other value is
+// configured.
+const DefaultSessionMaxAge = 14 * 24 * time.Hour
+
+// How often to record that a session is still in use. Writing on every
+// request would be wasteful, especially for the file store.
+const sessionTouchInterval = time.Minute
+
+// A Session is a login that can be revoked before it expires.
+type Session struct {
+	// A random identifier, stored in the user's (encrypted) login cookie.
+	ID string `json:"id"`
+	// The user's email address or other identifier.
+	UserID    string    `json:"user_id"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+	// The session ends at Expires, no matter how often it's used.
+	Expires time.Time `json:"expires"`
+	// If nonzero, the session ends if it isn't used for this long.
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+}
+
+// Expired reports whether the session is no longer valid at now.
+func (s *Session) Expired(now time.Time) bool {
+	if !now.Before(s.Expires) {
+		return true
+	}
+	return s.IdleTimeout > 0 && now.Sub(s.LastSeen) >= s.IdleTimeout
+}
+
+// newSessionID returns a random session identifier.
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+var ErrSessionNotFound = errors.New("Session not found")
+
+// SessionStore holds login sessions on the server, so they can be listed and
+// revoked. Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Get returns the session with the given ID, or ErrSessionNotFound if it
+	// doesn't exist or has expired.
+	Get(id string) (*Session, error)
+	// Put creates or replaces a session.
+	Put(s *Session) error
+	// Delete removes the session with the given ID. Deleting a session that
+	// doesn't exist is not an error.
+	Delete(id string) error
+	// List returns the unexpired sessions, ordered by user and then by the
+	// most recently used.
+	List() ([]*Session, error)
+}
+
+// MemorySessionStore keeps sessions in memory. Everyone has to log in again
+// when the server restarts.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	// Used in tests.
+	now func() time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*Session),
+		now:      time.Now,
+	}
+}
+
+func (m *MemorySessionStore) Get(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.Expired(m.now()) {
+		return nil, ErrSessionNotFound
+	}
+	sess := *s
+	return &sess, nil
+}
+
+func (m *MemorySessionStore) Put(s *Session) error {
+	sess := *s
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = &sess
+	m.pruneLocked()
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemorySessionStore) List() ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sess := *s
+		sessions = append(sessions, &sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].UserID != sessions[j].UserID {
+			return sessions[i].UserID < sessions[j].UserID
+		}
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+// pruneLocked removes expired sessions. Call it with m.mu held.
+func (m *MemorySessionStore) pruneLocked() {
+	now := m.now()
+	for id, s := range m.sessions {
+		if s.Expired(now) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// FileSessionStore keeps sessions in memory and saves them to a JSON file
+// after every change, so they survive restarts. Only one server should use
+// a given file.
+type FileSessionStore struct {
+	path string
+	// Guards writes to the file; the memory store has its own lock.
+	mu  sync.Mutex
+	mem *MemorySessionStore
+}
+
+// NewFileSessionStore loads the sessions saved at path. The file is created
+// the first time a session is saved.
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	f := &FileSessionStore{path: path, mem: NewMemorySessionStore()}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range sessions {
+		f.mem.sessions[s.ID] = s
+	}
+	f.mem.pruneLocked()
+	return f, nil
+}
+
+func (f *FileSessionStore) Get(id string) (*Session, error) {
+	return f.mem.Get(id)
+}
+
+func (f *FileSessionStore) Put(s *Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mem.Put(s)
+	return f.save()
+}
+
+func (f *FileSessionStore) Delete(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mem.Delete(id)
+	return f.save()
+}
+
+func (f *FileSessionStore) List() ([]*Session, error) {
+	return f.mem.List()
+}
+
+// save writes every session to the file. Call it with f.mu held.
+func (f *FileSessionStore) save() error {
+	sessions, _ := f.mem.List()
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, ".logrole-sessions-", data)
+}
+
+// writeFileAtomic writes data to a temporary file that only the owner can
+// read, and renames it over the file at path, so readers never see a
+// partially written file.
+func writeFileAtomic(path string, prefix string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), prefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/nacl"
+)
+
+func TestSessionExpired(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &Session{
+		LastSeen:    now,
+		Expires:     now.Add(24 * time.Hour),
+		IdleTimeout: time.Hour,
+	}
+	if s.Expired(now.Add(59 * time.Minute)) {
+		t.Error("session should be valid before the idle timeout")
+	}
+	if !s.Expired(now.Add(time.Hour)) {
+		t.Error("session should expire after the idle timeout")
+	}
+	s.IdleTimeout = 0
+	if s.Expired(now.Add(23 * time.Hour)) {
+		t.Error("session without an idle timeout should be valid until it expires")
+	}
+	if !s.Expired(now.Add(24 * time.Hour)) {
+		t.Error("session should expire at Expires")
+	}
+}
+
+func TestMemorySessionStorePrunesExpired(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemorySessionStore()
+	m.now = func() time.Time { return now }
+	m.Put(&Session{ID: "old", UserID: "a", LastSeen: now, Expires: now.Add(-time.Second)})
+	m.Put(&Session{ID: "new", UserID: "a", LastSeen: now, Expires: now.Add(time.Hour)})
+	if _, err := m.Get("old"); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+	sessions, _ := m.List()
+	if len(sessions) != 1 || sessions[0].ID != "new" {
+		t.Errorf("expected only the new session, got %v", sessions)
+	}
+}
+
+func TestFileSessionStoreSurvivesRestart(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-sessions-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sessions.json")
+	f, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	if err := f.Put(&Session{ID: "1", UserID: "a@example.com", LastSeen: now, Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Put(&Session{ID: "2", UserID: "b@example.com", LastSeen: now, Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete("2"); err != nil {
+		t.Fatal(err)
+	}
+	f2, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := f2.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UserID != "a@example.com" {
+		t.Errorf("expected a@example.com, got %s", s.UserID)
+	}
+	if _, err := f2.Get("2"); err != ErrSessionNotFound {
+		t.Errorf("expected deleted session to stay deleted, got %v", err)
+	}
+}
+
+func TestRevokedSessionMustLogin(t *testing.T) {
+	t.Parallel()
+	a := NewGoogleAuthenticator(NullLogger, "", "", "http://localhost", nil, nacl.NewKey())
+	a.Sessions = NewMemorySessionStore()
+	req, _ := http.NewRequest("GET", "/", nil)
+	cookie, err := a.cookies().newCookie(req, &token{ID: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(cookie)
+	if _, err := a.Authenticate(httptest.NewRecorder(), req); err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ := a.Sessions.List()
+	if len(sessions) != 1 || sessions[0].UserID != "user@example.com" {
+		t.Fatalf("expected one session for user@example.com, got %v", sessions)
+	}
+	a.Sessions.Delete(sessions[0].ID)
+	w := httptest.NewRecorder()
+	if _, err := a.Authenticate(w, req); err != MustLogin {
+		t.Errorf("expected MustLogin after revoking the session, got %v", err)
+	}
+	if hdr := w.Header().Get("Set-Cookie"); hdr == "" {
+		t.Error("expected revoked cookie to be cleared")
+	}
+}
+
+func TestStatelessCookieRejectedWithSessions(t *testing.T) {
+	t.Parallel()
+	a := NewGoogleAuthenticator(NullLogger, "", "", "http://localhost", nil, nacl.NewKey())
+	req, _ := http.NewRequest("GET", "/", nil)
+	cookie, err := a.cookies().newCookie(req, &token{ID: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(cookie)
+	a.Sessions = NewMemorySessionStore()
+	if _, err := a.Authenticate(httptest.NewRecorder(), req); err != MustLogin {
+		t.Errorf("expected MustLogin for a cookie without a session, got %v", err)
+	}
+}
@@ -1,11 +1,15 @@
 package config
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net"
+	"net/http"
 	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/inconshreveable/log15"
@@ -13,12 +17,23 @@ import (
 	"github.com/kevinburke/logrole/services"
 	"github.com/kevinburke/nacl"
 	twilio "github.com/kevinburke/twilio-go"
-	yaml "gopkg.in/yaml.v2"
 )
 
 const DefaultPort = "4114"
 const DefaultPageSize = 50
 
+// DefaultShutdownTimeout is how long the server waits for in-flight requests
+// to finish when it's shutting down. It leaves some time for a delay before
+// draining in a 30 second termination grace period.
+const DefaultShutdownTimeout = 25 * time.Second
+
+// The forwarding headers that trusted proxies can report a client's address
+// in.
+const (
+	ProxyHeaderXForwardedFor = "x-forwarded-for"
+	ProxyHeaderForwarded     = "forwarded"
+)
+
 // DefaultTimezones are a user's options if no timezones are configured. These
 // correspond to the 4 timezones in the USA, west to east.
 var DefaultTimezones = []string{
@@ -43,7 +58,34 @@ var missingGoogleCredentials = errors.New("Cannot use google auth without a Clie
 type FileConfig struct {
 	Port       string `yaml:"port"`
 	AccountSid string `yaml:"twilio_account_sid"`
-	AuthToken  string `yaml:"twilio_auth_token"`
+
+	// Serve HTTPS on Port with this certificate and key, instead of relying
+	// on a load balancer to terminate TLS. The files are reloaded when they
+	// change.
+	TLSCertFile string `yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `yaml:"tls_key_file,omitempty"`
+	// If set, also listen on this port, and redirect HTTP requests to HTTPS.
+	// Requires tls_cert_file.
+	HTTPRedirectPort string `yaml:"http_redirect_port,omitempty"`
+
+	AuthToken string `yaml:"twilio_auth_token"`
+	// Additional accounts, usually subaccounts of the main account, that
+	// users can switch between in the UI.
+	Accounts []AccountConfig `yaml:"twilio_accounts,omitempty"`
+
+	// Connect to Twilio at these URLs instead of the default ones, for
+	// example to use an edge location or a region, or a local stand-in.
+	TwilioBaseURLs *TwilioBaseURLs `yaml:"twilio_base_urls,omitempty"`
+	// Make requests to Twilio through this HTTP proxy. Defaults to the
+	// HTTPS_PROXY environment variable.
+	TwilioProxyURL string `yaml:"twilio_proxy_url,omitempty"`
+	// Trust the certificates in this PEM file, as well as the system's,
+	// when connecting to Twilio, for example for an egress proxy that
+	// inspects TLS traffic.
+	TwilioCAFile string `yaml:"twilio_ca_file,omitempty"`
+	// How long to wait for a response from the Twilio API. Defaults to
+	// 30.5 seconds.
+	TwilioTimeout time.Duration `yaml:"twilio_timeout,omitempty"`
 
 	Realm services.Rlm `yaml:"realm"`
 	// Default timezone for dates/times in the UI
@@ -52,18 +94,64 @@ type FileConfig struct {
 	Timezones  []string `yaml:"timezones"`
 	PublicHost string   `yaml:"public_host"`
 
-	// IP subnets that are allowed to visit the site. THIS IS NOT A SECURITY
-	// FEATURE. IP ADDRESSES ARE EASILY SPOOFED, AND YOUR IP ADDRESS IS EASILY
-	// DISCOVERABLE. To determine a user's ip address, we check the first value
-	// in a X-Forwarded-For header, or the RemoteHost value of a http.Request.
+	// When the server gets SIGTERM or SIGINT, it reports that it isn't ready
+	// for ShutdownDelay, so load balancers stop sending it new requests, and
+	// then waits up to ShutdownTimeout for in-flight requests to finish.
+	// ShutdownTimeout defaults to 25 seconds.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay,omitempty"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout,omitempty"`
+
+	// IP subnets that are allowed to visit the site. Unless TrustedProxies is
+	// set, THIS IS NOT A SECURITY FEATURE. IP ADDRESSES ARE EASILY SPOOFED,
+	// AND YOUR IP ADDRESS IS EASILY DISCOVERABLE. Without trusted proxies, we
+	// check the first value in a X-Forwarded-For header, or the RemoteHost
+	// value of a http.Request.
 	//
 	// If you have an IPv4 address, the subnet for *only* that address is
 	// "A.B.C.D/32". The recommended smallest subnet for IPv6 is /64.
 	IPSubnets []string `yaml:"ip_subnets"`
 
+	// Deny access if we can't determine a request's IP address, instead of
+	// allowing it.
+	IPSubnetsFailClosed bool `yaml:"ip_subnets_fail_closed,omitempty"`
+
+	// Subnets of the load balancers or proxies in front of the server. If
+	// set, we only read the TrustedProxyHeader header on requests from these
+	// proxies, and use the last address in the header that isn't a trusted
+	// proxy as the client's IP address.
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+
+	// The header your proxies add the client's address to, either
+	// "x-forwarded-for" (the default) or "forwarded". The other header is
+	// ignored, since proxies usually pass it through from the client.
+	TrustedProxyHeader string `yaml:"trusted_proxy_header,omitempty"`
+
+	// Limit how often each logged in user, and each IP address, can make
+	// requests. A policy group's rate_limit overrides UserRateLimit for its
+	// users. If unset, requests aren't limited.
+	UserRateLimit *RateLimit `yaml:"user_rate_limit,omitempty"`
+	IPRateLimit   *RateLimit `yaml:"ip_rate_limit,omitempty"`
+	// Limit how often the server calls the Twilio API, across all accounts.
+	// Background work, like caching the first page of each resource, waits
+	// until no user is waiting for a call.
+	TwilioRateLimit *RateLimit `yaml:"twilio_rate_limit,omitempty"`
+
+	// Send notifications when new alerts match these rules, for example
+	// when a webhook starts failing.
+	AlertNotifications *AlertNotifications `yaml:"alert_notifications,omitempty"`
+
 	PageSize       uint          `yaml:"page_size"`
 	SecretKey      string        `yaml:"secret_key"`
 	MaxResourceAge time.Duration `yaml:"max_resource_age"`
+	// Hide resources that are newer than this, for users whose group doesn't
+	// set min_resource_age.
+	MinResourceAge time.Duration `yaml:"min_resource_age,omitempty"`
+
+	// Regular expressions matching text to remove from message bodies, for
+	// users with redact_message_bodies set. If a pattern has a capture group,
+	// only the first group is removed. Defaults to patterns for credit card
+	// numbers, social security numbers and one-time passcodes.
+	RedactionPatterns []string `yaml:"redaction_patterns,omitempty"`
 
 	// Need a pointer to a boolean here since we want to be able to distinguish
 	// "false" from "omitted"
@@ -77,6 +165,44 @@ type FileConfig struct {
 	AuthScheme string `yaml:"auth_scheme"`
 	User       string `yaml:"basic_auth_user"`
 	Password   string `yaml:"basic_auth_password"`
+	// An htpasswd file with bcrypt password hashes, one "user:hash" line per
+	// user. The file is reloaded when it changes. Manage it with the
+	// logrole_passwd command or "htpasswd -B".
+	PasswordFile string `yaml:"basic_auth_password_file,omitempty"`
+	// If set, Basic Auth users log in with a form instead, and can set up
+	// two-factor authentication. Their TOTP secrets are kept in this file,
+	// encrypted with the secret key.
+	MFAFile string `yaml:"basic_auth_mfa_file,omitempty"`
+
+	// For auth_scheme "header": the header the authenticating proxy uses to
+	// send the user's identity, and optionally a comma-separated list of
+	// their groups. AuthHeader defaults to "X-Forwarded-Email".
+	AuthHeader       string `yaml:"auth_header,omitempty"`
+	AuthGroupsHeader string `yaml:"auth_groups_header,omitempty"`
+	// Where to send users who click "Logout" with header auth, for example
+	// "/oauth2/sign_out". Defaults to the homepage.
+	AuthLogoutURL string `yaml:"auth_logout_url,omitempty"`
+
+	// Where to keep login sessions for Google, SAML or form logins: "memory"
+	// or "file". If
+	// empty, a login is stored only in the user's cookie, and can't be
+	// revoked before it expires.
+	SessionStore string `yaml:"session_store,omitempty"`
+	// For session_store "file", the path to the session file.
+	SessionFile string `yaml:"session_file,omitempty"`
+	// How long a login lasts, no matter how often it's used. Defaults to 14
+	// days.
+	SessionMaxAge time.Duration `yaml:"session_max_age,omitempty"`
+	// Log users out if they haven't used the site for this long. Requires a
+	// session_store.
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout,omitempty"`
+
+	// For auth_scheme "saml": the metadata file from your identity
+	// provider, and optionally the attributes holding each user's id
+	// (instead of the NameID) and groups.
+	SAMLIdPMetadataFile string `yaml:"saml_idp_metadata_file,omitempty"`
+	SAMLUserAttribute   string `yaml:"saml_user_attribute,omitempty"`
+	SAMLGroupsAttribute string `yaml:"saml_groups_attribute,omitempty"`
 
 	GoogleClientID       string   `yaml:"google_client_id"`
 	GoogleClientSecret   string   `yaml:"google_client_secret"`
@@ -96,9 +222,26 @@ type Settings struct {
 	// The host the user visits to get to this site.
 	PublicHost string
 
+	// How long to report that the server isn't ready before draining
+	// requests, and how long to wait for them to finish, on shutdown.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
 	// Whether to allow HTTP traffic.
 	AllowUnencryptedTraffic bool
-	Client                  *twilio.Client
+
+	// If non-nil, the server terminates TLS itself using this config.
+	TLSConfig *tls.Config
+	Client    *twilio.Client
+
+	// Used to download media and recordings from Twilio. If nil,
+	// http.DefaultClient is used.
+	MediaClient *http.Client
+
+	// Additional Twilio accounts users can browse, besides the one used by
+	// Client. Each Group in the Policy can restrict which accounts its users
+	// can see.
+	Accounts []*Account
 
 	// LocationFinder determines the correct timezone to display for a given
 	// request, based on the default and a user's TZ cookie (if present).
@@ -115,6 +258,14 @@ type Settings struct {
 	// value to show all resources.
 	MaxResourceAge time.Duration
 
+	// Don't show resources that are newer than this age. Zero shows every
+	// resource.
+	MinResourceAge time.Duration
+
+	// Text to remove from message bodies for users that can't view sensitive
+	// information. If nil, config.DefaultRedactionPatterns are used.
+	RedactionPatterns []*regexp.Regexp
+
 	// Should a user have to click a button to view media attached to a MMS?
 	ShowMediaByDefault bool
 
@@ -128,9 +279,52 @@ type Settings struct {
 	// The authentication scheme.
 	Authenticator Authenticator
 
-	// THIS IS NOT A SECURITY FEATURE AND SHOULD NOT BE RELIED ON FOR IP
-	// WHITELISTING.
+	// Login sessions, if they are stored on the server. Users with the
+	// can_manage_sessions permission can list and revoke them.
+	Sessions SessionStore
+
+	// Unless TrustedProxies is set, THIS IS NOT A SECURITY FEATURE AND SHOULD
+	// NOT BE RELIED ON FOR IP WHITELISTING.
 	IPSubnets []*net.IPNet
+
+	// Deny access if a request's IP address can't be determined.
+	IPSubnetsFailClosed bool
+
+	// Forwarding headers are only trusted on requests from these subnets. If
+	// nil, the first value in the X-Forwarded-For header is used as the
+	// client's IP address.
+	TrustedProxies []*net.IPNet
+
+	// The forwarding header trusted proxies add the client's address to;
+	// ProxyHeaderXForwardedFor or ProxyHeaderForwarded.
+	TrustedProxyHeader string
+
+	// If non-nil, limit how often each user, or each IP address, can make
+	// requests. A user's group rate limit takes precedence over
+	// UserRateLimit.
+	UserRateLimit *RateLimit
+	IPRateLimit   *RateLimit
+
+	// If non-nil, limit how often the server calls the Twilio API.
+	TwilioRateLimit *RateLimit
+
+	// If non-nil, watch for new alerts and send notifications about them.
+	AlertNotifications *AlertNotifications
+
+	// Closed to stop goroutines started by NewSettingsFromConfig.
+	done      chan bool
+	closeOnce sync.Once
+}
+
+// Close stops any goroutines started by NewSettingsFromConfig, like the one
+// watching the password file. It's safe to call Close more than once.
+func (s *Settings) Close() error {
+	s.closeOnce.Do(func() {
+		if s.done != nil {
+			close(s.done)
+		}
+	})
+	return nil
 }
 
 // NewSettingsFromConfig creates a new Settings object from the given
@@ -159,11 +353,22 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 	if c.Policy != nil && c.PolicyFile != "" {
 		return nil, errors.New("Cannot define both policy and a policy_file")
 	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return nil, errors.New("Please set both tls_cert_file and tls_key_file, or neither")
+	}
+	if c.HTTPRedirectPort != "" && c.TLSCertFile == "" {
+		return nil, errors.New("Cannot use http_redirect_port without a tls_cert_file")
+	}
 	allowHTTP := false
-	if c.Realm == services.Local {
+	// With TLS configured, every page is served over HTTPS, even locally.
+	if c.Realm == services.Local && c.TLSCertFile == "" {
 		allowHTTP = true
 	}
 	if c.SecretKey == "" {
+		if c.MFAFile != "" {
+			// Otherwise nobody could log in after a restart.
+			return nil, errors.New("Cannot use basic_auth_mfa_file without a secret_key; the file is encrypted with it")
+		}
 		l.Warn("No secret key provided, generating random secret key. Sessions won't persist across restarts")
 	}
 	var secretKey nacl.Key
@@ -179,6 +384,12 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 	if c.MaxResourceAge == 0 {
 		c.MaxResourceAge = DefaultMaxResourceAge
 	}
+	if c.MinResourceAge < 0 {
+		return nil, errors.New("min_resource_age can't be negative")
+	}
+	if c.MinResourceAge >= c.MaxResourceAge {
+		return nil, fmt.Errorf("min_resource_age (%s) must be less than max_resource_age (%s)", c.MinResourceAge, c.MaxResourceAge)
+	}
 	var address *mail.Address
 	if c.EmailAddress != "" {
 		address, err = mail.ParseAddress(c.EmailAddress)
@@ -195,17 +406,12 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 
 	if c.PolicyFile != "" {
 		// we checked above that Policy is nil in this case
-		data, err := ioutil.ReadFile(c.PolicyFile)
+		policy, err := LoadPolicy(c.PolicyFile)
 		if err != nil {
-			l.Error("Couldn't load permission file", "loc", c.PolicyFile)
+			l.Error("Couldn't load policy file", "err", err, "loc", c.PolicyFile)
 			return nil, err
 		}
-		var policy Policy
-		if err := yaml.Unmarshal(data, &policy); err != nil {
-			l.Error("Couldn't parse policy file", "err", err, "loc", c.PolicyFile)
-			return nil, err
-		}
-		c.Policy = &policy
+		c.Policy = policy
 	}
 
 	if c.Policy != nil {
@@ -214,36 +420,205 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 			return nil, err
 		}
 	}
+	var trustedProxies []*net.IPNet
+	if c.TrustedProxies != nil {
+		trustedProxies = make([]*net.IPNet, len(c.TrustedProxies))
+		for i, ipStr := range c.TrustedProxies {
+			_, n, err := net.ParseCIDR(ipStr)
+			if err != nil {
+				l.Error("Couldn't parse trusted proxy subnet", "err", err, "ip", ipStr)
+				return nil, err
+			}
+			trustedProxies[i] = n
+		}
+	}
+	trustedProxyHeader := strings.ToLower(c.TrustedProxyHeader)
+	switch trustedProxyHeader {
+	case "":
+		trustedProxyHeader = ProxyHeaderXForwardedFor
+	case ProxyHeaderXForwardedFor, ProxyHeaderForwarded:
+	default:
+		return nil, fmt.Errorf("Unknown trusted_proxy_header %q, use %q or %q", c.TrustedProxyHeader, ProxyHeaderXForwardedFor, ProxyHeaderForwarded)
+	}
+
+	var sessions SessionStore
+	switch c.SessionStore {
+	case "":
+		if c.SessionIdleTimeout > 0 {
+			return nil, errors.New("Cannot use session_idle_timeout without a session_store")
+		}
+	case "memory":
+		sessions = NewMemorySessionStore()
+	case "file":
+		if c.SessionFile == "" {
+			return nil, errors.New("Cannot use the file session store without a session_file")
+		}
+		fs, err := NewFileSessionStore(c.SessionFile)
+		if err != nil {
+			l.Error("Couldn't load session file", "loc", c.SessionFile, "err", err)
+			return nil, err
+		}
+		sessions = fs
+	default:
+		return nil, fmt.Errorf("Unknown session store: %s", c.SessionStore)
+	}
+	loginForm := c.AuthScheme == "basic" && c.MFAFile != ""
+	if sessions != nil && c.AuthScheme != "google" && c.AuthScheme != "saml" && !loginForm {
+		l.Warn("Sessions are only stored for Google auth, SAML auth and the Basic Auth login form, ignoring session_store", "auth_scheme", c.AuthScheme)
+		sessions = nil
+	}
+	if c.MFAFile != "" && c.AuthScheme != "basic" {
+		return nil, errors.New("basic_auth_mfa_file only works with auth_scheme basic")
+	}
+	if c.Policy != nil && !loginForm {
+		for _, group := range *c.Policy {
+			if group.RequireMFA {
+				return nil, fmt.Errorf("Group %s has require_mfa set, but two-factor authentication needs auth_scheme basic and a basic_auth_mfa_file", group.Name)
+			}
+		}
+	}
+	if c.SessionMaxAge < 0 || c.SessionIdleTimeout < 0 {
+		return nil, errors.New("session_max_age and session_idle_timeout must be positive")
+	}
+	if c.ShutdownDelay < 0 || c.ShutdownTimeout < 0 {
+		return nil, errors.New("shutdown_delay and shutdown_timeout must be positive")
+	}
+	for name, rl := range map[string]*RateLimit{
+		"user_rate_limit":   c.UserRateLimit,
+		"ip_rate_limit":     c.IPRateLimit,
+		"twilio_rate_limit": c.TwilioRateLimit,
+	} {
+		if err := rl.validate(); err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", name, err)
+		}
+	}
+	if err := c.AlertNotifications.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid alert_notifications: %v", err)
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	done := make(chan bool)
+	var tlsConfig *tls.Config
+	var certs *CertReloader
+	if c.TLSCertFile != "" {
+		certs, err = NewCertReloader(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			l.Error("Couldn't load TLS certificate", "cert", c.TLSCertFile, "key", c.TLSKeyFile, "err", err)
+			return nil, err
+		}
+		tlsConfig = NewTLSConfig(certs)
+	}
+
+	var baseURL string
+	if allowHTTP {
+		baseURL = "http://" + c.PublicHost
+	} else {
+		baseURL = "https://" + c.PublicHost
+	}
 	var authenticator Authenticator
+	var passwords *BasicAuthAuthenticator
 	switch c.AuthScheme {
 	case "", "noop":
 		l.Warn("Disabling basic authentication")
 		authenticator = &NoopAuthenticator{User: DefaultUser}
 	case "basic":
-		if c.User == "" || c.Password == "" {
-			return nil, errors.New("Cannot use basic auth without a username or password, set a basic_auth_user")
+		if c.PasswordFile == "" && (c.User == "" || c.Password == "") {
+			return nil, errors.New("Cannot use basic auth without a username or password, set a basic_auth_user or a basic_auth_password_file")
 		}
 		ba := NewBasicAuthAuthenticator("logrole")
-		ba.AddUserPassword(c.User, c.Password)
+		if c.User != "" && c.Password != "" {
+			ba.AddUserPassword(c.User, c.Password)
+		}
+		if c.PasswordFile != "" {
+			if err := ba.LoadPasswordFile(c.PasswordFile); err != nil {
+				l.Error("Couldn't load password file", "loc", c.PasswordFile, "err", err)
+				return nil, err
+			}
+			passwords = ba
+		}
+		if loginForm {
+			mfa, err := NewMFAStore(c.MFAFile, secretKey)
+			if err != nil {
+				l.Error("Couldn't load MFA file", "loc", c.MFAFile, "err", err)
+				return nil, err
+			}
+			ba.EnableLoginForm(l, mfa, secretKey)
+			ba.AllowUnencryptedTraffic = allowHTTP
+			ba.Sessions = sessions
+			ba.SessionMaxAge = c.SessionMaxAge
+			ba.SessionIdleTimeout = c.SessionIdleTimeout
+		}
 		authenticator = ba
 	case "google":
 		if c.GoogleClientID == "" || c.GoogleClientSecret == "" {
 			return nil, missingGoogleCredentials
 		}
-		var baseURL string
-		if allowHTTP {
-			baseURL = "http://" + c.PublicHost
-		} else {
-			baseURL = "https://" + c.PublicHost
-		}
 		gauthenticator := NewGoogleAuthenticator(l, c.GoogleClientID, c.GoogleClientSecret, baseURL, c.GoogleAllowedDomains, secretKey)
 		gauthenticator.AllowUnencryptedTraffic = allowHTTP
+		gauthenticator.Sessions = sessions
+		gauthenticator.SessionMaxAge = c.SessionMaxAge
+		gauthenticator.SessionIdleTimeout = c.SessionIdleTimeout
 		authenticator = gauthenticator
+	case "saml":
+		if c.SAMLIdPMetadataFile == "" {
+			return nil, errors.New("Cannot use SAML auth without a saml_idp_metadata_file")
+		}
+		if c.PublicHost == "" {
+			return nil, errors.New("Cannot use SAML auth without a public_host")
+		}
+		idp, err := LoadIdPMetadata(c.SAMLIdPMetadataFile)
+		if err != nil {
+			l.Error("Couldn't load IdP metadata", "loc", c.SAMLIdPMetadataFile, "err", err)
+			return nil, err
+		}
+		sa := NewSAMLAuthenticator(l, idp, baseURL, secretKey)
+		sa.AllowUnencryptedTraffic = allowHTTP
+		sa.UserAttribute = c.SAMLUserAttribute
+		sa.GroupsAttribute = c.SAMLGroupsAttribute
+		sa.Sessions = sessions
+		sa.SessionMaxAge = c.SessionMaxAge
+		sa.SessionIdleTimeout = c.SessionIdleTimeout
+		authenticator = sa
+	case "header":
+		if len(trustedProxies) == 0 {
+			return nil, errors.New("Cannot use header auth without trusted_proxies; anyone could set the header")
+		}
+		ha := NewHeaderAuthenticator(c.AuthHeader, trustedProxies)
+		ha.GroupsHeader = c.AuthGroupsHeader
+		ha.LogoutURL = c.AuthLogoutURL
+		authenticator = ha
 	default:
 		return nil, fmt.Errorf("Unknown auth scheme: %s", c.AuthScheme)
 	}
 	authenticator.SetPolicy(c.Policy)
-	client := twilio.NewClient(c.AccountSid, c.AuthToken, nil)
+	network, err := NewTwilioNetwork(c.TwilioBaseURLs, c.TwilioProxyURL, c.TwilioCAFile, c.TwilioTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := network.NewClient(c.AccountSid, c.AuthToken)
+	accounts := make([]*Account, len(c.Accounts))
+	sids := map[string]bool{c.AccountSid: true}
+	for i, ac := range c.Accounts {
+		if sids[ac.Sid] {
+			return nil, fmt.Errorf("Account %s appears twice in the configuration", ac.Sid)
+		}
+		sids[ac.Sid] = true
+		accounts[i], err = newAccount(ac, client, network)
+		if err != nil {
+			l.Error("Couldn't load Twilio account", "err", err, "sid", ac.Sid)
+			return nil, err
+		}
+	}
+	if c.Policy != nil {
+		for _, group := range *c.Policy {
+			for _, sid := range group.Accounts {
+				if !sids[sid] {
+					return nil, fmt.Errorf("Group %s can view account %s, but that account is not configured", group.Name, sid)
+				}
+			}
+		}
+	}
 	if c.Timezone == "" {
 		l.Info("No timezone provided, defaulting to UTC")
 	}
@@ -275,6 +650,22 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 		}
 	}
 
+	if trustedProxies == nil && len(nets) > 0 {
+		l.Warn("ip_subnets is configured without trusted_proxies, so client IP addresses can be spoofed")
+	}
+
+	var redactionPatterns []*regexp.Regexp
+	if len(c.RedactionPatterns) > 0 {
+		redactionPatterns = make([]*regexp.Regexp, len(c.RedactionPatterns))
+		for i, pattern := range c.RedactionPatterns {
+			rx, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Couldn't parse redaction pattern %q: %v", pattern, err)
+			}
+			redactionPatterns[i] = rx
+		}
+	}
+
 	// TODO
 	if c.PageSize == 0 {
 		c.PageSize = DefaultPageSize
@@ -287,20 +678,44 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 		c.ShowMediaByDefault = &b
 	}
 
+	// Start watching files only once nothing else can fail; otherwise the
+	// watchers would run forever, since done is only closed by Close.
+	if certs != nil {
+		go certs.Watch(l, certFileInterval, done)
+	}
+	if passwords != nil {
+		go passwords.WatchPasswordFile(l, c.PasswordFile, passwordFileInterval, done)
+	}
 	settings = &Settings{
 		Logger:                  l,
 		AllowUnencryptedTraffic: allowHTTP,
+		TLSConfig:               tlsConfig,
 		Client:                  client,
+		MediaClient:             network.MediaClient(),
+		Accounts:                accounts,
 		LocationFinder:          locationFinder,
 		PublicHost:              c.PublicHost,
+		ShutdownDelay:           c.ShutdownDelay,
+		ShutdownTimeout:         c.ShutdownTimeout,
 		PageSize:                c.PageSize,
 		SecretKey:               secretKey,
 		MaxResourceAge:          c.MaxResourceAge,
+		MinResourceAge:          c.MinResourceAge,
+		RedactionPatterns:       redactionPatterns,
 		ShowMediaByDefault:      *c.ShowMediaByDefault,
 		Mailto:                  address,
 		Reporter:                reporter,
 		Authenticator:           authenticator,
 		IPSubnets:               nets,
+		IPSubnetsFailClosed:     c.IPSubnetsFailClosed,
+		TrustedProxies:          trustedProxies,
+		TrustedProxyHeader:      trustedProxyHeader,
+		UserRateLimit:           c.UserRateLimit,
+		IPRateLimit:             c.IPRateLimit,
+		TwilioRateLimit:         c.TwilioRateLimit,
+		AlertNotifications:      c.AlertNotifications,
+		Sessions:                sessions,
+		done:                    done,
 	}
 	return
 }
@@ -3,8 +3,10 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewSettingsFromEmptyConfig(t *testing.T) {
@@ -26,6 +28,12 @@ func TestNewSettingsFromEmptyConfig(t *testing.T) {
 	if settings.SecretKey == nil {
 		t.Errorf("expected SecretKey to be non-nil, got %v", settings.SecretKey)
 	}
+	if settings.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Errorf("expected ShutdownTimeout to be %v, got %v", DefaultShutdownTimeout, settings.ShutdownTimeout)
+	}
+	if err := settings.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
 }
 
 func TestInvalidSecretKeysError(t *testing.T) {
@@ -162,3 +170,146 @@ func TestIPAddressParse(t *testing.T) {
 		t.Errorf("bad mask: %s", n.Mask.String())
 	}
 }
+
+func TestSettingsAccounts(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{
+		AccountSid: "AC123",
+		AuthToken:  "123",
+		Accounts: []AccountConfig{
+			{Sid: "AC58f1e8f2b1c6b88ca90a012a4be0c279", AuthToken: "456", FriendlyName: "Support"},
+		},
+	}
+	settings, err := NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.Accounts) != 1 {
+		t.Fatalf("expected 1 account, got %d", len(settings.Accounts))
+	}
+	acct := settings.Accounts[0]
+	if acct.FriendlyName != "Support" {
+		t.Errorf("expected FriendlyName to be Support, got %s", acct.FriendlyName)
+	}
+	if acct.Client.AccountSid != acct.Sid || acct.Client.AuthToken != "456" {
+		t.Errorf("expected client to use the account's credentials, got %s", acct.Client.AccountSid)
+	}
+}
+
+func TestPolicyWithUnknownAccountRejected(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{
+		AccountSid: "AC123",
+		AuthToken:  "123",
+		Policy: &Policy{
+			&Group{Name: "support", Accounts: []string{"AC58f1e8f2b1c6b88ca90a012a4be0c279"}},
+		},
+	}
+	_, err := NewSettingsFromConfig(c, NullLogger)
+	if err == nil {
+		t.Fatal("expected NewSettingsFromConfig to error, got nil")
+	}
+	if !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestIdleTimeoutRequiresSessionStore(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{
+		AuthScheme:         "google",
+		GoogleClientID:     "foo",
+		GoogleClientSecret: "bar",
+		SessionIdleTimeout: time.Hour,
+	}
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Fatal("expected NewSettingsFromConfig to error, got nil")
+	}
+	c.SessionStore = "memory"
+	settings, err := NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Sessions == nil {
+		t.Error("expected a session store, got nil")
+	}
+}
+
+func TestRequireMFANeedsLoginForm(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{
+		AuthScheme: "basic",
+		User:       "test",
+		Password:   "password",
+		Policy: &Policy{&Group{
+			Name:        "support",
+			Default:     true,
+			RequireMFA:  true,
+			Permissions: AllUserSettings(),
+		}},
+	}
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Fatal("expected require_mfa without basic_auth_mfa_file to error, got nil")
+	}
+	dir, err := ioutil.TempDir("", "logrole-settings-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c.MFAFile = filepath.Join(dir, "mfa")
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Fatal("expected basic_auth_mfa_file without a secret_key to error, got nil")
+	}
+	c.SecretKey = "2ae8ee5ee7fdb2bd44e1ac1d10c8f2a4f1a2c3a7d29b8dbfc04c3a7b8ccf2b6b"
+	settings, err := NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba, ok := settings.Authenticator.(*BasicAuthAuthenticator)
+	if !ok || ba.MFA == nil {
+		t.Errorf("expected the Basic Auth login form to be enabled, got %#v", settings.Authenticator)
+	}
+}
+
+func TestMinResourceAgeMustBeLessThanMax(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{
+		MaxResourceAge: 24 * time.Hour,
+		MinResourceAge: 24 * time.Hour,
+	}
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Fatal("expected NewSettingsFromConfig to error, got nil")
+	}
+	c.MinResourceAge = time.Hour
+	settings, err := NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.MinResourceAge != time.Hour {
+		t.Errorf("expected MinResourceAge to be 1h, got %v", settings.MinResourceAge)
+	}
+}
+
+func TestTrustedProxyHeader(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{AccountSid: "AC123", AuthToken: "123"}
+	settings, err := NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.TrustedProxyHeader != ProxyHeaderXForwardedFor {
+		t.Errorf("expected the default header to be %q, got %q", ProxyHeaderXForwardedFor, settings.TrustedProxyHeader)
+	}
+	c.TrustedProxyHeader = "Forwarded"
+	settings, err = NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.TrustedProxyHeader != ProxyHeaderForwarded {
+		t.Errorf("expected header %q, got %q", ProxyHeaderForwarded, settings.TrustedProxyHeader)
+	}
+	c.TrustedProxyHeader = "x-real-ip"
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Error("expected an unknown trusted_proxy_header to error, got nil")
+	}
+}
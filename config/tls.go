@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// How often to check the certificate and key files for changes.
+var certFileInterval = 30 * time.Second
+
+// A CertReloader serves a TLS certificate from a pair of files, and reloads
+// it when either file changes, so renewed certificates are picked up without
+// a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader loads the certificate and key at certFile and keyFile.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the certificate and key files again. If they can't be
+// loaded, the previous certificate is kept.
+func (c *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate. Use it as the
+// GetCertificate field of a tls.Config.
+func (c *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+func (c *CertReloader) modTime() time.Time {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		if fi, err := os.Stat(path); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+// Watch reloads the certificate whenever the modification time of the
+// certificate or key file changes. Watch runs until done is closed.
+func (c *CertReloader) Watch(l log.Logger, interval time.Duration, done <-chan bool) {
+	lastMod := c.modTime()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		mod := c.modTime()
+		if mod.Equal(lastMod) {
+			continue
+		}
+		lastMod = mod
+		if err := c.Reload(); err != nil {
+			// The files may be mid-rename; try again on the next tick.
+			l.Error("Couldn't reload TLS certificate, keeping the old one", "cert", c.certFile, "err", err)
+			lastMod = time.Time{}
+			continue
+		}
+		l.Info("Reloaded TLS certificate", "cert", c.certFile)
+	}
+}
+
+// NewTLSConfig returns a tls.Config that serves the certificate from c, and
+// supports HTTP/2.
+func NewTLSConfig(c *CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name to certFile and
+// keyFile.
+func writeCert(t *testing.T, name, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func certName(t *testing.T, c *CertReloader) string {
+	t.Helper()
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloads(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, "old.example.com", certFile, keyFile)
+	c, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := certName(t, c); name != "old.example.com" {
+		t.Fatalf("expected the old certificate, got %s", name)
+	}
+	done := make(chan bool)
+	defer close(done)
+	go c.Watch(NullLogger, 10*time.Millisecond, done)
+	time.Sleep(20 * time.Millisecond)
+	writeCert(t, "new.example.com", certFile, keyFile)
+	future := time.Now().Add(time.Second)
+	os.Chtimes(certFile, future, future)
+	deadline := time.Now().Add(2 * time.Second)
+	for certName(t, c) != "new.example.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// A broken file doesn't replace the working certificate.
+	if err := ioutil.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reload(); err == nil {
+		t.Error("expected Reload to fail with a broken key")
+	}
+	if name := certName(t, c); name != "new.example.com" {
+		t.Errorf("expected to keep the new certificate, got %s", name)
+	}
+}
+
+func TestTLSSettings(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{TLSKeyFile: "key.pem"}
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Fatal("expected a key without a certificate to error, got nil")
+	}
+	c = &FileConfig{HTTPRedirectPort: "80"}
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Fatal("expected http_redirect_port without TLS to error, got nil")
+	}
+	dir, err := ioutil.TempDir("", "logrole-tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, "localhost", certFile, keyFile)
+	c = &FileConfig{Realm: "local", TLSCertFile: certFile, TLSKeyFile: keyFile}
+	settings, err := NewSettingsFromConfig(c, NullLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer settings.Close()
+	if settings.TLSConfig == nil {
+		t.Fatal("expected a TLS config, got nil")
+	}
+	if settings.AllowUnencryptedTraffic {
+		t.Error("expected a local server with TLS to use secure cookies")
+	}
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/rest/restclient"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// DefaultTwilioTimeout is how long to wait for a response from the Twilio
+// API if twilio_timeout isn't set. It's the twilio-go default.
+const DefaultTwilioTimeout = 30*time.Second + 500*time.Millisecond
+
+// TwilioBaseURLs are the base URLs for the Twilio products Logrole uses.
+// Omitted products use Twilio's default URL.
+type TwilioBaseURLs struct {
+	// Messages, calls, conferences, phone numbers, applications and call
+	// recordings. Defaults to "https://api.twilio.com".
+	API string `yaml:"api,omitempty"`
+	// Alerts. Defaults to "https://monitor.twilio.com".
+	Monitor string `yaml:"monitor,omitempty"`
+	// Rooms and video recordings. Defaults to "https://video.twilio.com".
+	Video string `yaml:"video,omitempty"`
+}
+
+func (b *TwilioBaseURLs) validate() error {
+	if b == nil {
+		return nil
+	}
+	for name, val := range map[string]string{"api": b.API, "monitor": b.Monitor, "video": b.Video} {
+		if val == "" {
+			continue
+		}
+		u, err := url.Parse(val)
+		if err != nil {
+			return fmt.Errorf("Invalid twilio_base_urls %s: %v", name, err)
+		}
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("Invalid twilio_base_urls %s %q: must be an absolute http or https URL", name, val)
+		}
+	}
+	return nil
+}
+
+// A TwilioNetwork creates clients that talk to Twilio using the configured
+// base URLs, proxy and timeouts.
+type TwilioNetwork struct {
+	baseURLs TwilioBaseURLs
+	// Used for API requests; has a timeout.
+	client *http.Client
+	// Used for media and recordings. Has no overall timeout, since
+	// recordings can be large, but waits at most the API timeout for
+	// response headers.
+	mediaTransport http.RoundTripper
+}
+
+// NewTwilioNetwork returns a TwilioNetwork that makes requests through
+// proxyURL, if it's not empty, or the proxy in the environment
+// (HTTPS_PROXY), and trusts the certificates in caFile, as well as the
+// system's. If timeout is zero, DefaultTwilioTimeout is used.
+func NewTwilioNetwork(urls *TwilioBaseURLs, proxyURL, caFile string, timeout time.Duration) (*TwilioNetwork, error) {
+	if err := urls.validate(); err != nil {
+		return nil, err
+	}
+	if timeout < 0 {
+		return nil, errors.New("twilio_timeout must be positive")
+	}
+	if timeout == 0 {
+		timeout = DefaultTwilioTimeout
+	}
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid twilio_proxy_url: %v", err)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("Invalid twilio_proxy_url %q: must be an absolute URL", proxyURL)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	var tlsConfig *tls.Config
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read twilio_ca_file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in twilio_ca_file %s", caFile)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: timeout,
+	}
+	n := &TwilioNetwork{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &restclient.Transport{RoundTripper: transport, Debug: restclient.DefaultTransport.Debug},
+		},
+		mediaTransport: transport,
+	}
+	if urls != nil {
+		n.baseURLs = *urls
+	}
+	return n, nil
+}
+
+// NewClient returns a Twilio client for the given account.
+func (n *TwilioNetwork) NewClient(accountSid, authToken string) *twilio.Client {
+	c := twilio.NewClient(accountSid, authToken, n.client)
+	if n.baseURLs.API != "" {
+		c.Base = strings.TrimSuffix(n.baseURLs.API, "/")
+	}
+	if n.baseURLs.Monitor != "" {
+		c.Monitor.Base = strings.TrimSuffix(n.baseURLs.Monitor, "/")
+	}
+	if n.baseURLs.Video != "" {
+		c.Video.Base = strings.TrimSuffix(n.baseURLs.Video, "/")
+	}
+	return c
+}
+
+// MediaClient returns a client for downloading media and recordings. It
+// follows redirects, and has no overall timeout.
+func (n *TwilioNetwork) MediaClient() *http.Client {
+	return &http.Client{Transport: n.mediaTransport}
+}
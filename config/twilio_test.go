@@ -0,0 +1,119 @@
+package config
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func accountServer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"sid": "AC123"}`))
+}
+
+func TestTwilioNetworkValidation(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		urls     *TwilioBaseURLs
+		proxyURL string
+		caFile   string
+		timeout  time.Duration
+		err      string
+	}{
+		{&TwilioBaseURLs{API: "api.twilio.com"}, "", "", 0, "twilio_base_urls api"},
+		{&TwilioBaseURLs{Video: "ftp://video.example.com"}, "", "", 0, "twilio_base_urls video"},
+		{nil, "/proxy", "", 0, "twilio_proxy_url"},
+		{nil, "", "/does/not/exist.pem", 0, "twilio_ca_file"},
+		{nil, "", "", -time.Second, "twilio_timeout"},
+	}
+	for _, tt := range tests {
+		_, err := NewTwilioNetwork(tt.urls, tt.proxyURL, tt.caFile, tt.timeout)
+		if err == nil {
+			t.Errorf("expected an error containing %q, got nil", tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected an error containing %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestTwilioNetworkBaseURLs(t *testing.T) {
+	t.Parallel()
+	n, err := NewTwilioNetwork(&TwilioBaseURLs{
+		API:     "http://localhost:8080/",
+		Monitor: "http://localhost:8081",
+	}, "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := n.NewClient("AC123", "123")
+	if c.Base != "http://localhost:8080" {
+		t.Errorf("expected the API base URL to be set, got %q", c.Base)
+	}
+	if c.Monitor.Base != "http://localhost:8081" {
+		t.Errorf("expected the Monitor base URL to be set, got %q", c.Monitor.Base)
+	}
+	if c.Video.Base != "https://video.twilio.com" {
+		t.Errorf("expected the default Video base URL, got %q", c.Video.Base)
+	}
+	if c.Client.Client.Timeout != DefaultTwilioTimeout {
+		t.Errorf("expected the default timeout, got %v", c.Client.Client.Timeout)
+	}
+}
+
+func TestTwilioNetworkCAFile(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewTLSServer(http.HandlerFunc(accountServer))
+	defer s.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewTwilioNetwork(&TwilioBaseURLs{API: s.URL}, "", caFile, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := n.NewClient("AC123", "123").Accounts.Get(context.Background(), "AC123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Sid != "AC123" {
+		t.Errorf("expected the stand-in's account, got %q", acct.Sid)
+	}
+}
+
+func TestTwilioNetworkProxy(t *testing.T) {
+	t.Parallel()
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host == "twilio.invalid" {
+			atomic.AddInt32(&proxied, 1)
+		}
+		accountServer(w, r)
+	}))
+	defer proxy.Close()
+	n, err := NewTwilioNetwork(&TwilioBaseURLs{API: "http://twilio.invalid"}, proxy.URL, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.NewClient("AC123", "123").Accounts.Get(context.Background(), "AC123"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := n.MediaClient().Get("http://twilio.invalid/recording.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := atomic.LoadInt32(&proxied); n != 2 {
+		t.Errorf("expected 2 requests through the proxy, got %d", n)
+	}
+}
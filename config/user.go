@@ -3,6 +3,7 @@ package config
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -11,26 +12,60 @@ import (
 var DefaultUser = NewUser(AllUserSettings())
 
 type User struct {
-	canViewNumMedia       bool
-	canViewMessages       bool
-	canViewMessageFrom    bool
-	canViewMessageTo      bool
-	canViewMessageBody    bool
-	canViewMessagePrice   bool
-	canViewMedia          bool
-	canViewCalls          bool
-	canViewCallFrom       bool
-	canViewCallTo         bool
-	canViewCallPrice      bool
-	canViewNumRecordings  bool
-	canPlayRecordings     bool
-	canViewRecordingPrice bool
-	canViewConferences    bool
-	canViewAlerts         bool
-	canViewCallbackURLs   bool
+	canViewNumMedia        bool
+	canViewMessages        bool
+	canViewMessageFrom     bool
+	canViewMessageTo       bool
+	canViewMessageBody     bool
+	canViewMessagePrice    bool
+	canViewMedia           bool
+	canViewCalls           bool
+	canViewCallFrom        bool
+	canViewCallTo          bool
+	canViewCallPrice       bool
+	canViewNumRecordings   bool
+	canPlayRecordings      bool
+	canViewRecordingPrice  bool
+	canViewConferences     bool
+	canViewAlerts          bool
+	canViewCallbackURLs    bool
+	canViewRooms           bool
+	canPlayVideoRecordings bool
+	canManageSessions      bool
 	// The maximum viewable age this viewer can view resources. If nonzero,
 	// this overrides any global setting.
 	maxResourceAge time.Duration
+	// If nonzero, the user can't view resources newer than this. Overrides
+	// any global setting.
+	minResourceAge time.Duration
+	// Sids of the Twilio accounts this user can view. If empty, the user can
+	// view every account.
+	accounts []string
+	// If non-nil, the user can only view messages and calls in this scope.
+	scope *Scope
+
+	messageFromMask     Mask
+	messageToMask       Mask
+	callFromMask        Mask
+	callToMask          Mask
+	redactMessageBodies bool
+
+	// The ID the user logged in with, if known.
+	id string
+	// The name of the policy group the user belongs to, if any.
+	group string
+	// If non-empty, the user can only sign in from these subnets.
+	ipSubnets []*net.IPNet
+	// If non-nil, the user can only sign in during these hours.
+	hours *hoursWindow
+	// If true, the user has to set up two-factor authentication.
+	requireMFA bool
+	// If non-nil, the user can request elevated access.
+	breakGlass *BreakGlass
+	// The break-glass elevation applied to this user, if any.
+	elevation *Elevation
+	// If non-nil, overrides the global rate limit for the user.
+	rateLimit *RateLimit
 }
 
 // UserSettings are used to define which permissions a User has. When parsing
@@ -54,7 +89,8 @@ type UserSettings struct {
 
 	// Can the user see any information about a call?
 	CanViewCalls bool `yaml:"can_view_calls"`
-	// Can the user view the call originator?
+	// Can the user view the call originator? This also covers the numbers on
+	// the outgoing caller IDs page.
 	CanViewCallFrom bool `yaml:"can_view_call_from"`
 	// Can the user view the call recipient?
 	CanViewCallTo    bool `yaml:"can_view_call_to"`
@@ -73,6 +109,28 @@ type UserSettings struct {
 	// Can the user view a StatusCallbackURL? Also protects
 	// Voice/SMS/Fallback/Callback URL's for phone numbers.
 	CanViewCallbackURLs bool `yaml:"can_view_callback_urls"`
+	// Can the user view metadata about a video room (sid, status, type,
+	// participants, etc)?
+	CanViewRooms bool `yaml:"can_view_rooms"`
+	// Can the user watch or listen to the recordings of a video room?
+	CanPlayVideoRecordings bool `yaml:"can_play_video_recordings"`
+	// Can the user list everyone's login sessions and revoke them? Unlike
+	// the other permissions, this defaults to false.
+	CanManageSessions bool `yaml:"can_manage_sessions"`
+
+	// How much of the message sender's phone number the user can see:
+	// "full" (the default), "hide", "last-N" to show only the last N digits,
+	// or "pseudonym" to show a stable identifier in place of the number.
+	MessageFromMask Mask `yaml:"message_from_mask"`
+	// How much of the message recipient's phone number the user can see.
+	MessageToMask Mask `yaml:"message_to_mask"`
+	// How much of the call originator's phone number the user can see.
+	CallFromMask Mask `yaml:"call_from_mask"`
+	// How much of the call recipient's phone number the user can see.
+	CallToMask Mask `yaml:"call_to_mask"`
+	// Replace credit card numbers, social security numbers and one-time
+	// passcodes in message bodies with "[redacted]".
+	RedactMessageBodies bool `yaml:"redact_message_bodies"`
 
 	// The maximum viewable age of resources this user can view. If nonzero,
 	// this overrides any global setting.
@@ -81,6 +139,12 @@ type UserSettings struct {
 	// numbers will be viewable even if the phone number was purchased before this
 	// age.
 	MaxResourceAge time.Duration `yaml:"max_resource_age"`
+
+	// The user can't view resources until they are at least this old, for
+	// example "24h" to keep live conversations private. If nonzero, this
+	// overrides any global setting. Like MaxResourceAge, phone numbers and
+	// applications are exempt.
+	MinResourceAge time.Duration `yaml:"min_resource_age"`
 }
 
 // An alias type to avoid infinite recursion when calling UnmarshalYAML.
@@ -95,6 +159,7 @@ func (us *UserSettings) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// sets everything to true
 	aus := AllUserSettings()
 	ys := yamlSettings(*aus)
+	ys.CanManageSessions = false
 	if err := unmarshal(&ys); err != nil {
 		if strings.Contains(err.Error(), "unmarshal !!seq") {
 			return fmt.Errorf("%s. Double check that permissions is a map and "+
@@ -107,27 +172,30 @@ func (us *UserSettings) UnmarshalYAML(unmarshal func(interface{}) error) error {
 }
 
 // AllUserSettings returns a UserSettings value with the widest possible set of
-// permissions.
+// permissions for viewing resources. Administrative permissions, like
+// CanManageSessions, are not included.
 func AllUserSettings() *UserSettings {
 	return &UserSettings{
-		CanViewNumMedia:       true,
-		CanViewMessages:       true,
-		CanViewMessageFrom:    true,
-		CanViewMessageTo:      true,
-		CanViewMessageBody:    true,
-		CanViewMessagePrice:   true,
-		CanViewMedia:          true,
-		CanViewCalls:          true,
-		CanViewCallFrom:       true,
-		CanViewCallTo:         true,
-		CanViewCallPrice:      true,
-		CanViewNumRecordings:  true,
-		CanPlayRecordings:     true,
-		CanViewRecordingPrice: true,
-		CanViewConferences:    true,
-		CanViewAlerts:         true,
-		CanViewCallbackURLs:   true,
-		MaxResourceAge:        DefaultMaxResourceAge,
+		CanViewNumMedia:        true,
+		CanViewMessages:        true,
+		CanViewMessageFrom:     true,
+		CanViewMessageTo:       true,
+		CanViewMessageBody:     true,
+		CanViewMessagePrice:    true,
+		CanViewMedia:           true,
+		CanViewCalls:           true,
+		CanViewCallFrom:        true,
+		CanViewCallTo:          true,
+		CanViewCallPrice:       true,
+		CanViewNumRecordings:   true,
+		CanPlayRecordings:      true,
+		CanViewRecordingPrice:  true,
+		CanViewConferences:     true,
+		CanViewAlerts:          true,
+		CanViewCallbackURLs:    true,
+		CanViewRooms:           true,
+		CanPlayVideoRecordings: true,
+		MaxResourceAge:         DefaultMaxResourceAge,
 	}
 }
 
@@ -137,24 +205,33 @@ func NewUser(us *UserSettings) *User {
 		us = &UserSettings{}
 	}
 	return &User{
-		canViewNumMedia:       us.CanViewNumMedia,
-		canViewMessages:       us.CanViewMessages,
-		canViewMessageFrom:    us.CanViewMessageFrom,
-		canViewMessageTo:      us.CanViewMessageTo,
-		canViewMessageBody:    us.CanViewMessageBody,
-		canViewMessagePrice:   us.CanViewMessagePrice,
-		canViewMedia:          us.CanViewMedia,
-		canViewCalls:          us.CanViewCalls,
-		canViewCallFrom:       us.CanViewCallFrom,
-		canViewCallTo:         us.CanViewCallTo,
-		canViewCallPrice:      us.CanViewCallPrice,
-		canViewNumRecordings:  us.CanViewNumRecordings,
-		canPlayRecordings:     us.CanPlayRecordings,
-		canViewRecordingPrice: us.CanViewRecordingPrice,
-		canViewConferences:    us.CanViewConferences,
-		canViewAlerts:         us.CanViewAlerts,
-		canViewCallbackURLs:   us.CanViewCallbackURLs,
-		maxResourceAge:        us.MaxResourceAge,
+		canViewNumMedia:        us.CanViewNumMedia,
+		canViewMessages:        us.CanViewMessages,
+		canViewMessageFrom:     us.CanViewMessageFrom,
+		canViewMessageTo:       us.CanViewMessageTo,
+		canViewMessageBody:     us.CanViewMessageBody,
+		canViewMessagePrice:    us.CanViewMessagePrice,
+		canViewMedia:           us.CanViewMedia,
+		canViewCalls:           us.CanViewCalls,
+		canViewCallFrom:        us.CanViewCallFrom,
+		canViewCallTo:          us.CanViewCallTo,
+		canViewCallPrice:       us.CanViewCallPrice,
+		canViewNumRecordings:   us.CanViewNumRecordings,
+		canPlayRecordings:      us.CanPlayRecordings,
+		canViewRecordingPrice:  us.CanViewRecordingPrice,
+		canViewConferences:     us.CanViewConferences,
+		canViewAlerts:          us.CanViewAlerts,
+		canViewCallbackURLs:    us.CanViewCallbackURLs,
+		canViewRooms:           us.CanViewRooms,
+		canPlayVideoRecordings: us.CanPlayVideoRecordings,
+		canManageSessions:      us.CanManageSessions,
+		maxResourceAge:         us.MaxResourceAge,
+		minResourceAge:         us.MinResourceAge,
+		messageFromMask:        us.MessageFromMask,
+		messageToMask:          us.MessageToMask,
+		callFromMask:           us.CallFromMask,
+		callToMask:             us.CallToMask,
+		redactMessageBodies:    us.RedactMessageBodies,
 	}
 }
 
@@ -167,11 +244,11 @@ func (u *User) CanViewMessages() bool {
 }
 
 func (u *User) CanViewMessageFrom() bool {
-	return u.CanViewMessages() && u.canViewMessageFrom
+	return u.CanViewMessages() && u.canViewMessageFrom && u.messageFromMask.Mode != MaskHide
 }
 
 func (u *User) CanViewMessageTo() bool {
-	return u.CanViewMessages() && u.canViewMessageTo
+	return u.CanViewMessages() && u.canViewMessageTo && u.messageToMask.Mode != MaskHide
 }
 
 func (u *User) CanViewMessageBody() bool {
@@ -191,11 +268,11 @@ func (u *User) CanViewCalls() bool {
 }
 
 func (u *User) CanViewCallFrom() bool {
-	return u.CanViewCalls() && u.canViewCallFrom
+	return u.CanViewCalls() && u.canViewCallFrom && u.callFromMask.Mode != MaskHide
 }
 
 func (u *User) CanViewCallTo() bool {
-	return u.CanViewCalls() && u.canViewCallTo
+	return u.CanViewCalls() && u.canViewCallTo && u.callToMask.Mode != MaskHide
 }
 
 func (u *User) CanViewCallPrice() bool {
@@ -226,21 +303,130 @@ func (u *User) CanViewCallbackURLs() bool {
 	return u.canViewCallbackURLs
 }
 
+func (u *User) CanViewRooms() bool {
+	return u.canViewRooms
+}
+
+func (u *User) CanPlayVideoRecordings() bool {
+	return u.CanViewRooms() && u.canPlayVideoRecordings
+}
+
+// CanManageSessions returns true if the user can list and revoke other
+// users' login sessions.
+func (u *User) CanManageSessions() bool {
+	return u.canManageSessions
+}
+
+// ID returns the ID the user logged in with, for example their username or
+// email address, or the empty string if it isn't known.
+func (u *User) ID() string {
+	return u.id
+}
+
+// RequiresMFA returns true if the user's group requires two-factor
+// authentication.
+func (u *User) RequiresMFA() bool {
+	return u.requireMFA
+}
+
+// Group returns the name of the policy group the user belongs to, or the
+// empty string if the user isn't part of a policy.
+func (u *User) Group() string {
+	return u.group
+}
+
+// CanViewAccount returns true if the user can view resources in the Twilio
+// account with the given sid.
+func (u *User) CanViewAccount(sid string) bool {
+	if len(u.accounts) == 0 {
+		return true
+	}
+	for _, acct := range u.accounts {
+		if acct == sid {
+			return true
+		}
+	}
+	return false
+}
+
+// IsScoped returns true if the user can only view messages and calls
+// involving particular phone numbers or messaging services.
+func (u *User) IsScoped() bool {
+	return !u.scope.empty()
+}
+
+// Scope returns the phone numbers and messaging services the user is
+// restricted to, or nil if the user isn't scoped.
+func (u *User) Scope() *Scope {
+	if !u.IsScoped() {
+		return nil
+	}
+	return u.scope
+}
+
+// InScope returns true if the user can view a resource with the given
+// messaging service sid (which may be empty) and phone numbers.
+func (u *User) InScope(messagingServiceSid string, numbers ...string) bool {
+	if !u.IsScoped() {
+		return true
+	}
+	return u.scope.Matches(messagingServiceSid, numbers...)
+}
+
+func (u *User) MessageFromMask() Mask {
+	return u.messageFromMask
+}
+
+func (u *User) MessageToMask() Mask {
+	return u.messageToMask
+}
+
+func (u *User) CallFromMask() Mask {
+	return u.callFromMask
+}
+
+func (u *User) CallToMask() Mask {
+	return u.callToMask
+}
+
+// RedactMessageBodies returns true if sensitive information should be removed
+// from message bodies before they are shown to the user.
+func (u *User) RedactMessageBodies() bool {
+	return u.redactMessageBodies
+}
+
 // CanViewResource returns true if the specified timestamp is within the
 // user's maxResourceAge setting. If the user's maxResourceAge is nonzero, it
 // overrides the globalMaxAge. Returns true if the globalMaxAge and the user's
 // maxResourceAge are both zero.
 func (u *User) CanViewResource(resourceCreatedAt time.Time, globalMaxAge time.Duration) bool {
-	var maxAge = globalMaxAge
-	if u.maxResourceAge != 0 {
-		maxAge = u.maxResourceAge
-	}
+	maxAge := u.MaxResourceAge(globalMaxAge)
 	if maxAge == 0 {
 		return true
 	}
 	return time.Since(resourceCreatedAt) < maxAge
 }
 
+// MinResourceAge returns the age resources have to reach before the user can
+// view them, given the global min_resource_age. The user's own setting takes
+// precedence.
+func (u *User) MinResourceAge(globalMinAge time.Duration) time.Duration {
+	if u.minResourceAge != 0 {
+		return u.minResourceAge
+	}
+	return globalMinAge
+}
+
+// IsTooNew returns true if the resource is newer than the user's
+// minResourceAge setting, or globalMinAge if the user's setting is zero.
+func (u *User) IsTooNew(resourceCreatedAt time.Time, globalMinAge time.Duration) bool {
+	minAge := u.MinResourceAge(globalMinAge)
+	if minAge == 0 {
+		return false
+	}
+	return time.Since(resourceCreatedAt) < minAge
+}
+
 type ctxVar int
 
 var userKey ctxVar = 0
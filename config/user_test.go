@@ -48,3 +48,24 @@ func TestCanViewResource(t *testing.T) {
 		t.Errorf("with local Age = time.Minute, global Age == time.Nanosecond, CanViewResource (2 minutes ago) should be false, got true")
 	}
 }
+
+func TestIsTooNew(t *testing.T) {
+	u := &User{}
+	now := time.Now()
+	if u.IsTooNew(now, 0) {
+		t.Errorf("with both values zero, IsTooNew should be false, got true")
+	}
+	if !u.IsTooNew(now, time.Hour) {
+		t.Errorf("with global Age == time.Hour, IsTooNew should be true, got false")
+	}
+	if u.IsTooNew(now.Add(-2*time.Hour), time.Hour) {
+		t.Errorf("with global Age == time.Hour, IsTooNew (2 hours ago) should be false, got true")
+	}
+	u.minResourceAge = 24 * time.Hour
+	if !u.IsTooNew(now.Add(-2*time.Hour), time.Hour) {
+		t.Errorf("with local Age = 24h, IsTooNew (2 hours ago) should be true, got false")
+	}
+	if reason := u.WhyTooNew(now, time.Hour); reason != "It's newer than your group's min_resource_age (24h0m0s)" {
+		t.Errorf("wrong reason: %q", reason)
+	}
+}
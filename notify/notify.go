@@ -0,0 +1,89 @@
+// Package notify watches for new Twilio alerts and sends notifications about
+// them, to webhooks, Slack or email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// A notification lists at most this many alerts. The rest are only counted.
+const maxNotificationAlerts = 10
+
+// A Notification tells someone about new alerts that matched a rule. Every
+// alert in a notification has the same error code and account.
+type Notification struct {
+	Rule       string      `json:"rule"`
+	AccountSid string      `json:"account_sid"`
+	ErrorCode  twilio.Code `json:"error_code"`
+	// The description of the most recent alert.
+	Description string `json:"description"`
+	// The number of new alerts. Alerts lists at most ten of them.
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Where to see the alerts with this error code in Logrole, if
+	// public_host is set.
+	URL    string          `json:"url,omitempty"`
+	Alerts []*AlertSummary `json:"alerts"`
+}
+
+// An AlertSummary describes one alert in a Notification.
+type AlertSummary struct {
+	Sid         string          `json:"sid"`
+	ResourceSid string          `json:"resource_sid,omitempty"`
+	LogLevel    twilio.LogLevel `json:"log_level"`
+	Description string          `json:"description"`
+	DateCreated time.Time       `json:"date_created"`
+	URL         string          `json:"url,omitempty"`
+}
+
+// Subject returns a one line summary of n.
+func (n *Notification) Subject() string {
+	noun := "alert"
+	if n.Count != 1 {
+		noun = "alerts"
+	}
+	return fmt.Sprintf("%d new Twilio %s with error code %d (rule %s)", n.Count, noun, n.ErrorCode, n.Rule)
+}
+
+// Text returns a plain text description of n, for chat messages and email.
+func (n *Notification) Text() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n\n", n.Subject())
+	if n.Description != "" {
+		fmt.Fprintf(&b, "%s\n", n.Description)
+	}
+	fmt.Fprintf(&b, "Account: %s\n", n.AccountSid)
+	fmt.Fprintf(&b, "First seen: %s\n", n.FirstSeen.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Last seen: %s\n", n.LastSeen.UTC().Format(time.RFC3339))
+	if n.URL != "" {
+		fmt.Fprintf(&b, "View them: %s\n", n.URL)
+	}
+	b.WriteString("\n")
+	for _, a := range n.Alerts {
+		fmt.Fprintf(&b, "- %s %s", a.DateCreated.UTC().Format(time.RFC3339), a.Sid)
+		if a.ResourceSid != "" {
+			fmt.Fprintf(&b, " (%s)", a.ResourceSid)
+		}
+		if a.URL != "" {
+			fmt.Fprintf(&b, " %s", a.URL)
+		}
+		b.WriteString("\n")
+	}
+	if more := n.Count - len(n.Alerts); more > 0 {
+		fmt.Fprintf(&b, "- and %d more\n", more)
+	}
+	return b.String()
+}
+
+// A Sink sends notifications somewhere. Implement Sink to send them
+// somewhere new, and pass it to NewWatcher. Sinks must be safe to use from
+// multiple goroutines.
+type Sink interface {
+	Notify(context.Context, *Notification) error
+}
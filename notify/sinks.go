@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+)
+
+// How long to wait for a sink to accept a notification.
+var sinkTimeout = 15 * time.Second
+
+// NewSinks returns the sinks in cfgs, by name. Webhook and Slack sinks use
+// client, or http.DefaultClient if client is nil.
+func NewSinks(cfgs []*config.AlertSink, client *http.Client) (map[string]Sink, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	sinks := make(map[string]Sink, len(cfgs))
+	for _, cfg := range cfgs {
+		switch cfg.Type {
+		case config.SinkWebhook:
+			sinks[cfg.Name] = &WebhookSink{URL: cfg.URL, Client: client}
+		case config.SinkSlack:
+			sinks[cfg.Name] = &SlackSink{URL: cfg.URL, Client: client}
+		case config.SinkEmail:
+			from, err := mail.ParseAddress(cfg.From)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid from address for sink %s: %v", cfg.Name, err)
+			}
+			to := make([]*mail.Address, len(cfg.To))
+			for i := range cfg.To {
+				to[i], err = mail.ParseAddress(cfg.To[i])
+				if err != nil {
+					return nil, fmt.Errorf("Invalid to address for sink %s: %v", cfg.Name, err)
+				}
+			}
+			sinks[cfg.Name] = &EmailSink{
+				Addr:     cfg.SMTPServer,
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword,
+				From:     from,
+				To:       to,
+			}
+		default:
+			return nil, fmt.Errorf("Unknown type %q for sink %s", cfg.Type, cfg.Name)
+		}
+	}
+	return sinks, nil
+}
+
+// postJSON POSTs body, encoded as JSON, to rawurl.
+func postJSON(ctx context.Context, client *http.Client, rawurl string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", rawurl, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Don't put the URL in the error; webhook URLs are often secret.
+		host := ""
+		if u, err := url.Parse(rawurl); err == nil {
+			host = u.Host
+		}
+		return fmt.Errorf("Webhook at %s returned %s", host, resp.Status)
+	}
+	return nil
+}
+
+// A WebhookSink POSTs notifications to URL as JSON.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Notify(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, s.Client, s.URL, n)
+}
+
+// A SlackSink posts notifications to a Slack incoming webhook, or anything
+// that accepts the same messages, like Mattermost.
+type SlackSink struct {
+	URL    string
+	Client *http.Client
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (s *SlackSink) Notify(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, s.Client, s.URL, &slackMessage{Text: n.Text()})
+}
+
+// An EmailSink emails notifications through an SMTP server. It uses
+// STARTTLS if the server supports it.
+type EmailSink struct {
+	// The SMTP server's host and port.
+	Addr string
+	// If Username is empty, the sink doesn't log in.
+	Username string
+	Password string
+	From     *mail.Address
+	To       []*mail.Address
+}
+
+// message returns the email for n.
+func (s *EmailSink) message(n *Notification, now time.Time) []byte {
+	to := make([]string, len(s.To))
+	for i := range s.To {
+		to[i] = s.To[i].String()
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From.String())
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.Replace(n.Text(), "\n", "\r\n", -1))
+	return b.Bytes()
+}
+
+func (s *EmailSink) Notify(ctx context.Context, n *Notification) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From.Address); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(n, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,182 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestNotification() *Notification {
+	now := time.Now().UTC()
+	return &Notification{
+		Rule:        "webhooks",
+		AccountSid:  "AC123",
+		ErrorCode:   11200,
+		Description: "HTTP retrieval failure: status code 502 when fetching TwiML",
+		Count:       12,
+		FirstSeen:   now.Add(-time.Minute),
+		LastSeen:    now,
+		URL:         "https://logrole.example.com/alerts?error-code=11200",
+		Alerts: []*AlertSummary{
+			{Sid: "NO123", ResourceSid: "CA123", LogLevel: "error", DateCreated: now},
+		},
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	t.Parallel()
+	received := make(chan *Notification, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected a JSON body, got Content-Type %q", ct)
+		}
+		n := new(Notification)
+		if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+			t.Error(err)
+		}
+		received <- n
+	}))
+	defer s.Close()
+	sink := &WebhookSink{URL: s.URL, Client: http.DefaultClient}
+	if err := sink.Notify(context.Background(), newTestNotification()); err != nil {
+		t.Fatal(err)
+	}
+	n := <-received
+	if n.ErrorCode != 11200 || n.Count != 12 || len(n.Alerts) != 1 || n.Alerts[0].Sid != "NO123" {
+		t.Errorf("webhook got the wrong notification: %#v", n)
+	}
+}
+
+func TestSlackSink(t *testing.T) {
+	t.Parallel()
+	received := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := new(slackMessage)
+		if err := json.NewDecoder(r.Body).Decode(msg); err != nil {
+			t.Error(err)
+		}
+		received <- msg.Text
+	}))
+	defer s.Close()
+	sink := &SlackSink{URL: s.URL, Client: http.DefaultClient}
+	if err := sink.Notify(context.Background(), newTestNotification()); err != nil {
+		t.Fatal(err)
+	}
+	text := <-received
+	for _, want := range []string{"12 new Twilio alerts with error code 11200", "status code 502", "NO123 (CA123)", "and 11 more", "error-code=11200"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected the message to contain %q, got %q", want, text)
+		}
+	}
+}
+
+func TestWebhookSinkError(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer s.Close()
+	sink := &SlackSink{URL: s.URL + "/services/T000/B000/secret", Client: http.DefaultClient}
+	err := sink.Notify(context.Background(), newTestNotification())
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected the error not to contain the webhook URL, got %v", err)
+	}
+}
+
+// smtpMessage is an email received by a stand-in SMTP server.
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// newSMTPServer starts an SMTP server that accepts one email, and sends it
+// to the returned channel.
+func newSMTPServer(t *testing.T) (string, <-chan *smtpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := make(chan *smtpMessage, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		msg := new(smtpMessage)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				tp.PrintfLine("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				tp.PrintfLine("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				tp.PrintfLine("250 OK")
+			case cmd == "DATA":
+				tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				lines, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				msg.data = strings.Join(lines, "\n")
+				tp.PrintfLine("250 OK")
+				msgs <- msg
+			case cmd == "QUIT":
+				tp.PrintfLine("221 Bye")
+				return
+			default:
+				tp.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), msgs
+}
+
+func TestEmailSink(t *testing.T) {
+	t.Parallel()
+	addr, msgs := newSMTPServer(t)
+	sink := &EmailSink{
+		Addr: addr,
+		From: &mail.Address{Name: "Logrole", Address: "logrole@example.com"},
+		To:   []*mail.Address{{Address: "ops@example.com"}, {Address: "oncall@example.com"}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sink.Notify(ctx, newTestNotification()); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-msgs
+	if msg.from != "logrole@example.com" {
+		t.Errorf("expected envelope from logrole@example.com, got %q", msg.from)
+	}
+	if strings.Join(msg.to, ",") != "ops@example.com,oncall@example.com" {
+		t.Errorf("expected both recipients, got %v", msg.to)
+	}
+	for _, want := range []string{"Subject: 12 new Twilio alerts with error code 11200", "To: <ops@example.com>, <oncall@example.com>", "NO123 (CA123)"} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("expected the email to contain %q, got %q", want, msg.data)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// Each poll looks for alerts created up to pollOverlap before the previous
+// poll started, since Twilio can take a while to make an alert visible.
+var pollOverlap = 5 * time.Minute
+
+// Each poll fetches at most this many pages of alerts for each account.
+var maxPollPages = 10
+
+const pollPageSize = "1000"
+
+// An Account is a Twilio account to watch for alerts.
+type Account struct {
+	Sid    string
+	Client *twilio.Client
+	// The URL of the account's pages in Logrole, ending in a slash, like
+	// "https://logrole.example.com/". If empty, notifications don't link to
+	// Logrole.
+	URL string
+}
+
+type stateKey struct {
+	rule    string
+	account string
+	code    twilio.Code
+}
+
+// ruleState tracks the alerts with one error code in one account that
+// matched a rule.
+type ruleState struct {
+	// When the matching alerts in the rule's window were created. Only kept
+	// if the rule has a window.
+	times []time.Time
+	// Matching alerts that haven't been sent, oldest first.
+	unsent   []*twilio.Alert
+	lastSent time.Time
+}
+
+type accountState struct {
+	// The alerts we've seen, and when they were created.
+	seen map[string]time.Time
+	// When the last successful poll started; zero before the first one.
+	polledAt time.Time
+}
+
+// A Watcher polls Twilio for new alerts, and sends notifications about the
+// ones that match its rules. Each alert is sent at most once for each rule.
+type Watcher struct {
+	log.Logger
+	cfg      *config.AlertNotifications
+	accounts map[string]*Account
+	order    []*Account
+	rules    map[string]*config.AlertRule
+	sinks    map[string]Sink
+
+	mu     sync.Mutex
+	polls  map[string]*accountState
+	states map[stateKey]*ruleState
+}
+
+// NewWatcher returns a Watcher that checks accounts for alerts matching the
+// rules in cfg, and sends notifications to sinks, which must contain every
+// sink the rules use.
+func NewWatcher(l log.Logger, cfg *config.AlertNotifications, accounts []*Account, sinks map[string]Sink) (*Watcher, error) {
+	w := &Watcher{
+		Logger:   l,
+		cfg:      cfg,
+		accounts: make(map[string]*Account, len(accounts)),
+		order:    accounts,
+		rules:    make(map[string]*config.AlertRule, len(cfg.Rules)),
+		sinks:    sinks,
+		polls:    make(map[string]*accountState),
+		states:   make(map[stateKey]*ruleState),
+	}
+	for _, a := range accounts {
+		w.accounts[a.Sid] = a
+	}
+	for _, r := range cfg.Rules {
+		for _, name := range r.Sinks {
+			if _, ok := sinks[name]; !ok {
+				return nil, fmt.Errorf("Rule %s uses unknown sink %s", r.Name, name)
+			}
+		}
+		w.rules[r.Name] = r
+	}
+	return w, nil
+}
+
+// Run polls for new alerts until ctx is canceled.
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		w.Poll(ctx)
+		t := time.NewTimer(w.cfg.PollInterval())
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Poll checks every account for new alerts once, and sends the
+// notifications that are due. The first Poll for an account only records
+// which alerts already exist, so restarting the server doesn't send
+// notifications about old alerts.
+func (w *Watcher) Poll(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	for _, acct := range w.order {
+		alerts, err := w.newAlerts(ctx, acct, now)
+		if err != nil {
+			w.Warn("Couldn't check for new alerts", "account", acct.Sid, "err", err)
+			continue
+		}
+		w.match(acct, alerts)
+	}
+	w.notify(ctx, now)
+}
+
+// newAlerts returns the alerts in acct we haven't seen before, oldest first.
+func (w *Watcher) newAlerts(ctx context.Context, acct *Account, now time.Time) ([]*twilio.Alert, error) {
+	st, ok := w.polls[acct.Sid]
+	if !ok {
+		st = &accountState{seen: make(map[string]time.Time)}
+		w.polls[acct.Sid] = st
+	}
+	start := now.Add(-pollOverlap)
+	if !st.polledAt.IsZero() {
+		start = st.polledAt.Add(-pollOverlap)
+	}
+	data := url.Values{"PageSize": []string{pollPageSize}}
+	iter := acct.Client.Monitor.Alerts.GetAlertsInRange(start, twilio.HeatDeath, data)
+	var alerts []*twilio.Alert
+	for i := 0; i < maxPollPages; i++ {
+		page, err := iter.Next(ctx)
+		if err == twilio.NoMoreResults {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, page.Alerts...)
+	}
+	first := st.polledAt.IsZero()
+	st.polledAt = now
+	// Alerts created before start won't be returned again.
+	for sid, created := range st.seen {
+		if created.Before(start) {
+			delete(st.seen, sid)
+		}
+	}
+	fresh := make([]*twilio.Alert, 0)
+	for _, a := range alerts {
+		if _, ok := st.seen[a.Sid]; ok {
+			continue
+		}
+		st.seen[a.Sid] = a.DateCreated.Time
+		fresh = append(fresh, a)
+	}
+	if first {
+		return nil, nil
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].DateCreated.Time.Before(fresh[j].DateCreated.Time)
+	})
+	return fresh, nil
+}
+
+func (w *Watcher) match(acct *Account, alerts []*twilio.Alert) {
+	for _, a := range alerts {
+		for _, r := range w.cfg.Rules {
+			if !r.Matches(a) {
+				continue
+			}
+			key := stateKey{rule: r.Name, account: acct.Sid, code: a.ErrorCode}
+			st, ok := w.states[key]
+			if !ok {
+				st = new(ruleState)
+				w.states[key] = st
+			}
+			if r.Window > 0 {
+				st.times = append(st.times, a.DateCreated.Time)
+			}
+			st.unsent = append(st.unsent, a)
+		}
+	}
+}
+
+// notify sends notifications for the rules that have enough unsent alerts,
+// and aren't cooling down.
+func (w *Watcher) notify(ctx context.Context, now time.Time) {
+	for key, st := range w.states {
+		r := w.rules[key.rule]
+		cutoff := now.Add(-r.Window)
+		if r.Window > 0 {
+			st.times = createdAfter(st.times, cutoff)
+		}
+		count := len(st.unsent)
+		if r.Window > 0 {
+			count = len(st.times)
+		}
+		switch {
+		case len(st.unsent) > 0 && count >= r.MinAlerts():
+			if st.lastSent.IsZero() || now.Sub(st.lastSent) >= r.CooldownPeriod() {
+				w.send(ctx, r, w.notification(r, w.accounts[key.account], st.unsent))
+				st.unsent = nil
+				st.lastSent = now
+			}
+		case r.Window > 0:
+			// Not enough alerts to send a notification yet. Forget the ones
+			// that are too old to count.
+			unsent := st.unsent[:0]
+			for _, a := range st.unsent {
+				if a.DateCreated.Time.After(cutoff) {
+					unsent = append(unsent, a)
+				}
+			}
+			st.unsent = unsent
+		}
+		if len(st.unsent) == 0 && len(st.times) == 0 && now.Sub(st.lastSent) >= r.CooldownPeriod() {
+			delete(w.states, key)
+		}
+	}
+}
+
+func createdAfter(times []time.Time, cutoff time.Time) []time.Time {
+	after := times[:0]
+	for _, t := range times {
+		if t.After(cutoff) {
+			after = append(after, t)
+		}
+	}
+	return after
+}
+
+// notification returns a Notification for alerts, which are in the same
+// account and have the same error code. It sorts alerts oldest first.
+func (w *Watcher) notification(r *config.AlertRule, acct *Account, alerts []*twilio.Alert) *Notification {
+	// Alerts that Twilio took a while to show us may be out of order.
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].DateCreated.Time.Before(alerts[j].DateCreated.Time)
+	})
+	last := alerts[len(alerts)-1]
+	n := &Notification{
+		Rule:        r.Name,
+		AccountSid:  acct.Sid,
+		ErrorCode:   last.ErrorCode,
+		Description: last.Description(),
+		Count:       len(alerts),
+		FirstSeen:   alerts[0].DateCreated.Time,
+		LastSeen:    last.DateCreated.Time,
+		Alerts:      make([]*AlertSummary, 0, maxNotificationAlerts),
+	}
+	if acct.URL != "" {
+		n.URL = acct.URL + "alerts?" + url.Values{"error-code": []string{strconv.Itoa(int(last.ErrorCode))}}.Encode()
+	}
+	for i := len(alerts) - 1; i >= 0 && len(n.Alerts) < maxNotificationAlerts; i-- {
+		a := alerts[i]
+		summary := &AlertSummary{
+			Sid:         a.Sid,
+			ResourceSid: a.ResourceSid,
+			LogLevel:    a.LogLevel,
+			Description: a.Description(),
+			DateCreated: a.DateCreated.Time,
+		}
+		if acct.URL != "" {
+			summary.URL = acct.URL + "alerts/" + a.Sid
+		}
+		n.Alerts = append(n.Alerts, summary)
+	}
+	return n
+}
+
+func (w *Watcher) send(ctx context.Context, r *config.AlertRule, n *Notification) {
+	for _, name := range r.Sinks {
+		sctx, cancel := context.WithTimeout(ctx, sinkTimeout)
+		err := w.sinks[name].Notify(sctx, n)
+		cancel()
+		if err != nil {
+			w.Error("Couldn't send alert notification", "rule", r.Name, "sink", name, "err", err)
+			continue
+		}
+		w.Info("Sent alert notification", "rule", r.Name, "sink", name, "code", n.ErrorCode, "count", n.Count)
+	}
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+var nullLogger = log.New()
+
+func init() {
+	nullLogger.SetHandler(log.DiscardHandler())
+}
+
+// alertServer is a stand-in for the Twilio Monitor API.
+type alertServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	alerts []string
+}
+
+func newAlertServer() *alertServer {
+	s := new(alertServer)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		// Newest first, like Twilio.
+		alerts := make([]string, len(s.alerts))
+		for i := range s.alerts {
+			alerts[i] = s.alerts[len(s.alerts)-1-i]
+		}
+		fmt.Fprintf(w, `{"meta": {"next_page_url": null, "key": "alerts"}, "alerts": [%s]}`, strings.Join(alerts, ","))
+	}))
+	return s
+}
+
+func (s *alertServer) add(sid string, code int, level string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, fmt.Sprintf(`{"sid": "%s", "error_code": "%d", "log_level": "%s", "resource_sid": "CA123", "alert_text": "Msg=Something+broke", "date_created": "%s"}`,
+		sid, code, level, time.Now().UTC().Format(time.RFC3339)))
+}
+
+// recordingSink records the notifications sent to it.
+type recordingSink struct {
+	mu   sync.Mutex
+	sent []*Notification
+}
+
+func (s *recordingSink) Notify(ctx context.Context, n *Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+func (s *recordingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+func newTestWatcher(t *testing.T, s *alertServer, rule *config.AlertRule) (*Watcher, *recordingSink) {
+	t.Helper()
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Monitor.Base = s.URL
+	rule.Name = "test"
+	rule.Sinks = []string{"recorder"}
+	sink := new(recordingSink)
+	w, err := NewWatcher(nullLogger, &config.AlertNotifications{Rules: []*config.AlertRule{rule}},
+		[]*Account{{Sid: "AC123", Client: c, URL: "https://logrole.example.com/"}},
+		map[string]Sink{"recorder": sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, sink
+}
+
+func TestWatcherSendsNewAlerts(t *testing.T) {
+	t.Parallel()
+	s := newAlertServer()
+	defer s.Close()
+	s.add("NO1", 11200, "error")
+	w, sink := newTestWatcher(t, s, &config.AlertRule{ErrorCodes: []twilio.Code{11200}})
+	ctx := context.Background()
+	w.Poll(ctx)
+	if n := sink.count(); n != 0 {
+		t.Fatalf("expected no notifications for alerts that existed before the first poll, got %d", n)
+	}
+	s.add("NO2", 11200, "error")
+	s.add("NO3", 30003, "error")
+	w.Poll(ctx)
+	if n := sink.count(); n != 1 {
+		t.Fatalf("expected 1 notification, got %d", n)
+	}
+	n := sink.sent[0]
+	if n.Count != 1 || n.Alerts[0].Sid != "NO2" || n.ErrorCode != 11200 {
+		t.Errorf("expected a notification for NO2, got %#v", n)
+	}
+	if n.URL != "https://logrole.example.com/alerts?error-code=11200" {
+		t.Errorf("expected a link to the alerts with the error code, got %q", n.URL)
+	}
+	if n.Alerts[0].URL != "https://logrole.example.com/alerts/NO2" {
+		t.Errorf("expected a link to the alert, got %q", n.Alerts[0].URL)
+	}
+	w.Poll(ctx)
+	if n := sink.count(); n != 1 {
+		t.Errorf("expected alerts to be sent only once, got %d notifications", n)
+	}
+}
+
+func TestWatcherThreshold(t *testing.T) {
+	t.Parallel()
+	s := newAlertServer()
+	defer s.Close()
+	w, sink := newTestWatcher(t, s, &config.AlertRule{Threshold: 3, Window: 10 * time.Minute})
+	ctx := context.Background()
+	w.Poll(ctx)
+	s.add("NO1", 11200, "error")
+	s.add("NO2", 11200, "error")
+	s.add("NO3", 30003, "error")
+	w.Poll(ctx)
+	if n := sink.count(); n != 0 {
+		t.Fatalf("expected no notifications below the threshold, got %d", n)
+	}
+	s.add("NO4", 11200, "error")
+	w.Poll(ctx)
+	if n := sink.count(); n != 1 {
+		t.Fatalf("expected 1 notification once the threshold is reached, got %d", n)
+	}
+	if n := sink.sent[0]; n.Count != 3 || n.ErrorCode != 11200 {
+		t.Errorf("expected the 3 alerts with code 11200, got %d with code %d", n.Count, n.ErrorCode)
+	}
+}
+
+func TestWatcherCooldown(t *testing.T) {
+	t.Parallel()
+	s := newAlertServer()
+	defer s.Close()
+	w, sink := newTestWatcher(t, s, &config.AlertRule{Cooldown: 50 * time.Millisecond})
+	ctx := context.Background()
+	w.Poll(ctx)
+	s.add("NO1", 11200, "error")
+	w.Poll(ctx)
+	s.add("NO2", 11200, "error")
+	s.add("NO3", 11200, "error")
+	w.Poll(ctx)
+	if n := sink.count(); n != 1 {
+		t.Fatalf("expected 1 notification during the cooldown, got %d", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	w.Poll(ctx)
+	if n := sink.count(); n != 2 {
+		t.Fatalf("expected a notification after the cooldown, got %d", n)
+	}
+	n := sink.sent[1]
+	if n.Count != 2 {
+		t.Fatalf("expected the 2 alerts from the cooldown, got %d", n.Count)
+	}
+	if sids := n.Alerts[0].Sid + "," + n.Alerts[1].Sid; sids != "NO3,NO2" && sids != "NO2,NO3" {
+		t.Errorf("expected NO2 and NO3, got %s", sids)
+	}
+}
+
+func TestNewWatcherUnknownSink(t *testing.T) {
+	t.Parallel()
+	cfg := &config.AlertNotifications{Rules: []*config.AlertRule{{Name: "test", Sinks: []string{"pager"}}}}
+	if _, err := NewWatcher(nullLogger, cfg, nil, map[string]Sink{}); err == nil {
+		t.Error("expected an error for an unknown sink, got nil")
+	}
+}
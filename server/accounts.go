@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/rest"
+)
+
+// Pages for the main account are served at the root; pages for every other
+// account are served under /accounts/<sid>.
+var accountRoute = regexp.MustCompile(`^/accounts/(?P<sid>AC[a-f0-9]{32})(?P<path>/.*)?$`)
+
+// accountLink is an entry in the account switcher.
+type accountLink struct {
+	Sid          string
+	FriendlyName string
+	// The URL of the account's homepage.
+	Base string
+}
+
+// accountState describes the account a request is being served from.
+type accountState struct {
+	Account *config.Account
+	// The URL that relative links on the page resolve against, either "/" or
+	// "/accounts/<sid>/".
+	Base string
+	// Other accounts the user can switch to. Empty if the user can only view
+	// one account.
+	Links []*accountLink
+}
+
+type accountCtxVar int
+
+var accountStateKey accountCtxVar = 0
+
+func getAccountState(r *http.Request) (*accountState, bool) {
+	st, ok := r.Context().Value(accountStateKey).(*accountState)
+	return st, ok && st != nil
+}
+
+func accountBase(accounts []*config.Account, a *config.Account) string {
+	if a == accounts[0] {
+		return "/"
+	}
+	return "/accounts/" + a.Sid + "/"
+}
+
+// accountPath returns the URL for the given path (which should start with a
+// slash) in the account the request is being served from.
+func accountPath(r *http.Request, path string) string {
+	st, ok := getAccountState(r)
+	if !ok {
+		return path
+	}
+	return strings.TrimSuffix(st.Base, "/") + path
+}
+
+// detachedContext returns a Context for work that should outlive the
+// request, but still retrieve resources from the request's account.
+func detachedContext(r *http.Request) context.Context {
+	ctx := context.Background()
+	if a, ok := config.GetAccount(r.Context()); ok {
+		return config.WithAccount(ctx, a)
+	}
+	return ctx
+}
+
+// backgroundContext is like detachedContext, but calls to Twilio made with
+// it yield to calls made for users.
+func backgroundContext(r *http.Request) context.Context {
+	return views.Background(detachedContext(r))
+}
+
+// withAccounts determines the Twilio account for a request from its URL,
+// strips the account prefix from the URL path, and stores the account in
+// the request context. Requests for an account the user cannot view are
+// denied. Must be called after the User has been set on the request.
+//
+// accounts[0] is the main account, served without a prefix. If the user
+// cannot view the main account, GET requests for unprefixed pages redirect
+// to the first account the user can view.
+func withAccounts(h http.Handler, accounts []*config.Account) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := config.GetUser(r)
+		if !ok {
+			rest.ServerError(w, r, errors.New("No user available"))
+			return
+		}
+		path := r.URL.Path
+		var acct *config.Account
+		if match := accountRoute.FindStringSubmatch(path); match != nil {
+			for _, a := range accounts {
+				if a.Sid == match[1] {
+					acct = a
+					break
+				}
+			}
+			if acct == nil {
+				rest.NotFound(w, r)
+				return
+			}
+			if !u.CanViewAccount(acct.Sid) {
+				rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+				return
+			}
+			path = match[2]
+			if path == "" {
+				path = "/"
+			}
+		} else {
+			for _, a := range accounts {
+				if u.CanViewAccount(a.Sid) {
+					acct = a
+					break
+				}
+			}
+			if acct == nil {
+				rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+				return
+			}
+			if acct != accounts[0] && r.Method == "GET" {
+				dest := *r.URL
+				dest.Path = strings.TrimSuffix(accountBase(accounts, acct), "/") + path
+				dest.RawPath = ""
+				http.Redirect(w, r, dest.String(), http.StatusFound)
+				return
+			}
+		}
+		st := &accountState{
+			Account: acct,
+			Base:    accountBase(accounts, acct),
+		}
+		for _, a := range accounts {
+			if u.CanViewAccount(a.Sid) {
+				st.Links = append(st.Links, &accountLink{
+					Sid:          a.Sid,
+					FriendlyName: a.FriendlyName,
+					Base:         accountBase(accounts, a),
+				})
+			}
+		}
+		if len(st.Links) < 2 {
+			st.Links = nil
+		}
+		ctx := context.WithValue(r.Context(), accountStateKey, st)
+		r = r.WithContext(config.WithAccount(ctx, acct))
+		if path != r.URL.Path {
+			stripped := *r.URL
+			stripped.Path = path
+			stripped.RawPath = ""
+			r.URL = &stripped
+		}
+		h.ServeHTTP(w, r)
+	})
+}
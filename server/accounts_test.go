@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/logrole/config"
+)
+
+const subaccountSid = "AC58f1e8f2b1c6b88ca90a012a4be0c279"
+
+var testAccounts = []*config.Account{
+	{Sid: "AC8bcd23dbb4ac9ea4aac7a9bde1b9d4d8", FriendlyName: "Main account"},
+	{Sid: subaccountSid, FriendlyName: "Support"},
+}
+
+func subaccountUser(t *testing.T) *config.User {
+	p := &config.Policy{
+		&config.Group{
+			Name:        "support",
+			Permissions: config.AllUserSettings(),
+			Users:       []string{"test@example.com"},
+			Accounts:    []string{subaccountSid},
+		},
+	}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestAccountPrefixStripped(t *testing.T) {
+	t.Parallel()
+	var path, sid string
+	h := withAccounts(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if a, ok := config.GetAccount(r.Context()); ok {
+			sid = a.Sid
+		}
+	}), testAccounts)
+	req, _ := http.NewRequest("GET", "/accounts/"+subaccountSid+"/calls", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("expected Code to be 200, got %d", w.Code)
+	}
+	if path != "/calls" {
+		t.Errorf("expected path to be /calls, got %s", path)
+	}
+	if sid != subaccountSid {
+		t.Errorf("expected account to be %s, got %s", subaccountSid, sid)
+	}
+}
+
+func TestAccountRedirectsToVisibleAccount(t *testing.T) {
+	t.Parallel()
+	h := withAccounts(http.NotFoundHandler(), testAccounts)
+	req, _ := http.NewRequest("GET", "/calls?to=%2B14105551234", nil)
+	req = config.SetUser(req, subaccountUser(t))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 302 {
+		t.Errorf("expected Code to be 302, got %d", w.Code)
+	}
+	expected := "/accounts/" + subaccountSid + "/calls?to=%2B14105551234"
+	if loc := w.Header().Get("Location"); loc != expected {
+		t.Errorf("expected redirect to %s, got %s", expected, loc)
+	}
+}
+
+func TestAccountNotVisibleForbidden(t *testing.T) {
+	t.Parallel()
+	h := withAccounts(http.NotFoundHandler(), testAccounts)
+	req, _ := http.NewRequest("GET", "/accounts/"+testAccounts[0].Sid+"/calls", nil)
+	req = config.SetUser(req, subaccountUser(t))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+	req, _ = http.NewRequest("GET", "/accounts/ACffffffffffffffffffffffffffffffff/calls", nil)
+	req = config.SetUser(req, theUser)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Errorf("expected Code to be 404, got %d", w.Code)
+	}
+}
+
+func TestAccountBaseRendered(t *testing.T) {
+	t.Parallel()
+	s, err := newIndexServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := withAccounts(s, testAccounts)
+	req, _ := http.NewRequest("GET", "/accounts/"+subaccountSid+"/", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `<base href="/accounts/`+subaccountSid+`/">`) {
+		t.Errorf("expected page to set the account's base URL, got %s", body)
+	}
+	if !strings.Contains(body, `id="account-select"`) {
+		t.Errorf("expected page to show the account switcher")
+	}
+}
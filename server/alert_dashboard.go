@@ -0,0 +1,480 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/rest"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// The dashboard fetches alerts in pages of this size.
+const dashboardPageSize = 1000
+
+// The dashboard stops after fetching this many pages of alerts, so a long
+// time range can't tie up the server, or use up the calls we're allowed to
+// make to Twilio.
+var maxDashboardPages = 20
+
+// How long the dashboard allows for fetching each page of alerts. The fetch
+// runs for at most maxDashboardPages times this, even if the user stops
+// waiting for it; the pages it fetches are cached, so reloading the
+// dashboard counts more of the alerts.
+var dashboardPageTimeout = 3 * time.Second
+
+// The dashboard lists at most this many affected resources for each error
+// code.
+const maxGroupResources = 10
+
+// The windows the dashboard counts alerts in, if the user doesn't choose
+// any.
+const defaultDashboardWindows = "1h,24h,7d"
+
+// Users can choose at most this many windows.
+const maxDashboardWindows = 6
+
+// An alertWindow is a period ending at the end of the dashboard's time range.
+type alertWindow struct {
+	Name     string
+	Duration time.Duration
+}
+
+// parseWindows parses a comma-separated list of windows like "30m,6h,7d".
+func parseWindows(val string) ([]*alertWindow, error) {
+	parts := strings.Split(val, ",")
+	if len(parts) > maxDashboardWindows {
+		return nil, fmt.Errorf("Too many windows: choose at most %d", maxDashboardWindows)
+	}
+	windows := make([]*alertWindow, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		var d time.Duration
+		var err error
+		if days := strings.TrimSuffix(part, "d"); days != part {
+			var n int
+			n, err = strconv.Atoi(days)
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			d, err = time.ParseDuration(part)
+		}
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("Invalid window %q: use a duration like 30m, 6h or 7d", part)
+		}
+		windows = append(windows, &alertWindow{Name: windowName(d), Duration: d})
+	}
+	return windows, nil
+}
+
+// windowName returns a short name for d, like "7d" or "90m".
+func windowName(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	}
+	return d.String()
+}
+
+// An alertGroup summarizes the alerts with one error code.
+type alertGroup struct {
+	Code twilio.Code
+	// The description and log level of the most recent alert.
+	Description string
+	LogLevel    twilio.LogLevel
+	MoreInfo    string
+	Count       int
+	// The number of alerts in each of the dashboard's windows.
+	WindowCounts []int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	// The most recently affected resources, newest first.
+	ResourceSids []string
+	// The number of affected resources not in ResourceSids.
+	MoreResources int
+
+	resources map[string]bool
+}
+
+// groupAlerts groups alerts by error code, and counts how many alerts with
+// each code were created in each window before end. Groups with the most
+// alerts come first.
+func groupAlerts(alerts []*views.Alert, windows []*alertWindow, end time.Time) []*alertGroup {
+	groups := make(map[twilio.Code]*alertGroup)
+	for _, alert := range alerts {
+		code, err := alert.ErrorCode()
+		if err != nil {
+			continue
+		}
+		created, err := alert.DateCreated()
+		if err != nil || !created.Valid {
+			continue
+		}
+		g, ok := groups[code]
+		if !ok {
+			g = &alertGroup{
+				Code:         code,
+				WindowCounts: make([]int, len(windows)),
+				resources:    make(map[string]bool),
+			}
+			groups[code] = g
+		}
+		g.Count++
+		for i, w := range windows {
+			if age := end.Sub(created.Time); age >= 0 && age < w.Duration {
+				g.WindowCounts[i]++
+			}
+		}
+		if g.FirstSeen.IsZero() || created.Time.Before(g.FirstSeen) {
+			g.FirstSeen = created.Time
+		}
+		if created.Time.After(g.LastSeen) {
+			g.LastSeen = created.Time
+			if desc, err := alert.Description(); err == nil {
+				g.Description = desc
+			}
+			if level, err := alert.LogLevel(); err == nil {
+				g.LogLevel = level
+			}
+			if moreInfo, err := alert.MoreInfo(); err == nil {
+				g.MoreInfo = moreInfo
+			}
+		}
+		// Twilio returns the newest alerts first, so the resources are
+		// added newest first.
+		if sid, err := alert.ResourceSid(); err == nil && sid != "" && !g.resources[sid] {
+			g.resources[sid] = true
+			if len(g.ResourceSids) < maxGroupResources {
+				g.ResourceSids = append(g.ResourceSids, sid)
+			} else {
+				g.MoreResources++
+			}
+		}
+	}
+	result := make([]*alertGroup, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		if !result[i].LastSeen.Equal(result[j].LastSeen) {
+			return result[i].LastSeen.After(result[j].LastSeen)
+		}
+		return result[i].Code < result[j].Code
+	})
+	return result
+}
+
+type alertDashboardServer struct {
+	log.Logger
+	Client         views.Client
+	MaxResourceAge time.Duration
+	// Resources newer than this are hidden. Set by NewServer.
+	MinResourceAge time.Duration
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+}
+
+type alertDashboardData struct {
+	Groups  []*alertGroup
+	Windows []*alertWindow
+	// The number of alerts counted.
+	Total int
+	// False if there were more alerts in the time range than the dashboard
+	// fetches, or Twilio took too long to return all of them.
+	Complete bool
+	// True if the dashboard is still fetching alerts in the background.
+	Fetching bool
+	Loc      *time.Location
+	Query    url.Values
+	Err      string
+}
+
+func (d *alertDashboardData) Title() string {
+	return "Alerts by Error Code"
+}
+
+func (d *alertDashboardData) LogLevels() []twilio.LogLevel {
+	return validAlertLevels
+}
+
+// ListQuery returns the query for the alerts list page, showing the alerts
+// in the dashboard with the given error code.
+func (d *alertDashboardData) ListQuery(code twilio.Code) template.URL {
+	data := url.Values{}
+	for _, key := range []string{"log-level", "resource-sid", "alert-start", "alert-end"} {
+		if val := d.Query.Get(key); val != "" {
+			data.Set(key, val)
+		}
+	}
+	data.Set("error-code", strconv.Itoa(int(code)))
+	return template.URL(data.Encode())
+}
+
+func newAlertDashboardServer(l log.Logger, vc views.Client,
+	lf services.LocationFinder, maxResourceAge time.Duration) (*alertDashboardServer, error) {
+	s := &alertDashboardServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+		MaxResourceAge: maxResourceAge,
+	}
+	tpl, err := newTpl(template.FuncMap{
+		"min":        minFunc(s.MaxResourceAge),
+		"max":        s.maxSearchVal,
+		"has_prefix": strings.HasPrefix,
+		"start_val":  s.StartSearchVal,
+		"end_val":    s.EndSearchVal,
+	}, base+alertDashboardTpl)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+// defaultAge returns how far back the dashboard looks if the user doesn't
+// choose a start time.
+func (s *alertDashboardServer) defaultAge() time.Duration {
+	if s.MaxResourceAge == config.DefaultMaxResourceAge {
+		// one week ago, arbitrary, same as the alerts list.
+		return 7 * 24 * time.Hour
+	}
+	return s.MaxResourceAge
+}
+
+func (s *alertDashboardServer) StartSearchVal(query url.Values, loc *time.Location) string {
+	if start, ok := query["alert-start"]; ok {
+		return start[0]
+	}
+	return minLoc(s.defaultAge(), loc)
+}
+
+func (s *alertDashboardServer) EndSearchVal(query url.Values, loc *time.Location) string {
+	if end, ok := query["alert-end"]; ok {
+		return end[0]
+	}
+	return s.maxSearchVal(loc)
+}
+
+// maxSearchVal returns the latest time the user can search for.
+func (s *alertDashboardServer) maxSearchVal(loc *time.Location) string {
+	return maxAgeLoc(s.MinResourceAge, loc)
+}
+
+func (s *alertDashboardServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	data := &baseData{
+		LF: s.LocationFinder,
+		Data: &alertDashboardData{
+			Err:      cleanError(err),
+			Loc:      s.LocationFinder.GetLocationReq(r),
+			Query:    query,
+			Complete: true,
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+}
+
+func (s *alertDashboardServer) validParams() []string {
+	return []string{"log-level", "resource-sid", "alert-start", "alert-end", "windows"}
+}
+
+// A dashboardFetch holds the alerts fetched for the dashboard so far.
+type dashboardFetch struct {
+	mu       sync.Mutex
+	alerts   []*views.Alert
+	complete bool
+	err      error
+	done     chan struct{}
+}
+
+func newDashboardFetch() *dashboardFetch {
+	return &dashboardFetch{done: make(chan struct{})}
+}
+
+func (f *dashboardFetch) add(alerts []*views.Alert) {
+	f.mu.Lock()
+	f.alerts = append(f.alerts, alerts...)
+	f.mu.Unlock()
+}
+
+func (f *dashboardFetch) finish(complete bool, err error) {
+	f.mu.Lock()
+	f.complete = complete
+	f.err = err
+	f.mu.Unlock()
+	close(f.done)
+}
+
+// wait waits for the fetch to finish, or ctx to expire, and returns the
+// alerts fetched so far. fetching is true if the fetch hasn't finished; a
+// fetch that is still on its first page returns no alerts and no error.
+func (f *dashboardFetch) wait(ctx context.Context) (alerts []*views.Alert, complete bool, fetching bool, err error) {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, false, false, f.err
+		}
+		return f.alerts, f.complete, false, nil
+	default:
+	}
+	return f.alerts[:len(f.alerts):len(f.alerts)], false, true, nil
+}
+
+// getAlerts fetches every page of alerts in the range from start to end,
+// up to maxDashboardPages, and adds them to f. The fetch is complete unless
+// there were more alerts than that, or ctx expired before all of them were
+// fetched.
+func (s *alertDashboardServer) getAlerts(ctx context.Context, u *config.User, start, end time.Time, vals url.Values, f *dashboardFetch) {
+	page, _, err := s.Client.GetAlertPageInRange(ctx, u, start, end, vals)
+	for pages := 1; ; pages++ {
+		if err == twilio.NoMoreResults {
+			f.finish(true, nil)
+			return
+		}
+		if err != nil {
+			if pages > 1 && ctx.Err() != nil {
+				s.Warn("Timed out fetching alerts for the dashboard", "pages", pages-1)
+				f.finish(false, nil)
+				return
+			}
+			f.finish(false, err)
+			return
+		}
+		f.add(page.Alerts())
+		next := page.NextPageURI()
+		if !next.Valid {
+			f.finish(true, nil)
+			return
+		}
+		if pages >= maxDashboardPages {
+			f.finish(false, nil)
+			return
+		}
+		page, _, err = s.Client.GetNextAlertPageInRange(ctx, u, start, end, next.String)
+	}
+}
+
+func (s *alertDashboardServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewAlerts() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	windowVal := query.Get("windows")
+	if windowVal == "" {
+		windowVal = defaultDashboardWindows
+	}
+	windows, err := parseWindows(windowVal)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	loc := s.LocationFinder.GetLocationReq(r)
+	startTime, endTime, wroteError := getTimes(w, r, "alert-start", "alert-end", loc, query, s)
+	if wroteError {
+		return
+	}
+	now := time.Now()
+	if _, ok := query["alert-start"]; !ok {
+		// Truncated so a reload can use the pages cached by the last fetch.
+		startTime = now.Add(-s.defaultAge()).Truncate(time.Minute)
+	}
+	if !startTime.Before(endTime) {
+		s.renderError(w, r, http.StatusBadRequest, query, errors.New("The start time must be before the end time"))
+		return
+	}
+	vals := url.Values{}
+	vals.Set("PageSize", strconv.Itoa(dashboardPageSize))
+	if filterErr := setPageFilters(query, vals); filterErr != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, filterErr)
+		return
+	}
+	// The fetch gets its own deadline, long enough to fetch every page, and
+	// keeps going if the user stops waiting for it.
+	fetchCtx, fetchCancel := context.WithTimeout(detachedContext(r), time.Duration(maxDashboardPages)*dashboardPageTimeout)
+	f := newDashboardFetch()
+	go func() {
+		defer fetchCancel()
+		s.getAlerts(fetchCtx, u, startTime, endTime, vals, f)
+	}()
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	start := monotime.Now()
+	alerts, complete, fetching, err := f.wait(ctx)
+	if err != nil {
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.Status {
+			case 400:
+				s.renderError(w, r, http.StatusBadRequest, query, err)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	// Windows end at the end of the time range, or now, if that's earlier.
+	windowEnd := endTime
+	if windowEnd.After(now) {
+		windowEnd = now
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data: &alertDashboardData{
+			Groups:   groupAlerts(alerts, windows, windowEnd),
+			Windows:  windows,
+			Total:    len(alerts),
+			Complete: complete,
+			Fetching: fetching,
+			Loc:      loc,
+			Query:    query,
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
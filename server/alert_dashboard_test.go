@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/test/harness"
+	"github.com/kevinburke/logrole/views"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+func TestParseWindows(t *testing.T) {
+	t.Parallel()
+	windows, err := parseWindows("30m, 6h,7d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"30m", 30 * time.Minute},
+		{"6h", 6 * time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("expected %d windows, got %d", len(want), len(windows))
+	}
+	for i, w := range want {
+		if windows[i].Name != w.name || windows[i].Duration != w.d {
+			t.Errorf("window %d: got (%q, %v), want (%q, %v)", i, windows[i].Name, windows[i].Duration, w.name, w.d)
+		}
+	}
+	for _, val := range []string{"", "soon", "10s", "xd", "1h,2h,3h,4h,5h,6h,7h"} {
+		if _, err := parseWindows(val); err == nil {
+			t.Errorf("parseWindows(%q): expected an error, got nil", val)
+		}
+	}
+}
+
+func newTestAlert(t *testing.T, sid string, code twilio.Code, resourceSid string, created time.Time) *views.Alert {
+	t.Helper()
+	alert, err := views.NewAlert(&twilio.Alert{
+		Sid:         sid,
+		ErrorCode:   code,
+		LogLevel:    twilio.LogLevelError,
+		AlertText:   "Msg=Something+went+wrong+" + sid,
+		ResourceSid: resourceSid,
+		DateCreated: twilio.TwilioTime{Valid: true, Time: created},
+	}, config.NewPermission(720*time.Hour), config.NewUser(config.AllUserSettings()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alert
+}
+
+func TestGroupAlerts(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	alerts := []*views.Alert{
+		newTestAlert(t, "NO1", 11200, "CA1", now.Add(-10*time.Minute)),
+		newTestAlert(t, "NO2", 30003, "SM1", now.Add(-20*time.Minute)),
+		newTestAlert(t, "NO3", 11200, "CA2", now.Add(-2*time.Hour)),
+		newTestAlert(t, "NO4", 11200, "CA1", now.Add(-3*24*time.Hour)),
+	}
+	windows := []*alertWindow{{Name: "1h", Duration: time.Hour}, {Name: "1d", Duration: 24 * time.Hour}}
+	groups := groupAlerts(alerts, windows, now)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	g := groups[0]
+	if g.Code != 11200 || g.Count != 3 {
+		t.Fatalf("expected 3 alerts with code 11200 first, got %d with code %d", g.Count, g.Code)
+	}
+	if g.WindowCounts[0] != 1 || g.WindowCounts[1] != 2 {
+		t.Errorf("expected window counts [1 2], got %v", g.WindowCounts)
+	}
+	if !g.FirstSeen.Equal(now.Add(-3*24*time.Hour)) || !g.LastSeen.Equal(now.Add(-10*time.Minute)) {
+		t.Errorf("wrong first or last seen: %v, %v", g.FirstSeen, g.LastSeen)
+	}
+	if strings.Join(g.ResourceSids, ",") != "CA1,CA2" {
+		t.Errorf("expected each affected resource once, newest first, got %v", g.ResourceSids)
+	}
+	if d := groups[1].Description; d != "Something went wrong NO2" {
+		t.Errorf("expected the description from the alert text, got %q", d)
+	}
+	if g.Description != "HTTP retrieval failure" {
+		t.Errorf("expected the description for 11200, got %q", g.Description)
+	}
+}
+
+func TestAlertDashboardPagesThroughRange(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	created := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		page := r.URL.Query().Get("Page")
+		next := "null"
+		code, resource := 11200, "CA1"
+		if page == "" {
+			next = fmt.Sprintf(`"%s/v1/Alerts?PageSize=1000&Page=1"`, s.URL)
+		} else {
+			code, resource = 30003, "SM1"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"meta": {"next_page_url": %s, "key": "alerts"}, "alerts": [{"sid": "NO%s", "error_code": "%d", "log_level": "error", "resource_sid": "%s", "date_created": "%s"}]}`,
+			next, page, code, resource, created)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{TestServer: s})
+	ads, err := newAlertDashboardServer(dlog, vc, lf, 720*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/alerts/dashboard?windows=2h", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	ads.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 requests to Twilio, got %d", n)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"2 alerts with 2 error codes", "11200", "30003", "Last 2h", "calls/CA1", "messages/SM1", "error-code=30003"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the dashboard to contain %q", want)
+		}
+	}
+}
+
+func TestAlertDashboardKeepsFetching(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	release := make(chan struct{})
+	created := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		page := r.URL.Query().Get("Page")
+		next := "null"
+		if page == "" {
+			next = fmt.Sprintf(`"%s/v1/Alerts?PageSize=1000&Page=1"`, s.URL)
+		} else {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"meta": {"next_page_url": %s, "key": "alerts"}, "alerts": [{"sid": "NO%s", "error_code": "11200", "log_level": "error", "resource_sid": "CA1", "date_created": "%s"}]}`,
+			next, page, created)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{TestServer: s})
+	ads, err := newAlertDashboardServer(dlog, vc, lf, 720*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A fixed start time, so both requests fetch the same pages.
+	startVal := time.Now().In(lf.GetLocationReq(httptest.NewRequest("GET", "/", nil))).Add(-24 * time.Hour).Format(HTML5DatetimeLocalFormat)
+	get := func() string {
+		req := httptest.NewRequest("GET", "/alerts/dashboard?windows=2h&alert-start="+startVal, nil)
+		req = config.SetUser(req, theUser)
+		// getContext leaves 3 seconds to render, so this waits for the
+		// alerts for 200ms.
+		ctx, cancel := context.WithTimeout(req.Context(), 3200*time.Millisecond)
+		defer cancel()
+		w := httptest.NewRecorder()
+		ads.ServeHTTP(w, req.WithContext(ctx))
+		if w.Code != 200 {
+			t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	body := get()
+	if !strings.Contains(body, "1 alerts with 1 error codes") || !strings.Contains(body, "reload the page") {
+		t.Errorf("expected a partial count while the dashboard is still fetching, got %s", body)
+	}
+	close(release)
+	for i := 0; atomic.LoadInt32(&requests) < 2; i++ {
+		if i > 100 {
+			t.Fatal("the dashboard stopped fetching alerts when the request ended")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Wait for the second page to be cached.
+	time.Sleep(50 * time.Millisecond)
+	body = get()
+	if !strings.Contains(body, "2 alerts with 1 error codes") {
+		t.Errorf("expected the reloaded dashboard to count both alerts, got %s", body)
+	}
+	if strings.Contains(body, "were counted") {
+		t.Errorf("expected the reloaded dashboard to be complete")
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected the reload to use the cached pages, got %d requests to Twilio", n)
+	}
+}
+
+func TestAlertDashboardSlowFirstPage(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	defer close(release)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"meta": {"next_page_url": null, "key": "alerts"}, "alerts": []}`))
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{TestServer: s})
+	ads, err := newAlertDashboardServer(dlog, vc, lf, 720*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/alerts/dashboard", nil)
+	req = config.SetUser(req, theUser)
+	// getContext leaves 3 seconds to render, so the first page is still
+	// loading when the dashboard stops waiting.
+	ctx, cancel := context.WithTimeout(req.Context(), 3200*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	ads.ServeHTTP(w, req.WithContext(ctx))
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Twilio is still returning alerts") {
+		t.Errorf("expected the dashboard to say it's still fetching, got %s", body)
+	}
+	if strings.Contains(body, "No alerts match") {
+		t.Errorf("expected no empty result while the dashboard is still fetching")
+	}
+}
+
+func TestAlertDashboardInvalidWindows(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	ads, err := newAlertDashboardServer(dlog, vc, lf, 720*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/alerts/dashboard?windows=often", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	ads.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected Code to be 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Invalid window") {
+		t.Errorf("expected an error about the window, got %s", w.Body.String())
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
@@ -26,6 +27,10 @@ const alertPattern = `(?P<sid>NO[a-f0-9]{32})`
 
 var alertInstanceRoute = regexp.MustCompile("^/alerts/" + alertPattern + "$")
 
+// The number of pages to read, looking for alerts with the error code the
+// user searched for, before giving up.
+const maxErrorCodePages = 10
+
 var validAlertLevels = []twilio.LogLevel{
 	twilio.LogLevelError,
 	twilio.LogLevelWarning,
@@ -121,7 +126,7 @@ func (s *alertInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	switch err {
 	case nil:
 		break
-	case config.PermissionDenied, config.ErrTooOld:
+	case config.PermissionDenied, config.ErrTooOld, config.ErrTooNew:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
 	default:
@@ -156,6 +161,8 @@ type alertListServer struct {
 	Client         views.Client
 	PageSize       uint
 	MaxResourceAge time.Duration
+	// Resources newer than this are hidden. Set by NewServer.
+	MinResourceAge time.Duration
 	LocationFinder services.LocationFinder
 	secretKey      *[32]byte
 	tpl            *template.Template
@@ -176,7 +183,7 @@ func (ad *alertListData) Title() string {
 }
 
 func (ad *alertListData) Path() string {
-	return "/alerts"
+	return "alerts"
 }
 
 func (d *alertListData) LogLevels() []twilio.LogLevel {
@@ -194,6 +201,9 @@ func (c *alertListData) NextQuery() template.URL {
 	if end, ok := c.Query["alert-end"]; ok {
 		data.Set("alert-end", end[0])
 	}
+	if code := c.Query.Get("error-code"); code != "" {
+		data.Set("error-code", code)
+	}
 	return template.URL(data.Encode())
 }
 
@@ -208,6 +218,9 @@ func (c *alertListData) PreviousQuery() template.URL {
 	if end, ok := c.Query["alert-end"]; ok {
 		data.Set("alert-end", end[0])
 	}
+	if code := c.Query.Get("error-code"); code != "" {
+		data.Set("error-code", code)
+	}
 	return template.URL(data.Encode())
 }
 
@@ -218,6 +231,20 @@ type alertFrequency struct {
 	HaveMore bool
 }
 
+// getErrorCode returns the error code in the "error-code" query parameter, or
+// 0 if there isn't one.
+func getErrorCode(query url.Values) (twilio.Code, error) {
+	val := query.Get("error-code")
+	if val == "" {
+		return 0, nil
+	}
+	code, err := strconv.Atoi(val)
+	if err != nil || code <= 0 {
+		return 0, fmt.Errorf("Invalid error code %q", val)
+	}
+	return twilio.Code(code), nil
+}
+
 func getAlertFrequency(alerts []*views.Alert, name string, since time.Duration) *alertFrequency {
 	now := time.Now()
 	count := uint(0)
@@ -251,7 +278,7 @@ func newAlertListServer(l log.Logger, vc views.Client,
 	}
 	tpl, err := newTpl(template.FuncMap{
 		"min":        minFunc(s.MaxResourceAge),
-		"max":        maxLoc,
+		"max":        s.maxSearchVal,
 		"has_prefix": strings.HasPrefix,
 		"start_val":  s.StartSearchVal,
 		"end_val":    s.EndSearchVal,
@@ -279,7 +306,12 @@ func (s *alertListServer) EndSearchVal(query url.Values, loc *time.Location) str
 	if end, ok := query["alert-end"]; ok {
 		return end[0]
 	}
-	return maxLoc(loc)
+	return s.maxSearchVal(loc)
+}
+
+// maxSearchVal returns the latest time the user can search for.
+func (s *alertListServer) maxSearchVal(loc *time.Location) string {
+	return maxAgeLoc(s.MinResourceAge, loc)
 }
 
 func (s *alertListServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
@@ -302,7 +334,26 @@ func (s *alertListServer) renderError(w http.ResponseWriter, r *http.Request, co
 }
 
 func (s *alertListServer) validParams() []string {
-	return []string{"log-level", "resource-sid", "next", "alert-start", "alert-end"}
+	return []string{"log-level", "resource-sid", "error-code", "next", "alert-start", "alert-end"}
+}
+
+// withErrorCode returns the alerts in page with the given error code. If
+// there aren't any, it reads up to maxErrorCodePages more pages, looking for
+// a page that has some.
+func (s *alertListServer) withErrorCode(ctx context.Context, u *config.User, start, end time.Time, page *views.AlertPage, code twilio.Code) *views.AlertPage {
+	filtered := page.WithErrorCode(code)
+	for i := 0; len(filtered.Alerts()) == 0 && filtered.NextPageURI().Valid && i < maxErrorCodePages; i++ {
+		next, _, err := s.Client.GetNextAlertPageInRange(ctx, u, start, end, filtered.NextPageURI().String)
+		if err == twilio.NoMoreResults {
+			break
+		}
+		if err != nil {
+			s.Debug("Error fetching next page", "err", err)
+			break
+		}
+		filtered = next.WithErrorCode(code)
+	}
+	return filtered
 }
 
 func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -320,6 +371,11 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.renderError(w, r, http.StatusBadRequest, query, err)
 		return
 	}
+	errorCode, err := getErrorCode(query)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
 	loc := s.LocationFinder.GetLocationReq(r)
 	// We always set startTime and endTime on the request, though they may end
 	// up just being sentinels
@@ -329,7 +385,6 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	ctx, cancel := getContext(r.Context(), 3*time.Second)
 	defer cancel()
-	var err error
 	next, nextErr := getNext(query, s.secretKey)
 	if nextErr != nil {
 		err = errors.New("Could not decrypt `next` query parameter: " + nextErr.Error())
@@ -376,10 +431,15 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Twilio can't filter alerts by error code, so we filter each page.
+	if errorCode != 0 {
+		page = s.withErrorCode(ctx, u, startTime, endTime, page, errorCode)
+	}
 	// Fetch the next page into the cache
+	bgctx := backgroundContext(r)
 	go func(u *config.User, n types.NullString, start, end time.Time) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextAlertPageInRange(context.Background(), u, start, end, n.String); err != nil {
+			if _, _, err := s.Client.GetNextAlertPageInRange(bgctx, u, start, end, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/test/harness"
+)
+
+func TestAlertListFiltersErrorCode(t *testing.T) {
+	t.Parallel()
+	created := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"meta": {"next_page_url": null, "key": "alerts"}, "alerts": [
+	{"sid": "NO1", "error_code": "11200", "log_level": "error", "resource_sid": "CA1", "date_created": "%s"},
+	{"sid": "NO2", "error_code": "30003", "log_level": "error", "resource_sid": "SM1", "date_created": "%s"}
+]}`, created, created)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{TestServer: s})
+	als, err := newAlertListServer(dlog, vc, lf, 50, 720*time.Hour, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req = config.SetUser(req, theUser)
+		w := httptest.NewRecorder()
+		als.ServeHTTP(w, req)
+		return w
+	}
+	w := get("/alerts?error-code=30003")
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "messages/SM1") || strings.Contains(body, "calls/CA1") {
+		t.Errorf("expected only alerts with error code 30003, got %s", body)
+	}
+	if w := get("/alerts?error-code=abc"); w.Code != 400 {
+		t.Errorf("expected Code to be 400 for an invalid error code, got %d", w.Code)
+	}
+}
+
+func TestAlertListSkipsPagesWithoutErrorCode(t *testing.T) {
+	t.Parallel()
+	created := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("Page")
+		next := "null"
+		code, resource := 11200, "CA1"
+		switch page {
+		case "":
+			next = fmt.Sprintf(`"%s/v1/Alerts?PageSize=50&Page=1"`, s.URL)
+		case "1":
+			next = fmt.Sprintf(`"%s/v1/Alerts?PageSize=50&Page=2"`, s.URL)
+		default:
+			code, resource = 30003, "SM1"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"meta": {"next_page_url": %s, "key": "alerts"}, "alerts": [{"sid": "NO%s", "error_code": "%d", "log_level": "error", "resource_sid": "%s", "date_created": "%s"}]}`,
+			next, page, code, resource, created)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{TestServer: s})
+	als, err := newAlertListServer(dlog, vc, lf, 50, 720*time.Hour, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/alerts?error-code=30003", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	als.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "messages/SM1") {
+		t.Errorf("expected the list to skip ahead to the alert with error code 30003, got %s", body)
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	types "github.com/kevinburke/go-types"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/rest"
+	twilio "github.com/kevinburke/twilio-go"
+	"golang.org/x/sync/errgroup"
+)
+
+const applicationPattern = `(?P<sid>AP[a-f0-9]{32})`
+
+var applicationInstanceRoute = regexp.MustCompile("^/applications/" + applicationPattern + "$")
+
+type applicationListServer struct {
+	log.Logger
+	Client         views.Client
+	PageSize       uint
+	LocationFinder services.LocationFinder
+	secretKey      *[32]byte
+	tpl            *template.Template
+}
+
+func newApplicationListServer(l log.Logger, vc views.Client,
+	lf services.LocationFinder, pageSize uint,
+	secretKey *[32]byte) (*applicationListServer, error) {
+	s := &applicationListServer{
+		Logger:         l,
+		Client:         vc,
+		PageSize:       pageSize,
+		LocationFinder: lf,
+		secretKey:      secretKey,
+	}
+	tpl, err := newTpl(template.FuncMap{}, base+applicationListTpl+pagingTpl)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+func (s *applicationListServer) validParams() []string {
+	return []string{"friendly-name", "next"}
+}
+
+type applicationListData struct {
+	Page                  *views.ApplicationPage
+	EncryptedNextPage     string
+	EncryptedPreviousPage string
+	Loc                   *time.Location
+	Err                   string
+	Query                 url.Values
+}
+
+func (d *applicationListData) Title() string {
+	return "Applications"
+}
+
+func (d *applicationListData) Path() string {
+	return "applications"
+}
+
+func (d *applicationListData) NextQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedNextPage != "" {
+		data.Set("next", d.EncryptedNextPage)
+	}
+	return template.URL(data.Encode())
+}
+
+func (d *applicationListData) PreviousQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedPreviousPage != "" {
+		data.Set("next", d.EncryptedPreviousPage)
+	}
+	return template.URL(data.Encode())
+}
+
+func (s *applicationListServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	str := cleanError(err)
+	data := &baseData{
+		LF: s.LocationFinder,
+		Data: &applicationListData{
+			Err:   str,
+			Loc:   s.LocationFinder.GetLocationReq(r),
+			Query: query,
+			Page:  new(views.ApplicationPage),
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+}
+
+func (s *applicationListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	var err error
+	next, nextErr := getNext(query, s.secretKey)
+	if nextErr != nil {
+		err = errors.New("Could not decrypt `next` query parameter: " + nextErr.Error())
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	var page *views.ApplicationPage
+	var cachedAt uint64
+	start := monotime.Now()
+	if next != "" {
+		if !strings.HasPrefix(next, "/"+twilio.APIVersion) {
+			s.Warn("Invalid next page URI", "next", next, "opaque", query.Get("next"))
+			s.renderError(w, r, http.StatusBadRequest, query, errors.New("Invalid next page uri"))
+			return
+		}
+		page, cachedAt, err = s.Client.GetNextApplicationPage(ctx, u, next)
+		setNextPageValsOnQuery(next, query)
+	} else {
+		vals := url.Values{}
+		vals.Set("PageSize", strconv.FormatUint(uint64(s.PageSize), 10))
+		if filterErr := setPageFilters(query, vals); filterErr != nil {
+			s.renderError(w, r, http.StatusBadRequest, query, filterErr)
+			return
+		}
+		page, cachedAt, err = s.Client.GetApplicationPage(ctx, u, vals)
+	}
+	if err == twilio.NoMoreResults {
+		page = new(views.ApplicationPage)
+		err = nil
+	}
+	if err != nil {
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.Status {
+			case 400:
+				s.renderError(w, r, http.StatusBadRequest, query, err)
+			case 404:
+				rest.NotFound(w, r)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	bgctx := backgroundContext(r)
+	go func(u *config.User, n types.NullString) {
+		if n.Valid {
+			if _, _, err := s.Client.GetNextApplicationPage(bgctx, u, n.String); err != nil {
+				s.Debug("Error fetching next page", "err", err)
+			}
+		}
+	}(u, page.NextPageURI())
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data: &applicationListData{
+			Page:                  page,
+			Query:                 query,
+			Loc:                   s.LocationFinder.GetLocationReq(r),
+			EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
+			EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
+		}}
+	if cachedAt > 0 {
+		data.CachedDuration = monotime.Since(cachedAt)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+type applicationInstanceServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+}
+
+func newApplicationInstanceServer(l log.Logger, vc views.Client, lf services.LocationFinder) (*applicationInstanceServer, error) {
+	s := &applicationInstanceServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+	}
+	tpl, err := newTpl(template.FuncMap{}, base+applicationInstanceTpl+sidTpl+copyScript)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+type applicationInstanceData struct {
+	Application *views.Application
+	Loc         *time.Location
+	// Phone numbers that use this application for Voice or SMS.
+	Numbers          []*views.IncomingNumber
+	NumbersErr       string
+	CanViewNumberApp bool
+}
+
+func (d *applicationInstanceData) Title() string {
+	return "Application Details"
+}
+
+func (s *applicationInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	sid := applicationInstanceRoute.FindStringSubmatch(r.URL.Path)[1]
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	start := monotime.Now()
+	data := &applicationInstanceData{
+		Loc:              s.LocationFinder.GetLocationReq(r),
+		CanViewNumberApp: u.CanViewCallbackURLs(),
+	}
+	g, errctx := errgroup.WithContext(ctx)
+	if u.CanViewCallbackURLs() {
+		g.Go(func() error {
+			numbers, err := s.Client.GetApplicationNumbers(errctx, u, sid)
+			if err != nil {
+				data.NumbersErr = err.Error()
+			} else {
+				data.Numbers = numbers
+			}
+			return nil
+		})
+	}
+	application, err := s.Client.GetApplication(ctx, u, sid)
+	switch err {
+	case nil:
+		break
+	case config.PermissionDenied, config.ErrTooOld:
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return
+	default:
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.Status {
+			case 404:
+				rest.NotFound(w, r)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	g.Wait()
+	data.Application = application
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	bd := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data:     data,
+	}
+	if err := render(w, r, s.tpl, "base", bd); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
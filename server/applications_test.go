@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/test/harness"
+)
+
+const applicationBody = `{
+  "account_sid": "AC123",
+  "api_version": "2010-04-01",
+  "date_created": "Mon, 22 Aug 2011 20:59:45 +0000",
+  "date_updated": "Tue, 18 Aug 2015 16:48:57 +0000",
+  "friendly_name": "Support line",
+  "sid": "AP2a0747eba6abf96b7e3c3ff0b4530f6e",
+  "sms_url": "https://example.com/sms-secret",
+  "status_callback": "",
+  "voice_method": "POST",
+  "voice_url": "https://example.com/voice-secret"
+}`
+
+const applicationNumbersBody = `{
+  "incoming_phone_numbers": [
+    {
+      "sid": "PN2a0747eba6abf96b7e3c3ff0b4530f6e",
+      "date_created": "Mon, 22 Aug 2011 20:59:45 +0000",
+      "friendly_name": "Support",
+      "phone_number": "+14105551234",
+      "voice_application_sid": "AP2a0747eba6abf96b7e3c3ff0b4530f6e",
+      "sms_application_sid": ""
+    },
+    {
+      "sid": "PN3a0747eba6abf96b7e3c3ff0b4530f6e",
+      "date_created": "Mon, 22 Aug 2011 20:59:45 +0000",
+      "friendly_name": "Sales",
+      "phone_number": "+14105559876",
+      "voice_application_sid": "",
+      "sms_application_sid": ""
+    }
+  ],
+  "next_page_uri": null
+}`
+
+func newApplicationTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/Applications/AP2a0747eba6abf96b7e3c3ff0b4530f6e.json"):
+			w.Write([]byte(applicationBody))
+		case strings.HasSuffix(r.URL.Path, "/IncomingPhoneNumbers.json"):
+			w.Write([]byte(applicationNumbersBody))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(404)
+		}
+	}))
+}
+
+func TestApplicationInstanceLinksNumbers(t *testing.T) {
+	t.Parallel()
+	s := newApplicationTestServer(t)
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	as, err := newApplicationInstanceServer(dlog, vc, lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/applications/AP2a0747eba6abf96b7e3c3ff0b4530f6e", nil)
+	req = config.SetUser(req, config.NewUser(config.AllUserSettings()))
+	w := httptest.NewRecorder()
+	as.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `href="phone-numbers/&#43;14105551234"`) {
+		t.Errorf("expected body to link to phone number using the application")
+	}
+	if strings.Contains(body, "14105559876") {
+		t.Errorf("expected body to omit phone number that doesn't use the application")
+	}
+	if !strings.Contains(body, "https://example.com/voice-secret") {
+		t.Errorf("expected body to contain Voice URL")
+	}
+}
+
+func TestApplicationInstanceHidesCallbackURLs(t *testing.T) {
+	t.Parallel()
+	s := newApplicationTestServer(t)
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	as, err := newApplicationInstanceServer(dlog, vc, lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/applications/AP2a0747eba6abf96b7e3c3ff0b4530f6e", nil)
+	us := config.AllUserSettings()
+	us.CanViewCallbackURLs = false
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	as.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "secret") {
+		t.Errorf("expected callback URLs to be hidden, got %s", body)
+	}
+	if strings.Contains(body, "14105551234") {
+		t.Errorf("expected phone numbers using the application to be hidden")
+	}
+}
@@ -1,12 +1,13 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"regexp"
+	"strings"
 
-	twilio "github.com/kevinburke/twilio-go"
 	"github.com/kevinburke/logrole/views"
 )
 
@@ -18,16 +19,25 @@ type audioServer struct {
 
 var audioRoute = regexp.MustCompile("^/audio/(?P<encrypted>([-_a-zA-Z0-9=]+))$")
 
-func newAudioReverseProxy() (*httputil.ReverseProxy, error) {
-	u, err := url.Parse(twilio.BaseURL)
+// newAudioReverseProxy returns a proxy that sends requests to the Twilio API
+// at baseURL, for example twilio.BaseURL, using transport. If transport is
+// nil, http.DefaultTransport is used.
+func newAudioReverseProxy(baseURL string, transport http.RoundTripper) (*httputil.ReverseProxy, error) {
+	u, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, err
 	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("Invalid Twilio base URL %q", baseURL)
+	}
 	return &httputil.ReverseProxy{
 		Director: func(r *http.Request) {
 			r.URL.Host = u.Host
-			r.URL.Scheme = "https"
+			r.URL.Scheme = u.Scheme
+			r.URL.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+			r.Host = u.Host
 		},
+		Transport: transport,
 	}, nil
 }
 
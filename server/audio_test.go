@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAudioProxyUsesBaseURL(t *testing.T) {
+	t.Parallel()
+	const path = "/2010-04-01/Accounts/AC123/Recordings/RE123.wav"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/twilio"+path {
+			t.Errorf("expected URL.Path to equal /twilio%s, got %s", path, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "audio/x-wav")
+		w.Write([]byte("recording"))
+	}))
+	defer s.Close()
+	proxy, err := newAudioReverseProxy(s.URL+"/twilio", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("expected Code to be 200, got %d", w.Code)
+	}
+	if w.Body.String() != "recording" {
+		t.Errorf("expected the stand-in's recording, got %q", w.Body.String())
+	}
+}
+
+func TestAudioProxyInvalidBaseURL(t *testing.T) {
+	t.Parallel()
+	if _, err := newAudioReverseProxy("api.twilio.com", nil); err == nil {
+		t.Error("expected an error for a base URL without a host, got nil")
+	}
+}
@@ -17,20 +17,22 @@ func (l *logoutServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 var theUser = config.NewUser(&config.UserSettings{
-	CanViewNumMedia:       true,
-	CanViewMessages:       true,
-	CanViewMessageFrom:    true,
-	CanViewMessageTo:      true,
-	CanViewMessageBody:    false,
-	CanViewMessagePrice:   false,
-	CanViewMedia:          true,
-	CanViewCalls:          true,
-	CanViewCallFrom:       true,
-	CanViewCallTo:         true,
-	CanViewCallPrice:      false,
-	CanViewNumRecordings:  true,
-	CanPlayRecordings:     true,
-	CanViewRecordingPrice: false,
-	CanViewConferences:    true,
-	CanViewAlerts:         true,
+	CanViewNumMedia:        true,
+	CanViewMessages:        true,
+	CanViewMessageFrom:     true,
+	CanViewMessageTo:       true,
+	CanViewMessageBody:     false,
+	CanViewMessagePrice:    false,
+	CanViewMedia:           true,
+	CanViewCalls:           true,
+	CanViewCallFrom:        true,
+	CanViewCallTo:          true,
+	CanViewCallPrice:       false,
+	CanViewNumRecordings:   true,
+	CanPlayRecordings:      true,
+	CanViewRecordingPrice:  false,
+	CanViewConferences:     true,
+	CanViewAlerts:          true,
+	CanViewRooms:           true,
+	CanPlayVideoRecordings: true,
 })
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/rest"
+)
+
+var errCannotBreakGlass = &rest.Error{
+	Title: "Your group can't request elevated access",
+	ID:    "forbidden",
+}
+
+// withElevation applies the user's break-glass elevation, if they have an
+// active one, and logs every request made with elevated access. If the
+// user's group can't elevate those permissions anymore, the elevation ends.
+func withElevation(h http.Handler, l log.Logger, elevations *config.ElevationStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := config.GetUser(r)
+		if ok && u.ID() != "" {
+			if e, ok := elevations.Get(u.ID()); ok {
+				if u.BreakGlass().Allows(e) {
+					l.Warn("Request with elevated access", "user", e.UserID, "path", r.URL.RequestURI(), "permissions", e.Permissions, "expires", e.Expires)
+					r = config.SetUser(r, u.WithElevation(e))
+				} else {
+					l.Warn("Ending elevated access the user's group no longer allows", "user", e.UserID, "permissions", e.Permissions)
+					elevations.End(u.ID())
+				}
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// breakGlassServer lets users in a group with break_glass set request
+// temporary elevated access, and end it early.
+type breakGlassServer struct {
+	log.Logger
+	Reporter       services.ErrorReporter
+	LocationFinder services.LocationFinder
+	Elevations     *config.ElevationStore
+	tpl            *template.Template
+}
+
+func newBreakGlassServer(l log.Logger, reporter services.ErrorReporter, lf services.LocationFinder, elevations *config.ElevationStore) (*breakGlassServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+breakGlassTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &breakGlassServer{
+		Logger:         l,
+		Reporter:       reporter,
+		LocationFinder: lf,
+		Elevations:     elevations,
+		tpl:            tpl,
+	}, nil
+}
+
+type breakGlassData struct {
+	// The permissions the user can elevate, and the longest they can do so.
+	Permissions []string
+	MaxMinutes  int
+	// The user's active elevation, if any.
+	Elevation *config.Elevation
+	Loc       *time.Location
+	Err       string
+	// The forms need the CSRF token.
+	CSRFToken string
+}
+
+func (d *breakGlassData) Title() string {
+	return "Break Glass"
+}
+
+func (s *breakGlassServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	bg := u.BreakGlass()
+	if bg == nil || u.ID() == "" {
+		rest.Forbidden(w, r, errCannotBreakGlass)
+		return
+	}
+	data := &breakGlassData{
+		Permissions: bg.Permissions,
+		MaxMinutes:  int(bg.MaxDuration / time.Minute),
+		Loc:         s.LocationFinder.GetLocationReq(r),
+		CSRFToken:   getCSRFToken(r),
+	}
+	if data.MaxMinutes == 0 {
+		data.MaxMinutes = int(config.DefaultBreakGlassDuration / time.Minute)
+	}
+	if r.Method == "POST" {
+		var err error
+		switch r.PostFormValue("action") {
+		case "elevate":
+			err = s.elevate(u, r)
+		case "end":
+			if e, ok := s.Elevations.End(u.ID()); ok {
+				s.Warn("Ended elevated access early", "user", e.UserID, "permissions", e.Permissions)
+			}
+		default:
+			rest.BadRequest(w, r, &rest.Error{Title: "Unknown action"})
+			return
+		}
+		if err == nil {
+			http.Redirect(w, r, accountPath(r, "/break-glass"), http.StatusSeeOther)
+			return
+		}
+		data.Err = err.Error()
+	}
+	if e, ok := s.Elevations.Get(u.ID()); ok {
+		data.Elevation = e
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", &baseData{LF: s.LocationFinder, Data: data}); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+// elevate grants the permissions in the form, and records the elevation in
+// the logs and the error reporter.
+func (s *breakGlassServer) elevate(u *config.User, r *http.Request) error {
+	minutes, err := strconv.Atoi(r.PostFormValue("minutes"))
+	if err != nil {
+		return errors.New("Please enter a number of minutes")
+	}
+	e, err := s.Elevations.Elevate(u, r.PostForm["permissions"], time.Duration(minutes)*time.Minute, r.PostFormValue("justification"))
+	if err != nil {
+		return err
+	}
+	s.Crit("BREAK GLASS: user elevated their permissions", "user", e.UserID, "group", e.Group,
+		"permissions", e.Permissions, "expires", e.Expires, "justification", e.Justification,
+		"ip", getClientIP(r))
+	// Not a real error, but the error reporter is where the people who need
+	// to know about it are looking.
+	if s.Reporter != nil {
+		s.Reporter.ReportError(fmt.Errorf("Break-glass elevation: %s", e), false)
+	}
+	return nil
+}
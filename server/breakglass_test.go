@@ -0,0 +1,149 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/nacl"
+)
+
+func TestBreakGlassElevation(t *testing.T) {
+	t.Parallel()
+	policy := &config.Policy{&config.Group{
+		Name:  "support",
+		Users: []string{"alice"},
+		BreakGlass: &config.BreakGlass{
+			Permissions: []string{"can_view_message_body"},
+			MaxDuration: 30 * time.Minute,
+		},
+		Permissions: &config.UserSettings{CanViewMessages: true},
+	}}
+	u, ok, err := policy.Lookup("alice")
+	if err != nil || !ok {
+		t.Fatalf("couldn't find alice: %v", err)
+	}
+	lf, _ := services.NewLocationFinder("UTC")
+	s, err := NewServer(&config.Settings{
+		AllowUnencryptedTraffic: true,
+		Authenticator:           &config.NoopAuthenticator{User: u},
+		LocationFinder:          lf,
+		SecretKey:               nacl.NewKey(),
+		Logger:                  NullLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &browser{t: t, h: s, cookies: make(map[string]*http.Cookie)}
+	w := b.do("GET", "/break-glass", nil)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `value="can_view_message_body"`) {
+		t.Fatalf("expected the break-glass form, got %d: %s", w.Code, w.Body.String())
+	}
+	match := csrfFieldRx.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatal("expected the break-glass form to have a CSRF token")
+	}
+	w = b.do("POST", "/break-glass", url.Values{
+		csrfField:       {match[1]},
+		"action":        {"elevate"},
+		"permissions":   {"can_view_message_body"},
+		"minutes":       {"15"},
+		"justification": {"short"},
+	})
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Please explain why") {
+		t.Fatalf("expected a justification error, got %d: %s", w.Code, w.Body.String())
+	}
+	w = b.do("POST", "/break-glass", url.Values{
+		csrfField:       {match[1]},
+		"action":        {"elevate"},
+		"permissions":   {"can_view_message_body"},
+		"minutes":       {"15"},
+		"justification": {"Incident 42: customer can't receive messages"},
+	})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected Code to be 303, got %d: %s", w.Code, w.Body.String())
+	}
+	w = b.do("GET", "/break-glass", nil)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Elevated access") {
+		t.Fatalf("expected the elevation banner, got %d: %s", w.Code, w.Body.String())
+	}
+	if u.CanViewMessageBody() {
+		t.Error("elevation modified the policy's user")
+	}
+
+	w = b.do("POST", "/break-glass", url.Values{csrfField: {match[1]}, "action": {"end"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected Code to be 303, got %d: %s", w.Code, w.Body.String())
+	}
+	w = b.do("GET", "/break-glass", nil)
+	if strings.Contains(w.Body.String(), "Elevated access") {
+		t.Error("expected the elevation to end")
+	}
+}
+
+func TestBreakGlassRequiresGroup(t *testing.T) {
+	t.Parallel()
+	lf, _ := services.NewLocationFinder("UTC")
+	s, err := NewServer(&config.Settings{
+		AllowUnencryptedTraffic: true,
+		Authenticator:           &config.NoopAuthenticator{User: config.NewUser(config.AllUserSettings())},
+		LocationFinder:          lf,
+		SecretKey:               nacl.NewKey(),
+		Logger:                  NullLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &browser{t: t, h: s, cookies: make(map[string]*http.Cookie)}
+	if w := b.do("GET", "/break-glass", nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
+
+func TestWithElevationDropsRevokedElevation(t *testing.T) {
+	t.Parallel()
+	lookup := func(bg *config.BreakGlass) *config.User {
+		policy := &config.Policy{&config.Group{
+			Name:        "support",
+			Users:       []string{"alice"},
+			BreakGlass:  bg,
+			Permissions: &config.UserSettings{CanViewMessages: true},
+		}}
+		u, ok, err := policy.Lookup("alice")
+		if err != nil || !ok {
+			t.Fatalf("couldn't find alice: %v", err)
+		}
+		return u
+	}
+	tests := []struct {
+		name string
+		bg   *config.BreakGlass
+	}{
+		{"break_glass removed", nil},
+		{"permission removed", &config.BreakGlass{Permissions: []string{"can_view_call_from"}}},
+	}
+	for _, tt := range tests {
+		elevations := config.NewElevationStore()
+		_, err := elevations.Elevate(lookup(&config.BreakGlass{Permissions: []string{"can_view_message_body"}}),
+			[]string{"can_view_message_body"}, 15*time.Minute, "Incident 42: customer can't receive messages")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := withElevation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, _ := config.GetUser(r)
+			if u.CanViewMessageBody() || u.Elevation() != nil {
+				t.Errorf("%s: expected the elevation not to be applied", tt.name)
+			}
+		}), NullLogger, elevations)
+		req := httptest.NewRequest("GET", "/messages", nil)
+		h.ServeHTTP(httptest.NewRecorder(), config.SetUser(req, lookup(tt.bg)))
+		if _, ok := elevations.Get("alice"); ok {
+			t.Errorf("%s: expected the elevation to end", tt.name)
+		}
+	}
+}
@@ -32,6 +32,8 @@ type callListServer struct {
 	LocationFinder services.LocationFinder
 	PageSize       uint
 	MaxResourceAge time.Duration
+	// Resources newer than this are hidden. Set by NewServer.
+	MinResourceAge time.Duration
 	secretKey      *[32]byte
 	tpl            *template.Template
 }
@@ -50,7 +52,7 @@ func newCallListServer(l log.Logger, vc views.Client, lf services.LocationFinder
 	tpl, err := newTpl(template.FuncMap{
 		"is_our_pn": vc.IsTwilioNumber,
 		"min":       minFunc(cs.MaxResourceAge),
-		"max":       maxLoc,
+		"max":       cs.maxSearchVal,
 		"start_val": cs.StartSearchVal,
 		"end_val":   cs.EndSearchVal,
 	}, base+callListTpl+pagingTpl+phoneTpl+copyScript)
@@ -107,7 +109,7 @@ func (c *callListData) Title() string {
 }
 
 func (c *callListData) Path() string {
-	return "/calls"
+	return "calls"
 }
 
 func (c *callListData) NextQuery() template.URL {
@@ -154,7 +156,12 @@ func (s *callListServer) EndSearchVal(query url.Values, loc *time.Location) stri
 	if end, ok := query["start-before"]; ok {
 		return end[0]
 	}
-	return maxLoc(loc)
+	return s.maxSearchVal(loc)
+}
+
+// maxSearchVal returns the latest time the user can search for.
+func (s *callListServer) maxSearchVal(loc *time.Location) string {
+	return maxAgeLoc(s.MinResourceAge, loc)
 }
 
 func (s *callListServer) validParams() []string {
@@ -178,6 +185,10 @@ func (s *callListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.renderError(w, r, http.StatusBadRequest, query, err)
 		return
 	}
+	if err := checkMaskedFilters(query, u.CallFromMask(), u.CallToMask()); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
 	loc := s.LocationFinder.GetLocationReq(r)
 	// We always set startTime and endTime on the request, though they may end
 	// up just being sentinels
@@ -224,9 +235,10 @@ func (s *callListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Fetch the next page into the cache
+	bgctx := backgroundContext(r)
 	go func(u *config.User, n types.NullString, startTime, endTime time.Time) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextCallPageInRange(context.Background(), u, startTime, endTime, n.String); err != nil {
+			if _, _, err := s.Client.GetNextCallPageInRange(bgctx, u, startTime, endTime, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
@@ -356,7 +368,7 @@ func (c *callInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch err {
 	case nil:
 		break
-	case config.PermissionDenied, config.ErrTooOld:
+	case config.PermissionDenied, config.ErrTooOld, config.ErrTooNew:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
 	default:
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/kevinburke/logrole/config"
@@ -65,3 +67,122 @@ func TestNoEndGeneratesCorrectQuery(t *testing.T) {
 		t.Errorf("expected Code to be 200, got %d", w.Code)
 	}
 }
+
+func TestScopedCallListHidesPaging(t *testing.T) {
+	t.Parallel()
+	p := &config.Policy{
+		&config.Group{
+			Name:        "franchise",
+			Permissions: config.AllUserSettings(),
+			Users:       []string{"franchise@example.com"},
+			Scope:       &config.Scope{PhoneNumbers: []string{"+16103317238"}},
+		},
+	}
+	u, _, err := p.Lookup("franchise@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first page has one call the user can view, and a next page where
+	// every call is hidden.
+	firstPage := bytes.Replace(test.CallListBody, []byte(`"next_page_uri": null`),
+		[]byte(`"next_page_uri": "/2010-04-01/Accounts/AC123/Calls.json?PageSize=2&Page=1&PageToken=PACA14b8432d941d883a9b69e2598b0e57ba"`), 1)
+	secondPage := bytes.Replace(test.CallListBody, []byte("+16103317238"), []byte("+16103310000"), -1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		if r.URL.Query().Get("Page") == "1" {
+			w.Write(secondPage)
+		} else {
+			w.Write(firstPage)
+		}
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	c, err := newCallListServer(dlog, vc, lf, 2, config.DefaultMaxResourceAge, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/calls", nil)
+	req = config.SetUser(req, u)
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "CA14b8432d941d883a9b69e2598b0e57ba") {
+		t.Error("expected body to contain the call in the user's scope")
+	}
+	if strings.Contains(body, "CAa5eba990e09906eedad4b80dc35893a4") {
+		t.Error("expected body to omit the call outside the user's scope")
+	}
+	if strings.Contains(body, "btn-next") {
+		t.Error("expected no link to a page where every call is hidden")
+	}
+}
+
+func TestMaskedCallListHidesNumbers(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.CallFromMask = config.Mask{Mode: config.MaskLastDigits, Digits: 4}
+	us.CallToMask = config.Mask{Mode: config.MaskPseudonym}
+	u := config.NewUser(us)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		w.Write(test.CallListBody)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	c, err := newCallListServer(dlog, vc, lf, 2, config.DefaultMaxResourceAge, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/calls", nil)
+	req = config.SetUser(req, u)
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "6103317238") {
+		t.Error("expected body to omit the masked phone number")
+	}
+	if strings.Contains(body, `href="phone-numbers/`) {
+		t.Error("expected masked phone numbers not to be linked")
+	}
+	if !strings.Contains(body, "anon-") {
+		t.Error("expected body to contain a pseudonym")
+	}
+}
+
+func TestMaskedCallListRejectsNumberFilters(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.CallFromMask = config.Mask{Mode: config.MaskLastDigits, Digits: 4}
+	u := config.NewUser(us)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		w.Write(test.CallListBody)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	c, err := newCallListServer(dlog, vc, lf, 2, config.DefaultMaxResourceAge, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]int{
+		"/calls?from=%2B16103317238": 400,
+		"/calls?to=%2B16103317238":   200,
+	} {
+		req, _ := http.NewRequest("GET", path, nil)
+		req = config.SetUser(req, u)
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: expected Code to be %d, got %d", path, want, w.Code)
+		}
+	}
+}
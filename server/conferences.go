@@ -1,7 +1,6 @@
 package server
 
 import (
-	"context"
 	"errors"
 	"html/template"
 	"net/http"
@@ -30,6 +29,8 @@ type conferenceListServer struct {
 	Client         views.Client
 	PageSize       uint
 	MaxResourceAge time.Duration
+	// Resources newer than this are hidden. Set by NewServer.
+	MinResourceAge time.Duration
 	LocationFinder services.LocationFinder
 	secretKey      *[32]byte
 	tpl            *template.Template
@@ -49,7 +50,7 @@ func (d *conferenceListData) Title() string {
 }
 
 func (d *conferenceListData) Path() string {
-	return "/conferences"
+	return "conferences"
 }
 
 type conferenceInstanceServer struct {
@@ -95,7 +96,7 @@ func newConferenceListServer(l log.Logger, vc views.Client,
 	}
 	tpl, err := newTpl(template.FuncMap{
 		"min":       minFunc(s.MaxResourceAge),
-		"max":       maxLoc,
+		"max":       s.maxSearchVal,
 		"start_val": s.StartSearchVal,
 		"end_val":   s.EndSearchVal,
 	}, base+conferenceListTpl+copyScript+pagingTpl)
@@ -150,7 +151,12 @@ func (s *conferenceListServer) EndSearchVal(query url.Values, loc *time.Location
 	if end, ok := query["created-before"]; ok {
 		return end[0]
 	}
-	return maxLoc(loc)
+	return s.maxSearchVal(loc)
+}
+
+// maxSearchVal returns the latest time the user can search for.
+func (s *conferenceListServer) maxSearchVal(loc *time.Location) string {
+	return maxAgeLoc(s.MinResourceAge, loc)
 }
 
 func (c *conferenceListServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
@@ -236,9 +242,10 @@ func (c *conferenceListServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	// Fetch the next page into the cache
+	bgctx := backgroundContext(r)
 	go func(u *config.User, n types.NullString, start, end time.Time) {
 		if n.Valid {
-			if _, _, err := c.Client.GetNextConferencePageInRange(context.Background(), u, start, end, n.String); err != nil {
+			if _, _, err := c.Client.GetNextConferencePageInRange(bgctx, u, start, end, n.String); err != nil {
 				c.Debug("Error fetching next page", "err", err)
 			}
 		}
@@ -281,7 +288,7 @@ func (c *conferenceInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	switch err {
 	case nil:
 		break
-	case config.PermissionDenied, config.ErrTooOld:
+	case config.PermissionDenied, config.ErrTooOld, config.ErrTooNew:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
 	default:
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/rest"
+)
+
+// Every browser gets a random CSRF session id, stored in this cookie. Forms
+// submit a token derived from the session id, the login session (if any) and
+// the secret key; another site can't read the cookie or compute the token.
+const csrfCookie = "csrf"
+
+// The form field or header that carries the token.
+const csrfField = "csrf_token"
+const csrfHeader = "X-CSRF-Token"
+
+// Set by config.GoogleAuthenticator and the other authenticators that use
+// a login cookie when a user logs in.
+const sessionCookie = "token"
+
+type csrfCtxVar int
+
+var csrfTokenKey csrfCtxVar = 0
+
+var errCSRF = &rest.Error{
+	Title: "Invalid or missing CSRF token. Reload the page and try again",
+}
+
+// csrfToken returns the token for the given CSRF session id and login session.
+func csrfToken(secretKey *[32]byte, csrfID, session string) string {
+	mac := hmac.New(sha256.New, secretKey[:])
+	mac.Write([]byte("csrf\x00"))
+	mac.Write([]byte(csrfID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// getCSRFToken returns the token that forms on the page should submit, or the
+// empty string if the request didn't pass through withCSRF.
+func getCSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfTokenKey).(string)
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// csrfExempt reports whether r can skip the CSRF check. SAML identity
+// providers post to the ACS endpoint from another site; the response is
+// signed instead.
+func csrfExempt(r *http.Request) bool {
+	return r.Method == "POST" && r.URL.Path == config.SAMLACSPath
+}
+
+func isLoginPath(path string) bool {
+	return path == config.LoginPath || path == config.MFALoginPath
+}
+
+// validCSRFID reports whether id looks like a value we generated.
+func validCSRFID(id string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil && len(b) == 32
+}
+
+// withCSRF rejects requests that can change state (anything except GET, HEAD
+// and OPTIONS) unless they carry a valid CSRF token, either in the
+// csrf_token form field or the X-CSRF-Token header. The token for the current
+// request is stored in the request context; render adds it to baseData.
+func withCSRF(h http.Handler, secretKey *[32]byte, allowUnencryptedTraffic bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var csrfID string
+		if cookie, err := r.Cookie(csrfCookie); err == nil && validCSRFID(cookie.Value) {
+			csrfID = cookie.Value
+		} else {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				rest.ServerError(w, r, err)
+				return
+			}
+			csrfID = base64.RawURLEncoding.EncodeToString(b)
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    csrfID,
+				Path:     "/",
+				Secure:   allowUnencryptedTraffic == false,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		var session string
+		// The login form is for people who aren't logged in yet; a stale
+		// login cookie may be cleared before they submit it.
+		if cookie, err := r.Cookie(sessionCookie); err == nil && !isLoginPath(r.URL.Path) {
+			session = cookie.Value
+		}
+		token := csrfToken(secretKey, csrfID, session)
+		r = r.WithContext(context.WithValue(r.Context(), csrfTokenKey, token))
+		if !isSafeMethod(r.Method) && !csrfExempt(r) {
+			got := r.Header.Get(csrfHeader)
+			if got == "" {
+				got = r.PostFormValue(csrfField)
+			}
+			if !hmac.Equal([]byte(got), []byte(token)) {
+				rest.Forbidden(w, r, errCSRF)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
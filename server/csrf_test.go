@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/nacl"
+)
+
+var csrfFieldRx = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func TestLogoutRequiresCSRFToken(t *testing.T) {
+	t.Parallel()
+	settings := &config.Settings{
+		AllowUnencryptedTraffic: true,
+		Authenticator:           &config.NoopAuthenticator{},
+		SecretKey:               nacl.NewKey(),
+		Logger:                  NullLogger,
+	}
+	s, err := NewServer(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:12345/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie {
+		t.Fatalf("expected a csrf cookie, got %v", cookies)
+	}
+	match := csrfFieldRx.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatal("expected the logout form to have a CSRF token")
+	}
+
+	post := func(token string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		if token != "" {
+			form.Set(csrfField, token)
+		}
+		req, _ := http.NewRequest("POST", "http://localhost:12345/auth/logout", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	if w := post(""); w.Code != 403 {
+		t.Errorf("expected POST without a token to get a 403, got %d", w.Code)
+	}
+	if w := post("wrong"); w.Code != 403 {
+		t.Errorf("expected POST with the wrong token to get a 403, got %d", w.Code)
+	}
+	if w := post(match[1]); w.Code == 403 {
+		t.Errorf("expected POST with a valid token to succeed, got %d", w.Code)
+	}
+}
@@ -15,7 +15,9 @@ type errorData struct {
 	baseData
 	Title       string
 	Description string
-	Mailto      *mail.Address
+	// Why the request failed, if we know and can tell the user.
+	Reason string
+	Mailto *mail.Address
 }
 
 type errorServer struct {
@@ -53,11 +55,15 @@ func newErrorServer(mailto *mail.Address, reporter services.ErrorReporter) (*err
 }
 
 func (e *errorServer) Serve403(w http.ResponseWriter, r *http.Request) {
-	data := &baseData{Data: &errorData{
+	ed := &errorData{
 		Title:       "Forbidden",
 		Description: "You don't have permission to access this page. If you think something is broken, please report a problem.",
 		Mailto:      e.Mailto,
-	}}
+	}
+	if rerr, ok := rest.CtxErr(r).(*rest.Error); ok && rerr != nil {
+		ed.Reason = rerr.Title
+	}
+	data := &baseData{Data: ed}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(403)
 	if err := render(w, r, e.tpl, "base", data); err != nil {
@@ -91,6 +97,27 @@ func (e *errorServer) Serve405(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Serve429 serves the page for a user or IP address that has made too many
+// requests. Set the Retry-After header before calling it.
+func (e *errorServer) Serve429(w http.ResponseWriter, r *http.Request) {
+	description := "You've made too many requests. Please wait a little while, then try again."
+	if secs := w.Header().Get("Retry-After"); secs == "1" {
+		description = "You've made too many requests. Please wait a second, then try again."
+	} else if secs != "" {
+		description = fmt.Sprintf("You've made too many requests. Please wait %s seconds, then try again.", secs)
+	}
+	data := &baseData{Data: &errorData{
+		Title:       "Too Many Requests",
+		Description: description,
+		Mailto:      e.Mailto,
+	}}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(429)
+	if err := render(w, r, e.tpl, "base", data); err != nil {
+		handlers.Logger.Info("Error rendering error template", "err", err)
+	}
+}
+
 func (e *errorServer) Serve500(w http.ResponseWriter, r *http.Request) {
 	data := &baseData{Data: &errorData{
 		Title:       "Server Error",
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/views"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// GitSHA is the commit the server was built from. Set it when building:
+//
+//	go install -ldflags="-X github.com/kevinburke/logrole/server.GitSHA=$(git rev-parse HEAD)" ./commands/...
+var GitSHA = "unknown"
+
+// The health check endpoints don't require authentication, so load balancers
+// can probe them. They don't reveal anything about the Twilio account.
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// healthzServer reports that the process is up and serving requests.
+type healthzServer struct{}
+
+func (h *healthzServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+type readyzResponse struct {
+	Ready bool `json:"ready"`
+	// Whether the server is still accepting requests; false once it starts
+	// shutting down.
+	Serving bool `json:"serving"`
+	// Whether the first run of CacheCommonQueries has finished.
+	CacheWarmed bool `json:"cache_warmed"`
+	// Whether the last call to Twilio succeeded.
+	TwilioReachable bool `json:"twilio_reachable"`
+}
+
+// readyzServer reports whether the server should be sent traffic.
+type readyzServer struct {
+	log.Logger
+	Client views.Client
+	// Ready returns false once the server starts shutting down.
+	Ready func() bool
+}
+
+func (s *readyzServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := &readyzResponse{
+		Serving:     s.Ready(),
+		CacheWarmed: s.Client.CommonQueriesCached(),
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+	if err := s.Client.Ping(ctx); err != nil {
+		s.Warn("Couldn't reach Twilio", "err", err)
+	} else {
+		resp.TwilioReachable = true
+	}
+	resp.Ready = resp.Serving && resp.CacheWarmed && resp.TwilioReachable
+	code := http.StatusOK
+	if !resp.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, resp)
+}
+
+type versionResponse struct {
+	Version       string `json:"version"`
+	TwilioVersion string `json:"twilio_version"`
+	GoVersion     string `json:"go_version"`
+	GitSHA        string `json:"git_sha"`
+}
+
+type versionServer struct{}
+
+func (v *versionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &versionResponse{
+		Version:       Version,
+		TwilioVersion: twilio.Version,
+		GoVersion:     runtime.Version(),
+		GitSHA:        GitSHA,
+	})
+}
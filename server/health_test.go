@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/nacl"
+)
+
+type readyClient struct {
+	views.Client
+	cached  bool
+	pingErr error
+}
+
+func (c *readyClient) CommonQueriesCached() bool      { return c.cached }
+func (c *readyClient) Ping(ctx context.Context) error { return c.pingErr }
+
+func TestReadyz(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		serving bool
+		client  *readyClient
+		code    int
+	}{
+		{"ready", true, &readyClient{cached: true}, 200},
+		{"cache cold", true, &readyClient{cached: false}, 503},
+		{"twilio down", true, &readyClient{cached: true, pingErr: errors.New("timeout")}, 503},
+		{"draining", false, &readyClient{cached: true}, 503},
+	}
+	for _, tt := range tests {
+		serving := tt.serving
+		s := &readyzServer{Logger: NullLogger, Client: tt.client, Ready: func() bool { return serving }}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: expected code %d, got %d", tt.name, tt.code, w.Code)
+		}
+		resp := new(readyzResponse)
+		if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Ready != (tt.code == 200) {
+			t.Errorf("%s: expected ready to be %t, got %t", tt.name, tt.code == 200, resp.Ready)
+		}
+	}
+}
+
+func TestHealthEndpointsSkipAuth(t *testing.T) {
+	t.Parallel()
+	lf, _ := services.NewLocationFinder("UTC")
+	s, err := NewServer(&config.Settings{
+		AllowUnencryptedTraffic: true,
+		Authenticator:           config.NewBasicAuthAuthenticator("logrole"),
+		LocationFinder:          lf,
+		SecretKey:               nacl.NewKey(),
+		Logger:                  NullLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+	if w.Code != 401 {
+		t.Fatalf("expected /me to require authentication, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != 200 {
+		t.Errorf("expected /healthz to return 200, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	if w.Code != 200 {
+		t.Fatalf("expected /version to return 200, got %d", w.Code)
+	}
+	resp := new(versionResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Version != Version || resp.GoVersion == "" || resp.GitSHA == "" {
+		t.Errorf("unexpected version response: %#v", resp)
+	}
+}
@@ -17,6 +17,8 @@ import (
 // An imageServer provides an opaque proxy for image requests.
 type imageServer struct {
 	secretKey *[32]byte
+	// Used to download images. If nil, twilio.MediaClient is used.
+	client *http.Client
 }
 
 var imageRoute = regexp.MustCompile("^/images/(?P<encrypted>([-_a-zA-Z0-9=]+))$")
@@ -68,7 +70,11 @@ func (i *imageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := getContext(r.Context(), 5*time.Second)
 	defer cancel()
 	req = req.WithContext(ctx)
-	resp, err := twilio.MediaClient.Do(req)
+	client := i.client
+	if client == nil {
+		client = &twilio.MediaClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		rest.ServerError(w, r, err)
 		return
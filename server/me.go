@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/rest"
+)
+
+// meServer shows the user their group and permissions, and explains why they
+// can or can't see a given resource.
+type meServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	MaxResourceAge time.Duration
+	// Set by NewServer.
+	MinResourceAge time.Duration
+	tpl            *template.Template
+}
+
+func newMeServer(l log.Logger, vc views.Client, lf services.LocationFinder, maxResourceAge time.Duration) (*meServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+meTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &meServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+		MaxResourceAge: maxResourceAge,
+		tpl:            tpl,
+	}, nil
+}
+
+type permissionRow struct {
+	Name    string
+	Allowed bool
+	// Why the permission is off, if it is.
+	Reason string
+}
+
+type meData struct {
+	ID          string
+	Group       string
+	Permissions []*permissionRow
+	Settings    *config.UserSettings
+	// The effective max resource age; zero means there's no limit.
+	MaxResourceAge time.Duration
+	// True if the user's group sets its own max_resource_age.
+	GroupMaxResourceAge bool
+	// The effective min resource age; zero means new resources are visible.
+	MinResourceAge time.Duration
+	// True if the user's group sets its own min_resource_age.
+	GroupMinResourceAge bool
+	Scoped              bool
+	Elevation           *config.Elevation
+
+	Sid         string
+	Explanation *views.Explanation
+	Err         string
+}
+
+func (d *meData) Title() string {
+	return "My Permissions"
+}
+
+func (s *meServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	settings := u.Settings()
+	data := &meData{
+		ID:                  u.ID(),
+		Group:               u.Group(),
+		Settings:            settings,
+		MaxResourceAge:      u.MaxResourceAge(s.MaxResourceAge),
+		GroupMaxResourceAge: settings.MaxResourceAge != 0,
+		MinResourceAge:      u.MinResourceAge(s.MinResourceAge),
+		GroupMinResourceAge: settings.MinResourceAge != 0,
+		Scoped:              u.IsScoped(),
+		Elevation:           u.Elevation(),
+		Sid:                 strings.TrimSpace(r.URL.Query().Get("sid")),
+	}
+	for _, name := range config.PermissionNames() {
+		data.Permissions = append(data.Permissions, &permissionRow{
+			Name:    name,
+			Allowed: u.Can(name),
+			Reason:  u.WhyNot(name),
+		})
+	}
+	if data.Sid != "" {
+		explanation, err := s.Client.Explain(r.Context(), u, data.Sid)
+		if err != nil {
+			s.Warn("Couldn't explain sid", "sid", data.Sid, "err", err)
+			data.Err = err.Error()
+		} else {
+			data.Explanation = explanation
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", &baseData{LF: s.LocationFinder, Data: data}); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/test/harness"
+)
+
+var oldMessageResp = []byte(`{"sid": "SM26b3b00f8def53be77c5697183bfe95e", "date_created": "Tue, 20 Sep 2016 22:41:38 +0000", "date_updated": "Tue, 20 Sep 2016 22:41:38 +0000", "to": "+19253920364", "from": "+19252717005", "body": "Hello", "status": "delivered", "num_segments": "1", "num_media": "0", "direction": "outbound-api", "price": "-0.00750", "price_unit": "USD", "uri": "/2010-04-01/Accounts/AC123/Messages/SM26b3b00f8def53be77c5697183bfe95e.json"}`)
+
+func TestMeExplainsHiddenMessage(t *testing.T) {
+	t.Parallel()
+	server := newServerWithResponse(200, oldMessageResp)
+	defer server.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{TestServer: server, MaxResourceAge: time.Hour})
+	s, err := newMeServer(dlog, vc, lf, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us := config.AllUserSettings()
+	us.CanViewMessageBody = false
+	us.MaxResourceAge = 0
+	req, _ := http.NewRequest("GET", "/me?sid=SM26b3b00f8def53be77c5697183bfe95e", nil)
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"It&#39;s older than the max_resource_age (1h0m0s)",
+		"can_view_message_body is off",
+		"(the site default)",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q, got %s", want, body)
+		}
+	}
+}
+
+func TestMeExplainsVideoRecording(t *testing.T) {
+	t.Parallel()
+	created := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	server := newServerWithResponse(200, []byte(`{"sid": "RT123", "status": "completed", "type": "video", "container_format": "mkv", "date_created": "`+created+`"}`))
+	defer server.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{TestServer: server})
+	s, err := newMeServer(dlog, vc, lf, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us := config.AllUserSettings()
+	us.CanViewRooms = false
+	req, _ := http.NewRequest("GET", "/me?sid=RT123", nil)
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"Video Recording", "ContainerFormat", "can_view_rooms is off"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q, got %s", want, body)
+		}
+	}
+}
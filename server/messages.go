@@ -1,7 +1,6 @@
 package server
 
 import (
-	"context"
 	"errors"
 	"html/template"
 	"net/http"
@@ -89,7 +88,7 @@ func (s *messageInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request
 	switch err {
 	case nil:
 		break
-	case config.PermissionDenied, config.ErrTooOld:
+	case config.PermissionDenied, config.ErrTooOld, config.ErrTooNew:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
 	default:
@@ -141,6 +140,8 @@ type messageListServer struct {
 	PageSize       uint
 	secretKey      *[32]byte
 	MaxResourceAge time.Duration
+	// Resources newer than this are hidden. Set by NewServer.
+	MinResourceAge time.Duration
 	tpl            *template.Template
 }
 
@@ -160,7 +161,12 @@ func (s *messageListServer) EndSearchVal(query url.Values, loc *time.Location) s
 	if end, ok := query["end"]; ok {
 		return end[0]
 	}
-	return maxLoc(loc)
+	return s.maxSearchVal(loc)
+}
+
+// maxSearchVal returns the latest time the user can search for.
+func (s *messageListServer) maxSearchVal(loc *time.Location) string {
+	return maxAgeLoc(s.MinResourceAge, loc)
 }
 
 func newMessageListServer(l log.Logger, vc views.Client, lf services.LocationFinder, pageSize uint, maxResourceAge time.Duration, secretKey *[32]byte) (*messageListServer, error) {
@@ -175,7 +181,7 @@ func newMessageListServer(l log.Logger, vc views.Client, lf services.LocationFin
 	tpl, err := newTpl(template.FuncMap{
 		"is_our_pn": vc.IsTwilioNumber,
 		"min":       minFunc(s.MaxResourceAge),
-		"max":       maxLoc,
+		"max":       s.maxSearchVal,
 		"start_val": s.StartSearchVal,
 		"end_val":   s.EndSearchVal,
 	}, base+messageListTpl+messageStatusTpl+pagingTpl+phoneTpl+copyScript)
@@ -201,7 +207,7 @@ func (m *messageListData) Title() string {
 }
 
 func (m *messageListData) Path() string {
-	return "/messages"
+	return "messages"
 }
 
 func (m *messageListData) NextQuery() template.URL {
@@ -276,6 +282,10 @@ func (s *messageListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.renderError(w, r, http.StatusBadRequest, query, err)
 		return
 	}
+	if err := checkMaskedFilters(query, u.MessageFromMask(), u.MessageToMask()); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
 	loc := s.LocationFinder.GetLocationReq(r)
 	var err error
 	startTime, endTime, wroteError := getTimes(w, r, "start", "end", loc, query, s)
@@ -332,9 +342,10 @@ func (s *messageListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Fetch the next page into the cache
+	bgctx := backgroundContext(r)
 	go func(u *config.User, n types.NullString, start, end time.Time) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextMessagePageInRange(context.Background(), u, start, end, n.String); err != nil {
+			if _, _, err := s.Client.GetNextMessagePageInRange(bgctx, u, start, end, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
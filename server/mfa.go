@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/rest"
+)
+
+// Size of the QR code on the enrollment page, in pixels.
+const qrCodeSize = 200
+
+type mfaCtxVar int
+
+var mfaEnabledKey mfaCtxVar = 0
+
+// withMFALink marks the request so the page shows a link to the two-factor
+// settings page.
+func withMFALink(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), mfaEnabledKey, true))
+}
+
+func mfaLinkEnabled(r *http.Request) bool {
+	enabled, _ := r.Context().Value(mfaEnabledKey).(bool)
+	return enabled
+}
+
+// mfaServer lets users who log in with the login form set up, change and
+// turn off two-factor authentication.
+type mfaServer struct {
+	log.Logger
+	Authenticator *config.BasicAuthAuthenticator
+	secretKey     *[32]byte
+	tpl           *template.Template
+}
+
+func newMFAServer(l log.Logger, a *config.BasicAuthAuthenticator, secretKey *[32]byte) (*mfaServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+mfaTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &mfaServer{
+		Logger:        l,
+		Authenticator: a,
+		secretKey:     secretKey,
+		tpl:           tpl,
+	}, nil
+}
+
+type mfaData struct {
+	Enrolled bool
+	// True if the user's group requires two-factor authentication, so they
+	// can't turn it off.
+	Required          bool
+	RecoveryCodesLeft int
+	// Shown once, right after they're generated.
+	RecoveryCodes []string
+	// For users who haven't enrolled: the new secret, as a QR code and as
+	// text, and the encrypted key for the form to send back.
+	QRCode template.URL
+	Secret string
+	Key    string
+	Err    string
+	// The forms need the CSRF token.
+	CSRFToken string
+}
+
+func (d *mfaData) Title() string {
+	return "Two-Factor Authentication"
+}
+
+// SecretGroups splits the secret into groups of four characters, so it's
+// easier to type.
+func (d *mfaData) SecretGroups() string {
+	var groups []string
+	for s := d.Secret; len(s) > 0; {
+		n := 4
+		if len(s) < n {
+			n = len(s)
+		}
+		groups = append(groups, s[:n])
+		s = s[n:]
+	}
+	return strings.Join(groups, " ")
+}
+
+func (s *mfaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok || u.ID() == "" {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	data := &mfaData{
+		Required:  u.RequiresMFA(),
+		CSRFToken: getCSRFToken(r),
+	}
+	// The key the user is enrolling with, if they entered an incorrect code.
+	var key *config.MFAKey
+	if r.Method == "POST" {
+		var err error
+		switch r.PostFormValue("action") {
+		case "enroll":
+			if s.Authenticator.MFA.Enrolled(u.ID()) {
+				http.Redirect(w, r, config.MFAPath, http.StatusSeeOther)
+				return
+			}
+			key, err = s.formKey(r, u)
+			if err == nil {
+				data.RecoveryCodes, err = s.Authenticator.EnrollMFA(w, r, u, key.Secret(), r.PostFormValue("code"))
+			}
+		case "recovery-codes":
+			if !s.Authenticator.MFA.Enrolled(u.ID()) {
+				http.Redirect(w, r, config.MFAPath, http.StatusSeeOther)
+				return
+			}
+			data.RecoveryCodes, err = s.Authenticator.NewRecoveryCodes(u, r.PostFormValue("code"))
+		case "disable":
+			err = s.Authenticator.DisableMFA(w, r, u, r.PostFormValue("code"))
+		default:
+			rest.BadRequest(w, r, &rest.Error{Title: "Unknown action"})
+			return
+		}
+		switch {
+		case err == config.ErrInvalidMFACode || err == config.ErrMFALocked || err == config.ErrMFARequired || err == errInvalidMFAKey:
+			data.Err = err.Error()
+		case err != nil:
+			rest.ServerError(w, r, err)
+			return
+		case data.RecoveryCodes == nil:
+			http.Redirect(w, r, config.MFAPath, http.StatusSeeOther)
+			return
+		}
+	}
+	s.render(w, r, u, data, key)
+}
+
+var errInvalidMFAKey = errors.New("The setup form expired. Please scan the new QR code")
+
+// formKey returns the key from the enrollment form. The form holds the key
+// encrypted, along with the user it was generated for.
+func (s *mfaServer) formKey(r *http.Request, u *config.User) (*config.MFAKey, error) {
+	plain, err := services.Unopaque(r.PostFormValue("key"), s.secretKey)
+	if err != nil {
+		return nil, errInvalidMFAKey
+	}
+	parts := strings.SplitN(plain, "\x00", 2)
+	if len(parts) != 2 || parts[0] != u.ID() {
+		return nil, errInvalidMFAKey
+	}
+	key, err := config.ParseMFAKey(parts[1])
+	if err != nil {
+		return nil, errInvalidMFAKey
+	}
+	return key, nil
+}
+
+// render shows the page. Users who haven't enrolled see key, or a new key if
+// it's nil.
+func (s *mfaServer) render(w http.ResponseWriter, r *http.Request, u *config.User, data *mfaData, key *config.MFAKey) {
+	mfa := s.Authenticator.MFA
+	data.Enrolled = mfa.Enrolled(u.ID())
+	data.RecoveryCodesLeft = mfa.RecoveryCodesLeft(u.ID())
+	if !data.Enrolled {
+		if key == nil {
+			var err error
+			key, err = config.NewMFAKey(u.ID())
+			if err != nil {
+				rest.ServerError(w, r, err)
+				return
+			}
+		}
+		png, err := key.PNG(qrCodeSize)
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+		data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		data.Secret = key.Secret()
+		data.Key = services.Opaque(u.ID()+"\x00"+key.URL(), s.secretKey)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := render(w, r, s.tpl, "base", &baseData{Data: data}); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/nacl"
+)
+
+// browser keeps the cookies a server sets, like a browser would.
+type browser struct {
+	t       *testing.T
+	h       http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (b *browser) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	b.t.Helper()
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, "http://localhost:12345"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, "http://localhost:12345"+path, nil)
+	}
+	for _, c := range b.cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	b.h.ServeHTTP(w, req)
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge < 0 {
+			delete(b.cookies, c.Name)
+		} else {
+			b.cookies[c.Name] = c
+		}
+	}
+	return w
+}
+
+var mfaSecretRx = regexp.MustCompile(`<code>([A-Z2-7 ]+)</code>`)
+var mfaKeyRx = regexp.MustCompile(`name="key" value="([^"]+)"`)
+
+func TestMFAEnrollment(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-mfa-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := nacl.NewKey()
+	store, err := config.NewMFAStore(filepath.Join(dir, "mfa"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba := config.NewBasicAuthAuthenticator("logrole")
+	ba.AddUserPassword("alice", "hunter2")
+	ba.AllowUnencryptedTraffic = true
+	ba.EnableLoginForm(NullLogger, store, key)
+	lf, _ := services.NewLocationFinder("UTC")
+	s, err := NewServer(&config.Settings{
+		AllowUnencryptedTraffic: true,
+		Authenticator:           ba,
+		LocationFinder:          lf,
+		SecretKey:               key,
+		Logger:                  NullLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &browser{t: t, h: s, cookies: make(map[string]*http.Cookie)}
+
+	w := b.do("GET", "/login", nil)
+	if w.Code != 401 || !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Fatalf("expected the login form, got %d: %s", w.Code, w.Body.String())
+	}
+	match := csrfFieldRx.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatal("expected the login form to have a CSRF token")
+	}
+	w = b.do("POST", "/login", url.Values{csrfField: {match[1]}, "user": {"alice"}, "password": {"hunter2"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected to log in, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = b.do("GET", "/mfa", nil)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "data:image/png;base64,") {
+		t.Error("expected the enrollment page to show a QR code")
+	}
+	secretMatch := mfaSecretRx.FindStringSubmatch(body)
+	keyMatch := mfaKeyRx.FindStringSubmatch(body)
+	match = csrfFieldRx.FindStringSubmatch(body)
+	if secretMatch == nil || keyMatch == nil || match == nil {
+		t.Fatalf("couldn't find the secret and form fields in %s", body)
+	}
+	w = b.do("POST", "/mfa", url.Values{csrfField: {match[1]}, "action": {"recovery-codes"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected users who haven't enrolled to be redirected, got %d: %s", w.Code, w.Body.String())
+	}
+	secret := strings.Replace(secretMatch[1], " ", "", -1)
+	code, err := config.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = b.do("POST", "/mfa", url.Values{
+		csrfField: {match[1]},
+		"action":  {"enroll"},
+		"key":     {keyMatch[1]},
+		"code":    {code},
+	})
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Recovery codes") {
+		t.Fatalf("expected to see recovery codes, got %d: %s", w.Code, w.Body.String())
+	}
+	if !store.Enrolled("alice") {
+		t.Fatal("expected alice to be enrolled")
+	}
+	// The login cookie was replaced with one that records the second factor.
+	w = b.do("GET", "/mfa", nil)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Two-factor authentication is on") {
+		t.Fatalf("expected to stay logged in, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// New recovery codes need a code from the authenticator app.
+	match = csrfFieldRx.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatal("expected the settings page to have a CSRF token")
+	}
+	w = b.do("POST", "/mfa", url.Values{csrfField: {match[1]}, "action": {"recovery-codes"}})
+	if w.Code != 200 || strings.Contains(w.Body.String(), "Recovery codes") || !strings.Contains(w.Body.String(), "That code is incorrect") {
+		t.Fatalf("expected new recovery codes to need a code, got %d: %s", w.Code, w.Body.String())
+	}
+	code, err = config.TOTPCode(secret, time.Now().Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = b.do("POST", "/mfa", url.Values{csrfField: {match[1]}, "action": {"recovery-codes"}, "code": {code}})
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Recovery codes") {
+		t.Fatalf("expected to see new recovery codes, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/notify"
+)
+
+// newAlertWatcher returns a Watcher that sends notifications about new alerts
+// in accounts, as configured in settings.AlertNotifications.
+func newAlertWatcher(settings *config.Settings, accounts []*config.Account) (*notify.Watcher, error) {
+	sinks, err := notify.NewSinks(settings.AlertNotifications.Sinks, nil)
+	if err != nil {
+		return nil, err
+	}
+	base := ""
+	if settings.PublicHost != "" {
+		scheme := "https"
+		if settings.AllowUnencryptedTraffic {
+			scheme = "http"
+		}
+		base = scheme + "://" + settings.PublicHost
+	}
+	watched := make([]*notify.Account, 0, len(accounts))
+	for _, acct := range accounts {
+		if acct.Client == nil {
+			continue
+		}
+		a := &notify.Account{Sid: acct.Sid, Client: acct.Client}
+		if base != "" {
+			a.URL = base + accountBase(accounts, acct)
+		}
+		watched = append(watched, a)
+	}
+	return notify.NewWatcher(settings.Logger, settings.AlertNotifications, watched, sinks)
+}
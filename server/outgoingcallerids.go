@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	types "github.com/kevinburke/go-types"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/rest"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+type outgoingCallerIDListServer struct {
+	log.Logger
+	Client         views.Client
+	PageSize       uint
+	LocationFinder services.LocationFinder
+	secretKey      *[32]byte
+	tpl            *template.Template
+}
+
+func newOutgoingCallerIDListServer(l log.Logger, vc views.Client,
+	lf services.LocationFinder, pageSize uint,
+	secretKey *[32]byte) (*outgoingCallerIDListServer, error) {
+	s := &outgoingCallerIDListServer{
+		Logger:         l,
+		Client:         vc,
+		PageSize:       pageSize,
+		LocationFinder: lf,
+		secretKey:      secretKey,
+	}
+	tpl, err := newTpl(template.FuncMap{}, base+outgoingCallerIDListTpl+pagingTpl+sidTpl+copyScript)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+func (s *outgoingCallerIDListServer) validParams() []string {
+	return []string{"phone-number", "friendly-name", "next"}
+}
+
+type outgoingCallerIDListData struct {
+	Page                  *views.OutgoingCallerIDPage
+	EncryptedNextPage     string
+	EncryptedPreviousPage string
+	Loc                   *time.Location
+	Err                   string
+	Query                 url.Values
+}
+
+func (d *outgoingCallerIDListData) Title() string {
+	return "Outgoing Caller IDs"
+}
+
+func (d *outgoingCallerIDListData) Path() string {
+	return "outgoing-caller-ids"
+}
+
+func (d *outgoingCallerIDListData) NextQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedNextPage != "" {
+		data.Set("next", d.EncryptedNextPage)
+	}
+	return template.URL(data.Encode())
+}
+
+func (d *outgoingCallerIDListData) PreviousQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedPreviousPage != "" {
+		data.Set("next", d.EncryptedPreviousPage)
+	}
+	return template.URL(data.Encode())
+}
+
+func (s *outgoingCallerIDListServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	str := cleanError(err)
+	data := &baseData{
+		LF: s.LocationFinder,
+		Data: &outgoingCallerIDListData{
+			Err:   str,
+			Loc:   s.LocationFinder.GetLocationReq(r),
+			Query: query,
+			Page:  new(views.OutgoingCallerIDPage),
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+}
+
+func (s *outgoingCallerIDListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	var err error
+	next, nextErr := getNext(query, s.secretKey)
+	if nextErr != nil {
+		err = errors.New("Could not decrypt `next` query parameter: " + nextErr.Error())
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	var page *views.OutgoingCallerIDPage
+	var cachedAt uint64
+	start := monotime.Now()
+	if next != "" {
+		if !strings.HasPrefix(next, "/"+twilio.APIVersion) {
+			s.Warn("Invalid next page URI", "next", next, "opaque", query.Get("next"))
+			s.renderError(w, r, http.StatusBadRequest, query, errors.New("Invalid next page uri"))
+			return
+		}
+		page, cachedAt, err = s.Client.GetNextOutgoingCallerIDPage(ctx, u, next)
+		setNextPageValsOnQuery(next, query)
+	} else {
+		vals := url.Values{}
+		vals.Set("PageSize", strconv.FormatUint(uint64(s.PageSize), 10))
+		if filterErr := setPageFilters(query, vals); filterErr != nil {
+			s.renderError(w, r, http.StatusBadRequest, query, filterErr)
+			return
+		}
+		page, cachedAt, err = s.Client.GetOutgoingCallerIDPage(ctx, u, vals)
+	}
+	if err == twilio.NoMoreResults {
+		page = new(views.OutgoingCallerIDPage)
+		err = nil
+	}
+	if err != nil {
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.Status {
+			case 400:
+				s.renderError(w, r, http.StatusBadRequest, query, err)
+			case 404:
+				rest.NotFound(w, r)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	bgctx := backgroundContext(r)
+	go func(u *config.User, n types.NullString) {
+		if n.Valid {
+			if _, _, err := s.Client.GetNextOutgoingCallerIDPage(bgctx, u, n.String); err != nil {
+				s.Debug("Error fetching next page", "err", err)
+			}
+		}
+	}(u, page.NextPageURI())
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data: &outgoingCallerIDListData{
+			Page:                  page,
+			Query:                 query,
+			Loc:                   s.LocationFinder.GetLocationReq(r),
+			EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
+			EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
+		}}
+	if cachedAt > 0 {
+		data.CachedDuration = monotime.Since(cachedAt)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
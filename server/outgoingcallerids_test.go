@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/test"
+	"github.com/kevinburke/logrole/test/harness"
+)
+
+func TestScopedCallerIDListOnlyShowsScopedNumbers(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		w.Write(test.OutgoingCallerIDListBody)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	c, err := newOutgoingCallerIDListServer(dlog, vc, lf, 50, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/outgoing-caller-ids", nil)
+	req = config.SetUser(req, scopedUser(t, &config.Scope{PhoneNumbers: []string{"+14105551234"}}))
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "PNca86cf94c7d4f89e0bd45bfa7d9b9e7d") {
+		t.Errorf("expected the scoped caller ID in the list, got %s", body)
+	}
+	if strings.Contains(body, "PN2a0747eba6abf96b7e3c3ff0b4530f6e") {
+		t.Errorf("expected the out of scope caller ID to be hidden, got %s", body)
+	}
+}
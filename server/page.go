@@ -9,6 +9,7 @@ import (
 
 	types "github.com/kevinburke/go-types"
 	twilio "github.com/kevinburke/twilio-go"
+	"github.com/kevinburke/logrole/config"
 	"github.com/kevinburke/logrole/services"
 )
 
@@ -118,6 +119,26 @@ func setNextPageValsOnQuery(nextpageuri string, query url.Values) {
 	if level := nq.Get("LogLevel"); level != "" {
 		query.Set("log-level", level)
 	}
+	if uniqueName := nq.Get("UniqueName"); uniqueName != "" {
+		query.Set("unique-name", uniqueName)
+	}
+}
+
+// checkMaskedFilters returns an error if query filters by a "from" or "to"
+// number that the user can only see masked. Otherwise they could confirm a
+// masked number by searching for each candidate.
+func checkMaskedFilters(query url.Values, fromMask config.Mask, toMask config.Mask) error {
+	if query.Get("from") != "" && fromMask.Mode != config.MaskFull {
+		return maskedFilterError("From")
+	}
+	if query.Get("to") != "" && toMask.Mode != config.MaskFull {
+		return maskedFilterError("To")
+	}
+	return nil
+}
+
+func maskedFilterError(field string) error {
+	return fmt.Errorf("Your group can't see full %s numbers, so you can't search by them", field)
 }
 
 // Reverse of the function above, with validation. Every list filter calls this
@@ -147,6 +168,10 @@ func setPageFilters(query url.Values, pageFilters url.Values) error {
 	if friendlyName := query.Get("friendly-name"); friendlyName != "" {
 		pageFilters.Set("FriendlyName", friendlyName)
 	}
+	// for rooms
+	if uniqueName := query.Get("unique-name"); uniqueName != "" {
+		pageFilters.Set("UniqueName", uniqueName)
+	}
 	if phoneNumber := query.Get("phone-number"); phoneNumber != "" {
 		pageFilters.Set("PhoneNumber", phoneNumber)
 	}
@@ -1,7 +1,6 @@
 package server
 
 import (
-	"context"
 	"errors"
 	"html/template"
 	"net/http"
@@ -98,7 +97,7 @@ func (d *numberListData) Title() string {
 }
 
 func (ad *numberListData) Path() string {
-	return "/phone-numbers"
+	return "phone-numbers"
 }
 
 func (c *numberListData) NextQuery() template.URL {
@@ -178,9 +177,10 @@ func (s *numberListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	bgctx := backgroundContext(r)
 	go func(u *config.User, n types.NullString) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextNumberPage(context.Background(), u, n.String); err != nil {
+			if _, _, err := s.Client.GetNextNumberPage(bgctx, u, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
@@ -299,7 +299,7 @@ func (s *numberInstanceServer) redirectPN(w http.ResponseWriter, r *http.Request
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
 	}
-	http.Redirect(w, r, "/phone-numbers/"+string(pn), 301)
+	http.Redirect(w, r, accountPath(r, "/phone-numbers/"+string(pn)), 301)
 }
 
 func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -345,8 +345,17 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	innerData.Number = number
+	// Searching for a number the user can only see masked would confirm it,
+	// unless it's one of the account's numbers, which they can see in full.
+	canSearch := func(m config.Mask) bool {
+		return number != nil || m.Mode == config.MaskFull
+	}
 	g.Go(func() error {
 		// get SMS from this number
+		if !canSearch(u.MessageFromMask()) {
+			innerData.SMSFromErr = maskedFilterError("From").Error()
+			return nil
+		}
 		data := url.Values{}
 		data.Set("From", pn)
 		data.Set("PageSize", "20")
@@ -365,6 +374,10 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	})
 	g.Go(func() error {
 		// get SMS to this number
+		if !canSearch(u.MessageToMask()) {
+			innerData.SMSToErr = maskedFilterError("To").Error()
+			return nil
+		}
 		data := url.Values{}
 		data.Set("To", pn)
 		data.Set("PageSize", "20")
@@ -383,6 +396,10 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	})
 	g.Go(func() error {
 		// get Calls to this number
+		if !canSearch(u.CallToMask()) {
+			innerData.CallsToErr = maskedFilterError("To").Error()
+			return nil
+		}
 		data := url.Values{}
 		data.Set("To", pn)
 		data.Set("PageSize", "20")
@@ -401,6 +418,10 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	})
 	g.Go(func() error {
 		// get Calls from this number
+		if !canSearch(u.CallFromMask()) {
+			innerData.CallsFromErr = maskedFilterError("From").Error()
+			return nil
+		}
 		data := url.Values{}
 		data.Set("From", pn)
 		data.Set("PageSize", "20")
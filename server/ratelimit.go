@@ -0,0 +1,131 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	"golang.org/x/time/rate"
+)
+
+// How often to forget about users and IP addresses that have stopped making
+// requests.
+var rateLimitSweepInterval = time.Minute
+
+type keyedLimiter struct {
+	lim  *rate.Limiter
+	rl   *config.RateLimit
+	seen time.Time
+}
+
+// rateLimiters keeps a token bucket for each user or IP address.
+type rateLimiters struct {
+	mu        sync.Mutex
+	limiters  map[string]*keyedLimiter
+	lastSweep time.Time
+}
+
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{limiters: make(map[string]*keyedLimiter)}
+}
+
+// allow reports whether key can make a request at now under rl. If not, it
+// returns how long until the next request is allowed.
+func (rls *rateLimiters) allow(key string, rl *config.RateLimit, now time.Time) (bool, time.Duration) {
+	rls.mu.Lock()
+	defer rls.mu.Unlock()
+	if now.Sub(rls.lastSweep) > rateLimitSweepInterval {
+		rls.sweep(now)
+	}
+	kl, ok := rls.limiters[key]
+	if !ok || kl.rl != rl {
+		kl = &keyedLimiter{lim: rate.NewLimiter(rate.Limit(rl.Rate), rl.BurstSize()), rl: rl}
+		rls.limiters[key] = kl
+	}
+	kl.seen = now
+	res := kl.lim.ReserveN(now, 1)
+	if !res.OK() {
+		return false, time.Second
+	}
+	if delay := res.DelayFrom(now); delay > 0 {
+		// Don't count requests we turn away against the bucket.
+		res.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// sweep removes buckets that have been idle long enough to refill, since a
+// new bucket would allow the same requests.
+func (rls *rateLimiters) sweep(now time.Time) {
+	for key, kl := range rls.limiters {
+		refill := time.Duration(float64(kl.rl.BurstSize()) / kl.rl.Rate * float64(time.Second))
+		if now.Sub(kl.seen) > refill {
+			delete(rls.limiters, key)
+		}
+	}
+	rls.lastSweep = now
+}
+
+// tooManyRequests sets a Retry-After header and serves the 429 page.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, tooMany http.Handler, retryAfter time.Duration) {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	tooMany.ServeHTTP(w, r)
+}
+
+// withIPRateLimit limits how often each IP address can make requests.
+// Requests whose IP address can't be determined aren't limited. Must be
+// called after withClientIP.
+func withIPRateLimit(h http.Handler, l log.Logger, rl *config.RateLimit, tooMany http.Handler) http.Handler {
+	limiters := newRateLimiters()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := getClientIP(r)
+		if ip == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if ok, retryAfter := limiters.allow(ip.String(), rl, time.Now()); !ok {
+			l.Warn("Rate limited request", "ip", ip.String(), "path", r.URL.Path, "retry_after", retryAfter)
+			tooManyRequests(w, r, tooMany, retryAfter)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// withUserRateLimit limits how often each user can make requests. A user's
+// group rate_limit takes precedence over global, which may be nil. Requests
+// from users without an ID aren't limited. Must be called after the User has
+// been set on the request.
+func withUserRateLimit(h http.Handler, l log.Logger, global *config.RateLimit, tooMany http.Handler) http.Handler {
+	limiters := newRateLimiters()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := config.GetUser(r)
+		if !ok || u.ID() == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rl := u.RateLimit()
+		if rl == nil {
+			rl = global
+		}
+		if rl == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if ok, retryAfter := limiters.allow(u.ID(), rl, time.Now()); !ok {
+			l.Warn("Rate limited request", "user", u.ID(), "path", r.URL.Path, "retry_after", retryAfter)
+			tooManyRequests(w, r, tooMany, retryAfter)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
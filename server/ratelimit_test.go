@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+)
+
+func newTooManyHandler(t *testing.T) http.Handler {
+	t.Helper()
+	e, err := newErrorServer(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return http.HandlerFunc(e.Serve429)
+}
+
+func TestUserRateLimit(t *testing.T) {
+	t.Parallel()
+	policy := &config.Policy{
+		&config.Group{Name: "scripts", Users: []string{"bot"}, RateLimit: &config.RateLimit{Rate: 0.001, Burst: 1}},
+		&config.Group{Name: "people", Users: []string{"alice"}},
+	}
+	global := &config.RateLimit{Rate: 0.001, Burst: 3}
+	h := withUserRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}), NullLogger, global, newTooManyHandler(t))
+	get := func(id string) *httptest.ResponseRecorder {
+		u, _, err := policy.Lookup(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/messages", nil)
+		req = config.SetUser(req, u)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("bot"); w.Code != 200 {
+		t.Fatalf("expected first request to succeed, got %d", w.Code)
+	}
+	w := get("bot")
+	if w.Code != 429 {
+		t.Fatalf("expected the group's rate limit to apply, got %d", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra == "" {
+		t.Error("expected a Retry-After header")
+	}
+	if !strings.Contains(w.Body.String(), "Too Many Requests") {
+		t.Errorf("expected the 429 page, got %s", w.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		if w := get("alice"); w.Code != 200 {
+			t.Fatalf("request %d: expected the global burst to allow it, got %d", i+1, w.Code)
+		}
+	}
+	if w := get("alice"); w.Code != 429 {
+		t.Errorf("expected the global rate limit to apply, got %d", w.Code)
+	}
+}
+
+func TestIPRateLimit(t *testing.T) {
+	t.Parallel()
+	rl := &config.RateLimit{Rate: 0.001, Burst: 1}
+	h := withIPRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}), NullLogger, rl, newTooManyHandler(t))
+	h = withClientIP(h, newIPResolver(nil, config.ProxyHeaderXForwardedFor))
+	get := func(addr string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := get("10.0.0.1:1234"); code != 200 {
+		t.Fatalf("expected first request to succeed, got %d", code)
+	}
+	if code := get("10.0.0.1:5678"); code != 429 {
+		t.Errorf("expected second request from the same IP to be limited, got %d", code)
+	}
+	if code := get("10.0.0.2:1234"); code != 200 {
+		t.Errorf("expected a request from another IP to succeed, got %d", code)
+	}
+}
+
+func TestRateLimitersSweep(t *testing.T) {
+	t.Parallel()
+	rls := newRateLimiters()
+	rl := &config.RateLimit{Rate: 1, Burst: 2}
+	now := time.Now()
+	rls.allow("a", rl, now)
+	rls.allow("b", rl, now.Add(rateLimitSweepInterval))
+	rls.allow("c", rl, now.Add(2*rateLimitSweepInterval))
+	if _, ok := rls.limiters["a"]; ok {
+		t.Error("expected idle limiter to be removed")
+	}
+	if _, ok := rls.limiters["c"]; !ok {
+		t.Error("expected active limiter to be kept")
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/kevinburke/logrole/config"
+)
+
+// ipResolver determines the address of the client that made a request.
+//
+// If trusted is nil, we use the first value in the X-Forwarded-For header, or
+// r.RemoteAddr if the header is not present. Anyone can set that header, so
+// configure trusted proxies before relying on the result.
+//
+// Otherwise, we only read one forwarding header - the one our proxies add to
+// - and only on requests that came from a trusted proxy. Proxies usually pass
+// the other header through from the client, so it can't be trusted. We walk
+// the list of hops from right to left - the order each proxy appended them -
+// and return the first address that isn't a trusted proxy.
+type ipResolver struct {
+	trusted []*net.IPNet
+	// config.ProxyHeaderXForwardedFor or config.ProxyHeaderForwarded.
+	header string
+}
+
+func newIPResolver(trusted []*net.IPNet, header string) *ipResolver {
+	return &ipResolver{trusted: trusted, header: header}
+}
+
+func (ir *ipResolver) isTrusted(ip net.IP) bool {
+	for _, n := range ir.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHost parses an IP address that may have a port, or brackets around an
+// IPv6 address.
+func parseHost(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	return net.ParseIP(s)
+}
+
+// forwardedFor returns the "for" parameters in the request's Forwarded
+// headers (RFC 7239), in order. Obfuscated identifiers and "unknown" are
+// returned as is; they won't parse as IP addresses.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, line := range h["Forwarded"] {
+		for _, elem := range strings.Split(line, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "for") {
+					continue
+				}
+				hops = append(hops, strings.Trim(kv[1], `"`))
+			}
+		}
+	}
+	return hops
+}
+
+// xForwardedFor returns the values in the request's X-Forwarded-For headers,
+// in order.
+func xForwardedFor(h http.Header) []string {
+	var hops []string
+	for _, line := range h["X-Forwarded-For"] {
+		for _, hop := range strings.Split(line, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// ClientIP returns the IP address of the client that made r, or nil if it
+// can't be determined.
+func (ir *ipResolver) ClientIP(r *http.Request) net.IP {
+	if ir.trusted == nil {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return parseHost(strings.Split(fwd, ",")[0])
+		}
+		return parseHost(r.RemoteAddr)
+	}
+	ip := parseHost(r.RemoteAddr)
+	if ip == nil || !ir.isTrusted(ip) {
+		return ip
+	}
+	var hops []string
+	if ir.header == config.ProxyHeaderForwarded {
+		hops = forwardedFor(r.Header)
+	} else {
+		hops = xForwardedFor(r.Header)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip = parseHost(hops[i])
+		if ip == nil {
+			// A proxy we trust gave us a value we can't parse, so we don't
+			// know where the request came from.
+			return nil
+		}
+		if !ir.isTrusted(ip) {
+			return ip
+		}
+	}
+	// Every hop is a trusted proxy; use the one furthest from us.
+	return ip
+}
+
+type ipCtxVar int
+
+var clientIPKey ipCtxVar = 0
+
+// withClientIP stores the IP address of the request's client in the request
+// context; retrieve it with getClientIP.
+func withClientIP(h http.Handler, ir *ipResolver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ir.ClientIP(r)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+	})
+}
+
+// getClientIP returns the IP address of the request's client, or nil if it
+// is unknown.
+func getClientIP(r *http.Request) net.IP {
+	if ip, ok := r.Context().Value(clientIPKey).(net.IP); ok {
+		return ip
+	}
+	return nil
+}
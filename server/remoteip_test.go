@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kevinburke/logrole/config"
+)
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+const xff = config.ProxyHeaderXForwardedFor
+
+var clientIPTests = []struct {
+	name       string
+	header     string
+	remoteAddr string
+	headers    map[string]string
+	want       string
+}{
+	{"no headers", xff, "10.0.0.5:4567", nil, "10.0.0.5"},
+	{"untrusted remote ignores headers", xff, "198.51.100.7:4567",
+		map[string]string{"X-Forwarded-For": "1.2.3.4"}, "198.51.100.7"},
+	{"spoofed leftmost value", xff, "10.0.0.5:4567",
+		map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.9, 10.0.0.6"}, "203.0.113.9"},
+	{"all hops trusted", xff, "10.0.0.5:4567",
+		map[string]string{"X-Forwarded-For": "10.0.0.7, 10.0.0.6"}, "10.0.0.7"},
+	{"unparseable hop", xff, "10.0.0.5:4567",
+		map[string]string{"X-Forwarded-For": "203.0.113.9, garbage"}, "<nil>"},
+	{"client forwarded header is ignored", xff, "10.0.0.5:4567",
+		map[string]string{
+			"Forwarded":       "for=198.51.100.7",
+			"X-Forwarded-For": "203.0.113.9",
+		}, "203.0.113.9"},
+	{"client forwarded unknown is ignored", xff, "10.0.0.5:4567",
+		map[string]string{
+			"Forwarded":       "for=unknown",
+			"X-Forwarded-For": "203.0.113.9",
+		}, "203.0.113.9"},
+	{"forwarded header", config.ProxyHeaderForwarded, "10.0.0.5:4567",
+		map[string]string{
+			"Forwarded":       `for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.6`,
+			"X-Forwarded-For": "5.6.7.8",
+		}, "2001:db8:cafe::17"},
+	{"client x-forwarded-for is ignored", config.ProxyHeaderForwarded, "10.0.0.5:4567",
+		map[string]string{"X-Forwarded-For": "5.6.7.8"}, "10.0.0.5"},
+	{"obfuscated forwarded identifier", config.ProxyHeaderForwarded, "10.0.0.5:4567",
+		map[string]string{"Forwarded": "for=_hidden"}, "<nil>"},
+}
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+	for _, tt := range clientIPTests {
+		ir := newIPResolver([]*net.IPNet{mustCIDR(t, "10.0.0.0/8")}, tt.header)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		if got := ir.ClientIP(req).String(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	t.Parallel()
+	ir := newIPResolver(nil, xff)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:4567"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.6")
+	if got := ir.ClientIP(req).String(); got != "1.2.3.4" {
+		t.Errorf("expected the first X-Forwarded-For value, got %s", got)
+	}
+}
+
+func TestWhitelistFailClosed(t *testing.T) {
+	t.Parallel()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	nets := []*net.IPNet{mustCIDR(t, "203.0.113.0/24")}
+	ir := newIPResolver([]*net.IPNet{mustCIDR(t, "10.0.0.0/8")}, config.ProxyHeaderForwarded)
+	for _, failClosed := range []bool{false, true} {
+		h := withClientIP(whitelistIPs(ok, NullLogger, nets, failClosed), ir)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.5:4567"
+		req.Header.Set("Forwarded", "for=unknown")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if failClosed && w.Code != 403 {
+			t.Errorf("expected fail closed to deny access, got %d", w.Code)
+		}
+		if !failClosed && w.Code != 200 {
+			t.Errorf("expected fail open to allow access, got %d", w.Code)
+		}
+	}
+}
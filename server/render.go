@@ -13,12 +13,17 @@ import (
 	"github.com/aristanetworks/goarista/monotime"
 	"github.com/kevinburke/handlers"
 	"github.com/kevinburke/logrole/assets"
+	"github.com/kevinburke/logrole/config"
 	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/logrole/views"
+	twilio "github.com/kevinburke/twilio-go"
 )
 
 var base, phoneTpl, copyScript, sidTpl, messageInstanceTpl, messageListTpl,
 	callInstanceTpl, callListTpl, conferenceListTpl, conferenceInstanceTpl,
-	alertListTpl, alertInstanceTpl, numberListTpl, numberInstanceTpl,
+	alertListTpl, alertInstanceTpl, alertDashboardTpl, numberListTpl, numberInstanceTpl,
+	roomListTpl, roomInstanceTpl, applicationListTpl, applicationInstanceTpl,
+	outgoingCallerIDListTpl, sessionListTpl, mfaTpl, breakGlassTpl, meTpl,
 	indexTpl, loginTpl, recordingTpl, pagingTpl, openSearchTpl,
 	messageStatusTpl, messageSummaryTpl, callSummaryTpl, openSourceTpl,
 	errorTpl string
@@ -42,6 +47,16 @@ func init() {
 	numberInstanceTpl = assets.MustAssetString("templates/phone-numbers/instance.html")
 	alertListTpl = assets.MustAssetString("templates/alerts/list.html")
 	alertInstanceTpl = assets.MustAssetString("templates/alerts/instance.html")
+	alertDashboardTpl = assets.MustAssetString("templates/alerts/dashboard.html")
+	roomListTpl = assets.MustAssetString("templates/rooms/list.html")
+	roomInstanceTpl = assets.MustAssetString("templates/rooms/instance.html")
+	applicationListTpl = assets.MustAssetString("templates/applications/list.html")
+	applicationInstanceTpl = assets.MustAssetString("templates/applications/instance.html")
+	outgoingCallerIDListTpl = assets.MustAssetString("templates/outgoing-caller-ids/list.html")
+	sessionListTpl = assets.MustAssetString("templates/sessions/list.html")
+	mfaTpl = assets.MustAssetString("templates/mfa/settings.html")
+	breakGlassTpl = assets.MustAssetString("templates/break-glass.html")
+	meTpl = assets.MustAssetString("templates/me.html")
 	indexTpl = assets.MustAssetString("templates/index.html")
 	loginTpl = assets.MustAssetString("templates/login.html")
 	recordingTpl = assets.MustAssetString("templates/calls/recordings.html")
@@ -77,6 +92,13 @@ var funcMap = template.FuncMap{
 	"truncate_sid":  services.TruncateSid,
 	"prefix_strip":  stripPrefix("+1 "),
 	"tztime":        tzTime,
+	"is_masked":     isMasked,
+}
+
+// isMasked reports whether a phone number was masked before being shown to
+// the user. Masked numbers can't be linked to or searched for.
+func isMasked(pn twilio.PhoneNumber) bool {
+	return config.IsMasked(string(pn))
 }
 
 // stripPrefix strips the prefix from a phone number - in this case we strip
@@ -102,6 +124,27 @@ type baseData struct {
 	LoggedOut      bool
 	TZ             string
 	LF             services.LocationFinder
+	// Relative links on the page resolve against Base, so they point at the
+	// same Twilio account as the current page.
+	Base string
+	// The Twilio account the page belongs to, if the request has one.
+	Account *config.Account
+	// Accounts the user can switch to.
+	Accounts []*accountLink
+	// Forms that POST to the site must submit this in the csrf_token field.
+	CSRFToken string
+	// Show a link to the sessions page.
+	CanManageSessions bool
+	// Show a link to the two-factor authentication page.
+	ShowMFA bool
+	// Show a link to the break-glass page.
+	CanBreakGlass bool
+	// The user's break-glass elevation, if they have one. Every page shows
+	// a banner while it's active.
+	Elevation *config.Elevation
+	// True if Twilio failed while serving the page, so it may show stale
+	// data from the cache, or be missing data.
+	Degraded bool
 	// Whatever data gets sent to the child template. Should have a Title
 	// property or Title() function.
 	Data interface{}
@@ -111,6 +154,19 @@ func (bd *baseData) Version() string {
 	return Version
 }
 
+// FullPath returns the path of the current page, including the account
+// prefix.
+func (bd *baseData) FullPath() string {
+	return strings.TrimSuffix(bd.Base, "/") + bd.Path
+}
+
+// AccountURL returns the URL of the current section (calls, messages, etc)
+// in the given account.
+func (bd *baseData) AccountURL(a *accountLink) string {
+	section := strings.SplitN(strings.TrimPrefix(bd.Path, "/"), "/", 2)[0]
+	return a.Base + section
+}
+
 func tzTime(now time.Time, lf services.LocationFinder, loc string) string {
 	l := lf.GetLocation(loc)
 	return services.FriendlyDate(now.In(l))
@@ -132,6 +188,16 @@ func maxLoc(l *time.Location) string {
 	return time.Now().In(l).Add(1 * time.Hour).Truncate(time.Hour).Format(HTML5DatetimeLocalFormat)
 }
 
+// maxAgeLoc returns the latest acceptable creation time for a resource,
+// formatted using the HTML5 Datetime format. If minAge is nonzero, resources
+// newer than minAge are excluded.
+func maxAgeLoc(minAge time.Duration, l *time.Location) string {
+	if minAge == 0 {
+		return maxLoc(l)
+	}
+	return minLoc(minAge, l)
+}
+
 // Render renders the given template to a bytes.Buffer. If the template renders
 // successfully, we write it to the ResponseWriter, otherwise we return the
 // error.
@@ -141,6 +207,20 @@ func render(w io.Writer, r *http.Request, tpl *template.Template, name string, d
 	data.Start = monotime.Now()
 	data.Now = time.Now().UTC()
 	data.Path = r.URL.Path
+	data.Base = "/"
+	data.CSRFToken = getCSRFToken(r)
+	if u, ok := config.GetUser(r); ok {
+		data.CanManageSessions = u.CanManageSessions()
+		data.CanBreakGlass = u.BreakGlass() != nil
+		data.Elevation = u.Elevation()
+	}
+	data.ShowMFA = mfaLinkEnabled(r)
+	data.Degraded = views.Degraded(r.Context())
+	if st, ok := getAccountState(r); ok {
+		data.Base = st.Base
+		data.Account = st.Account
+		data.Accounts = st.Links
+	}
 	data.ReqDuration = handlers.GetDuration(r.Context())
 	if data.LF != nil {
 		data.TZ = data.LF.GetLocationReq(r).String()
@@ -0,0 +1,366 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	types "github.com/kevinburke/go-types"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/rest"
+	twilio "github.com/kevinburke/twilio-go"
+	"golang.org/x/sync/errgroup"
+)
+
+const roomPattern = `(?P<sid>RM[a-f0-9]{32})`
+
+var roomInstanceRoute = regexp.MustCompile("^/rooms/" + roomPattern + "$")
+
+// Not putting this in the twilio-go library since Twilio might add more
+// statuses later.
+var validRoomStatuses = []twilio.Status{twilio.StatusInProgress, twilio.StatusCompleted, twilio.StatusFailed}
+
+type roomListServer struct {
+	log.Logger
+	Client         views.Client
+	PageSize       uint
+	MaxResourceAge time.Duration
+	// Resources newer than this are hidden. Set by NewServer.
+	MinResourceAge time.Duration
+	LocationFinder services.LocationFinder
+	secretKey      *[32]byte
+	tpl            *template.Template
+}
+
+type roomListData struct {
+	Err                   string
+	Query                 url.Values
+	Page                  *views.RoomPage
+	Loc                   *time.Location
+	EncryptedNextPage     string
+	EncryptedPreviousPage string
+}
+
+func (d *roomListData) Title() string {
+	return "Rooms"
+}
+
+func (d *roomListData) Path() string {
+	return "rooms"
+}
+
+func (d *roomListData) Statuses() []twilio.Status {
+	return validRoomStatuses
+}
+
+func newRoomListServer(l log.Logger, vc views.Client,
+	lf services.LocationFinder, pageSize uint, maxResourceAge time.Duration,
+	secretKey *[32]byte) (*roomListServer, error) {
+	s := &roomListServer{
+		Logger:         l,
+		Client:         vc,
+		PageSize:       pageSize,
+		LocationFinder: lf,
+		MaxResourceAge: maxResourceAge,
+		secretKey:      secretKey,
+	}
+	tpl, err := newTpl(template.FuncMap{
+		"min":       minFunc(s.MaxResourceAge),
+		"max":       s.maxSearchVal,
+		"start_val": s.StartSearchVal,
+		"end_val":   s.EndSearchVal,
+	}, base+roomListTpl+copyScript+pagingTpl)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+func (d *roomListData) NextQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedNextPage != "" {
+		data.Set("next", d.EncryptedNextPage)
+	}
+	if end, ok := d.Query["created-before"]; ok {
+		data.Set("created-before", end[0])
+	}
+	if start, ok := d.Query["created-after"]; ok {
+		data.Set("created-after", start[0])
+	}
+	return template.URL(data.Encode())
+}
+
+func (d *roomListData) PreviousQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedPreviousPage != "" {
+		data.Set("next", d.EncryptedPreviousPage)
+	}
+	if end, ok := d.Query["created-before"]; ok {
+		data.Set("created-before", end[0])
+	}
+	if start, ok := d.Query["created-after"]; ok {
+		data.Set("created-after", start[0])
+	}
+	return template.URL(data.Encode())
+}
+
+func (s *roomListServer) StartSearchVal(query url.Values, loc *time.Location) string {
+	if start, ok := query["created-after"]; ok {
+		return start[0]
+	}
+	if s.MaxResourceAge == config.DefaultMaxResourceAge {
+		// one week ago, arbitrary
+		return minLoc(7*24*time.Hour, loc)
+	} else {
+		return minLoc(s.MaxResourceAge, loc)
+	}
+}
+
+func (s *roomListServer) EndSearchVal(query url.Values, loc *time.Location) string {
+	if end, ok := query["created-before"]; ok {
+		return end[0]
+	}
+	return s.maxSearchVal(loc)
+}
+
+// maxSearchVal returns the latest time the user can search for.
+func (s *roomListServer) maxSearchVal(loc *time.Location) string {
+	return maxAgeLoc(s.MinResourceAge, loc)
+}
+
+func (s *roomListServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	str := cleanError(err)
+	data := &baseData{
+		LF: s.LocationFinder,
+		Data: &roomListData{
+			Err:   str,
+			Query: query,
+			Loc:   s.LocationFinder.GetLocationReq(r),
+			Page:  new(views.RoomPage),
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+}
+
+func (s *roomListServer) validParams() []string {
+	return []string{"status", "unique-name", "next", "created-after", "created-before"}
+}
+
+func (s *roomListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewRooms() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	var err error
+	loc := s.LocationFinder.GetLocationReq(r)
+	// We always set startTime and endTime on the request, though they may end
+	// up just being sentinels
+	startTime, endTime, wroteError := getTimes(w, r, "created-after", "created-before", loc, query, s)
+	if wroteError {
+		return
+	}
+	next, nextErr := getNext(query, s.secretKey)
+	if nextErr != nil {
+		err = errors.New("Could not decrypt `next` query parameter: " + nextErr.Error())
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	var page *views.RoomPage
+	var cachedAt uint64
+	start := monotime.Now()
+	if next != "" {
+		if !strings.HasPrefix(next, twilio.VideoBaseUrl) {
+			s.Warn("Invalid next page URI", "next", next, "opaque", query.Get("next"))
+			s.renderError(w, r, http.StatusBadRequest, query, errors.New("Invalid next page uri"))
+			return
+		}
+		page, cachedAt, err = s.Client.GetNextRoomPageInRange(ctx, u, startTime, endTime, next)
+		setNextPageValsOnQuery(next, query)
+	} else {
+		data := url.Values{}
+		data.Set("PageSize", strconv.FormatUint(uint64(s.PageSize), 10))
+		if filterErr := setPageFilters(query, data); filterErr != nil {
+			s.renderError(w, r, http.StatusBadRequest, query, filterErr)
+			return
+		}
+		page, cachedAt, err = s.Client.GetRoomPageInRange(ctx, u, startTime, endTime, data)
+	}
+	if err == twilio.NoMoreResults {
+		page = new(views.RoomPage)
+		err = nil
+	}
+	if err != nil {
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.Status {
+			case 400:
+				s.renderError(w, r, http.StatusBadRequest, query, err)
+			case 404:
+				rest.NotFound(w, r)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	// Fetch the next page into the cache
+	bgctx := backgroundContext(r)
+	go func(u *config.User, n types.NullString, start, end time.Time) {
+		if n.Valid {
+			if _, _, err := s.Client.GetNextRoomPageInRange(bgctx, u, start, end, n.String); err != nil {
+				s.Debug("Error fetching next page", "err", err)
+			}
+		}
+	}(u, page.NextPageURI(), startTime, endTime)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data: &roomListData{
+			Query:                 query,
+			Page:                  page,
+			Loc:                   loc,
+			EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
+			EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
+		},
+	}
+	if cachedAt > 0 {
+		data.CachedDuration = monotime.Since(cachedAt)
+	}
+	if err = render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+type roomInstanceServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+}
+
+func newRoomInstanceServer(l log.Logger, vc views.Client,
+	lf services.LocationFinder) (*roomInstanceServer, error) {
+	s := &roomInstanceServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+	}
+	tpl, err := newTpl(template.FuncMap{}, base+roomInstanceTpl+sidTpl+copyScript)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+type roomInstanceData struct {
+	Room                   *views.Room
+	Loc                    *time.Location
+	Participants           *views.RoomParticipants
+	ParticipantsErr        error
+	Recordings             *views.VideoRecordingPage
+	RecordingsErr          error
+	CanPlayVideoRecordings bool
+}
+
+func (d *roomInstanceData) Title() string {
+	return "Room Details"
+}
+
+func (s *roomInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewRooms() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	sid := roomInstanceRoute.FindStringSubmatch(r.URL.Path)[1]
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	start := monotime.Now()
+	var participants *views.RoomParticipants
+	var recordings *views.VideoRecordingPage
+	var participantsErr, recordingsErr error
+	// These errors are rendered on the page, instead of failing the request.
+	g, errctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		participants, participantsErr = s.Client.GetRoomParticipants(errctx, u, sid)
+		return nil
+	})
+	g.Go(func() error {
+		recordings, recordingsErr = s.Client.GetRoomRecordings(errctx, u, sid)
+		return nil
+	})
+	room, err := s.Client.GetRoom(ctx, u, sid)
+	switch err {
+	case nil:
+		break
+	case config.PermissionDenied, config.ErrTooOld, config.ErrTooNew:
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return
+	default:
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.Status {
+			case 404:
+				rest.NotFound(w, r)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	g.Wait()
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data: &roomInstanceData{
+			Room:                   room,
+			Loc:                    s.LocationFinder.GetLocationReq(r),
+			Participants:           participants,
+			ParticipantsErr:        participantsErr,
+			Recordings:             recordings,
+			RecordingsErr:          recordingsErr,
+			CanPlayVideoRecordings: u.CanPlayVideoRecordings(),
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/test"
+	"github.com/kevinburke/logrole/test/harness"
+)
+
+func TestUnauthorizedUserCantViewRoomList(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newRoomListServer(dlog, vc, nil, 50, time.Hour, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/rooms", nil)
+	u := config.NewUser(&config.UserSettings{CanViewRooms: false})
+	req = config.SetUser(req, u)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+func TestUnauthorizedUserCantViewRoomInstance(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newRoomInstanceServer(dlog, vc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/rooms/RM4070b618362c1682b2385b1f9982833c", nil)
+	u := config.NewUser(&config.UserSettings{CanViewRooms: false})
+	req = config.SetUser(req, u)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+func TestUnauthorizedUserCantPlayVideo(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s := &videoServer{Client: vc, secretKey: key}
+	req, _ := http.NewRequest("GET", "/video/foo", nil)
+	u := config.NewUser(&config.UserSettings{CanViewRooms: true, CanPlayVideoRecordings: false})
+	req = config.SetUser(req, u)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+func scopedUser(t *testing.T, scope *config.Scope) *config.User {
+	t.Helper()
+	p := &config.Policy{
+		&config.Group{
+			Name:        "franchise",
+			Permissions: config.AllUserSettings(),
+			Users:       []string{"franchise@example.com"},
+			Scope:       scope,
+		},
+	}
+	u, _, err := p.Lookup("franchise@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestScopedUserCantViewRoomList(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		w.Write(test.RoomListBody)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	c, err := newRoomListServer(dlog, vc, lf, 1, 0, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/rooms", nil)
+	req = config.SetUser(req, scopedUser(t, &config.Scope{PhoneNumbers: []string{"+14105551234"}}))
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "RM4070b618362c1682b2385b1f9982833c") {
+		t.Errorf("expected a scoped user not to see the room, got %s", body)
+	}
+}
+
+func TestScopedUserCantViewRoomInstance(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/Rooms/RM4070b618362c1682b2385b1f9982833c" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		w.Write(test.RoomInstanceBody)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s})
+	c, err := newRoomInstanceServer(dlog, vc, lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/rooms/RM4070b618362c1682b2385b1f9982833c", nil)
+	req = config.SetUser(req, scopedUser(t, &config.Scope{PhoneNumbers: []string{"+14105551234"}}))
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Errorf("expected a scoped user to get a 404, got %d", w.Code)
+	}
+}
+
+func TestGetRoomFiltersGeneratesCorrectQuery(t *testing.T) {
+	t.Parallel()
+	expected := "/v1/Rooms?DateCreatedAfter=2016-10-27T02%3A34%3A00Z&DateCreatedBefore=2016-10-27T23%3A25%3A00Z&PageSize=1&UniqueName=DailyStandup"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() != expected {
+			t.Errorf("expected URL to be %s, got %s", expected, r.URL.String())
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(200)
+		w.Write(test.RoomListBody)
+	}))
+	defer s.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key, TestServer: s, MaxResourceAge: config.DefaultMaxResourceAge})
+	c, err := newRoomListServer(dlog, vc, lf, 1, config.DefaultMaxResourceAge, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 22:34 NYC time gets converted to 2:34 next day UTC
+	req, _ := http.NewRequest("GET", "/rooms?unique-name=DailyStandup&created-before=2016-10-27T19:25&created-after=2016-10-26T22:34", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("expected Code to be 200, got %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `href="rooms/RM4070b618362c1682b2385b1f9982833c"`) {
+		t.Errorf("expected body to link to room, got %s", body)
+	}
+}
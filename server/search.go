@@ -19,40 +19,51 @@ var callSid = regexp.MustCompile("^" + callPattern + "$")
 var conferenceSid = regexp.MustCompile("^" + conferencePattern + "$")
 var notificationSid = regexp.MustCompile("^" + alertPattern + "$")
 var numberSid = regexp.MustCompile("^" + numberSidPattern + "$")
+var roomSid = regexp.MustCompile("^" + roomPattern + "$")
+var applicationSid = regexp.MustCompile("^" + applicationPattern + "$")
 
 func (s *searchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	q := query.Get("q")
 	if q == "" {
-		http.Redirect(w, r, "/", http.StatusFound)
+		http.Redirect(w, r, accountPath(r, "/"), http.StatusFound)
 		return
 	}
 	if smsSid.MatchString(q) {
-		http.Redirect(w, r, "/messages/"+q, http.StatusMovedPermanently)
+		http.Redirect(w, r, accountPath(r, "/messages/"+q), http.StatusMovedPermanently)
 		return
 	}
 	if callSid.MatchString(q) {
-		http.Redirect(w, r, "/calls/"+q, http.StatusMovedPermanently)
+		http.Redirect(w, r, accountPath(r, "/calls/"+q), http.StatusMovedPermanently)
 		return
 	}
 	if conferenceSid.MatchString(q) {
-		http.Redirect(w, r, "/conferences/"+q, http.StatusMovedPermanently)
+		http.Redirect(w, r, accountPath(r, "/conferences/"+q), http.StatusMovedPermanently)
 		return
 	}
 	if notificationSid.MatchString(q) {
-		http.Redirect(w, r, "/alerts/"+q, http.StatusMovedPermanently)
+		http.Redirect(w, r, accountPath(r, "/alerts/"+q), http.StatusMovedPermanently)
+		return
+	}
+	if roomSid.MatchString(q) {
+		http.Redirect(w, r, accountPath(r, "/rooms/"+q), http.StatusMovedPermanently)
+		return
+	}
+	if applicationSid.MatchString(q) {
+		http.Redirect(w, r, accountPath(r, "/applications/"+q), http.StatusMovedPermanently)
 		return
 	}
 	if numberSid.MatchString(q) {
-		http.Redirect(w, r, "/phone-numbers/"+q, http.StatusMovedPermanently)
+		http.Redirect(w, r, accountPath(r, "/phone-numbers/"+q), http.StatusMovedPermanently)
 		return
 	}
 	num, err := twilio.NewPhoneNumber(q)
 	if err == nil && len(num) > 3 {
-		http.Redirect(w, r, "/phone-numbers/"+string(num), http.StatusFound)
+		http.Redirect(w, r, accountPath(r, "/phone-numbers/"+string(num)), http.StatusFound)
+		return
 	}
 	s.Warn("Unknown search query", "q", q)
-	http.Redirect(w, r, "/", http.StatusFound)
+	http.Redirect(w, r, accountPath(r, "/"), http.StatusFound)
 }
 
 type openSearchXMLServer struct {
@@ -6,13 +6,16 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/inconshreveable/log15"
@@ -20,42 +23,44 @@ import (
 	"github.com/kevinburke/rest"
 	"github.com/kevinburke/logrole/assets"
 	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/notify"
 	"github.com/kevinburke/logrole/services"
 	"github.com/kevinburke/logrole/views"
+	twilio "github.com/kevinburke/twilio-go"
 )
 
 // Server version, run "make release" to increase this value
 const Version = "1.6"
 
-func getRemoteIP(r *http.Request) string {
-	fwd := r.Header.Get("X-Forwarded-For")
-	if fwd == "" {
-		return r.RemoteAddr
-	}
-	return strings.Split(fwd, ",")[0]
+// withDegraded records whether Twilio failed while serving the request, so
+// pages can show a banner.
+func withDegraded(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(views.TrackDegraded(r.Context())))
+	})
 }
 
-// whitelistIPs checks whether the request's IP address was made from an IP
-// inside the provided ranges of ips. WhitelistIPs uses the first value in the
-// request's X-Forwarded-For header (if one is present), or r.RemoteAddr if an
-// X-Forwarded-For header is not present.
+// whitelistIPs checks whether the request was made from an IP address inside
+// the provided ranges of ips. Call withClientIP first to determine the
+// request's IP address.
 //
-// THIS IS NOT A SECURITY FEATURE. It is possible to spoof IP addresses or
-// construct an X-Forwarded-For header that contains a different IP address
+// Unless you have configured trusted proxies, this is not a security feature;
+// any client can send an X-Forwarded-For header with a different IP address
 // than the request's originating address.
-func whitelistIPs(h http.Handler, l log.Logger, nets []*net.IPNet) http.Handler {
+//
+// If the IP address can't be determined, access is denied if failClosed is
+// true, and allowed otherwise.
+func whitelistIPs(h http.Handler, l log.Logger, nets []*net.IPNet, failClosed bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ipStr := getRemoteIP(r)
-		// RemoteHost reports both
-		host, _, err := net.SplitHostPort(ipStr)
-		if err == nil {
-			ipStr = host
-		}
-		ip := net.ParseIP(ipStr)
+		ip := getClientIP(r)
 		found := false
 		if ip == nil {
-			l.Warn("Could not parse X-Forwarded-For header or RemoteHost as IP address. Allowing access", "ip", ipStr)
-			found = true
+			if failClosed {
+				l.Warn("Could not determine IP address of request. Denying access", "remote_addr", r.RemoteAddr)
+			} else {
+				l.Warn("Could not determine IP address of request. Allowing access", "remote_addr", r.RemoteAddr)
+				found = true
+			}
 		} else {
 			for _, n := range nets {
 				if n.Contains(ip) {
@@ -65,7 +70,7 @@ func whitelistIPs(h http.Handler, l log.Logger, nets []*net.IPNet) http.Handler
 			}
 		}
 		if !found {
-			l.Warn("Denying access to request based on IP", "ip", ipStr, "subnets", nets)
+			l.Warn("Denying access to request based on IP", "ip", ip, "subnets", nets)
 			rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
 			return
 		}
@@ -73,25 +78,58 @@ func whitelistIPs(h http.Handler, l log.Logger, nets []*net.IPNet) http.Handler
 	})
 }
 
+// isSecure reports whether r was made over HTTPS, either to this server or to
+// a proxy in front of it. If a proxy doesn't say which protocol it received
+// the request on, we assume HTTPS, unless unencrypted traffic is allowed.
+func isSecure(r *http.Request, allowUnencryptedTraffic bool) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto == "https"
+	}
+	return allowUnencryptedTraffic == false
+}
+
 func UpgradeInsecureHandler(h http.Handler, allowUnencryptedTraffic bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if allowUnencryptedTraffic == false {
-			if r.Header.Get("X-Forwarded-Proto") == "http" {
-				u := r.URL
-				u.Scheme = "https"
-				u.Host = r.Host
-				http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
-				return
-			}
+		if allowUnencryptedTraffic == false && !isSecure(r, allowUnencryptedTraffic) {
+			u := r.URL
+			u.Scheme = "https"
+			u.Host = r.Host
+			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+			return
+		}
+		// Browsers ignore this header on responses sent over HTTP.
+		if isSecure(r, allowUnencryptedTraffic) {
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains; preload")
 		}
-		// This header doesn't mean anything when served over HTTP, but
-		// detecting HTTPS is a general way is hard, so let's just send it
-		// every time.
-		w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains; preload")
 		h.ServeHTTP(w, r)
 	})
 }
 
+// RedirectToHTTPS redirects every request to the same URL on the HTTPS
+// server listening on httpsPort.
+func RedirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			rest.BadRequest(w, r, &rest.Error{Title: "Missing Host header"})
+			return
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
+
 // Static file HTTP server; all assets are packaged up in the assets directory
 // with go-bindata.
 type static struct {
@@ -172,10 +210,26 @@ type Server struct {
 	vc       views.Client
 	DoneChan chan bool
 	PageSize uint
+	settings *config.Settings
+
+	// Sends notifications about new alerts, if they're configured.
+	watcher      *notify.Watcher
+	watchCtx     context.Context
+	stopWatching context.CancelFunc
+
+	// Set to 1 by Drain.
+	draining  int32
+	closeOnce sync.Once
 }
 
+// Close stops the goroutines started by CacheCommonQueries, WatchAlerts and
+// config.NewSettingsFromConfig. It's safe to call Close more than once.
 func (s *Server) Close() error {
-	s.DoneChan <- true
+	s.closeOnce.Do(func() {
+		s.DoneChan <- true
+		s.stopWatching()
+		s.settings.Close()
+	})
 	return nil
 }
 
@@ -183,9 +237,25 @@ func (s *Server) CacheCommonQueries() {
 	go s.vc.CacheCommonQueries(s.PageSize, s.DoneChan)
 }
 
+// WatchAlerts starts checking for new alerts and sending notifications about
+// them, if alert_notifications is configured. Close stops it.
+func (s *Server) WatchAlerts() {
+	if s.watcher == nil {
+		return
+	}
+	go s.watcher.Run(s.watchCtx)
+}
+
 type loginData struct {
 	baseData
 	URL string
+	// Who the user logs in with, e.g. "Google".
+	Provider string
+	// For the login form: the step the user is on, and what went wrong with
+	// their last attempt, if anything.
+	Step      string
+	Message   string
+	CSRFToken string
 }
 
 func (l *loginData) Title() string {
@@ -206,7 +276,7 @@ func newLoginServer() (*loginServer, error) {
 	}, nil
 }
 
-func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string) {
+func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string, provider string) {
 	if r.URL.Path != "/login" {
 		http.Redirect(w, r, "/login?g="+r.URL.Path, 302)
 		return
@@ -215,7 +285,36 @@ func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string)
 		LoggedOut: true,
 	}
 	bd.Data = &loginData{
-		URL: URL,
+		URL:      URL,
+		Provider: provider,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(401)
+	if err := render(w, r, ls.tpl, "base", bd); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+// ServeForm renders the login form, at the step in lerr.
+func (ls *loginServer) ServeForm(w http.ResponseWriter, r *http.Request, lerr *config.LoginError) {
+	if r.URL.Path != config.LoginPath && r.URL.Path != config.MFALoginPath {
+		http.Redirect(w, r, "/login?g="+r.URL.Path, 302)
+		return
+	}
+	// The form posts back to this URL, so we can send the user to the page
+	// in the "g" parameter once they log in.
+	action := config.LoginPath
+	if g := r.URL.Query().Get("g"); g != "" {
+		action += "?" + url.Values{"g": []string{g}}.Encode()
+	}
+	bd := &baseData{
+		LoggedOut: true,
+	}
+	bd.Data = &loginData{
+		URL:       action,
+		Step:      lerr.Step,
+		Message:   lerr.Message,
+		CSRFToken: getCSRFToken(r),
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(401)
@@ -225,25 +324,42 @@ func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string)
 }
 
 // AddAuthenticator adds the Authenticator as a HTTP middleware. If
-// authentication is successful, we set the User in the request context and
-// continue.
+// authentication is successful, and the user's group allows access from the
+// request's IP address at the current time, we set the User in the request
+// context and continue.
 func AddAuthenticator(h http.Handler, ls *loginServer, a config.Authenticator) http.Handler {
-	// TODO
-	o, ok := a.(*config.GoogleAuthenticator)
+	o, ok := a.(config.OAuthAuthenticator)
+	provider := "Google"
+	if _, isSAML := a.(*config.SAMLAuthenticator); isSAML {
+		provider = "single sign-on"
+	}
+	ba, isBasic := a.(*config.BasicAuthAuthenticator)
+	loginForm := isBasic && ba.MFA != nil
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		u, err := a.Authenticate(w, r)
+		if lerr, ok := err.(*config.LoginError); ok {
+			ls.ServeForm(w, r, lerr)
+			return
+		}
 		if err == config.MustLogin {
 			var url string
 			if ok {
 				url = o.URL(w, r)
 			}
-			ls.Serve(w, r, url)
+			ls.Serve(w, r, url, provider)
 			return
 		}
 		if err != nil {
 			return
 		}
+		if err := u.CheckAccess(getClientIP(r), time.Now()); err != nil {
+			rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+			return
+		}
 		r = config.SetUser(r, u)
+		if loginForm {
+			r = withMFALink(r)
+		}
 		h.ServeHTTP(w, r)
 	})
 }
@@ -270,7 +386,36 @@ func NewServer(settings *config.Settings) (*Server, error) {
 		return nil, errors.New("Please configure a non-nil Logger")
 	}
 	permission := config.NewPermission(settings.MaxResourceAge)
-	vc := views.NewClient(settings.Logger, settings.Client, settings.SecretKey, permission)
+	permission.SetPseudonymKey(config.DerivePseudonymKey(settings.SecretKey))
+	permission.SetRedactionPatterns(settings.RedactionPatterns)
+	permission.SetMinResourceAge(settings.MinResourceAge)
+	main := &config.Account{
+		FriendlyName: "Main account",
+		Client:       settings.Client,
+	}
+	if settings.Client != nil {
+		main.Sid = settings.Client.AccountSid
+	}
+	accounts := append([]*config.Account{main}, settings.Accounts...)
+	if settings.TwilioRateLimit != nil {
+		limiter := views.NewLimiter(settings.TwilioRateLimit)
+		for _, acct := range accounts {
+			if acct.Client != nil {
+				limiter.Limit(acct.Client)
+			}
+		}
+	}
+	vc, err := views.NewAccountsClient(settings.Logger, accounts, settings.MediaClient, settings.SecretKey, permission)
+	if err != nil {
+		return nil, err
+	}
+	var watcher *notify.Watcher
+	if settings.AlertNotifications != nil {
+		watcher, err = newAlertWatcher(settings, accounts)
+		if err != nil {
+			return nil, err
+		}
+	}
 	mls, err := newMessageListServer(settings.Logger, vc, settings.LocationFinder,
 		settings.PageSize, settings.MaxResourceAge, settings.SecretKey)
 	if err != nil {
@@ -306,10 +451,45 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	ads, err := newAlertDashboardServer(settings.Logger, vc,
+		settings.LocationFinder, settings.MaxResourceAge)
+	if err != nil {
+		return nil, err
+	}
 	ais, err := newAlertInstanceServer(settings.Logger, vc, settings.LocationFinder)
 	if err != nil {
 		return nil, err
 	}
+	rls, err := newRoomListServer(settings.Logger, vc,
+		settings.LocationFinder, settings.PageSize, settings.MaxResourceAge,
+		settings.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	ris, err := newRoomInstanceServer(settings.Logger, vc, settings.LocationFinder)
+	if err != nil {
+		return nil, err
+	}
+	mls.MinResourceAge = settings.MinResourceAge
+	cls.MinResourceAge = settings.MinResourceAge
+	confs.MinResourceAge = settings.MinResourceAge
+	als.MinResourceAge = settings.MinResourceAge
+	ads.MinResourceAge = settings.MinResourceAge
+	rls.MinResourceAge = settings.MinResourceAge
+	apls, err := newApplicationListServer(settings.Logger, vc,
+		settings.LocationFinder, settings.PageSize, settings.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	apis, err := newApplicationInstanceServer(settings.Logger, vc, settings.LocationFinder)
+	if err != nil {
+		return nil, err
+	}
+	ocls, err := newOutgoingCallerIDListServer(settings.Logger, vc,
+		settings.LocationFinder, settings.PageSize, settings.SecretKey)
+	if err != nil {
+		return nil, err
+	}
 	ns, err := newNumberListServer(settings.Logger, vc, settings.LocationFinder,
 		settings.PageSize, settings.MaxResourceAge, settings.SecretKey)
 	if err != nil {
@@ -337,7 +517,23 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	image := &imageServer{
 		secretKey: settings.SecretKey,
 	}
-	proxy, err := newAudioReverseProxy()
+	// Media and recordings are downloaded through the same proxy as API
+	// requests, and audio comes from the same API host.
+	audioBase := twilio.BaseURL
+	if settings.Client != nil {
+		audioBase = settings.Client.Base
+	}
+	var mediaTransport http.RoundTripper
+	if settings.MediaClient != nil {
+		mediaTransport = settings.MediaClient.Transport
+		image.client = &http.Client{
+			Transport: mediaTransport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	proxy, err := newAudioReverseProxy(audioBase, mediaTransport)
 	if err != nil {
 		return nil, err
 	}
@@ -346,16 +542,42 @@ func NewServer(settings *config.Settings) (*Server, error) {
 		Proxy:     proxy,
 		secretKey: settings.SecretKey,
 	}
+	video := &videoServer{
+		Client:    vc,
+		secretKey: settings.SecretKey,
+		client:    settings.MediaClient,
+	}
 	staticServer := &static{
 		modTime: time.Now().UTC(),
 	}
 	logout := &logoutServer{
 		Authenticator: settings.Authenticator,
 	}
+	sessions, err := newSessionsServer(settings.Logger, settings.LocationFinder, settings.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	me, err := newMeServer(settings.Logger, vc, settings.LocationFinder, settings.MaxResourceAge)
+	if err != nil {
+		return nil, err
+	}
+	me.MinResourceAge = settings.MinResourceAge
+	elevations := config.NewElevationStore()
+	breakGlass, err := newBreakGlassServer(settings.Logger, settings.Reporter, settings.LocationFinder, elevations)
+	if err != nil {
+		return nil, err
+	}
 	ls, err := newLoginServer()
 	if err != nil {
 		return nil, err
 	}
+	var mfa *mfaServer
+	if ba, ok := settings.Authenticator.(*config.BasicAuthAuthenticator); ok && ba.MFA != nil {
+		mfa, err = newMFAServer(settings.Logger, ba, settings.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+	}
 	tz := &tzServer{
 		Logger:                  settings.Logger,
 		AllowUnencryptedTraffic: settings.AllowUnencryptedTraffic,
@@ -372,32 +594,67 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	authR.Handle(regexp.MustCompile(`^/$`), []string{"GET"}, index)
 	authR.Handle(imageRoute, []string{"GET"}, image)
 	authR.Handle(audioRoute, []string{"GET"}, audio)
+	authR.Handle(videoRoute, []string{"GET"}, video)
 	authR.Handle(regexp.MustCompile(`^/search$`), []string{"GET"}, ss)
 	authR.Handle(regexp.MustCompile(`^/calls$`), []string{"GET"}, cls)
 	authR.Handle(regexp.MustCompile(`^/conferences$`), []string{"GET"}, confs)
 	authR.Handle(regexp.MustCompile(`^/phone-numbers$`), []string{"GET"}, ns)
 	authR.Handle(regexp.MustCompile(`^/messages$`), []string{"GET"}, mls)
 	authR.Handle(regexp.MustCompile(`^/alerts$`), []string{"GET"}, als)
+	authR.Handle(regexp.MustCompile(`^/alerts/dashboard$`), []string{"GET"}, ads)
+	authR.Handle(regexp.MustCompile(`^/rooms$`), []string{"GET"}, rls)
+	authR.Handle(regexp.MustCompile(`^/applications$`), []string{"GET"}, apls)
+	authR.Handle(regexp.MustCompile(`^/outgoing-caller-ids$`), []string{"GET"}, ocls)
 	authR.Handle(regexp.MustCompile(`^/tz$`), []string{"POST"}, tz)
+	authR.Handle(regexp.MustCompile(`^/sessions$`), []string{"GET", "POST"}, sessions)
+	authR.Handle(regexp.MustCompile(`^/me$`), []string{"GET"}, me)
+	authR.Handle(regexp.MustCompile(`^/break-glass$`), []string{"GET", "POST"}, breakGlass)
+	if mfa != nil {
+		authR.Handle(regexp.MustCompile(`^/mfa$`), []string{"GET", "POST"}, mfa)
+	}
 	authR.Handle(alertInstanceRoute, []string{"GET"}, ais)
 	authR.Handle(numberInstanceRoute, []string{"GET"}, nis)
 	authR.Handle(conferenceInstanceRoute, []string{"GET"}, confInstance)
+	authR.Handle(roomInstanceRoute, []string{"GET"}, ris)
+	authR.Handle(applicationInstanceRoute, []string{"GET"}, apis)
 	authR.Handle(callInstanceRoute, []string{"GET"}, cis)
 	authR.Handle(messageInstanceRoute, []string{"GET"}, mis)
-	authH := AddAuthenticator(authR, ls, settings.Authenticator)
+	tooMany := http.HandlerFunc(e.Serve429)
+	authH := withElevation(withAccounts(authR, accounts), settings.Logger, elevations)
+	authH = withUserRateLimit(authH, settings.Logger, settings.UserRateLimit, tooMany)
+	authH = AddAuthenticator(authH, ls, settings.Authenticator)
 	authH = handlers.WithLogger(authH, settings.Logger)
+	if settings.IPRateLimit != nil {
+		authH = withIPRateLimit(authH, settings.Logger, settings.IPRateLimit, tooMany)
+	}
 	if len(settings.IPSubnets) > 0 {
-		authH = whitelistIPs(authH, settings.Logger, settings.IPSubnets)
+		authH = whitelistIPs(authH, settings.Logger, settings.IPSubnets, settings.IPSubnetsFailClosed)
 	}
 
+	s := &Server{
+		PageSize: settings.PageSize,
+		vc:       vc,
+		DoneChan: make(chan bool, 1),
+		settings: settings,
+		watcher:  watcher,
+	}
+	s.watchCtx, s.stopWatching = context.WithCancel(views.Background(context.Background()))
+	readyz := &readyzServer{Logger: settings.Logger, Client: vc, Ready: s.Ready}
+
 	r := new(handlers.Regexp)
 	r.Handle(regexp.MustCompile(`(^/static|^/favicon.ico$)`), []string{"GET"}, handlers.GZip(staticServer))
+	r.Handle(regexp.MustCompile(`^/healthz$`), []string{"GET"}, &healthzServer{})
+	r.Handle(regexp.MustCompile(`^/readyz$`), []string{"GET"}, readyz)
+	r.Handle(regexp.MustCompile(`^/version$`), []string{"GET"}, &versionServer{})
 	r.Handle(regexp.MustCompile(`^/open-source$`), []string{"GET"}, openSource)
 	r.Handle(regexp.MustCompile(`^/opensearch.xml$`), []string{"GET"}, o)
 	r.Handle(regexp.MustCompile(`^/auth/logout$`), []string{"POST"}, logout)
 	// todo awkward using HTTP methods here
 	r.Handle(regexp.MustCompile(`^/`), []string{"GET", "POST", "PUT", "DELETE"}, authH)
-	h := UpgradeInsecureHandler(r, settings.AllowUnencryptedTraffic)
+	h := withDegraded(r)
+	h = withCSRF(h, settings.SecretKey, settings.AllowUnencryptedTraffic)
+	h = UpgradeInsecureHandler(h, settings.AllowUnencryptedTraffic)
+	h = withClientIP(h, newIPResolver(settings.TrustedProxies, settings.TrustedProxyHeader))
 
 	// Innermost handlers are first.
 	h = handlers.Server(h, "logrole/"+Version)
@@ -407,10 +664,6 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	h = handlers.WithTimeout(h, 32*time.Second)
 	h = settings.Reporter.ReportPanics(h)
 	h = handlers.Duration(h)
-	return &Server{
-		Handler:  h,
-		PageSize: settings.PageSize,
-		vc:       vc,
-		DoneChan: make(chan bool, 1),
-	}, nil
+	s.Handler = h
+	return s, nil
 }
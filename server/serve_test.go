@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -36,6 +37,64 @@ func TestRequestsUpgraded(t *testing.T) {
 	}
 }
 
+func TestHSTSOnlyOverHTTPS(t *testing.T) {
+	t.Parallel()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name  string
+		allow bool
+		tls   bool
+		proto string
+		hsts  bool
+	}{
+		{"direct TLS", false, true, "", true},
+		{"TLS ignores forwarded proto", false, true, "http", true},
+		{"proxy over HTTPS", false, false, "https", true},
+		{"proxy without header", false, false, "", true},
+		{"local HTTP", true, false, "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/foo", nil)
+		if tt.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if tt.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		w := httptest.NewRecorder()
+		UpgradeInsecureHandler(ok, tt.allow).ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("%s: expected Code to be 200, got %d", tt.name, w.Code)
+		}
+		if got := w.Header().Get("Strict-Transport-Security") != ""; got != tt.hsts {
+			t.Errorf("%s: expected HSTS header to be %t, got %t", tt.name, tt.hsts, got)
+		}
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		port, host, want string
+	}{
+		{"443", "example.com", "https://example.com/messages?page=2"},
+		{"443", "example.com:80", "https://example.com/messages?page=2"},
+		{"8443", "example.com:8080", "https://example.com:8443/messages?page=2"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/messages?page=2", nil)
+		req.Host = tt.host
+		w := httptest.NewRecorder()
+		RedirectToHTTPS(tt.port).ServeHTTP(w, req)
+		if w.Code != 301 {
+			t.Errorf("expected Code to be 301, got %d", w.Code)
+		}
+		if loc := w.Header().Get("Location"); loc != tt.want {
+			t.Errorf("expected redirect to %s, got %s", tt.want, loc)
+		}
+	}
+}
+
 func TestIndex(t *testing.T) {
 	t.Parallel()
 	settings := &config.Settings{
@@ -129,3 +188,44 @@ func TestStaticPagesAvailableNoAuth(t *testing.T) {
 		t.Errorf("expected Code to be 200, got %d", w.Code)
 	}
 }
+
+func TestGroupIPRestrictionShowsReason(t *testing.T) {
+	t.Parallel()
+	a := config.NewBasicAuthAuthenticator("logrole")
+	a.AddUserPassword("test", "test")
+	a.SetPolicy(&config.Policy{&config.Group{
+		Name:        "contractors",
+		Permissions: config.AllUserSettings(),
+		Users:       []string{"test"},
+		IPSubnets:   []string{"10.8.0.0/16"},
+	}})
+	settings := &config.Settings{
+		SecretKey:               nacl.NewKey(),
+		Authenticator:           a,
+		Logger:                  NullLogger,
+		AllowUnencryptedTraffic: true,
+	}
+	s, err := NewServer(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:12345/", nil)
+	req.RemoteAddr = "192.0.2.1:4567"
+	req.SetBasicAuth("test", "test")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Fatalf("expected Code to be 403, got %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Your IP address (192.0.2.1) is not on an approved network") {
+		t.Errorf("expected body to explain the denial, got %s", body)
+	}
+	req, _ = http.NewRequest("GET", "http://localhost:12345/", nil)
+	req.RemoteAddr = "10.8.0.1:4567"
+	req.SetBasicAuth("test", "test")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("expected Code to be 200, got %d", w.Code)
+	}
+}
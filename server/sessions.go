@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/rest"
+)
+
+var errCannotManageSessions = &rest.Error{
+	Title: "You don't have permission to manage sessions",
+	ID:    "forbidden",
+}
+
+// sessionsServer lists the login sessions in the session store, and lets
+// users with the can_manage_sessions permission revoke them.
+type sessionsServer struct {
+	log.Logger
+	LocationFinder services.LocationFinder
+	// nil if sessions aren't stored on the server.
+	Sessions config.SessionStore
+	tpl      *template.Template
+}
+
+func newSessionsServer(l log.Logger, lf services.LocationFinder, sessions config.SessionStore) (*sessionsServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+sessionListTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionsServer{
+		Logger:         l,
+		LocationFinder: lf,
+		Sessions:       sessions,
+		tpl:            tpl,
+	}, nil
+}
+
+// userSessions are the sessions belonging to one user.
+type userSessions struct {
+	UserID   string
+	Sessions []*config.Session
+}
+
+type sessionListData struct {
+	// False if sessions aren't stored on the server.
+	Enabled bool
+	Users   []*userSessions
+	Loc     *time.Location
+	// The revoke forms need the CSRF token.
+	CSRFToken string
+}
+
+func (d *sessionListData) Title() string {
+	return "Sessions"
+}
+
+func (s *sessionsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanManageSessions() {
+		rest.Forbidden(w, r, errCannotManageSessions)
+		return
+	}
+	if r.Method == "POST" {
+		s.revoke(w, r)
+		return
+	}
+	data := &sessionListData{
+		Enabled:   s.Sessions != nil,
+		Loc:       s.LocationFinder.GetLocationReq(r),
+		CSRFToken: getCSRFToken(r),
+	}
+	if s.Sessions != nil {
+		sessions, err := s.Sessions.List()
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+		// List sorts the sessions by user.
+		for _, sess := range sessions {
+			if len(data.Users) == 0 || data.Users[len(data.Users)-1].UserID != sess.UserID {
+				data.Users = append(data.Users, &userSessions{UserID: sess.UserID})
+			}
+			us := data.Users[len(data.Users)-1]
+			us.Sessions = append(us.Sessions, sess)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", &baseData{LF: s.LocationFinder, Data: data}); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+// revoke ends the session with the given id, or every session belonging to
+// the given user.
+func (s *sessionsServer) revoke(w http.ResponseWriter, r *http.Request) {
+	if s.Sessions == nil {
+		rest.BadRequest(w, r, &rest.Error{Title: "Sessions aren't stored on the server"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		rest.BadRequest(w, r, &rest.Error{Title: err.Error()})
+		return
+	}
+	id := r.PostForm.Get("id")
+	user := r.PostForm.Get("user")
+	if id == "" && user == "" {
+		rest.BadRequest(w, r, &rest.Error{Title: "Please provide a session id or user to revoke"})
+		return
+	}
+	sessions, err := s.Sessions.List()
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	for _, sess := range sessions {
+		if sess.ID != id && sess.UserID != user {
+			continue
+		}
+		if err := s.Sessions.Delete(sess.ID); err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+		s.Info("Revoked session", "user", sess.UserID, "created", sess.Created)
+	}
+	http.Redirect(w, r, accountPath(r, "/sessions"), http.StatusSeeOther)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/nacl"
+)
+
+func TestRevokeSessions(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.CanManageSessions = true
+	store := config.NewMemorySessionStore()
+	now := time.Now().UTC()
+	for _, sess := range []*config.Session{
+		{ID: "1", UserID: "alice@example.com", Created: now, LastSeen: now, Expires: now.Add(time.Hour)},
+		{ID: "2", UserID: "alice@example.com", Created: now, LastSeen: now, Expires: now.Add(time.Hour)},
+		{ID: "3", UserID: "bob@example.com", Created: now, LastSeen: now, Expires: now.Add(time.Hour)},
+	} {
+		store.Put(sess)
+	}
+	lf, _ := services.NewLocationFinder("UTC")
+	settings := &config.Settings{
+		AllowUnencryptedTraffic: true,
+		Authenticator:           &config.NoopAuthenticator{User: config.NewUser(us)},
+		LocationFinder:          lf,
+		SecretKey:               nacl.NewKey(),
+		Logger:                  NullLogger,
+		Sessions:                store,
+	}
+	s, err := NewServer(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:12345/sessions", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "alice@example.com") || !strings.Contains(body, "bob@example.com") {
+		t.Errorf("expected sessions page to list every user, got %s", body)
+	}
+	cookies := w.Result().Cookies()
+	match := csrfFieldRx.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatal("expected the revoke form to have a CSRF token")
+	}
+	form := url.Values{}
+	form.Set(csrfField, match[1])
+	form.Set("user", "alice@example.com")
+	req, _ = http.NewRequest("POST", "http://localhost:12345/sessions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected Code to be 303, got %d: %s", w.Code, w.Body.String())
+	}
+	sessions, _ := store.List()
+	if len(sessions) != 1 || sessions[0].UserID != "bob@example.com" {
+		t.Errorf("expected only bob's session to remain, got %v", sessions)
+	}
+}
+
+func TestSessionsRequiresPermission(t *testing.T) {
+	t.Parallel()
+	settings := &config.Settings{
+		AllowUnencryptedTraffic: true,
+		Authenticator:           &config.NoopAuthenticator{},
+		SecretKey:               nacl.NewKey(),
+		Logger:                  NullLogger,
+		Sessions:                config.NewMemorySessionStore(),
+	}
+	s, err := NewServer(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:12345/sessions", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
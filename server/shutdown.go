@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/kevinburke/logrole/services"
+)
+
+// Ready reports whether the server is accepting new requests. It returns
+// false once Drain has been called.
+func (s *Server) Ready() bool {
+	return atomic.LoadInt32(&s.draining) == 0
+}
+
+// Drain marks the server as not ready, so load balancers stop sending it new
+// requests. Requests are still served, but clients are asked to close their
+// connections afterwards, so they reconnect to another server.
+func (s *Server) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		w.Header().Set("Connection", "close")
+	}
+	s.Handler.ServeHTTP(w, r)
+}
+
+// Shutdown drains the server, stops its background goroutines and waits for
+// the error reporter to send any errors it has queued. Call it after the
+// http.Server has shut down. Shutdown returns ctx.Err() if ctx is done before
+// the reporter finishes.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Drain()
+	s.Close()
+	f, ok := s.settings.Reporter.(services.Flusher)
+	if !ok {
+		return nil
+	}
+	flushed := make(chan struct{})
+	go func() {
+		f.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
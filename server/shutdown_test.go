@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/nacl"
+)
+
+type blockingReporter struct {
+	services.NoopErrorReporter
+	flushed chan struct{}
+}
+
+func (b *blockingReporter) Flush() {
+	<-b.flushed
+}
+
+func newShutdownServer(t *testing.T, reporter services.ErrorReporter) *Server {
+	t.Helper()
+	lf, _ := services.NewLocationFinder("UTC")
+	s, err := NewServer(&config.Settings{
+		AllowUnencryptedTraffic: true,
+		LocationFinder:          lf,
+		SecretKey:               nacl.NewKey(),
+		Logger:                  NullLogger,
+		Reporter:                reporter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDrainClosesConnections(t *testing.T) {
+	t.Parallel()
+	s := newShutdownServer(t, nil)
+	if !s.Ready() {
+		t.Fatal("expected a new server to be ready")
+	}
+	req := httptest.NewRequest("GET", "/open-source", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Header().Get("Connection") != "" {
+		t.Errorf("expected no Connection header, got %q", w.Header().Get("Connection"))
+	}
+	s.Drain()
+	if s.Ready() {
+		t.Fatal("expected a draining server not to be ready")
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected draining server to serve requests, got %d", w.Code)
+	}
+	if w.Header().Get("Connection") != "close" {
+		t.Errorf("expected Connection: close, got %q", w.Header().Get("Connection"))
+	}
+}
+
+func TestShutdownFlushesReporter(t *testing.T) {
+	t.Parallel()
+	reporter := &blockingReporter{flushed: make(chan struct{})}
+	s := newShutdownServer(t, reporter)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected Shutdown to time out waiting for the reporter, got %v", err)
+	}
+	close(reporter.flushed)
+	// Close and Shutdown can be called more than once.
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
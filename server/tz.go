@@ -15,7 +15,6 @@ type tzServer struct {
 }
 
 func (t *tzServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// TODO csrf
 	if err := r.ParseForm(); err != nil {
 		t.Warn("Error parsing form on TZ page", "err", err)
 		http.Redirect(w, r, "/", 302)
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/kevinburke/handlers"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/views"
+	"github.com/kevinburke/rest"
+)
+
+// A videoServer provides an opaque proxy for video room recordings.
+type videoServer struct {
+	Client    views.Client
+	secretKey *[32]byte
+	// Used to make requests to Twilio. Must follow redirects; the Media
+	// resource redirects to a temporary URL for the recording.
+	client *http.Client
+}
+
+var videoRoute = regexp.MustCompile("^/video/(?P<encrypted>([-_a-zA-Z0-9=]+))$")
+
+// Headers from the browser that we pass along to Twilio, so the browser can
+// seek through the recording.
+var videoRequestHeaders = []string{"Range", "If-Range"}
+
+// Headers from the recording response that we pass along to the browser.
+var videoResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"}
+
+// GET /video/<encrypted URL>
+//
+// Decode the encrypted URL, then make a request to retrieve the recording and
+// forward it to the frontend.
+func (v *videoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanPlayVideoRecordings() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	encoded := videoRoute.FindStringSubmatch(r.URL.Path)[1]
+	mediaURL, wroteError := decryptURL(w, r, encoded, v.secretKey)
+	if wroteError {
+		return
+	}
+	req, err := http.NewRequest("GET", mediaURL.String(), nil)
+	if err != nil {
+		handlers.Logger.Warn("Could not create proxy request", "err", err)
+		rest.BadRequest(w, r, &rest.Error{
+			Title: "Could not create proxy request",
+		})
+		return
+	}
+	// Recordings can be large, so we don't set a timeout beyond the one on the
+	// incoming request. net/http drops the Authorization header if the Media
+	// resource redirects us to a different host.
+	req = req.WithContext(r.Context())
+	v.Client.SetBasicAuth(req)
+	for _, hdr := range videoRequestHeaders {
+		if val := r.Header.Get(hdr); val != "" {
+			req.Header.Set(hdr, val)
+		}
+	}
+	client := v.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+		break
+	case http.StatusNotFound:
+		rest.NotFound(w, r)
+		return
+	default:
+		rest.ServerError(w, r, errors.New("Unexpected status code fetching recording: "+resp.Status))
+		return
+	}
+	for _, hdr := range videoResponseHeaders {
+		if val := resp.Header.Get(hdr); val != "" {
+			w.Header().Set(hdr, val)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		handlers.Logger.Warn("Error copying video recording", "err", err)
+	}
+}
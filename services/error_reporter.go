@@ -21,6 +21,12 @@ type ErrorReporter interface {
 	ReportPanics(http.Handler) http.Handler
 }
 
+// A Flusher is an ErrorReporter that sends errors in the background. Flush
+// blocks until every error reported so far has been sent.
+type Flusher interface {
+	Flush()
+}
+
 var reporters = map[string]ErrorReporter{}
 var reporterMu sync.Mutex
 
@@ -77,6 +83,10 @@ func (s *SentryErrorReporter) ReportError(err error, block bool) {
 	}
 }
 
+func (s *SentryErrorReporter) Flush() {
+	raven.Wait()
+}
+
 func (s *SentryErrorReporter) ReportPanics(h http.Handler) http.Handler {
 	// yuck, https://github.com/getsentry/raven-go/issues/78
 	return http.HandlerFunc(raven.RecoveryHandler(h.ServeHTTP))
@@ -33,6 +33,8 @@ func ViewsClient(harness ViewHarness) views.Client {
 	}
 	if harness.TestServer != nil {
 		c.Base = harness.TestServer.URL
+		c.Video.Base = harness.TestServer.URL
+		c.Monitor.Base = harness.TestServer.URL
 	}
 	if harness.SecretKey == nil {
 		harness.SecretKey = nacl.NewKey()
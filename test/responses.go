@@ -1328,3 +1328,99 @@ var CallListBody = []byte(`
     "uri": "/2010-04-01/Accounts/AC58f1e8f2b1c6b88ca90a012a4be0c279/Calls.json?StartTime%3E=2016-10-27&StartTime%3C=2016-10-28&PageSize=2&Page=0"
 }
 `)
+
+var RoomListBody = []byte(`
+{
+    "meta": {
+        "first_page_url": "https://video.twilio.com/v1/Rooms?PageSize=1&Page=0",
+        "key": "rooms",
+        "next_page_url": null,
+        "page": 0,
+        "page_size": 1,
+        "previous_page_url": null,
+        "url": "https://video.twilio.com/v1/Rooms?PageSize=1&Page=0"
+    },
+    "rooms": [
+        {
+            "account_sid": "AC58f1e8f2b1c6b88ca90a012a4be0c279",
+            "date_created": "2017-04-03T22:21:49Z",
+            "date_updated": "2017-04-03T22:21:51Z",
+            "duration": 2,
+            "enable_turn": true,
+            "end_time": "2017-04-03T22:21:51Z",
+            "links": {
+                "participants": "https://video.twilio.com/v1/Rooms/RM4070b618362c1682b2385b1f9982833c/Participants",
+                "recordings": "https://video.twilio.com/v1/Rooms/RM4070b618362c1682b2385b1f9982833c/Recordings"
+            },
+            "max_participants": 10,
+            "media_region": "us1",
+            "record_participants_on_connect": false,
+            "sid": "RM4070b618362c1682b2385b1f9982833c",
+            "status": "completed",
+            "status_callback": null,
+            "status_callback_method": "POST",
+            "type": "group",
+            "unique_name": "DailyStandup",
+            "url": "https://video.twilio.com/v1/Rooms/RM4070b618362c1682b2385b1f9982833c"
+        }
+    ]
+}
+`)
+
+var RoomInstanceBody = []byte(`
+{
+    "account_sid": "AC58f1e8f2b1c6b88ca90a012a4be0c279",
+    "date_created": "2017-04-03T22:21:49Z",
+    "date_updated": "2017-04-03T22:21:51Z",
+    "duration": 2,
+    "enable_turn": true,
+    "end_time": "2017-04-03T22:21:51Z",
+    "links": {
+        "participants": "https://video.twilio.com/v1/Rooms/RM4070b618362c1682b2385b1f9982833c/Participants",
+        "recordings": "https://video.twilio.com/v1/Rooms/RM4070b618362c1682b2385b1f9982833c/Recordings"
+    },
+    "max_participants": 10,
+    "media_region": "us1",
+    "record_participants_on_connect": false,
+    "sid": "RM4070b618362c1682b2385b1f9982833c",
+    "status": "completed",
+    "status_callback": null,
+    "status_callback_method": "POST",
+    "type": "group",
+    "unique_name": "DailyStandup",
+    "url": "https://video.twilio.com/v1/Rooms/RM4070b618362c1682b2385b1f9982833c"
+}
+`)
+
+var OutgoingCallerIDListBody = []byte(`
+{
+    "end": 1,
+    "first_page_uri": "/2010-04-01/Accounts/AC58f1e8f2b1c6b88ca90a012a4be0c279/OutgoingCallerIds.json?PageSize=50&Page=0",
+    "next_page_uri": null,
+    "outgoing_caller_ids": [
+        {
+            "account_sid": "AC58f1e8f2b1c6b88ca90a012a4be0c279",
+            "date_created": "Tue, 27 Sep 2016 17:45:33 +0000",
+            "date_updated": "Tue, 27 Sep 2016 17:45:33 +0000",
+            "friendly_name": "Front desk",
+            "phone_number": "+14105551234",
+            "sid": "PNca86cf94c7d4f89e0bd45bfa7d9b9e7d",
+            "uri": "/2010-04-01/Accounts/AC58f1e8f2b1c6b88ca90a012a4be0c279/OutgoingCallerIds/PNca86cf94c7d4f89e0bd45bfa7d9b9e7d.json"
+        },
+        {
+            "account_sid": "AC58f1e8f2b1c6b88ca90a012a4be0c279",
+            "date_created": "Wed, 28 Sep 2016 09:12:04 +0000",
+            "date_updated": "Wed, 28 Sep 2016 09:12:04 +0000",
+            "friendly_name": "Warehouse",
+            "phone_number": "+19253920364",
+            "sid": "PN2a0747eba6abf96b7e3c3ff0b4530f6e",
+            "uri": "/2010-04-01/Accounts/AC58f1e8f2b1c6b88ca90a012a4be0c279/OutgoingCallerIds/PN2a0747eba6abf96b7e3c3ff0b4530f6e.json"
+        }
+    ],
+    "page": 0,
+    "page_size": 50,
+    "previous_page_uri": null,
+    "start": 0,
+    "uri": "/2010-04-01/Accounts/AC58f1e8f2b1c6b88ca90a012a4be0c279/OutgoingCallerIds.json?PageSize=50&Page=0"
+}
+`)
@@ -0,0 +1,235 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// accountsClient serves each request from the Client for the Twilio account
+// stored in the request's context.
+type accountsClient struct {
+	clients map[string]*client
+	// Used for requests that don't specify an account.
+	main *client
+	all  []*client
+}
+
+// NewAccountsClient creates a Client that can retrieve resources from several
+// Twilio accounts. Call config.WithAccount to choose the account for a given
+// request; requests without an account use the first account in the list.
+// All of the accounts share a single cache.
+//
+// Message media URLs are looked up with mediaClient, or a client with the
+// default timeout if it's nil.
+//
+// Callers should check that the user can view an account before setting it
+// on the context; the returned Client only checks a user's permissions for
+// individual resources.
+func NewAccountsClient(l log.Logger, accounts []*config.Account, mediaClient *http.Client, secretKey *[32]byte, p *config.Permission) (Client, error) {
+	if len(accounts) == 0 {
+		return nil, errors.New("views: please provide at least one account")
+	}
+	ch := newCache(l)
+	ac := &accountsClient{
+		clients: make(map[string]*client, len(accounts)),
+		all:     make([]*client, len(accounts)),
+	}
+	for i, acct := range accounts {
+		c := newClient(l.New("account", acct.Sid), acct.Client, mediaClient, ch, secretKey, p)
+		ac.clients[acct.Sid] = c
+		ac.all[i] = c
+	}
+	ac.main = ac.all[0]
+	return ac, nil
+}
+
+func (ac *accountsClient) get(ctx context.Context) *client {
+	acct, ok := config.GetAccount(ctx)
+	if !ok {
+		return ac.main
+	}
+	if c, ok := ac.clients[acct.Sid]; ok {
+		return c
+	}
+	return ac.main
+}
+
+func (ac *accountsClient) SetBasicAuth(r *http.Request) {
+	ac.get(r.Context()).SetBasicAuth(r)
+}
+
+func (ac *accountsClient) GetMessage(ctx context.Context, u *config.User, sid string) (*Message, error) {
+	return ac.get(ctx).GetMessage(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetCall(ctx context.Context, u *config.User, sid string) (*Call, error) {
+	return ac.get(ctx).GetCall(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetConference(ctx context.Context, u *config.User, sid string) (*Conference, error) {
+	return ac.get(ctx).GetConference(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetRoom(ctx context.Context, u *config.User, sid string) (*Room, error) {
+	return ac.get(ctx).GetRoom(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetIncomingNumber(ctx context.Context, u *config.User, sid string) (*IncomingNumber, error) {
+	return ac.get(ctx).GetIncomingNumber(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetIncomingNumberByPN(ctx context.Context, u *config.User, pn string) (*IncomingNumber, error) {
+	return ac.get(ctx).GetIncomingNumberByPN(ctx, u, pn)
+}
+
+func (ac *accountsClient) GetApplication(ctx context.Context, u *config.User, sid string) (*Application, error) {
+	return ac.get(ctx).GetApplication(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetApplicationNumbers(ctx context.Context, u *config.User, sid string) ([]*IncomingNumber, error) {
+	return ac.get(ctx).GetApplicationNumbers(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetAlert(ctx context.Context, u *config.User, sid string) (*Alert, error) {
+	return ac.get(ctx).GetAlert(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetMediaURLs(ctx context.Context, u *config.User, sid string) ([]*url.URL, error) {
+	return ac.get(ctx).GetMediaURLs(ctx, u, sid)
+}
+
+func (ac *accountsClient) GetMessagePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*MessagePage, uint64, error) {
+	return ac.get(ctx).GetMessagePageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountsClient) GetCallPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*CallPage, uint64, error) {
+	return ac.get(ctx).GetCallPageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountsClient) GetNumberPage(ctx context.Context, u *config.User, data url.Values) (*IncomingNumberPage, uint64, error) {
+	return ac.get(ctx).GetNumberPage(ctx, u, data)
+}
+
+func (ac *accountsClient) GetApplicationPage(ctx context.Context, u *config.User, data url.Values) (*ApplicationPage, uint64, error) {
+	return ac.get(ctx).GetApplicationPage(ctx, u, data)
+}
+
+func (ac *accountsClient) GetOutgoingCallerIDPage(ctx context.Context, u *config.User, data url.Values) (*OutgoingCallerIDPage, uint64, error) {
+	return ac.get(ctx).GetOutgoingCallerIDPage(ctx, u, data)
+}
+
+func (ac *accountsClient) GetConferencePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*ConferencePage, uint64, error) {
+	return ac.get(ctx).GetConferencePageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountsClient) GetAlertPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*AlertPage, uint64, error) {
+	return ac.get(ctx).GetAlertPageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountsClient) GetRoomPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*RoomPage, uint64, error) {
+	return ac.get(ctx).GetRoomPageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountsClient) GetNextMessagePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*MessagePage, uint64, error) {
+	return ac.get(ctx).GetNextMessagePageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountsClient) GetNextNumberPage(ctx context.Context, u *config.User, nextPage string) (*IncomingNumberPage, uint64, error) {
+	return ac.get(ctx).GetNextNumberPage(ctx, u, nextPage)
+}
+
+func (ac *accountsClient) GetNextApplicationPage(ctx context.Context, u *config.User, nextPage string) (*ApplicationPage, uint64, error) {
+	return ac.get(ctx).GetNextApplicationPage(ctx, u, nextPage)
+}
+
+func (ac *accountsClient) GetNextOutgoingCallerIDPage(ctx context.Context, u *config.User, nextPage string) (*OutgoingCallerIDPage, uint64, error) {
+	return ac.get(ctx).GetNextOutgoingCallerIDPage(ctx, u, nextPage)
+}
+
+func (ac *accountsClient) GetNextCallPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*CallPage, uint64, error) {
+	return ac.get(ctx).GetNextCallPageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountsClient) GetNextConferencePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*ConferencePage, uint64, error) {
+	return ac.get(ctx).GetNextConferencePageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountsClient) GetNextAlertPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*AlertPage, uint64, error) {
+	return ac.get(ctx).GetNextAlertPageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountsClient) GetNextRoomPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*RoomPage, uint64, error) {
+	return ac.get(ctx).GetNextRoomPageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountsClient) GetNextRecordingPage(ctx context.Context, u *config.User, nextPage string) (*RecordingPage, error) {
+	return ac.get(ctx).GetNextRecordingPage(ctx, u, nextPage)
+}
+
+func (ac *accountsClient) GetCallRecordings(ctx context.Context, u *config.User, callSid string, data url.Values) (*RecordingPage, error) {
+	return ac.get(ctx).GetCallRecordings(ctx, u, callSid, data)
+}
+
+func (ac *accountsClient) GetCallAlerts(ctx context.Context, u *config.User, callSid string) (*AlertPage, error) {
+	return ac.get(ctx).GetCallAlerts(ctx, u, callSid)
+}
+
+func (ac *accountsClient) GetRoomParticipants(ctx context.Context, u *config.User, roomSid string) (*RoomParticipants, error) {
+	return ac.get(ctx).GetRoomParticipants(ctx, u, roomSid)
+}
+
+func (ac *accountsClient) GetRoomRecordings(ctx context.Context, u *config.User, roomSid string) (*VideoRecordingPage, error) {
+	return ac.get(ctx).GetRoomRecordings(ctx, u, roomSid)
+}
+
+func (ac *accountsClient) Explain(ctx context.Context, u *config.User, sid string) (*Explanation, error) {
+	return ac.get(ctx).Explain(ctx, u, sid)
+}
+
+// CacheCommonQueries caches the most common queries for every account until
+// a value is sent on doneCh.
+func (ac *accountsClient) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
+	chans := make([]chan bool, len(ac.all))
+	for i, c := range ac.all {
+		chans[i] = make(chan bool, 1)
+		go c.CacheCommonQueries(pageSize, chans[i])
+	}
+	<-doneCh
+	for _, ch := range chans {
+		ch <- true
+	}
+}
+
+// CommonQueriesCached reports whether the first run of CacheCommonQueries has
+// finished for every account.
+func (ac *accountsClient) CommonQueriesCached() bool {
+	for _, c := range ac.all {
+		if !c.CommonQueriesCached() {
+			return false
+		}
+	}
+	return true
+}
+
+// Ping checks that Twilio can be reached with the main account's
+// credentials.
+func (ac *accountsClient) Ping(ctx context.Context) error {
+	return ac.main.Ping(ctx)
+}
+
+// IsTwilioNumber reports whether num belongs to any of the accounts.
+func (ac *accountsClient) IsTwilioNumber(num twilio.PhoneNumber) bool {
+	for _, c := range ac.all {
+		if c.IsTwilioNumber(num) {
+			return true
+		}
+	}
+	return false
+}
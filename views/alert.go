@@ -2,6 +2,7 @@ package views
 
 import (
 	"errors"
+	"net/url"
 	"strings"
 
 	types "github.com/kevinburke/go-types"
@@ -16,8 +17,9 @@ type AlertPage struct {
 }
 
 type Alert struct {
-	user  *config.User
-	alert *twilio.Alert
+	user       *config.User
+	permission *config.Permission
+	alert      *twilio.Alert
 }
 
 func NewAlert(alert *twilio.Alert, p *config.Permission, u *config.User) (*Alert, error) {
@@ -30,7 +32,25 @@ func NewAlert(alert *twilio.Alert, p *config.Permission, u *config.User) (*Alert
 	if !u.CanViewResource(alert.DateCreated.Time, p.MaxResourceAge()) {
 		return nil, config.ErrTooOld
 	}
-	return &Alert{user: u, alert: alert}, nil
+	if u.IsTooNew(alert.DateCreated.Time, p.MinResourceAge()) {
+		return nil, config.ErrTooNew
+	}
+	if !alertInScope(alert, u) {
+		return nil, config.ErrOutOfScope
+	}
+	return &Alert{user: u, permission: p, alert: alert}, nil
+}
+
+// alertInScope returns true if u has no Scope, or the request that caused
+// the alert was about a message or call in u's Scope. Alerts that don't say
+// which numbers were involved are out of scope, since they could be about
+// anything in the account.
+func alertInScope(alert *twilio.Alert, u *config.User) bool {
+	if !u.IsScoped() {
+		return true
+	}
+	vars := alert.RequestVariables
+	return u.InScope(vars.Get("MessagingServiceSid"), vars.Get("From"), vars.Get("To"))
 }
 
 func NewAlertPage(ap *twilio.AlertPage, p *config.Permission, u *config.User) (*AlertPage, error) {
@@ -40,7 +60,7 @@ func NewAlertPage(ap *twilio.AlertPage, p *config.Permission, u *config.User) (*
 	alerts := make([]*Alert, 0)
 	for _, alert := range ap.Alerts {
 		cl, err := NewAlert(alert, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -63,6 +83,22 @@ func (a *AlertPage) Alerts() []*Alert {
 	return a.alerts
 }
 
+// WithErrorCode returns a copy of ap with only the alerts that have the given
+// error code. The copy has the same next and previous pages as ap.
+func (ap *AlertPage) WithErrorCode(code twilio.Code) *AlertPage {
+	alerts := make([]*Alert, 0, len(ap.alerts))
+	for _, alert := range ap.alerts {
+		if c, err := alert.ErrorCode(); err == nil && c == code {
+			alerts = append(alerts, alert)
+		}
+	}
+	return &AlertPage{
+		alerts:          alerts,
+		nextPageURI:     ap.nextPageURI,
+		previousPageURI: ap.previousPageURI,
+	}
+}
+
 func (ap *AlertPage) NextPageURI() types.NullString {
 	return ap.nextPageURI
 }
@@ -94,20 +130,28 @@ func (ap *AlertPage) ShowHeader(fieldName string) bool {
 	return false
 }
 
+var alertProperties = propertyPermissions{
+	"Sid":              {"can_view_alerts"},
+	"ErrorCode":        {"can_view_alerts"},
+	"MoreInfo":         {"can_view_alerts"},
+	"DateCreated":      {"can_view_alerts"},
+	"DateUpdated":      {"can_view_alerts"},
+	"ResourceSid":      {"can_view_alerts"},
+	"LogLevel":         {"can_view_alerts"},
+	"ServiceSid":       {"can_view_alerts"},
+	"RequestURL":       {"can_view_callback_urls"},
+	"RequestMethod":    {"can_view_callback_urls"},
+	"RequestVariables": {"can_view_callback_urls"},
+	"AlertText":        {"can_view_callback_urls"},
+	"ResponseHeaders":  {"can_view_callback_urls"},
+	"ResponseBody":     {"can_view_callback_urls"},
+}
+
 func (c *Alert) CanViewProperty(property string) bool {
 	if c.user == nil {
 		return false
 	}
-	switch property {
-	case "Sid", "ErrorCode", "MoreInfo", "DateCreated", "DateUpdated",
-		"ResourceSid", "LogLevel", "ServiceSid":
-		return c.user.CanViewAlerts()
-	case "RequestURL", "RequestMethod", "RequestVariables", "AlertText",
-		"ResponseHeaders", "ResponseBody":
-		return c.user.CanViewCallbackURLs()
-	default:
-		panic("unknown property " + property)
-	}
+	return alertProperties.canView(c.user, property)
 }
 
 func (a *Alert) CanViewDescription() bool {
@@ -201,12 +245,48 @@ func (a *Alert) RequestMethod() (string, error) {
 	}
 }
 
+// RequestVariables returns the parameters of the request that caused the
+// alert. Phone numbers are masked, and message bodies redacted, the same way
+// as on the message or call the request was about.
 func (a *Alert) RequestVariables() (twilio.Values, error) {
-	if a.CanViewProperty("RequestVariables") {
-		return a.alert.RequestVariables, nil
-	} else {
+	if !a.CanViewProperty("RequestVariables") {
 		return twilio.Values{}, config.PermissionDenied
 	}
+	fromMask, toMask := a.user.MessageFromMask(), a.user.MessageToMask()
+	if strings.HasPrefix(a.alert.ResourceSid, "CA") {
+		fromMask, toMask = a.user.CallFromMask(), a.user.CallToMask()
+	}
+	vals := make(url.Values, len(a.alert.RequestVariables.Values))
+	for k, v := range a.alert.RequestVariables.Values {
+		var mask config.Mask
+		switch k {
+		// Voice webhooks send the numbers as Caller and Called, too.
+		case "From", "Caller":
+			mask = fromMask
+		case "To", "Called":
+			mask = toMask
+		case "Body":
+			if a.user.RedactMessageBodies() {
+				vals[k] = make([]string, len(v))
+				for i := range v {
+					vals[k][i] = a.permission.Redact(v[i])
+				}
+				continue
+			}
+		}
+		if mask.Mode == config.MaskFull {
+			vals[k] = v
+			continue
+		}
+		if mask.Mode == config.MaskHide {
+			continue
+		}
+		vals[k] = make([]string, len(v))
+		for i := range v {
+			vals[k][i] = a.permission.Mask(mask, v[i])
+		}
+	}
+	return twilio.Values{Values: vals}, nil
 }
 
 func (a *Alert) ResponseHeaders() (twilio.Values, error) {
@@ -1,11 +1,14 @@
 package views
 
 import (
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	twilio "github.com/kevinburke/twilio-go"
 	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/nacl"
 )
 
 func TestViewResourceSid(t *testing.T) {
@@ -34,3 +37,159 @@ func TestViewResourceSid(t *testing.T) {
 		t.Errorf("wrong Sid")
 	}
 }
+
+func TestAlertOutOfScope(t *testing.T) {
+	t.Parallel()
+	u := scopedUser(t, &config.Scope{PhoneNumbers: []string{"+14105551234"}})
+	p := config.NewPermission(time.Hour)
+	now := twilio.TwilioTime{Valid: true, Time: time.Now()}
+	vars := func(s string) twilio.Values {
+		v, err := url.ParseQuery(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return twilio.Values{Values: v}
+	}
+	visible := &twilio.Alert{Sid: "NO1", ResourceSid: "SM1", DateCreated: now,
+		RequestVariables: vars("From=%2B19253920364&To=%2B14105551234&Body=hi")}
+	hidden := &twilio.Alert{Sid: "NO2", ResourceSid: "SM2", DateCreated: now,
+		RequestVariables: vars("From=%2B19253920364&To=%2B19253920365&Body=hi")}
+	unknown := &twilio.Alert{Sid: "NO3", ResourceSid: "PN123", DateCreated: now}
+	for _, alert := range []*twilio.Alert{hidden, unknown} {
+		if _, err := NewAlert(alert, p, u); err != config.ErrOutOfScope {
+			t.Errorf("%s: expected ErrOutOfScope, got %v", alert.Sid, err)
+		}
+	}
+	ap, err := NewAlertPage(&twilio.AlertPage{
+		Alerts: []*twilio.Alert{visible, hidden, unknown},
+	}, p, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := ap.Alerts()
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts))
+	}
+	if sid, _ := alerts[0].Sid(); sid != "NO1" {
+		t.Errorf("expected the visible alert to be NO1, got %s", sid)
+	}
+}
+
+func TestConferenceHiddenFromScopedUsers(t *testing.T) {
+	t.Parallel()
+	u := scopedUser(t, &config.Scope{PhoneNumbers: []string{"+14105551234"}})
+	conference := &twilio.Conference{Sid: "CF123", DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()}}
+	if _, err := NewConference(conference, config.NewPermission(time.Hour), u); err != config.ErrOutOfScope {
+		t.Errorf("expected ErrOutOfScope, got %v", err)
+	}
+}
+
+func TestRoomHiddenFromScopedUsers(t *testing.T) {
+	t.Parallel()
+	u := scopedUser(t, &config.Scope{PhoneNumbers: []string{"+14105551234"}})
+	p := config.NewPermission(time.Hour)
+	created := twilio.TwilioTime{Valid: true, Time: time.Now()}
+	if _, err := NewRoom(&twilio.Room{Sid: "RM123", DateCreated: created}, p, u); err != config.ErrOutOfScope {
+		t.Errorf("room: expected ErrOutOfScope, got %v", err)
+	}
+	if _, err := NewVideoRecording(&twilio.VideoRecording{Sid: "RT123", DateCreated: created}, p, u, nacl.NewKey()); err != config.ErrOutOfScope {
+		t.Errorf("recording: expected ErrOutOfScope, got %v", err)
+	}
+}
+
+func TestOutgoingCallerIDOutOfScope(t *testing.T) {
+	t.Parallel()
+	u := scopedUser(t, &config.Scope{PhoneNumbers: []string{"+14105551234"}})
+	p := config.NewPermission(time.Hour)
+	created := twilio.TwilioTime{Valid: true, Time: time.Now()}
+	if _, err := NewOutgoingCallerID(&twilio.OutgoingCallerID{Sid: "PN1", PhoneNumber: "+14105551234", DateCreated: created}, p, u); err != nil {
+		t.Errorf("expected the scoped caller ID to be visible, got %v", err)
+	}
+	if _, err := NewOutgoingCallerID(&twilio.OutgoingCallerID{Sid: "PN2", PhoneNumber: "+19253920364", DateCreated: created}, p, u); err != config.ErrOutOfScope {
+		t.Errorf("expected ErrOutOfScope, got %v", err)
+	}
+}
+
+func TestOutgoingCallerIDPhoneNumberPermission(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.CanViewCallFrom = false
+	u := config.NewUser(us)
+	callerID := &twilio.OutgoingCallerID{Sid: "PN1", PhoneNumber: "+14105551234", DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()}}
+	o, err := NewOutgoingCallerID(callerID, config.NewPermission(time.Hour), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.CanViewProperty("FriendlyName") {
+		t.Error("expected to be able to view the friendly name")
+	}
+	if o.CanViewProperty("PhoneNumber") {
+		t.Error("expected the phone number to need can_view_call_from")
+	}
+	if _, err := o.PhoneNumber(); err != config.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+	if o.CanViewProperty("Unknown") {
+		t.Error("expected an unknown property to be hidden")
+	}
+}
+
+func TestAlertRequestVariablesMasked(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.MessageFromMask = config.Mask{Mode: config.MaskLastDigits, Digits: 2}
+	us.MessageToMask = config.Mask{Mode: config.MaskHide}
+	us.CallFromMask = config.Mask{Mode: config.MaskPseudonym}
+	us.RedactMessageBodies = true
+	u := config.NewUser(us)
+	p := config.NewPermission(time.Hour)
+	v, err := url.ParseQuery("From=%2B14105551234&To=%2B19253920364&Body=Your+code+is+482913&SmsStatus=received")
+	if err != nil {
+		t.Fatal(err)
+	}
+	talert := &twilio.Alert{Sid: "NO1", ResourceSid: "SM123", DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+		RequestVariables: twilio.Values{Values: v}}
+	alert, err := NewAlert(talert, p, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, err := alert.RequestVariables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from := vars.Get("From"); from != "••••••••••34" {
+		t.Errorf("expected masked From, got %q", from)
+	}
+	if _, ok := vars.Values["To"]; ok {
+		t.Errorf("expected hidden To to be removed, got %q", vars.Get("To"))
+	}
+	if body := vars.Get("Body"); body != "Your code is [redacted]" {
+		t.Errorf("expected redacted Body, got %q", body)
+	}
+	if status := vars.Get("SmsStatus"); status != "received" {
+		t.Errorf("expected other variables to be unchanged, got %q", status)
+	}
+	if talert.RequestVariables.Get("From") != "+14105551234" {
+		t.Error("expected the underlying alert not to be modified")
+	}
+
+	v, err = url.ParseQuery("From=%2B14105551234&Caller=%2B14105551234&To=%2B19253920364")
+	if err != nil {
+		t.Fatal(err)
+	}
+	talert = &twilio.Alert{Sid: "NO2", ResourceSid: "CA123", DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+		RequestVariables: twilio.Values{Values: v}}
+	alert, err = NewAlert(talert, p, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ = alert.RequestVariables()
+	for _, k := range []string{"From", "Caller"} {
+		if !strings.HasPrefix(vars.Get(k), "anon-") {
+			t.Errorf("expected a pseudonym for the call's %s, got %q", k, vars.Get(k))
+		}
+	}
+	if to := vars.Get("To"); to != "+19253920364" {
+		t.Errorf("expected the call's To to be shown in full, got %q", to)
+	}
+}
@@ -0,0 +1,227 @@
+package views
+
+import (
+	"errors"
+
+	types "github.com/kevinburke/go-types"
+	twilio "github.com/kevinburke/twilio-go"
+	"github.com/kevinburke/logrole/config"
+)
+
+type ApplicationPage struct {
+	applications    []*Application
+	nextPageURI     types.NullString
+	previousPageURI types.NullString
+}
+
+func (p *ApplicationPage) Applications() []*Application {
+	return p.applications
+}
+
+func (p *ApplicationPage) NextPageURI() types.NullString {
+	return p.nextPageURI
+}
+
+func (p *ApplicationPage) PreviousPageURI() types.NullString {
+	return p.previousPageURI
+}
+
+func (p *ApplicationPage) ShowHeader(property string) bool {
+	if p == nil {
+		return showAllColumnsOnEmptyPage
+	}
+	applications := p.Applications()
+	if len(applications) == 0 {
+		return showAllColumnsOnEmptyPage
+	}
+	for _, application := range applications {
+		if application.CanViewProperty(property) {
+			return true
+		}
+	}
+	return false
+}
+
+// An Application is a TwiML application - a set of URL's that phone numbers
+// can point to instead of configuring each URL on the number.
+type Application struct {
+	user        *config.User
+	application *twilio.Application
+}
+
+func NewApplication(a *twilio.Application, p *config.Permission, u *config.User) (*Application, error) {
+	if a.DateCreated.Valid == false {
+		return nil, errors.New("Invalid DateCreated for application")
+	}
+	// NB: Like phone numbers, applications are *exempt* from max resource age
+	// rules, since they are configuration and not a record of activity.
+	return &Application{user: u, application: a}, nil
+}
+
+func NewApplicationPage(ap *twilio.ApplicationPage, p *config.Permission, u *config.User) (*ApplicationPage, error) {
+	applications := make([]*Application, 0)
+	for _, tapplication := range ap.Applications {
+		application, err := NewApplication(tapplication, p, u)
+		if err == config.ErrTooOld || err == config.PermissionDenied {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+	var npuri types.NullString
+	if len(applications) > 0 {
+		npuri = ap.NextPageURI
+	}
+	return &ApplicationPage{
+		applications:    applications,
+		nextPageURI:     npuri,
+		previousPageURI: ap.PreviousPageURI,
+	}, nil
+}
+
+var applicationProperties = propertyPermissions{
+	"Sid":                   nil,
+	"DateCreated":           nil,
+	"DateUpdated":           nil,
+	"FriendlyName":          nil,
+	"VoiceCallerIDLookup":   nil,
+	"VoiceURL":              {"can_view_callback_urls"},
+	"VoiceMethod":           {"can_view_callback_urls"},
+	"VoiceFallbackURL":      {"can_view_callback_urls"},
+	"VoiceFallbackMethod":   {"can_view_callback_urls"},
+	"SMSURL":                {"can_view_callback_urls"},
+	"SMSFallbackURL":        {"can_view_callback_urls"},
+	"SMSFallbackMethod":     {"can_view_callback_urls"},
+	"StatusCallback":        {"can_view_callback_urls"},
+	"StatusCallbackMethod":  {"can_view_callback_urls"},
+	"MessageStatusCallback": {"can_view_callback_urls"},
+}
+
+func (a *Application) CanViewProperty(property string) bool {
+	if a.application == nil {
+		return false
+	}
+	return applicationProperties.canView(a.user, property)
+}
+
+func (a *Application) Sid() (string, error) {
+	if a.CanViewProperty("Sid") {
+		return a.application.Sid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) FriendlyName() (string, error) {
+	if a.CanViewProperty("FriendlyName") {
+		return a.application.FriendlyName, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) DateCreated() (twilio.TwilioTime, error) {
+	if a.CanViewProperty("DateCreated") {
+		return a.application.DateCreated, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
+
+func (a *Application) DateUpdated() (twilio.TwilioTime, error) {
+	if a.CanViewProperty("DateUpdated") {
+		return a.application.DateUpdated, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
+
+func (a *Application) VoiceCallerIDLookup() (bool, error) {
+	if a.CanViewProperty("VoiceCallerIDLookup") {
+		return a.application.VoiceCallerIDLookup, nil
+	} else {
+		return false, config.PermissionDenied
+	}
+}
+
+func (a *Application) VoiceURL() (string, error) {
+	if a.CanViewProperty("VoiceURL") {
+		return a.application.VoiceURL, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) VoiceMethod() (string, error) {
+	if a.CanViewProperty("VoiceMethod") {
+		return a.application.VoiceMethod, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) VoiceFallbackURL() (string, error) {
+	if a.CanViewProperty("VoiceFallbackURL") {
+		return a.application.VoiceFallbackURL, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) VoiceFallbackMethod() (string, error) {
+	if a.CanViewProperty("VoiceFallbackMethod") {
+		return a.application.VoiceFallbackMethod, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) SMSURL() (string, error) {
+	if a.CanViewProperty("SMSURL") {
+		return a.application.SMSURL, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) SMSFallbackURL() (string, error) {
+	if a.CanViewProperty("SMSFallbackURL") {
+		return a.application.SMSFallbackURL, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) SMSFallbackMethod() (string, error) {
+	if a.CanViewProperty("SMSFallbackMethod") {
+		return a.application.SMSFallbackMethod, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) StatusCallback() (string, error) {
+	if a.CanViewProperty("StatusCallback") {
+		return a.application.StatusCallback, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) StatusCallbackMethod() (string, error) {
+	if a.CanViewProperty("StatusCallbackMethod") {
+		return a.application.StatusCallbackMethod, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (a *Application) MessageStatusCallback() (string, error) {
+	if a.CanViewProperty("MessageStatusCallback") {
+		return a.application.MessageStatusCallback, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
@@ -15,8 +15,9 @@ type CallPage struct {
 }
 
 type Call struct {
-	user *config.User
-	call *twilio.Call
+	user       *config.User
+	permission *config.Permission
+	call       *twilio.Call
 }
 
 func NewCall(call *twilio.Call, p *config.Permission, u *config.User) (*Call, error) {
@@ -29,26 +30,35 @@ func NewCall(call *twilio.Call, p *config.Permission, u *config.User) (*Call, er
 	if !u.CanViewResource(call.DateCreated.Time, p.MaxResourceAge()) {
 		return nil, config.ErrTooOld
 	}
-	return &Call{user: u, call: call}, nil
+	if u.IsTooNew(call.DateCreated.Time, p.MinResourceAge()) {
+		return nil, config.ErrTooNew
+	}
+	if !u.InScope("", string(call.From), string(call.To)) {
+		return nil, config.ErrOutOfScope
+	}
+	return &Call{user: u, permission: p, call: call}, nil
+}
+
+var callProperties = propertyPermissions{
+	"Sid":         {"can_view_calls"},
+	"Direction":   {"can_view_calls"},
+	"Status":      {"can_view_calls"},
+	"DateCreated": {"can_view_calls"},
+	"DateUpdated": {"can_view_calls"},
+	"Duration":    {"can_view_calls"},
+	"StartTime":   {"can_view_calls"},
+	"EndTime":     {"can_view_calls"},
+	"Price":       {"can_view_call_price"},
+	"PriceUnit":   {"can_view_call_price"},
+	"From":        {"can_view_call_from"},
+	"To":          {"can_view_call_to"},
 }
 
 func (c *Call) CanViewProperty(property string) bool {
 	if c.user == nil {
 		return false
 	}
-	switch property {
-	case "Sid", "Direction", "Status", "DateCreated", "DateUpdated",
-		"Duration", "StartTime", "EndTime":
-		return c.user.CanViewCalls()
-	case "Price", "PriceUnit":
-		return c.user.CanViewCallPrice()
-	case "From":
-		return c.user.CanViewCallFrom()
-	case "To":
-		return c.user.CanViewCallTo()
-	default:
-		panic("unknown property " + property)
-	}
+	return callProperties.canView(c.user, property)
 }
 
 func (c *Call) Sid() (string, error) {
@@ -85,7 +95,7 @@ func (c *Call) Status() (twilio.Status, error) {
 
 func (c *Call) From() (twilio.PhoneNumber, error) {
 	if c.CanViewProperty("From") {
-		return c.call.From, nil
+		return twilio.PhoneNumber(c.permission.Mask(c.user.CallFromMask(), string(c.call.From))), nil
 	} else {
 		return twilio.PhoneNumber(""), config.PermissionDenied
 	}
@@ -93,7 +103,7 @@ func (c *Call) From() (twilio.PhoneNumber, error) {
 
 func (c *Call) To() (twilio.PhoneNumber, error) {
 	if c.CanViewProperty("To") {
-		return c.call.To, nil
+		return twilio.PhoneNumber(c.permission.Mask(c.user.CallToMask(), string(c.call.To))), nil
 	} else {
 		return twilio.PhoneNumber(""), config.PermissionDenied
 	}
@@ -146,7 +156,7 @@ func NewCallPage(cp *twilio.CallPage, p *config.Permission, u *config.User) (*Ca
 	calls := make([]*Call, 0)
 	for _, call := range cp.Calls {
 		cl, err := NewCall(call, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -14,10 +14,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/groupcache/singleflight"
 	log "github.com/inconshreveable/log15"
+	types "github.com/kevinburke/go-types"
 	"github.com/kevinburke/logrole/cache"
 	"github.com/kevinburke/logrole/config"
 	"github.com/kevinburke/logrole/services"
@@ -32,6 +34,10 @@ var frontPageTimeout = 30 * time.Second
 // to be changing.
 var nextPageTimeout = 5 * time.Minute
 
+// The number of pages to read, looking for messages or calls a scoped user
+// can view, before giving up.
+const maxScopedPages = 5
+
 // A Client retrieves resources from a backend API, and hides information that
 // shouldn't be seen before returning them to the caller.
 type Client interface {
@@ -39,24 +45,42 @@ type Client interface {
 	GetMessage(context.Context, *config.User, string) (*Message, error)
 	GetCall(context.Context, *config.User, string) (*Call, error)
 	GetConference(context.Context, *config.User, string) (*Conference, error)
+	GetRoom(context.Context, *config.User, string) (*Room, error)
 	GetIncomingNumber(ctx context.Context, u *config.User, sid string) (*IncomingNumber, error)
 	GetIncomingNumberByPN(ctx context.Context, u *config.User, pn string) (*IncomingNumber, error)
+	GetApplication(context.Context, *config.User, string) (*Application, error)
+	GetApplicationNumbers(context.Context, *config.User, string) ([]*IncomingNumber, error)
 	GetAlert(context.Context, *config.User, string) (*Alert, error)
 	GetMediaURLs(context.Context, *config.User, string) ([]*url.URL, error)
 	GetMessagePageInRange(context.Context, *config.User, time.Time, time.Time, url.Values) (*MessagePage, uint64, error)
 	GetCallPageInRange(context.Context, *config.User, time.Time, time.Time, url.Values) (*CallPage, uint64, error)
 	GetNumberPage(context.Context, *config.User, url.Values) (*IncomingNumberPage, uint64, error)
+	GetApplicationPage(context.Context, *config.User, url.Values) (*ApplicationPage, uint64, error)
+	GetOutgoingCallerIDPage(context.Context, *config.User, url.Values) (*OutgoingCallerIDPage, uint64, error)
 	GetConferencePageInRange(context.Context, *config.User, time.Time, time.Time, url.Values) (*ConferencePage, uint64, error)
 	GetAlertPageInRange(context.Context, *config.User, time.Time, time.Time, url.Values) (*AlertPage, uint64, error)
+	GetRoomPageInRange(context.Context, *config.User, time.Time, time.Time, url.Values) (*RoomPage, uint64, error)
 	GetNextMessagePageInRange(context.Context, *config.User, time.Time, time.Time, string) (*MessagePage, uint64, error)
 	GetNextNumberPage(context.Context, *config.User, string) (*IncomingNumberPage, uint64, error)
+	GetNextApplicationPage(context.Context, *config.User, string) (*ApplicationPage, uint64, error)
+	GetNextOutgoingCallerIDPage(context.Context, *config.User, string) (*OutgoingCallerIDPage, uint64, error)
 	GetNextCallPageInRange(context.Context, *config.User, time.Time, time.Time, string) (*CallPage, uint64, error)
 	GetNextConferencePageInRange(context.Context, *config.User, time.Time, time.Time, string) (*ConferencePage, uint64, error)
 	GetNextAlertPageInRange(context.Context, *config.User, time.Time, time.Time, string) (*AlertPage, uint64, error)
+	GetNextRoomPageInRange(context.Context, *config.User, time.Time, time.Time, string) (*RoomPage, uint64, error)
 	GetNextRecordingPage(context.Context, *config.User, string) (*RecordingPage, error)
 	GetCallRecordings(context.Context, *config.User, string, url.Values) (*RecordingPage, error)
 	GetCallAlerts(context.Context, *config.User, string) (*AlertPage, error)
+	GetRoomParticipants(context.Context, *config.User, string) (*RoomParticipants, error)
+	GetRoomRecordings(context.Context, *config.User, string) (*VideoRecordingPage, error)
+	Explain(context.Context, *config.User, string) (*Explanation, error)
 	CacheCommonQueries(uint, <-chan bool)
+	// CommonQueriesCached reports whether the first run of
+	// CacheCommonQueries has finished.
+	CommonQueriesCached() bool
+	// Ping returns an error if Twilio can't be reached. Results are cached
+	// for a short time, so Ping is cheap to call often.
+	Ping(context.Context) error
 	IsTwilioNumber(num twilio.PhoneNumber) bool
 }
 
@@ -68,47 +92,92 @@ type client struct {
 	secretKey  *[32]byte
 	permission *config.Permission
 	numbers    map[twilio.PhoneNumber]bool
+
+	// Used to look up where message media can be downloaded from.
+	mediaClient *http.Client
+
+	// Phone numbers keyed by the Voice or SMS application sid they use.
+	appNumbers map[string][]*twilio.IncomingPhoneNumber
 	numbersMu  sync.RWMutex
+	// Set to 1 when the first run of CacheCommonQueries finishes.
+	commonQueriesCached int32
+	// The result of the last call to Twilio from Ping.
+	pingMu  sync.Mutex
+	pingAt  time.Time
+	pingErr error
 }
 
+// How long Ping reuses the result of its last call to Twilio.
+var pingTimeout = 15 * time.Second
+
 // this allows about 8k entries in the cache
 const cacheSizeMB = 25
 const averageCacheEntryBytes = 3000
 
 // NewClient creates a new Client encapsulating the provided values.
 func NewClient(l log.Logger, c *twilio.Client, secretKey *[32]byte, p *config.Permission) Client {
+	return newClient(l, c, nil, newCache(l), secretKey, p)
+}
+
+func newCache(l log.Logger) *cache.Cache {
+	return cache.NewCache(cacheSizeMB*1024*1024/averageCacheEntryBytes, l)
+}
+
+// newClient returns a client for c. If mediaClient is nil, media URLs are
+// looked up with a client with the default timeout.
+func newClient(l log.Logger, c *twilio.Client, mediaClient *http.Client, ch *cache.Cache, secretKey *[32]byte, p *config.Permission) *client {
+	makeResilient(c)
+	if mediaClient == nil {
+		mediaClient = defaultMediaClient
+	}
 	return &client{
-		Logger:     l,
-		group:      singleflight.Group{},
-		cache:      cache.NewCache(cacheSizeMB*1024*1024/averageCacheEntryBytes, l),
-		client:     c,
-		secretKey:  secretKey,
-		permission: p,
+		Logger:      l,
+		group:       singleflight.Group{},
+		cache:       ch,
+		client:      c,
+		mediaClient: mediaClient,
+		secretKey:   secretKey,
+		permission:  p,
 	}
 }
 
 func (vc *client) getNumbers() {
+	if err := vc.loadNumbers(Background(context.Background())); err != nil {
+		vc.Debug("Error updating phone number map", "err", err)
+	}
+}
+
+func (vc *client) loadNumbers(ctx context.Context) error {
 	iter := vc.client.IncomingNumbers.GetPageIterator(nil)
 	size, count := 0, 0
 	mp := make(map[twilio.PhoneNumber]bool)
+	apps := make(map[string][]*twilio.IncomingPhoneNumber)
 	for count < 200 {
-		page, err := iter.Next(context.Background())
+		page, err := iter.Next(ctx)
 		if err == twilio.NoMoreResults {
 			break
 		}
 		if err != nil {
-			return
+			return err
 		}
 		for _, pn := range page.IncomingPhoneNumbers {
 			mp[pn.PhoneNumber] = true
+			if pn.VoiceApplicationSid != "" {
+				apps[pn.VoiceApplicationSid] = append(apps[pn.VoiceApplicationSid], pn)
+			}
+			if pn.SMSApplicationSid != "" && pn.SMSApplicationSid != pn.VoiceApplicationSid {
+				apps[pn.SMSApplicationSid] = append(apps[pn.SMSApplicationSid], pn)
+			}
 			size++
 		}
 		count++
 	}
 	vc.numbersMu.Lock()
 	vc.numbers = mp
+	vc.appNumbers = apps
 	vc.numbersMu.Unlock()
 	vc.Debug("Updated phone number map", "size", size)
+	return nil
 }
 
 // SetBasicAuth sets the Twilio AccountSid and AuthToken on the given request.
@@ -173,6 +242,50 @@ func (vc *client) GetIncomingNumberByPN(ctx context.Context, user *config.User,
 	return NewIncomingNumber(page.IncomingPhoneNumbers[0], vc.permission, user)
 }
 
+// GetApplication fetches a single Application from the Twilio API, and returns
+// any network or permission errors that occur.
+func (vc *client) GetApplication(ctx context.Context, user *config.User, sid string) (*Application, error) {
+	application, err := vc.client.Applications.Get(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	return NewApplication(application, vc.permission, user)
+}
+
+// GetApplicationNumbers returns the phone numbers that use the application
+// with the given sid for Voice or SMS. Twilio can't filter phone numbers by
+// application, so we use the phone number map that's refreshed in the
+// background by CacheCommonQueries, and load it if it's not present.
+func (vc *client) GetApplicationNumbers(ctx context.Context, user *config.User, sid string) ([]*IncomingNumber, error) {
+	// The application a number points to is hidden along with its URL's.
+	if !user.CanViewCallbackURLs() {
+		return nil, config.PermissionDenied
+	}
+	vc.numbersMu.RLock()
+	loaded := vc.appNumbers != nil
+	vc.numbersMu.RUnlock()
+	if !loaded {
+		if err := vc.loadNumbers(ctx); err != nil {
+			return nil, err
+		}
+	}
+	vc.numbersMu.RLock()
+	tnumbers := vc.appNumbers[sid]
+	vc.numbersMu.RUnlock()
+	numbers := make([]*IncomingNumber, 0, len(tnumbers))
+	for _, tnumber := range tnumbers {
+		number, err := NewIncomingNumber(tnumber, vc.permission, user)
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied || err == config.ErrOutOfScope {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
 // GetConference fetches a single Conference from the Twilio API, and returns any
 // network or permission errors that occur.
 func (vc *client) GetConference(ctx context.Context, user *config.User, sid string) (*Conference, error) {
@@ -183,6 +296,16 @@ func (vc *client) GetConference(ctx context.Context, user *config.User, sid stri
 	return NewConference(conference, vc.permission, user)
 }
 
+// GetRoom fetches a single video Room from the Twilio API, and returns any
+// network or permission errors that occur.
+func (vc *client) GetRoom(ctx context.Context, user *config.User, sid string) (*Room, error) {
+	room, err := vc.client.Video.Rooms.Get(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	return NewRoom(room, vc.permission, user)
+}
+
 // Just make sure we get all of the media when we make a request
 var mediaUrlsFilters = url.Values{
 	"PageSize": []string{"100"},
@@ -194,7 +317,13 @@ func (vc *client) GetMediaURLs(ctx context.Context, u *config.User, sid string)
 	if u.CanViewMedia() == false {
 		return nil, config.PermissionDenied
 	}
-	urls, err := vc.client.Messages.GetMediaURLs(ctx, sid, mediaUrlsFilters)
+	if u.IsScoped() {
+		// Media doesn't say which numbers were involved; check the message.
+		if _, err := vc.GetMessage(ctx, u, sid); err != nil {
+			return nil, err
+		}
+	}
+	urls, err := vc.getMediaURLs(ctx, sid, mediaUrlsFilters)
 	if err != nil {
 		return nil, err
 	}
@@ -210,8 +339,26 @@ func (vc *client) GetMediaURLs(ctx context.Context, u *config.User, sid string)
 	return opaqueImages, nil
 }
 
-func hash(typ, val string, a, b time.Time) string {
-	return strings.Join([]string{typ, val, a.Format(time.RFC3339Nano), b.Format(time.RFC3339Nano)}, "|")
+// clampEnd moves end back so it excludes resources newer than the user's
+// min_resource_age. The result is truncated to the minute so the cache keys
+// stay stable. clampEnd returns false if nothing in [start, end) is old
+// enough to view.
+func (vc *client) clampEnd(user *config.User, start, end time.Time) (time.Time, bool) {
+	minAge := user.MinResourceAge(vc.permission.MinResourceAge())
+	if minAge == 0 {
+		return end, true
+	}
+	latest := time.Now().Add(-minAge).Truncate(time.Minute)
+	if end.After(latest) {
+		end = latest.In(end.Location())
+	}
+	return end, start.Before(end)
+}
+
+// hash returns a cache key for the given resource type and query. Keys include
+// the account sid, since clients for different accounts may share a cache.
+func (vc *client) hash(typ, val string, a, b time.Time) string {
+	return strings.Join([]string{vc.client.AccountSid, typ, val, a.Format(time.RFC3339Nano), b.Format(time.RFC3339Nano)}, "|")
 }
 
 func (vc *client) getAndCacheMessage(ctx context.Context, start, end time.Time, data url.Values) (*CacheResult, error) {
@@ -219,7 +366,7 @@ func (vc *client) getAndCacheMessage(ctx context.Context, start, end time.Time,
 	if err != nil {
 		return nil, err
 	}
-	key := hash("messages", data.Encode(), start, end)
+	key := vc.hash("messages", data.Encode(), start, end)
 	vc.cache.Set(key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
@@ -229,7 +376,7 @@ func (vc *client) getAndCacheConference(ctx context.Context, start, end time.Tim
 	if err != nil {
 		return nil, err
 	}
-	key := hash("conferences", data.Encode(), start, end)
+	key := vc.hash("conferences", data.Encode(), start, end)
 	vc.cache.Set(key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
@@ -239,7 +386,7 @@ func (vc *client) getAndCacheAlert(ctx context.Context, start, end time.Time, da
 	if err != nil {
 		return nil, err
 	}
-	key := hash("alerts", data.Encode(), start, end)
+	key := vc.hash("alerts", data.Encode(), start, end)
 	vc.cache.Set(key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
@@ -249,7 +396,7 @@ func (vc *client) getAndCacheCall(ctx context.Context, start, end time.Time, dat
 	if err != nil {
 		return nil, err
 	}
-	key := hash("calls", data.Encode(), start, end)
+	key := vc.hash("calls", data.Encode(), start, end)
 	vc.cache.Set(key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
@@ -259,7 +406,7 @@ func (vc *client) getAndCacheNumber(ctx context.Context, data url.Values) (*Cach
 	if err != nil {
 		return nil, err
 	}
-	key := hash("incoming-numbers", data.Encode(), twilio.Epoch, twilio.HeatDeath)
+	key := vc.hash("incoming-numbers", data.Encode(), twilio.Epoch, twilio.HeatDeath)
 	vc.cache.Set(key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
@@ -283,24 +430,32 @@ func (vc *client) cacheToMsg(user *config.User, val interface{}) (*MessagePage,
 }
 
 func (vc *client) GetMessagePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*MessagePage, uint64, error) {
-	key := hash("messages", data.Encode(), start, end)
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("messages", data.Encode(), start, end)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.MessagePage)
 		t, err := vc.cache.Get(key, page)
 		if err == nil {
 			return &CacheResult{t, page}, nil
 		}
-		return vc.getAndCacheMessage(ctx, start, end, data)
+		result, err := vc.getAndCacheMessage(ctx, start, end, data)
+		if err != nil {
+			return vc.orStale(ctx, key, page, err)
+		}
+		return result, nil
 	})
 	if err != nil {
 		return nil, 0, err
 	}
-	return vc.cacheToMsg(user, val)
+	return vc.scopeMessagePage(ctx, user, start, end, val)
 }
 
-func (vc *client) GetNextMessagePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*MessagePage, uint64, error) {
-	key := hash("messages", nextPage, start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
+func (vc *client) getNextMessagePage(ctx context.Context, start time.Time, end time.Time, nextPage string) (interface{}, error) {
+	key := vc.hash("messages", nextPage, start, end)
+	return vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.MessagePage)
 		t, err := vc.cache.Get(key, page)
 		if err == nil {
@@ -308,15 +463,69 @@ func (vc *client) GetNextMessagePageInRange(ctx context.Context, user *config.Us
 		}
 		page, err = vc.client.Messages.GetNextMessagesInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
-			return nil, err
+			return vc.orStale(ctx, key, new(twilio.MessagePage), err)
 		}
 		vc.cache.Set(key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
+}
+
+func (vc *client) GetNextMessagePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*MessagePage, uint64, error) {
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	val, err := vc.getNextMessagePage(ctx, start, end, nextPage)
 	if err != nil {
 		return nil, 0, err
 	}
-	return vc.cacheToMsg(user, val)
+	return vc.scopeMessagePage(ctx, user, start, end, val)
+}
+
+// scopeMessagePage converts val to a MessagePage. For a user with a Scope,
+// pages where every message is hidden are skipped, and the page only links
+// to a next page if that page has a message the user can view, so the paging
+// links don't reveal that hidden messages exist.
+func (vc *client) scopeMessagePage(ctx context.Context, user *config.User, start time.Time, end time.Time, val interface{}) (*MessagePage, uint64, error) {
+	mp, cachedAt, err := vc.cacheToMsg(user, val)
+	if err != nil || !user.IsScoped() {
+		return mp, cachedAt, err
+	}
+	page := val.(*CacheResult).Value.(*twilio.MessagePage)
+	for i := 0; len(mp.messages) == 0 && page.NextPageURI.Valid && i < maxScopedPages; i++ {
+		val, err = vc.getNextMessagePage(ctx, start, end, page.NextPageURI.String)
+		if err != nil {
+			return nil, 0, err
+		}
+		mp, cachedAt, err = vc.cacheToMsg(user, val)
+		if err != nil {
+			return nil, 0, err
+		}
+		page = val.(*CacheResult).Value.(*twilio.MessagePage)
+	}
+	mp.previousPageURI = types.NullString{}
+	mp.nextPageURI = types.NullString{}
+	if len(mp.messages) == 0 {
+		return mp, cachedAt, nil
+	}
+	next := page.NextPageURI
+	for i := 0; next.Valid && i < maxScopedPages; i++ {
+		nval, err := vc.getNextMessagePage(ctx, start, end, next.String)
+		if err != nil {
+			vc.Debug("Error fetching next page", "err", err)
+			break
+		}
+		nmp, _, err := vc.cacheToMsg(user, nval)
+		if err != nil {
+			break
+		}
+		if len(nmp.messages) > 0 {
+			mp.nextPageURI = next
+			break
+		}
+		next = nval.(*CacheResult).Value.(*twilio.MessagePage).NextPageURI
+	}
+	return mp, cachedAt, nil
 }
 
 func (vc *client) cacheToCall(user *config.User, val interface{}) (*CallPage, uint64, error) {
@@ -333,24 +542,32 @@ func (vc *client) cacheToCall(user *config.User, val interface{}) (*CallPage, ui
 }
 
 func (vc *client) GetCallPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*CallPage, uint64, error) {
-	key := hash("calls", data.Encode(), start, end)
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("calls", data.Encode(), start, end)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.CallPage)
 		t, err := vc.cache.Get(key, page)
 		if err == nil {
 			return &CacheResult{t, page}, nil
 		}
-		return vc.getAndCacheCall(ctx, start, end, data)
+		result, err := vc.getAndCacheCall(ctx, start, end, data)
+		if err != nil {
+			return vc.orStale(ctx, key, page, err)
+		}
+		return result, nil
 	})
 	if err != nil {
 		return nil, 0, err
 	}
-	return vc.cacheToCall(user, val)
+	return vc.scopeCallPage(ctx, user, start, end, val)
 }
 
-func (vc *client) GetNextCallPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*CallPage, uint64, error) {
-	key := hash("calls", nextPage, start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
+func (vc *client) getNextCallPage(ctx context.Context, start time.Time, end time.Time, nextPage string) (interface{}, error) {
+	key := vc.hash("calls", nextPage, start, end)
+	return vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.CallPage)
 		t, err := vc.cache.Get(key, page)
 		if err == nil {
@@ -358,15 +575,67 @@ func (vc *client) GetNextCallPageInRange(ctx context.Context, user *config.User,
 		}
 		page, err = vc.client.Calls.GetNextCallsInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
-			return nil, err
+			return vc.orStale(ctx, key, new(twilio.CallPage), err)
 		}
 		vc.cache.Set(key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
+}
+
+func (vc *client) GetNextCallPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*CallPage, uint64, error) {
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	val, err := vc.getNextCallPage(ctx, start, end, nextPage)
 	if err != nil {
 		return nil, 0, err
 	}
-	return vc.cacheToCall(user, val)
+	return vc.scopeCallPage(ctx, user, start, end, val)
+}
+
+// scopeCallPage converts val to a CallPage, skipping pages and hiding paging
+// links for scoped users like scopeMessagePage.
+func (vc *client) scopeCallPage(ctx context.Context, user *config.User, start time.Time, end time.Time, val interface{}) (*CallPage, uint64, error) {
+	cp, cachedAt, err := vc.cacheToCall(user, val)
+	if err != nil || !user.IsScoped() {
+		return cp, cachedAt, err
+	}
+	page := val.(*CacheResult).Value.(*twilio.CallPage)
+	for i := 0; len(cp.calls) == 0 && page.NextPageURI.Valid && i < maxScopedPages; i++ {
+		val, err = vc.getNextCallPage(ctx, start, end, page.NextPageURI.String)
+		if err != nil {
+			return nil, 0, err
+		}
+		cp, cachedAt, err = vc.cacheToCall(user, val)
+		if err != nil {
+			return nil, 0, err
+		}
+		page = val.(*CacheResult).Value.(*twilio.CallPage)
+	}
+	cp.previousPageURI = types.NullString{}
+	cp.nextPageURI = types.NullString{}
+	if len(cp.calls) == 0 {
+		return cp, cachedAt, nil
+	}
+	next := page.NextPageURI
+	for i := 0; next.Valid && i < maxScopedPages; i++ {
+		nval, err := vc.getNextCallPage(ctx, start, end, next.String)
+		if err != nil {
+			vc.Debug("Error fetching next page", "err", err)
+			break
+		}
+		ncp, _, err := vc.cacheToCall(user, nval)
+		if err != nil {
+			break
+		}
+		if len(ncp.calls) > 0 {
+			cp.nextPageURI = next
+			break
+		}
+		next = nval.(*CacheResult).Value.(*twilio.CallPage).NextPageURI
+	}
+	return cp, cachedAt, nil
 }
 
 func (vc *client) cacheToNumber(user *config.User, val interface{}) (*IncomingNumberPage, uint64, error) {
@@ -383,14 +652,18 @@ func (vc *client) cacheToNumber(user *config.User, val interface{}) (*IncomingNu
 }
 
 func (vc *client) GetNumberPage(ctx context.Context, user *config.User, data url.Values) (*IncomingNumberPage, uint64, error) {
-	key := hash("incoming-numbers", data.Encode(), twilio.Epoch, twilio.HeatDeath)
+	key := vc.hash("incoming-numbers", data.Encode(), twilio.Epoch, twilio.HeatDeath)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.IncomingPhoneNumberPage)
 		t, err := vc.cache.Get(key, page)
 		if err == nil {
 			return &CacheResult{t, page}, nil
 		}
-		return vc.getAndCacheNumber(ctx, data)
+		result, err := vc.getAndCacheNumber(ctx, data)
+		if err != nil {
+			return vc.orStale(ctx, key, page, err)
+		}
+		return result, nil
 	})
 	if err != nil {
 		return nil, 0, err
@@ -399,7 +672,7 @@ func (vc *client) GetNumberPage(ctx context.Context, user *config.User, data url
 }
 
 func (vc *client) GetNextNumberPage(ctx context.Context, user *config.User, nextPage string) (*IncomingNumberPage, uint64, error) {
-	key := hash("incoming-numbers", nextPage, twilio.Epoch, twilio.HeatDeath)
+	key := vc.hash("incoming-numbers", nextPage, twilio.Epoch, twilio.HeatDeath)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.IncomingPhoneNumberPage)
 		t, err := vc.cache.Get(key, page)
@@ -407,7 +680,7 @@ func (vc *client) GetNextNumberPage(ctx context.Context, user *config.User, next
 			return &CacheResult{Time: t, Value: page}, nil
 		}
 		if err = vc.client.GetNextPage(ctx, nextPage, page); err != nil {
-			return nil, err
+			return vc.orStale(ctx, key, new(twilio.IncomingPhoneNumberPage), err)
 		}
 		vc.cache.Set(key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
@@ -418,6 +691,123 @@ func (vc *client) GetNextNumberPage(ctx context.Context, user *config.User, next
 	return vc.cacheToNumber(user, val)
 }
 
+func (vc *client) getAndCacheApplication(ctx context.Context, data url.Values) (*CacheResult, error) {
+	page, err := vc.client.Applications.GetPage(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	key := vc.hash("applications", data.Encode(), twilio.Epoch, twilio.HeatDeath)
+	vc.cache.Set(key, page, frontPageTimeout)
+	return &CacheResult{Value: page}, nil
+}
+
+func (vc *client) cacheToApplication(user *config.User, val interface{}) (*ApplicationPage, uint64, error) {
+	result, ok := val.(*CacheResult)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a CacheResult")
+	}
+	page, ok := result.Value.(*twilio.ApplicationPage)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a ApplicationPage")
+	}
+	ap, err := NewApplicationPage(page, vc.permission, user)
+	return ap, result.Time, err
+}
+
+func (vc *client) GetApplicationPage(ctx context.Context, user *config.User, data url.Values) (*ApplicationPage, uint64, error) {
+	key := vc.hash("applications", data.Encode(), twilio.Epoch, twilio.HeatDeath)
+	val, err := vc.group.Do(key, func() (interface{}, error) {
+		page := new(twilio.ApplicationPage)
+		t, err := vc.cache.Get(key, page)
+		if err == nil {
+			return &CacheResult{t, page}, nil
+		}
+		result, err := vc.getAndCacheApplication(ctx, data)
+		if err != nil {
+			return vc.orStale(ctx, key, page, err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToApplication(user, val)
+}
+
+func (vc *client) GetNextApplicationPage(ctx context.Context, user *config.User, nextPage string) (*ApplicationPage, uint64, error) {
+	key := vc.hash("applications", nextPage, twilio.Epoch, twilio.HeatDeath)
+	val, err := vc.group.Do(key, func() (interface{}, error) {
+		page := new(twilio.ApplicationPage)
+		t, err := vc.cache.Get(key, page)
+		if err == nil {
+			return &CacheResult{Time: t, Value: page}, nil
+		}
+		if err = vc.client.GetNextPage(ctx, nextPage, page); err != nil {
+			return vc.orStale(ctx, key, new(twilio.ApplicationPage), err)
+		}
+		vc.cache.Set(key, page, nextPageTimeout)
+		return &CacheResult{Value: page}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToApplication(user, val)
+}
+
+func (vc *client) cacheToOutgoingCallerID(user *config.User, val interface{}) (*OutgoingCallerIDPage, uint64, error) {
+	result, ok := val.(*CacheResult)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a CacheResult")
+	}
+	page, ok := result.Value.(*twilio.OutgoingCallerIDPage)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a OutgoingCallerIDPage")
+	}
+	op, err := NewOutgoingCallerIDPage(page, vc.permission, user)
+	return op, result.Time, err
+}
+
+func (vc *client) GetOutgoingCallerIDPage(ctx context.Context, user *config.User, data url.Values) (*OutgoingCallerIDPage, uint64, error) {
+	key := vc.hash("outgoing-caller-ids", data.Encode(), twilio.Epoch, twilio.HeatDeath)
+	val, err := vc.group.Do(key, func() (interface{}, error) {
+		page := new(twilio.OutgoingCallerIDPage)
+		t, err := vc.cache.Get(key, page)
+		if err == nil {
+			return &CacheResult{t, page}, nil
+		}
+		page, err = vc.client.OutgoingCallerIDs.GetPage(ctx, data)
+		if err != nil {
+			return vc.orStale(ctx, key, new(twilio.OutgoingCallerIDPage), err)
+		}
+		vc.cache.Set(key, page, frontPageTimeout)
+		return &CacheResult{Value: page}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToOutgoingCallerID(user, val)
+}
+
+func (vc *client) GetNextOutgoingCallerIDPage(ctx context.Context, user *config.User, nextPage string) (*OutgoingCallerIDPage, uint64, error) {
+	key := vc.hash("outgoing-caller-ids", nextPage, twilio.Epoch, twilio.HeatDeath)
+	val, err := vc.group.Do(key, func() (interface{}, error) {
+		page := new(twilio.OutgoingCallerIDPage)
+		t, err := vc.cache.Get(key, page)
+		if err == nil {
+			return &CacheResult{Time: t, Value: page}, nil
+		}
+		if err = vc.client.GetNextPage(ctx, nextPage, page); err != nil {
+			return vc.orStale(ctx, key, new(twilio.OutgoingCallerIDPage), err)
+		}
+		vc.cache.Set(key, page, nextPageTimeout)
+		return &CacheResult{Value: page}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToOutgoingCallerID(user, val)
+}
+
 func (vc *client) cacheToConference(user *config.User, val interface{}) (*ConferencePage, uint64, error) {
 	result, ok := val.(*CacheResult)
 	if !ok {
@@ -432,7 +822,11 @@ func (vc *client) cacheToConference(user *config.User, val interface{}) (*Confer
 }
 
 func (vc *client) GetConferencePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*ConferencePage, uint64, error) {
-	key := hash("conferences", data.Encode(), start, end)
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("conferences", data.Encode(), start, end)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.ConferencePage)
 		t, err := vc.cache.Get(key, page)
@@ -441,7 +835,7 @@ func (vc *client) GetConferencePageInRange(ctx context.Context, user *config.Use
 		}
 		page, err = vc.client.Conferences.GetConferencesInRange(start, end, data).Next(ctx)
 		if err != nil {
-			return nil, err
+			return vc.orStale(ctx, key, new(twilio.ConferencePage), err)
 		}
 		vc.cache.Set(key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
@@ -453,7 +847,11 @@ func (vc *client) GetConferencePageInRange(ctx context.Context, user *config.Use
 }
 
 func (vc *client) GetNextConferencePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*ConferencePage, uint64, error) {
-	key := hash("conferences", nextPage, start, end)
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("conferences", nextPage, start, end)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.ConferencePage)
 		t, err := vc.cache.Get(key, page)
@@ -462,7 +860,7 @@ func (vc *client) GetNextConferencePageInRange(ctx context.Context, user *config
 		}
 		page, err = vc.client.Conferences.GetNextConferencesInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
-			return nil, err
+			return vc.orStale(ctx, key, new(twilio.ConferencePage), err)
 		}
 		vc.cache.Set(key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
@@ -487,14 +885,22 @@ func (vc *client) cacheToAlert(user *config.User, val interface{}) (*AlertPage,
 }
 
 func (vc *client) GetAlertPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*AlertPage, uint64, error) {
-	key := hash("alerts", data.Encode(), start, end)
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("alerts", data.Encode(), start, end)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.AlertPage)
 		t, err := vc.cache.Get(key, page)
 		if err == nil {
 			return &CacheResult{t, page}, nil
 		}
-		return vc.getAndCacheAlert(ctx, start, end, data)
+		result, err := vc.getAndCacheAlert(ctx, start, end, data)
+		if err != nil {
+			return vc.orStale(ctx, key, page, err)
+		}
+		return result, nil
 	})
 	if err != nil {
 		return nil, 0, err
@@ -503,7 +909,11 @@ func (vc *client) GetAlertPageInRange(ctx context.Context, user *config.User, st
 }
 
 func (vc *client) GetNextAlertPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*AlertPage, uint64, error) {
-	key := hash("alerts", nextPage, start, end)
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("alerts", nextPage, start, end)
 	val, err := vc.group.Do(key, func() (interface{}, error) {
 		page := new(twilio.AlertPage)
 		t, err := vc.cache.Get(key, page)
@@ -512,7 +922,7 @@ func (vc *client) GetNextAlertPageInRange(ctx context.Context, user *config.User
 		}
 		page, err = vc.client.Monitor.Alerts.GetNextAlertsInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
-			return nil, err
+			return vc.orStale(ctx, key, new(twilio.AlertPage), err)
 		}
 		vc.cache.Set(key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
@@ -533,6 +943,9 @@ func (vc *client) GetNextRecordingPage(ctx context.Context, user *config.User, n
 }
 
 func (vc *client) GetCallRecordings(ctx context.Context, user *config.User, callSid string, data url.Values) (*RecordingPage, error) {
+	if err := vc.checkCallScope(ctx, user, callSid); err != nil {
+		return nil, err
+	}
 	page, err := vc.client.Calls.GetRecordings(ctx, callSid, data)
 	if err != nil {
 		return nil, err
@@ -540,7 +953,20 @@ func (vc *client) GetCallRecordings(ctx context.Context, user *config.User, call
 	return NewRecordingPage(page, vc.permission, user, vc.secretKey)
 }
 
+// checkCallScope returns an error if user has a Scope, and the call with the
+// given sid is outside of it.
+func (vc *client) checkCallScope(ctx context.Context, user *config.User, callSid string) error {
+	if !user.IsScoped() {
+		return nil
+	}
+	_, err := vc.GetCall(ctx, user, callSid)
+	return err
+}
+
 func (vc *client) GetCallAlerts(ctx context.Context, user *config.User, callSid string) (*AlertPage, error) {
+	if err := vc.checkCallScope(ctx, user, callSid); err != nil {
+		return nil, err
+	}
 	data := url.Values{}
 	data.Set("ResourceSid", callSid)
 	data.Set("PageSize", "400")
@@ -551,6 +977,125 @@ func (vc *client) GetCallAlerts(ctx context.Context, user *config.User, callSid
 	return NewAlertPage(page, vc.permission, user)
 }
 
+func (vc *client) cacheToRoom(user *config.User, val interface{}) (*RoomPage, uint64, error) {
+	result, ok := val.(*CacheResult)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a CacheResult")
+	}
+	page, ok := result.Value.(*twilio.RoomPage)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a RoomPage")
+	}
+	rp, err := NewRoomPage(page, vc.permission, user)
+	return rp, result.Time, err
+}
+
+// The Rooms API filters by date on the server, unlike the other list
+// resources, so we don't need a page iterator to filter results in range.
+func setRoomDateFilters(start, end time.Time, data url.Values) url.Values {
+	d := url.Values{}
+	for k, v := range data {
+		d[k] = v
+	}
+	if start != twilio.Epoch {
+		d.Set("DateCreatedAfter", start.UTC().Format(time.RFC3339))
+	}
+	if end != twilio.HeatDeath {
+		d.Set("DateCreatedBefore", end.UTC().Format(time.RFC3339))
+	}
+	return d
+}
+
+func (vc *client) getAndCacheRoom(ctx context.Context, start, end time.Time, data url.Values) (*CacheResult, error) {
+	page, err := vc.client.Video.Rooms.GetPage(ctx, setRoomDateFilters(start, end, data))
+	if err != nil {
+		return nil, err
+	}
+	key := vc.hash("rooms", data.Encode(), start, end)
+	vc.cache.Set(key, page, frontPageTimeout)
+	return &CacheResult{Value: page}, nil
+}
+
+func (vc *client) GetRoomPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*RoomPage, uint64, error) {
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("rooms", data.Encode(), start, end)
+	val, err := vc.group.Do(key, func() (interface{}, error) {
+		page := new(twilio.RoomPage)
+		t, err := vc.cache.Get(key, page)
+		if err == nil {
+			return &CacheResult{t, page}, nil
+		}
+		result, err := vc.getAndCacheRoom(ctx, start, end, data)
+		if err != nil {
+			return vc.orStale(ctx, key, page, err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToRoom(user, val)
+}
+
+func (vc *client) GetNextRoomPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*RoomPage, uint64, error) {
+	end, ok := vc.clampEnd(user, start, end)
+	if !ok {
+		return nil, 0, twilio.NoMoreResults
+	}
+	key := vc.hash("rooms", nextPage, start, end)
+	val, err := vc.group.Do(key, func() (interface{}, error) {
+		page := new(twilio.RoomPage)
+		t, err := vc.cache.Get(key, page)
+		if err == nil {
+			return &CacheResult{t, page}, nil
+		}
+		if err = vc.client.Video.GetNextPage(ctx, nextPage, page); err != nil {
+			return vc.orStale(ctx, key, new(twilio.RoomPage), err)
+		}
+		if len(page.Rooms) == 0 {
+			return nil, twilio.NoMoreResults
+		}
+		vc.cache.Set(key, page, nextPageTimeout)
+		return &CacheResult{Value: page}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToRoom(user, val)
+}
+
+// GetRoomParticipants retrieves the participants that joined the room with
+// the given sid.
+func (vc *client) GetRoomParticipants(ctx context.Context, user *config.User, roomSid string) (*RoomParticipants, error) {
+	if !user.CanViewRooms() {
+		return nil, config.PermissionDenied
+	}
+	data := url.Values{}
+	data.Set("PageSize", "100")
+	page := new(roomParticipantPage)
+	pathPart := strings.Join([]string{"Rooms", roomSid, "Participants"}, "/")
+	if err := vc.client.Video.ListResource(ctx, pathPart, data, page); err != nil {
+		return nil, err
+	}
+	return newRoomParticipants(page, user)
+}
+
+// GetRoomRecordings retrieves the recordings made in the room with the given
+// sid.
+func (vc *client) GetRoomRecordings(ctx context.Context, user *config.User, roomSid string) (*VideoRecordingPage, error) {
+	data := url.Values{}
+	data.Set("GroupingSid", roomSid)
+	data.Set("PageSize", "100")
+	page, err := vc.client.Video.VideoRecordings.GetPage(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return NewVideoRecordingPage(page, vc.permission, user, vc.secretKey)
+}
+
 func (vc *client) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
 	timeout := time.After(1 * time.Millisecond)
 	ps := strconv.FormatUint(uint64(pageSize), 10)
@@ -558,15 +1103,22 @@ func (vc *client) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
 	// we could add timeouts here but not much value; these all happen in the
 	// background and the twilio client sets a 31 second timeout on all
 	// requests.
-	ctx := context.Background()
+	ctx := Background(context.Background())
 	for {
 		select {
 		case <-timeout:
-			go vc.getAndCacheMessage(ctx, twilio.Epoch, twilio.HeatDeath, data)
-			go vc.getAndCacheCall(ctx, twilio.Epoch, twilio.HeatDeath, data)
-			go vc.getAndCacheConference(ctx, twilio.Epoch, twilio.HeatDeath, data)
-			go vc.getAndCacheAlert(ctx, twilio.Epoch, twilio.HeatDeath, data)
-			go vc.getNumbers()
+			var wg sync.WaitGroup
+			wg.Add(6)
+			go func() { defer wg.Done(); vc.getAndCacheMessage(ctx, twilio.Epoch, twilio.HeatDeath, data) }()
+			go func() { defer wg.Done(); vc.getAndCacheCall(ctx, twilio.Epoch, twilio.HeatDeath, data) }()
+			go func() { defer wg.Done(); vc.getAndCacheConference(ctx, twilio.Epoch, twilio.HeatDeath, data) }()
+			go func() { defer wg.Done(); vc.getAndCacheAlert(ctx, twilio.Epoch, twilio.HeatDeath, data) }()
+			go func() { defer wg.Done(); vc.getAndCacheRoom(ctx, twilio.Epoch, twilio.HeatDeath, data) }()
+			go func() { defer wg.Done(); vc.getNumbers() }()
+			go func() {
+				wg.Wait()
+				atomic.StoreInt32(&vc.commonQueriesCached, 1)
+			}()
 		case <-doneCh:
 			return
 		}
@@ -574,6 +1126,29 @@ func (vc *client) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
 	}
 }
 
+func (vc *client) CommonQueriesCached() bool {
+	return atomic.LoadInt32(&vc.commonQueriesCached) == 1
+}
+
+func (vc *client) Ping(ctx context.Context) error {
+	vc.pingMu.Lock()
+	if !vc.pingAt.IsZero() && time.Since(vc.pingAt) < pingTimeout {
+		err := vc.pingErr
+		vc.pingMu.Unlock()
+		return err
+	}
+	vc.pingMu.Unlock()
+	_, err := vc.group.Do(vc.hash("ping", "", time.Time{}, time.Time{}), func() (interface{}, error) {
+		_, err := vc.client.Accounts.Get(ctx, vc.client.AccountSid)
+		vc.pingMu.Lock()
+		vc.pingAt = time.Now()
+		vc.pingErr = err
+		vc.pingMu.Unlock()
+		return nil, err
+	})
+	return err
+}
+
 func (vc *client) IsTwilioNumber(num twilio.PhoneNumber) bool {
 	vc.numbersMu.RLock()
 	_, ok := vc.numbers[num]
@@ -54,6 +54,14 @@ func NewConference(conference *twilio.Conference, p *config.Permission, u *confi
 	if !u.CanViewResource(conference.DateCreated.Time, p.MaxResourceAge()) {
 		return nil, config.ErrTooOld
 	}
+	if u.IsTooNew(conference.DateCreated.Time, p.MinResourceAge()) {
+		return nil, config.ErrTooNew
+	}
+	// Conferences don't say which numbers took part, so users with a Scope
+	// can't see any of them.
+	if u.IsScoped() {
+		return nil, config.ErrOutOfScope
+	}
 	return &Conference{user: u, conference: conference}, nil
 }
 
@@ -61,7 +69,7 @@ func NewConferencePage(mp *twilio.ConferencePage, p *config.Permission, u *confi
 	conferences := make([]*Conference, 0)
 	for _, conference := range mp.Conferences {
 		conference, err := NewConference(conference, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -80,17 +88,23 @@ func NewConferencePage(mp *twilio.ConferencePage, p *config.Permission, u *confi
 	}, nil
 }
 
+var conferenceProperties = propertyPermissions{
+	"Sid":          {"can_view_conferences"},
+	"DateCreated":  {"can_view_conferences"},
+	"DateUpdated":  {"can_view_conferences"},
+	"APIVersion":   {"can_view_conferences"},
+	"AccountSID":   {"can_view_conferences"},
+	"URI":          {"can_view_conferences"},
+	"Status":       {"can_view_conferences"},
+	"FriendlyName": {"can_view_conferences"},
+	"Region":       {"can_view_conferences"},
+}
+
 func (c *Conference) CanViewProperty(property string) bool {
 	if c.user == nil {
 		return false
 	}
-	switch property {
-	case "Sid", "DateCreated", "DateUpdated", "APIVersion", "AccountSID",
-		"URI", "Status", "FriendlyName", "Region":
-		return c.user.CanViewConferences()
-	default:
-		panic("unknown property " + property)
-	}
+	return conferenceProperties.canView(c.user, property)
 }
 
 func (c *Conference) FriendlyName() (string, error) {
@@ -0,0 +1,179 @@
+package views
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/rest"
+)
+
+// propertyPermissions maps each property of a resource to the permissions a
+// user needs to view it. Properties with no permissions are visible to
+// everyone who can view the resource.
+type propertyPermissions map[string][]string
+
+// canView returns true if u has every permission needed to view property.
+// canView panics if the property does not exist.
+func (pp propertyPermissions) canView(u *config.User, property string) bool {
+	perms, ok := pp[property]
+	if !ok {
+		panic("unknown property " + property)
+	}
+	for _, perm := range perms {
+		if !u.Can(perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// whyNot explains why u can't view property, or returns the empty string if
+// they can.
+func (pp propertyPermissions) whyNot(u *config.User, property string) string {
+	perms, ok := pp[property]
+	if !ok {
+		panic("unknown property " + property)
+	}
+	for _, perm := range perms {
+		if reason := u.WhyNot(perm); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// A PropertyExplanation says whether a user can view one property of a
+// resource, and if not, why.
+type PropertyExplanation struct {
+	Name    string
+	Visible bool
+	Reason  string
+}
+
+// An Explanation says whether a user can view a resource, and which of its
+// properties they can view.
+type Explanation struct {
+	Sid string
+	// "Message", "Call", etc.
+	Type    string
+	Visible bool
+	// Why the resource is hidden, if it is.
+	Reason     string
+	Properties []*PropertyExplanation
+}
+
+// Resources outside the user's scope look like resources that don't exist;
+// see config.ErrOutOfScope.
+const notFoundReason = "It doesn't exist in this account, or it's outside your group's scope"
+
+// Explain fetches the resource with the given sid, and explains which of its
+// properties u can view, using the same rules as the rest of the package.
+func (vc *client) Explain(ctx context.Context, u *config.User, sid string) (*Explanation, error) {
+	e := &Explanation{Sid: sid}
+	var properties propertyPermissions
+	// The permission that hides the whole resource, if there is one.
+	var permission string
+	var created time.Time
+	var err error
+	switch {
+	case strings.HasPrefix(sid, "SM"), strings.HasPrefix(sid, "MM"):
+		e.Type, properties, permission = "Message", messageProperties, "can_view_messages"
+		message, getErr := vc.client.Messages.Get(ctx, sid)
+		if err = getErr; err == nil {
+			created = message.DateCreated.Time
+			_, err = NewMessage(message, vc.permission, u)
+		}
+	case strings.HasPrefix(sid, "CA"):
+		e.Type, properties, permission = "Call", callProperties, "can_view_calls"
+		call, getErr := vc.client.Calls.Get(ctx, sid)
+		if err = getErr; err == nil {
+			created = call.DateCreated.Time
+			_, err = NewCall(call, vc.permission, u)
+		}
+	case strings.HasPrefix(sid, "CF"):
+		e.Type, properties, permission = "Conference", conferenceProperties, "can_view_conferences"
+		conference, getErr := vc.client.Conferences.Get(ctx, sid)
+		if err = getErr; err == nil {
+			created = conference.DateCreated.Time
+			_, err = NewConference(conference, vc.permission, u)
+		}
+	case strings.HasPrefix(sid, "NO"):
+		e.Type, properties, permission = "Alert", alertProperties, "can_view_alerts"
+		alert, getErr := vc.client.Monitor.Alerts.Get(ctx, sid)
+		if err = getErr; err == nil {
+			created = alert.DateCreated.Time
+			_, err = NewAlert(alert, vc.permission, u)
+		}
+	case strings.HasPrefix(sid, "RM"):
+		e.Type, properties, permission = "Room", roomProperties, "can_view_rooms"
+		room, getErr := vc.client.Video.Rooms.Get(ctx, sid)
+		if err = getErr; err == nil {
+			created = room.DateCreated.Time
+			_, err = NewRoom(room, vc.permission, u)
+		}
+	case strings.HasPrefix(sid, "RT"):
+		e.Type, properties, permission = "Video Recording", videoRecordingProperties, "can_view_rooms"
+		recording, getErr := vc.client.Video.VideoRecordings.Get(ctx, sid)
+		if err = getErr; err == nil {
+			created = recording.DateCreated.Time
+			_, err = NewVideoRecording(recording, vc.permission, u, vc.secretKey)
+		}
+	case strings.HasPrefix(sid, "PN"):
+		e.Type, properties = "Phone Number", incomingNumberProperties
+		number, getErr := vc.client.IncomingNumbers.Get(ctx, sid)
+		if err = getErr; err == nil {
+			_, err = NewIncomingNumber(number, vc.permission, u)
+		}
+	case strings.HasPrefix(sid, "AP"):
+		e.Type, properties = "Application", applicationProperties
+		application, getErr := vc.client.Applications.Get(ctx, sid)
+		if err = getErr; err == nil {
+			_, err = NewApplication(application, vc.permission, u)
+		}
+	default:
+		return nil, fmt.Errorf("Can't explain %q; enter the sid of a message, call, conference, alert, room, video recording, phone number or application", sid)
+	}
+	switch err {
+	case nil:
+		// Conferences don't check can_view_conferences until a property is
+		// viewed.
+		if permission != "" {
+			e.Reason = u.WhyNot(permission)
+		}
+		e.Visible = e.Reason == ""
+	case config.PermissionDenied:
+		e.Reason = u.WhyNot(permission)
+	case config.ErrTooOld:
+		e.Reason = u.WhyTooOld(created, vc.permission.MaxResourceAge())
+	case config.ErrTooNew:
+		e.Reason = u.WhyTooNew(created, vc.permission.MinResourceAge())
+	case config.ErrOutOfScope:
+		e.Reason = notFoundReason
+	default:
+		if rerr, ok := err.(*rest.Error); ok && rerr.Status == 404 {
+			e.Reason = notFoundReason
+		} else {
+			return nil, err
+		}
+	}
+	e.Properties = explainProperties(properties, u)
+	return e, nil
+}
+
+func explainProperties(pp propertyPermissions, u *config.User) []*PropertyExplanation {
+	names := make([]string, 0, len(pp))
+	for name := range pp {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	explanations := make([]*PropertyExplanation, len(names))
+	for i, name := range names {
+		reason := pp.whyNot(u, name)
+		explanations[i] = &PropertyExplanation{Name: name, Visible: reason == "", Reason: reason}
+	}
+	return explanations
+}
@@ -0,0 +1,97 @@
+package views
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	twilio "github.com/kevinburke/twilio-go"
+	"golang.org/x/time/rate"
+)
+
+// A Limiter limits how often the server calls the Twilio API, so one busy
+// user can't use up the account's concurrency limit for everyone.
+//
+// Calls made for a user wait their turn. Calls made with a Context from
+// Background, like CacheCommonQueries and the prefetches for the next page,
+// only go out when no user's call is waiting and the limit allows a call
+// right away, so they yield to interactive traffic.
+type Limiter struct {
+	lim *rate.Limiter
+	// How long background calls sleep before checking the limit again.
+	interval time.Duration
+	// The number of interactive calls waiting for the limiter.
+	waiting int32
+}
+
+// NewLimiter returns a Limiter that allows calls at the given rate.
+func NewLimiter(rl *config.RateLimit) *Limiter {
+	interval := time.Duration(float64(time.Second) / rl.Rate)
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return &Limiter{
+		lim:      rate.NewLimiter(rate.Limit(rl.Rate), rl.BurstSize()),
+		interval: interval,
+	}
+}
+
+type backgroundKey struct{}
+
+// Background returns a Context for calls to Twilio that nobody is waiting
+// for. They run after any calls made for users.
+func Background(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+func isBackground(ctx context.Context) bool {
+	bg, _ := ctx.Value(backgroundKey{}).(bool)
+	return bg
+}
+
+// Wait blocks until a call to Twilio is allowed, or ctx is canceled.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if !isBackground(ctx) {
+		atomic.AddInt32(&l.waiting, 1)
+		defer atomic.AddInt32(&l.waiting, -1)
+		return l.lim.Wait(ctx)
+	}
+	for {
+		if atomic.LoadInt32(&l.waiting) == 0 && l.lim.Allow() {
+			return nil
+		}
+		t := time.NewTimer(l.interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+type limitedTransport struct {
+	http.RoundTripper
+	limiter *Limiter
+}
+
+func (t *limitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(r.Context()); err != nil {
+		return nil, err
+	}
+	return t.RoundTripper.RoundTrip(r)
+}
+
+// Limit makes every call c makes to Twilio, including calls to other
+// products like Monitor and Video, wait for l. Call Limit before passing c
+// to NewClient or NewAccountsClient.
+func (l *Limiter) Limit(c *twilio.Client) {
+	wrapTransports(c, func(rt http.RoundTripper) http.RoundTripper {
+		return &limitedTransport{RoundTripper: rt, limiter: l}
+	}, func(rt http.RoundTripper) bool {
+		lt, ok := rt.(*limitedTransport)
+		return ok && lt.limiter == l
+	})
+}
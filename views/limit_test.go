@@ -0,0 +1,86 @@
+package views
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+func TestBackgroundCallsYield(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(&config.RateLimit{Rate: 20, Burst: 1})
+	ctx := context.Background()
+	// Use up the burst, so the next call has to wait.
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan string, 2)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		if err := l.Wait(ctx); err != nil {
+			t.Error(err)
+		}
+		order <- "interactive"
+	}()
+	go func() {
+		if err := l.Wait(Background(ctx)); err != nil {
+			t.Error(err)
+		}
+		order <- "background"
+	}()
+	// The background call starts first, but the limiter is empty, so the
+	// interactive call should get the next token.
+	if first := <-order; first != "interactive" {
+		t.Errorf("expected the interactive call to go first, got %s", first)
+	}
+	<-order
+}
+
+func TestBackgroundWaitCanceled(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(&config.RateLimit{Rate: 0.001, Burst: 1})
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(Background(context.Background()), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestLimitTwilioClient(t *testing.T) {
+	t.Parallel()
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sid": "AC123"}`))
+	}))
+	defer s.Close()
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = s.URL
+	l := NewLimiter(&config.RateLimit{Rate: 0.001, Burst: 1})
+	l.Limit(c)
+	l.Limit(c)
+	if _, ok := c.Client.Client.Transport.(*limitedTransport).RoundTripper.(*limitedTransport); ok {
+		t.Fatal("expected Limit to wrap the transport only once")
+	}
+	ctx := context.Background()
+	if _, err := c.Accounts.Get(ctx, "AC123"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Accounts.Get(ctx, "AC123"); err == nil {
+		t.Fatal("expected the second call to be limited, got nil error")
+	}
+	if calls != 1 {
+		t.Errorf("expected one call to reach Twilio, got %d", calls)
+	}
+}
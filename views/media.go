@@ -0,0 +1,106 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kevinburke/logrole/config"
+	"golang.org/x/sync/errgroup"
+)
+
+// Used to look up media URLs if the Client wasn't given a media client.
+var defaultMediaClient = &http.Client{Timeout: config.DefaultTwilioTimeout}
+
+// How many redirects to follow when looking up a media URL.
+const maxMediaRedirects = 5
+
+// getMediaURLs returns the URLs to download the media attached to the
+// message with the given sid.
+//
+// twilio-go can do this too, but it always looks up the URLs with
+// twilio.MediaClient, which doesn't use our proxy, certificates or timeout.
+func (vc *client) getMediaURLs(ctx context.Context, sid string, data url.Values) ([]*url.URL, error) {
+	page, err := vc.client.Media.GetPage(ctx, sid, data)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]*url.URL, len(page.MediaList))
+	g, errctx := errgroup.WithContext(ctx)
+	for i, media := range page.MediaList {
+		i, mediaSid := i, media.Sid
+		g.Go(func() error {
+			u, err := vc.getMediaURL(errctx, sid, mediaSid)
+			if err != nil {
+				return err
+			}
+			urls[i] = u
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// getMediaURL follows the redirects from the API URL for a media item to
+// the URL the file can be downloaded from.
+func (vc *client) getMediaURL(ctx context.Context, messageSid string, sid string) (*url.URL, error) {
+	hc := *vc.mediaClient
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	// We want the media, not the .json representation.
+	path := strings.TrimSuffix(vc.client.FullPath("Messages/"+messageSid+"/Media/"+sid), ".json")
+	urlStr := vc.client.Base + path
+	base, err := url.Parse(vc.client.Base)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i <= maxMediaRedirects; i++ {
+		req, err := http.NewRequest("GET", urlStr, nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		// Only send the account credentials to the API, not to any other host
+		// we get redirected to.
+		if req.URL.Host == base.Host {
+			req.SetBasicAuth(vc.client.AccountSid, vc.client.AuthToken)
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return nil, errors.New("Couldn't follow redirect for media " + sid)
+		}
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(u.Host, "amazonaws") && strings.Count(u.Host, ".") == 2 && u.Scheme == "https" {
+			return u, nil
+		}
+		if strings.Contains(u.Host, "media.twiliocdn.com.") && strings.Contains(u.Host, "amazonaws") {
+			// Twilio redirects to the bucket's virtual host over HTTP.
+			// Rewrite it to the HTTPS path-based URL for the bucket.
+			if u.Scheme == "http" {
+				u.Host = strings.Replace(u.Host, "media.twiliocdn.com.", "", 1)
+				u.Path = "/media.twiliocdn.com" + u.Path
+				u.Scheme = "https"
+			}
+			return u, nil
+		}
+		urlStr = resp.Request.URL.ResolveReference(u).String()
+	}
+	return nil, errors.New("Too many redirects for media " + sid)
+}
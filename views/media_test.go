@@ -0,0 +1,110 @@
+package views
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	"github.com/kevinburke/nacl"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	http.RoundTripper
+	count int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return t.RoundTripper.RoundTrip(r)
+}
+
+func TestGetMediaURLsUsesMediaClient(t *testing.T) {
+	t.Parallel()
+	const s3URL = "https://s3-external-1.amazonaws.com/media.twiliocdn.com/AC123/abc"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2010-04-01/Accounts/AC123/Messages/MM123/Media.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"media_list": [{"sid": "ME123"}], "next_page_uri": null}`))
+		case "/2010-04-01/Accounts/AC123/Messages/MM123/Media/ME123":
+			if user, _, _ := r.BasicAuth(); user != "AC123" {
+				w.WriteHeader(401)
+				return
+			}
+			http.Redirect(w, r, "/cdn/abc", http.StatusFound)
+		case "/cdn/abc":
+			http.Redirect(w, r, s3URL, http.StatusFound)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = s.URL
+	transport := &countingTransport{RoundTripper: http.DefaultTransport}
+	key := nacl.NewKey()
+	vc := newClient(nullLogger, c, &http.Client{Transport: transport}, newCache(nullLogger), key, config.NewPermission(time.Hour))
+	urls, err := vc.GetMediaURLs(context.Background(), config.NewUser(config.AllUserSettings()), "MM123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 {
+		t.Fatalf("expected 1 media URL, got %d", len(urls))
+	}
+	if n := atomic.LoadInt32(&transport.count); n != 2 {
+		t.Errorf("expected both redirects to be looked up with the media client, got %d requests", n)
+	}
+	plain, err := services.Unopaque(strings.TrimPrefix(urls[0].Path, "/images/"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain != s3URL {
+		t.Errorf("expected the media URL to be %s, got %s", s3URL, plain)
+	}
+}
+
+func TestGetMediaURLsOnlySendsCredentialsToAPI(t *testing.T) {
+	t.Parallel()
+	const s3URL = "https://s3-external-1.amazonaws.com/media.twiliocdn.com/AC123/abc"
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("expected no credentials to be sent to another host, got %q", auth)
+		}
+		http.Redirect(w, r, s3URL, http.StatusFound)
+	}))
+	defer cdn.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2010-04-01/Accounts/AC123/Messages/MM123/Media.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"media_list": [{"sid": "ME123"}], "next_page_uri": null}`))
+		case "/2010-04-01/Accounts/AC123/Messages/MM123/Media/ME123":
+			if user, _, _ := r.BasicAuth(); user != "AC123" {
+				w.WriteHeader(401)
+				return
+			}
+			http.Redirect(w, r, cdn.URL+"/cdn/abc", http.StatusFound)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = s.URL
+	vc := newClient(nullLogger, c, &http.Client{}, newCache(nullLogger), nacl.NewKey(), config.NewPermission(time.Hour))
+	urls, err := vc.GetMediaURLs(context.Background(), config.NewUser(config.AllUserSettings()), "MM123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 {
+		t.Fatalf("expected 1 media URL, got %d", len(urls))
+	}
+}
@@ -9,8 +9,9 @@ import (
 )
 
 type Message struct {
-	user    *config.User
-	message *twilio.Message
+	user       *config.User
+	permission *config.Permission
+	message    *twilio.Message
 }
 
 type MessagePage struct {
@@ -59,7 +60,7 @@ func NewMessagePage(mp *twilio.MessagePage, p *config.Permission, u *config.User
 	messages := make([]*Message, 0)
 	for _, message := range mp.Messages {
 		msg, err := NewMessage(message, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -78,6 +79,24 @@ func NewMessagePage(mp *twilio.MessagePage, p *config.Permission, u *config.User
 	}, nil
 }
 
+var messageProperties = propertyPermissions{
+	"Sid":                 {"can_view_messages"},
+	"DateCreated":         {"can_view_messages"},
+	"DateUpdated":         {"can_view_messages"},
+	"MessagingServiceSid": {"can_view_messages"},
+	"Status":              {"can_view_messages"},
+	"Direction":           {"can_view_messages"},
+	"ErrorCode":           {"can_view_messages"},
+	"ErrorMessage":        {"can_view_messages"},
+	"Price":               {"can_view_message_price"},
+	"PriceUnit":           {"can_view_message_price"},
+	"NumMedia":            {"can_view_num_media"},
+	"From":                {"can_view_message_from"},
+	"To":                  {"can_view_message_to"},
+	"Body":                {"can_view_message_body"},
+	"NumSegments":         {"can_view_message_body"},
+}
+
 // CanViewProperty returns true if the caller can access the given property.
 // CanViewProperty panics if the property does not exist. The input is
 // case-sensitive; "MessagingServiceSid" is the correct casing.
@@ -85,24 +104,7 @@ func (m *Message) CanViewProperty(property string) bool {
 	if m.user == nil {
 		return false
 	}
-	switch property {
-	case "Sid", "DateCreated", "DateUpdated", "MessagingServiceSid",
-		"Status", "Direction", "ErrorCode",
-		"ErrorMessage":
-		return m.user.CanViewMessages()
-	case "Price", "PriceUnit":
-		return m.user.CanViewMessagePrice()
-	case "NumMedia":
-		return m.user.CanViewNumMedia()
-	case "From":
-		return m.user.CanViewMessageFrom()
-	case "To":
-		return m.user.CanViewMessageTo()
-	case "Body", "NumSegments":
-		return m.user.CanViewMessageBody()
-	default:
-		panic("unknown property " + property)
-	}
+	return messageProperties.canView(m.user, property)
 }
 
 func (m *Message) NumMedia() (twilio.NumMedia, error) {
@@ -131,7 +133,7 @@ func (m *Message) DateCreated() (twilio.TwilioTime, error) {
 
 func (m *Message) From() (twilio.PhoneNumber, error) {
 	if m.CanViewProperty("From") {
-		return m.message.From, nil
+		return twilio.PhoneNumber(m.permission.Mask(m.user.MessageFromMask(), string(m.message.From))), nil
 	} else {
 		return twilio.PhoneNumber(""), config.PermissionDenied
 	}
@@ -139,7 +141,7 @@ func (m *Message) From() (twilio.PhoneNumber, error) {
 
 func (m *Message) To() (twilio.PhoneNumber, error) {
 	if m.CanViewProperty("To") {
-		return m.message.To, nil
+		return twilio.PhoneNumber(m.permission.Mask(m.user.MessageToMask(), string(m.message.To))), nil
 	} else {
 		return twilio.PhoneNumber(""), config.PermissionDenied
 	}
@@ -195,6 +197,9 @@ func (m *Message) FriendlyPrice() (string, error) {
 
 func (m *Message) Body() (string, error) {
 	if m.CanViewProperty("Body") {
+		if m.user.RedactMessageBodies() {
+			return m.permission.Redact(m.message.Body), nil
+		}
 		return m.message.Body, nil
 	} else {
 		return "", config.PermissionDenied
@@ -242,5 +247,11 @@ func NewMessage(msg *twilio.Message, p *config.Permission, u *config.User) (*Mes
 	if !u.CanViewResource(msg.DateCreated.Time, p.MaxResourceAge()) {
 		return nil, config.ErrTooOld
 	}
-	return &Message{user: u, message: msg}, nil
+	if u.IsTooNew(msg.DateCreated.Time, p.MinResourceAge()) {
+		return nil, config.ErrTooNew
+	}
+	if !u.InScope(msg.MessagingServiceSid.String, string(msg.From), string(msg.To)) {
+		return nil, config.ErrOutOfScope
+	}
+	return &Message{user: u, permission: p, message: msg}, nil
 }
@@ -0,0 +1,109 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	types "github.com/kevinburke/go-types"
+	"github.com/kevinburke/logrole/config"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+func scopedUser(t *testing.T, scope *config.Scope) *config.User {
+	p := &config.Policy{
+		&config.Group{
+			Name:        "franchise",
+			Permissions: config.AllUserSettings(),
+			Users:       []string{"franchise@example.com"},
+			Scope:       scope,
+		},
+	}
+	u, _, err := p.Lookup("franchise@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestMessageOutOfScope(t *testing.T) {
+	t.Parallel()
+	u := scopedUser(t, &config.Scope{
+		PhoneNumbers:         []string{"+14105551234"},
+		MessagingServiceSids: []string{"MG0123456789abcdef0123456789abcdef"},
+	})
+	p := config.NewPermission(time.Hour)
+	now := twilio.TwilioTime{Valid: true, Time: time.Now()}
+	visible := &twilio.Message{Sid: "SM1", From: "+14105551234", To: "+19253920364", DateCreated: now}
+	service := &twilio.Message{Sid: "SM2", From: "+19253920364", To: "+19253920365", DateCreated: now,
+		MessagingServiceSid: types.NullString{Valid: true, String: "MG0123456789abcdef0123456789abcdef"}}
+	hidden := &twilio.Message{Sid: "SM3", From: "+19253920364", To: "+19253920365", DateCreated: now}
+	if _, err := NewMessage(hidden, p, u); err != config.ErrOutOfScope {
+		t.Errorf("expected ErrOutOfScope, got %v", err)
+	}
+	mp, err := NewMessagePage(&twilio.MessagePage{
+		Messages: []*twilio.Message{visible, hidden, service},
+	}, p, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := mp.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if sid, _ := msgs[1].Sid(); sid != "SM2" {
+		t.Errorf("expected second message to be SM2, got %s", sid)
+	}
+}
+
+func TestMessageMasks(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.MessageFromMask = config.Mask{Mode: config.MaskLastDigits, Digits: 2}
+	us.MessageToMask = config.Mask{Mode: config.MaskHide}
+	us.RedactMessageBodies = true
+	u := config.NewUser(us)
+	p := config.NewPermission(time.Hour)
+	msg, err := NewMessage(&twilio.Message{
+		Sid:         "SM1",
+		From:        "+14105551234",
+		To:          "+19253920364",
+		Body:        "Your code is 482913",
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}, p, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from, _ := msg.From(); from != "••••••••••34" {
+		t.Errorf("expected masked From, got %q", from)
+	}
+	if msg.CanViewProperty("To") {
+		t.Errorf("expected hidden To to be unviewable")
+	}
+	if _, err := msg.To(); err != config.PermissionDenied {
+		t.Errorf("expected PermissionDenied for hidden To, got %v", err)
+	}
+	if body, _ := msg.Body(); body != "Your code is [redacted]" {
+		t.Errorf("expected redacted body, got %q", body)
+	}
+}
+
+func TestMessageTooNew(t *testing.T) {
+	t.Parallel()
+	u := config.NewUser(config.AllUserSettings())
+	p := config.NewPermission(config.DefaultMaxResourceAge)
+	p.SetMinResourceAge(24 * time.Hour)
+	old := &twilio.Message{Sid: "SM1", DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now().Add(-48 * time.Hour)}}
+	recent := &twilio.Message{Sid: "SM2", DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now().Add(-time.Hour)}}
+	if _, err := NewMessage(recent, p, u); err != config.ErrTooNew {
+		t.Errorf("expected ErrTooNew, got %v", err)
+	}
+	mp, err := NewMessagePage(&twilio.MessagePage{
+		Messages: []*twilio.Message{recent, old},
+	}, p, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := mp.Messages(); len(msgs) != 1 {
+		t.Errorf("expected 1 message, got %d", len(msgs))
+	}
+}
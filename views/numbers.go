@@ -37,6 +37,9 @@ func NewIncomingNumber(pn *twilio.IncomingPhoneNumber, p *config.Permission, u *
 	}
 	// NB: Phone numbers are *exempt* from max resource age rules, they don't
 	// really make sense.
+	if !u.InScope("", string(pn.PhoneNumber)) {
+		return nil, config.ErrOutOfScope
+	}
 	return &IncomingNumber{user: u, number: pn}, nil
 }
 
@@ -44,7 +47,7 @@ func NewIncomingNumberPage(pn *twilio.IncomingPhoneNumberPage, p *config.Permiss
 	numbers := make([]*IncomingNumber, 0)
 	for _, number := range pn.IncomingPhoneNumbers {
 		num, err := NewIncomingNumber(number, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		if err == config.ErrTooOld || err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -84,22 +87,34 @@ func (page *IncomingNumberPage) ShowHeader(property string) bool {
 	return false
 }
 
+var incomingNumberProperties = propertyPermissions{
+	"Sid":                  nil,
+	"DateCreated":          nil,
+	"PhoneNumber":          nil,
+	"FriendlyName":         nil,
+	"Beta":                 nil,
+	"TrunkSid":             nil,
+	"Capabilities":         nil,
+	"EmergencyStatus":      nil,
+	"VoiceURL":             {"can_view_callback_urls"},
+	"SMSURL":               {"can_view_callback_urls"},
+	"VoiceMethod":          {"can_view_callback_urls"},
+	"SMSMethod":            {"can_view_callback_urls"},
+	"StatusCallback":       {"can_view_callback_urls"},
+	"StatusCallbackMethod": {"can_view_callback_urls"},
+	"VoiceFallbackURL":     {"can_view_callback_urls"},
+	"VoiceFallbackMethod":  {"can_view_callback_urls"},
+	"SMSFallbackURL":       {"can_view_callback_urls"},
+	"SMSFallbackMethod":    {"can_view_callback_urls"},
+	"VoiceApplicationSid":  {"can_view_callback_urls"},
+	"SMSApplicationSid":    {"can_view_callback_urls"},
+}
+
 func (n *IncomingNumber) CanViewProperty(property string) bool {
 	if n.number == nil {
 		return false
 	}
-	switch property {
-	case "Sid", "DateCreated", "PhoneNumber", "FriendlyName", "Beta",
-		"TrunkSid", "Capabilities", "EmergencyStatus":
-		return true
-	case "VoiceURL", "SMSURL", "VoiceMethod", "SMSMethod", "StatusCallback",
-		"StatusCallbackMethod", "VoiceFallbackURL", "VoiceFallbackMethod",
-		"SMSFallbackURL", "SMSFallbackMethod", "VoiceApplicationSid",
-		"SMSApplicationSid":
-		return n.user.CanViewCallbackURLs()
-	default:
-		panic("unknown property " + property)
-	}
+	return incomingNumberProperties.canView(n.user, property)
 }
 
 func (n *IncomingNumber) Sid() (string, error) {
@@ -0,0 +1,136 @@
+package views
+
+import (
+	"errors"
+
+	types "github.com/kevinburke/go-types"
+	twilio "github.com/kevinburke/twilio-go"
+	"github.com/kevinburke/logrole/config"
+)
+
+type OutgoingCallerIDPage struct {
+	callerIDs       []*OutgoingCallerID
+	nextPageURI     types.NullString
+	previousPageURI types.NullString
+}
+
+func (p *OutgoingCallerIDPage) CallerIDs() []*OutgoingCallerID {
+	return p.callerIDs
+}
+
+func (p *OutgoingCallerIDPage) NextPageURI() types.NullString {
+	return p.nextPageURI
+}
+
+func (p *OutgoingCallerIDPage) PreviousPageURI() types.NullString {
+	return p.previousPageURI
+}
+
+func (p *OutgoingCallerIDPage) ShowHeader(property string) bool {
+	if p == nil {
+		return showAllColumnsOnEmptyPage
+	}
+	callerIDs := p.CallerIDs()
+	if len(callerIDs) == 0 {
+		return showAllColumnsOnEmptyPage
+	}
+	for _, callerID := range callerIDs {
+		if callerID.CanViewProperty(property) {
+			return true
+		}
+	}
+	return false
+}
+
+// An OutgoingCallerID is a phone number that has been verified for use as
+// the caller ID on outbound calls, but isn't hosted at Twilio.
+type OutgoingCallerID struct {
+	user     *config.User
+	callerID *twilio.OutgoingCallerID
+}
+
+func NewOutgoingCallerID(o *twilio.OutgoingCallerID, p *config.Permission, u *config.User) (*OutgoingCallerID, error) {
+	if o.DateCreated.Valid == false {
+		return nil, errors.New("Invalid DateCreated for outgoing caller id")
+	}
+	// NB: Like phone numbers, caller ID's are *exempt* from max resource age
+	// rules.
+	if !u.InScope("", string(o.PhoneNumber)) {
+		return nil, config.ErrOutOfScope
+	}
+	return &OutgoingCallerID{user: u, callerID: o}, nil
+}
+
+func NewOutgoingCallerIDPage(op *twilio.OutgoingCallerIDPage, p *config.Permission, u *config.User) (*OutgoingCallerIDPage, error) {
+	callerIDs := make([]*OutgoingCallerID, 0)
+	for _, tcallerID := range op.OutgoingCallerIDs {
+		callerID, err := NewOutgoingCallerID(tcallerID, p, u)
+		if err == config.ErrTooOld || err == config.PermissionDenied || err == config.ErrOutOfScope {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		callerIDs = append(callerIDs, callerID)
+	}
+	var npuri types.NullString
+	if len(callerIDs) > 0 {
+		npuri = op.NextPageURI
+	}
+	return &OutgoingCallerIDPage{
+		callerIDs:       callerIDs,
+		nextPageURI:     npuri,
+		previousPageURI: op.PreviousPageURI,
+	}, nil
+}
+
+var outgoingCallerIDProperties = propertyPermissions{
+	"Sid":          nil,
+	"DateCreated":  nil,
+	"DateUpdated":  nil,
+	"FriendlyName": nil,
+	// Caller IDs are the From number on outbound calls.
+	"PhoneNumber": {"can_view_call_from"},
+}
+
+func (o *OutgoingCallerID) CanViewProperty(property string) bool {
+	if o.callerID == nil || o.user == nil {
+		return false
+	}
+	if _, ok := outgoingCallerIDProperties[property]; !ok {
+		return false
+	}
+	return outgoingCallerIDProperties.canView(o.user, property)
+}
+
+func (o *OutgoingCallerID) Sid() (string, error) {
+	if o.CanViewProperty("Sid") {
+		return o.callerID.Sid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (o *OutgoingCallerID) FriendlyName() (string, error) {
+	if o.CanViewProperty("FriendlyName") {
+		return o.callerID.FriendlyName, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (o *OutgoingCallerID) PhoneNumber() (twilio.PhoneNumber, error) {
+	if o.CanViewProperty("PhoneNumber") {
+		return o.callerID.PhoneNumber, nil
+	} else {
+		return twilio.PhoneNumber(""), config.PermissionDenied
+	}
+}
+
+func (o *OutgoingCallerID) DateCreated() (twilio.TwilioTime, error) {
+	if o.CanViewProperty("DateCreated") {
+		return o.callerID.DateCreated, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
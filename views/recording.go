@@ -116,11 +116,16 @@ func NewRecording(r *twilio.Recording, p *config.Permission, u *config.User, key
 	if !u.CanViewResource(r.DateCreated.Time, p.MaxResourceAge()) {
 		return nil, config.ErrTooOld
 	}
+	if u.IsTooNew(r.DateCreated.Time, p.MinResourceAge()) {
+		return nil, config.ErrTooNew
+	}
 	url := services.Opaque(r.URL(".wav"), key)
 	return &Recording{
 		user:      u,
 		recording: r,
-		url:       "/audio/" + url,
+		// Relative, so the recording is fetched with the credentials of the
+		// account the page belongs to.
+		url: "audio/" + url,
 	}, nil
 }
 
@@ -128,7 +133,7 @@ func NewRecordingPage(rp *twilio.RecordingPage, p *config.Permission, u *config.
 	recordings := make([]*Recording, 0)
 	for _, trecording := range rp.Recordings {
 		recording, err := NewRecording(trecording, p, u, key)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied {
 			continue
 		}
 		if err != nil {
@@ -0,0 +1,318 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kevinburke/rest"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+// How many times to retry a GET request that failed with a 429, a 5xx or a
+// network error.
+var maxRetries = 2
+
+// The first retry waits up to retryBackoff, and each retry after that waits
+// up to twice as long as the one before.
+var retryBackoff = 250 * time.Millisecond
+
+// Don't honor a Retry-After header longer than this; give up instead.
+var maxRetryAfter = 10 * time.Second
+
+// After breakerThreshold failures in a row, calls to a resource type fail
+// fast for breakerCooldown, and then a single call is let through to check
+// whether Twilio has recovered.
+var breakerThreshold = 5
+var breakerCooldown = 30 * time.Second
+
+// ErrCircuitOpen is returned for calls to a resource type that has failed
+// too many times in a row. The calls aren't sent to Twilio.
+var ErrCircuitOpen = errors.New("Twilio is having problems with this resource, try again soon")
+
+type degradedKey struct{}
+
+// TrackDegraded returns a Context that records whether Twilio failed, or
+// calls to it were skipped, while serving a request. Pass the Context (or
+// one derived from it) to the Client, then call Degraded.
+func TrackDegraded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, degradedKey{}, new(int32))
+}
+
+// Degraded returns true if a call to Twilio made with ctx failed, or was
+// skipped because its circuit breaker was open, so the page may be missing
+// data or show stale data.
+func Degraded(ctx context.Context) bool {
+	d, ok := ctx.Value(degradedKey{}).(*int32)
+	return ok && atomic.LoadInt32(d) == 1
+}
+
+func markDegraded(ctx context.Context) {
+	if d, ok := ctx.Value(degradedKey{}).(*int32); ok {
+		atomic.StoreInt32(d, 1)
+	}
+}
+
+// A breaker is a circuit breaker for one resource type.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// True while a single call is checking whether Twilio has recovered.
+	probing bool
+}
+
+// allow reports whether a call can be made at now.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// cancel records that a call allow let through was abandoned before we
+// learned anything about Twilio's health.
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// record records the result of a call that allow let through.
+func (b *breaker) record(now time.Time, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openUntil = now.Add(breakerCooldown)
+	}
+}
+
+// resourceType returns the resource type for a Twilio API URL, for example
+// "api.twilio.com/Messages" for
+// /2010-04-01/Accounts/AC123/Messages/SM123/Media.json.
+func resourceType(u *url.URL) string {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	// Skip the API version.
+	if len(parts) > 0 {
+		parts = parts[1:]
+	}
+	if len(parts) > 2 && parts[0] == "Accounts" {
+		parts = parts[2:]
+	}
+	typ := ""
+	if len(parts) > 0 {
+		typ = strings.TrimSuffix(parts[0], ".json")
+	}
+	return u.Host + "/" + typ
+}
+
+// retryable reports whether a request that got resp and err might succeed
+// if it's made again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		_, ok := err.(net.Error)
+		return ok
+	}
+	return resp.StatusCode == 429 || resp.StatusCode >= 500
+}
+
+// retryAfter returns the delay requested by resp's Retry-After header, or
+// false if there isn't one.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// backoff returns how long to wait before retry number attempt (starting at
+// 0), with full jitter, so clients that failed together don't retry
+// together.
+func backoff(attempt int) time.Duration {
+	max := retryBackoff << uint(attempt)
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// resilientTransport retries idempotent requests that fail with a 429, a 5xx
+// or a network error, and fails fast while a resource type's circuit breaker
+// is open.
+type resilientTransport struct {
+	http.RoundTripper
+	breakers *breakers
+}
+
+// breakers holds a circuit breaker for each resource type.
+type breakers struct {
+	mu sync.Mutex
+	m  map[string]*breaker
+}
+
+func (bs *breakers) get(typ string) *breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.m[typ]
+	if !ok {
+		b = new(breaker)
+		bs.m[typ] = b
+	}
+	return b
+}
+
+func (t *resilientTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	b := t.breakers.get(resourceType(r.URL))
+	if !b.allow(time.Now()) {
+		markDegraded(ctx)
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.roundTrip(r)
+	if ctx.Err() != nil {
+		// We gave up on the request; it doesn't tell us whether Twilio is
+		// healthy.
+		b.cancel()
+		return resp, err
+	}
+	failed := retryable(resp, err)
+	b.record(time.Now(), failed)
+	if failed {
+		markDegraded(ctx)
+	}
+	return resp, err
+}
+
+func (t *resilientTransport) roundTrip(r *http.Request) (*http.Response, error) {
+	idempotent := r.Method == "GET" || r.Method == "HEAD"
+	for attempt := 0; ; attempt++ {
+		resp, err := t.RoundTripper.RoundTrip(r)
+		if !idempotent || attempt >= maxRetries || !retryable(resp, err) {
+			return resp, err
+		}
+		wait, ok := retryAfter(resp, time.Now())
+		if !ok {
+			wait = backoff(attempt)
+		} else if wait > maxRetryAfter {
+			return resp, err
+		}
+		if deadline, ok := r.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// wrapTransports replaces the transport of c, and of the clients c uses for
+// other products like Monitor and Video, with wrap(transport). Clients whose
+// transport already satisfies skip are left alone.
+func wrapTransports(c *twilio.Client, wrap func(http.RoundTripper) http.RoundTripper, skip func(http.RoundTripper) bool) {
+	clients := []*twilio.Client{c, c.Monitor, c.Pricing, c.Fax, c.Wireless,
+		c.Notify, c.Lookup, c.Verify, c.Video, c.TaskRouter, c.Insights}
+	for _, tc := range clients {
+		if tc == nil || tc.Client == nil {
+			continue
+		}
+		hc := http.Client{}
+		if tc.Client.Client != nil {
+			hc = *tc.Client.Client
+		}
+		rt := hc.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		if skip(rt) {
+			continue
+		}
+		hc.Transport = wrap(rt)
+		tc.Client.Client = &hc
+	}
+}
+
+// makeResilient adds retries and circuit breakers to every call c makes.
+// The breakers are shared by c and the clients it uses for other products.
+func makeResilient(c *twilio.Client) {
+	if c == nil {
+		return
+	}
+	bs := &breakers{m: make(map[string]*breaker)}
+	wrapTransports(c, func(rt http.RoundTripper) http.RoundTripper {
+		return &resilientTransport{RoundTripper: rt, breakers: bs}
+	}, func(rt http.RoundTripper) bool {
+		_, ok := rt.(*resilientTransport)
+		return ok
+	})
+}
+
+// isTwilioFailure reports whether err means Twilio is failing, as opposed
+// to the request being invalid or the resource not existing.
+func isTwilioFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	switch terr := err.(type) {
+	case *rest.Error:
+		return terr.Status == 429 || terr.Status >= 500
+	case *url.Error:
+		return true
+	}
+	return err == ErrCircuitOpen
+}
+
+// orStale is called when fetching the value for key fails with err. If
+// Twilio is failing and there's an expired value for key in the cache,
+// orStale decodes it into stale and returns it instead of the error.
+func (vc *client) orStale(ctx context.Context, key string, stale interface{}, err error) (interface{}, error) {
+	if !isTwilioFailure(ctx, err) {
+		return nil, err
+	}
+	t, cacheErr := vc.cache.GetStale(key, stale)
+	if cacheErr != nil {
+		return nil, err
+	}
+	vc.Warn("Serving stale data from the cache", "key", key, "err", err)
+	markDegraded(ctx)
+	return &CacheResult{Time: t, Value: stale}, nil
+}
@@ -0,0 +1,193 @@
+package views
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/nacl"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+var nullLogger = log.New()
+
+func init() {
+	nullLogger.SetHandler(log.DiscardHandler())
+}
+
+// newFailingServer returns a server that fails the first failures requests
+// with status code, then returns an account.
+func newFailingServer(code int, failures int32) (*httptest.Server, *int32) {
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if n := atomic.AddInt32(&calls, 1); n <= failures || failures < 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(code)
+			w.Write([]byte(`{"code": 20003, "message": "failed", "status": 503}`))
+			return
+		}
+		w.Write([]byte(`{"sid": "AC123"}`))
+	}))
+	return s, &calls
+}
+
+func newResilientClient(base string) *twilio.Client {
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = base
+	makeResilient(c)
+	return c
+}
+
+func TestRetryAfterFailure(t *testing.T) {
+	t.Parallel()
+	s, calls := newFailingServer(503, 1)
+	defer s.Close()
+	c := newResilientClient(s.URL)
+	if _, err := c.Accounts.Get(context.Background(), "AC123"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("expected 2 calls, got %d", n)
+	}
+}
+
+func TestNoRetryOnNotFound(t *testing.T) {
+	t.Parallel()
+	s, calls := newFailingServer(404, 1)
+	defer s.Close()
+	c := newResilientClient(s.URL)
+	if _, err := c.Accounts.Get(context.Background(), "AC123"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("expected 1 call, got %d", n)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	t.Parallel()
+	// HTTP dates don't have fractional seconds.
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{now.Add(10 * time.Second).UTC().Format(http.TimeFormat), 10 * time.Second, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		d, ok := retryAfter(resp, now)
+		if ok != tt.ok || d != tt.want {
+			t.Errorf("retryAfter(%q): got (%v, %t), want (%v, %t)", tt.header, d, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestResourceType(t *testing.T) {
+	t.Parallel()
+	tests := []struct{ in, want string }{
+		{"https://api.twilio.com/2010-04-01/Accounts/AC123/Messages.json", "api.twilio.com/Messages"},
+		{"https://api.twilio.com/2010-04-01/Accounts/AC123/Messages/SM123/Media.json", "api.twilio.com/Messages"},
+		{"https://api.twilio.com/2010-04-01/Accounts/AC123.json", "api.twilio.com/Accounts"},
+		{"https://monitor.twilio.com/v1/Alerts", "monitor.twilio.com/Alerts"},
+		{"https://video.twilio.com/v1/Rooms/RM123", "video.twilio.com/Rooms"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.in)
+		if got := resourceType(u); got != tt.want {
+			t.Errorf("resourceType(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBreakerOpens(t *testing.T) {
+	t.Parallel()
+	s, calls := newFailingServer(503, -1)
+	defer s.Close()
+	c := newResilientClient(s.URL)
+	for i := 0; i < breakerThreshold; i++ {
+		if _, err := c.Accounts.Get(context.Background(), "AC123"); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	}
+	before := atomic.LoadInt32(calls)
+	ctx := TrackDegraded(context.Background())
+	_, err := c.Accounts.Get(ctx, "AC123")
+	if uerr, ok := err.(*url.Error); !ok || uerr.Err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if n := atomic.LoadInt32(calls); n != before {
+		t.Errorf("expected no calls while the breaker is open, got %d", n-before)
+	}
+	if !Degraded(ctx) {
+		t.Error("expected the context to be marked degraded")
+	}
+}
+
+func TestBreakerRecovers(t *testing.T) {
+	t.Parallel()
+	b := new(breaker)
+	now := time.Now()
+	for i := 0; i < breakerThreshold; i++ {
+		b.record(now, true)
+	}
+	if b.allow(now) {
+		t.Fatal("expected the breaker to be open")
+	}
+	later := now.Add(breakerCooldown + time.Second)
+	if !b.allow(later) {
+		t.Fatal("expected the breaker to let one call through after the cooldown")
+	}
+	if b.allow(later) {
+		t.Fatal("expected only one call through while checking for recovery")
+	}
+	b.record(later, false)
+	if !b.allow(later) {
+		t.Error("expected the breaker to close after a successful call")
+	}
+}
+
+func TestServeStaleMessages(t *testing.T) {
+	t.Parallel()
+	s, _ := newFailingServer(503, -1)
+	defer s.Close()
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = s.URL
+	vc := newClient(nullLogger, c, nil, newCache(nullLogger), nacl.NewKey(), config.NewPermission(time.Hour))
+	data := url.Values{"PageSize": []string{"50"}}
+	now := twilio.TwilioTime{Valid: true, Time: time.Now()}
+	page := &twilio.MessagePage{Messages: []*twilio.Message{
+		{Sid: "SM123", From: "+14105551234", To: "+19253920364", DateCreated: now},
+	}}
+	vc.cache.Set(vc.hash("messages", data.Encode(), twilio.Epoch, twilio.HeatDeath), page, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	ctx := TrackDegraded(context.Background())
+	u := config.NewUser(config.AllUserSettings())
+	mp, cachedAt, err := vc.GetMessagePageInRange(ctx, u, twilio.Epoch, twilio.HeatDeath, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cachedAt == 0 {
+		t.Error("expected a stale page to report when it was cached")
+	}
+	if msgs := mp.Messages(); len(msgs) != 1 {
+		t.Errorf("expected the stale page's message, got %d messages", len(msgs))
+	}
+	if !Degraded(ctx) {
+		t.Error("expected the context to be marked degraded")
+	}
+}
@@ -0,0 +1,517 @@
+package views
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	types "github.com/kevinburke/go-types"
+	"github.com/kevinburke/logrole/config"
+	"github.com/kevinburke/logrole/services"
+	twilio "github.com/kevinburke/twilio-go"
+)
+
+type Room struct {
+	user *config.User
+	room *twilio.Room
+}
+
+type RoomPage struct {
+	rooms           []*Room
+	previousPageURI types.NullString
+	nextPageURI     types.NullString
+}
+
+func (rp *RoomPage) Rooms() []*Room {
+	return rp.rooms
+}
+
+func (rp *RoomPage) NextPageURI() types.NullString {
+	return rp.nextPageURI
+}
+
+func (rp *RoomPage) PreviousPageURI() types.NullString {
+	return rp.previousPageURI
+}
+
+func (rp *RoomPage) ShowHeader(fieldName string) bool {
+	if rp == nil {
+		return showAllColumnsOnEmptyPage
+	}
+	rooms := rp.Rooms()
+	if len(rooms) == 0 {
+		return showAllColumnsOnEmptyPage
+	}
+	for _, room := range rooms {
+		if room.CanViewProperty(fieldName) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewRoom(room *twilio.Room, p *config.Permission, u *config.User) (*Room, error) {
+	if !u.CanViewRooms() {
+		return nil, config.PermissionDenied
+	}
+	if room.DateCreated.Valid == false {
+		return nil, errors.New("Invalid DateCreated for room")
+	}
+	if !u.CanViewResource(room.DateCreated.Time, p.MaxResourceAge()) {
+		return nil, config.ErrTooOld
+	}
+	if u.IsTooNew(room.DateCreated.Time, p.MinResourceAge()) {
+		return nil, config.ErrTooNew
+	}
+	// Rooms don't say which numbers took part, so users with a Scope can't
+	// see any of them.
+	if u.IsScoped() {
+		return nil, config.ErrOutOfScope
+	}
+	return &Room{user: u, room: room}, nil
+}
+
+func NewRoomPage(rp *twilio.RoomPage, p *config.Permission, u *config.User) (*RoomPage, error) {
+	rooms := make([]*Room, 0)
+	for _, room := range rp.Rooms {
+		room, err := NewRoom(room, p, u)
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied || err == config.ErrOutOfScope {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	var npuri types.NullString
+	if len(rooms) > 0 {
+		npuri = rp.Meta.NextPageURL
+	}
+	return &RoomPage{
+		rooms:           rooms,
+		nextPageURI:     npuri,
+		previousPageURI: rp.Meta.PreviousPageURL,
+	}, nil
+}
+
+var roomProperties = propertyPermissions{
+	"Sid":             {"can_view_rooms"},
+	"DateCreated":     {"can_view_rooms"},
+	"DateUpdated":     {"can_view_rooms"},
+	"EndTime":         {"can_view_rooms"},
+	"Status":          {"can_view_rooms"},
+	"Type":            {"can_view_rooms"},
+	"UniqueName":      {"can_view_rooms"},
+	"MaxParticipants": {"can_view_rooms"},
+	"Duration":        {"can_view_rooms"},
+	"MediaRegion":     {"can_view_rooms"},
+	"StatusCallback":  {"can_view_rooms", "can_view_callback_urls"},
+}
+
+func (r *Room) CanViewProperty(property string) bool {
+	if r.user == nil {
+		return false
+	}
+	return roomProperties.canView(r.user, property)
+}
+
+func (r *Room) Sid() (string, error) {
+	if r.CanViewProperty("Sid") {
+		return r.room.Sid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (r *Room) UniqueName() (string, error) {
+	if r.CanViewProperty("UniqueName") {
+		return r.room.UniqueName, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// Type returns the room type, for example "group" or "peer-to-peer".
+func (r *Room) Type() (string, error) {
+	if r.CanViewProperty("Type") {
+		return r.room.Type, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (r *Room) Status() (twilio.Status, error) {
+	if r.CanViewProperty("Status") {
+		return r.room.Status, nil
+	} else {
+		return twilio.Status(""), config.PermissionDenied
+	}
+}
+
+func (r *Room) MaxParticipants() (uint, error) {
+	if r.CanViewProperty("MaxParticipants") {
+		return r.room.MaxParticipants, nil
+	} else {
+		return 0, config.PermissionDenied
+	}
+}
+
+func (r *Room) MediaRegion() (string, error) {
+	if r.CanViewProperty("MediaRegion") {
+		return r.room.MediaRegion, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// Duration returns the length of the room. Twilio only reports a duration
+// for rooms that have completed.
+func (r *Room) Duration() (twilio.TwilioDuration, error) {
+	if r.CanViewProperty("Duration") {
+		return secondsToDuration(r.room.Duration), nil
+	} else {
+		return twilio.TwilioDuration(0), config.PermissionDenied
+	}
+}
+
+func (r *Room) DateCreated() (twilio.TwilioTime, error) {
+	if r.CanViewProperty("DateCreated") {
+		return r.room.DateCreated, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
+
+func (r *Room) EndTime() (twilio.TwilioTime, error) {
+	if r.CanViewProperty("EndTime") {
+		return r.room.EndTime, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
+
+func (r *Room) StatusCallback() (string, error) {
+	if r.CanViewProperty("StatusCallback") {
+		return r.room.StatusCallback, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// roomParticipant is a Participant in a Video Room. twilio-go doesn't have
+// support for this resource yet.
+type roomParticipant struct {
+	Sid         string            `json:"sid"`
+	RoomSid     string            `json:"room_sid"`
+	Identity    string            `json:"identity"`
+	Status      twilio.Status     `json:"status"`
+	Duration    uint              `json:"duration"`
+	StartTime   twilio.TwilioTime `json:"start_time"`
+	EndTime     twilio.TwilioTime `json:"end_time"`
+	DateCreated twilio.TwilioTime `json:"date_created"`
+}
+
+type roomParticipantPage struct {
+	Meta         twilio.Meta        `json:"meta"`
+	Participants []*roomParticipant `json:"participants"`
+}
+
+// RoomParticipant is a participant in a video room.
+type RoomParticipant struct {
+	user        *config.User
+	participant *roomParticipant
+}
+
+var roomParticipantProperties = propertyPermissions{
+	"Sid":       {"can_view_rooms"},
+	"Identity":  {"can_view_rooms"},
+	"Status":    {"can_view_rooms"},
+	"Duration":  {"can_view_rooms"},
+	"StartTime": {"can_view_rooms"},
+	"EndTime":   {"can_view_rooms"},
+}
+
+func (rp *RoomParticipant) CanViewProperty(property string) bool {
+	if rp.user == nil {
+		return false
+	}
+	return roomParticipantProperties.canView(rp.user, property)
+}
+
+func (rp *RoomParticipant) Sid() (string, error) {
+	if rp.CanViewProperty("Sid") {
+		return rp.participant.Sid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (rp *RoomParticipant) Identity() (string, error) {
+	if rp.CanViewProperty("Identity") {
+		return rp.participant.Identity, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (rp *RoomParticipant) Status() (twilio.Status, error) {
+	if rp.CanViewProperty("Status") {
+		return rp.participant.Status, nil
+	} else {
+		return twilio.Status(""), config.PermissionDenied
+	}
+}
+
+func (rp *RoomParticipant) Duration() (twilio.TwilioDuration, error) {
+	if rp.CanViewProperty("Duration") {
+		return secondsToDuration(rp.participant.Duration), nil
+	} else {
+		return twilio.TwilioDuration(0), config.PermissionDenied
+	}
+}
+
+func (rp *RoomParticipant) StartTime() (twilio.TwilioTime, error) {
+	if rp.CanViewProperty("StartTime") {
+		return rp.participant.StartTime, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
+
+// RoomParticipants is the list of participants that joined a room.
+type RoomParticipants struct {
+	participants []*RoomParticipant
+}
+
+func (rp *RoomParticipants) Participants() []*RoomParticipant {
+	return rp.participants
+}
+
+// Count returns the number of participants that joined the room.
+func (rp *RoomParticipants) Count() int {
+	return len(rp.participants)
+}
+
+// Connected returns the number of participants still connected to the room.
+func (rp *RoomParticipants) Connected() int {
+	count := 0
+	for _, p := range rp.participants {
+		if p.participant.Status == twilio.Status("connected") {
+			count++
+		}
+	}
+	return count
+}
+
+func newRoomParticipants(page *roomParticipantPage, u *config.User) (*RoomParticipants, error) {
+	if !u.CanViewRooms() {
+		return nil, config.PermissionDenied
+	}
+	if u.IsScoped() {
+		return nil, config.ErrOutOfScope
+	}
+	participants := make([]*RoomParticipant, len(page.Participants))
+	for i, p := range page.Participants {
+		participants[i] = &RoomParticipant{user: u, participant: p}
+	}
+	return &RoomParticipants{participants: participants}, nil
+}
+
+type VideoRecording struct {
+	user      *config.User
+	recording *twilio.VideoRecording
+	// The media URL, encrypted with the secret key. This must be set in
+	// NewVideoRecording.
+	url string
+}
+
+type VideoRecordingPage struct {
+	recordings  []*VideoRecording
+	nextPageURI types.NullString
+}
+
+func (vrp *VideoRecordingPage) Recordings() []*VideoRecording {
+	return vrp.recordings
+}
+
+func (vrp *VideoRecordingPage) NextPageURI() types.NullString {
+	return vrp.nextPageURI
+}
+
+var videoRecordingProperties = propertyPermissions{
+	"Sid":             {"can_view_rooms"},
+	"DateCreated":     {"can_view_rooms"},
+	"Duration":        {"can_view_rooms"},
+	"Status":          {"can_view_rooms"},
+	"Type":            {"can_view_rooms"},
+	"Size":            {"can_view_rooms"},
+	"ContainerFormat": {"can_view_rooms"},
+	"Codec":           {"can_view_rooms"},
+	"SourceSid":       {"can_view_rooms"},
+}
+
+func (vr *VideoRecording) CanViewProperty(property string) bool {
+	if vr.user == nil {
+		return false
+	}
+	return videoRecordingProperties.canView(vr.user, property)
+}
+
+func (vr *VideoRecording) Sid() (string, error) {
+	if vr.CanViewProperty("Sid") {
+		return vr.recording.Sid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// Type returns "audio" or "video".
+func (vr *VideoRecording) Type() (string, error) {
+	if vr.CanViewProperty("Type") {
+		return vr.recording.Type, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (vr *VideoRecording) Status() (twilio.Status, error) {
+	if vr.CanViewProperty("Status") {
+		return vr.recording.Status, nil
+	} else {
+		return twilio.Status(""), config.PermissionDenied
+	}
+}
+
+func (vr *VideoRecording) Codec() (string, error) {
+	if vr.CanViewProperty("Codec") {
+		return vr.recording.Codec, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// SourceSid returns the sid of the track that was recorded.
+func (vr *VideoRecording) SourceSid() (string, error) {
+	if vr.CanViewProperty("SourceSid") {
+		return vr.recording.SourceSid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// Size returns the size of the recording, in bytes.
+func (vr *VideoRecording) Size() (uint, error) {
+	if vr.CanViewProperty("Size") {
+		return vr.recording.Size, nil
+	} else {
+		return 0, config.PermissionDenied
+	}
+}
+
+func (vr *VideoRecording) Duration() (twilio.TwilioDuration, error) {
+	if vr.CanViewProperty("Duration") {
+		return secondsToDuration(vr.recording.Duration), nil
+	} else {
+		return twilio.TwilioDuration(0), config.PermissionDenied
+	}
+}
+
+func (vr *VideoRecording) DateCreated() (twilio.TwilioTime, error) {
+	if vr.CanViewProperty("DateCreated") {
+		return vr.recording.DateCreated, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
+
+// IsVideo reports whether the recording is of a video track, as opposed to an
+// audio track.
+func (vr *VideoRecording) IsVideo() bool {
+	return vr.recording.Type == "video"
+}
+
+func (vr *VideoRecording) CanPlay() bool {
+	return vr.user.CanPlayVideoRecordings() && vr.recording.Status == twilio.StatusCompleted
+}
+
+// URL returns the encrypted URL of the recording's media.
+func (vr *VideoRecording) URL() (string, error) {
+	if vr.user.CanPlayVideoRecordings() {
+		return vr.url, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// MediaType returns the Content-Type for the encrypted recording's URL.
+func (vr *VideoRecording) MediaType() string {
+	switch vr.recording.ContainerFormat {
+	case "mka":
+		return "audio/x-matroska"
+	case "mkv":
+		return "video/x-matroska"
+	case "webm":
+		if vr.IsVideo() {
+			return "video/webm"
+		}
+		return "audio/webm"
+	case "mp4":
+		return "video/mp4"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// mediaURL returns the URL for the recording's media, which redirects to the
+// actual recording file.
+func mediaURL(r *twilio.VideoRecording) string {
+	if u, ok := r.Links["media"]; ok && u != "" {
+		return u
+	}
+	return strings.Join([]string{twilio.VideoBaseUrl, twilio.VideoVersion, "Recordings", r.Sid, "Media"}, "/")
+}
+
+func NewVideoRecording(r *twilio.VideoRecording, p *config.Permission, u *config.User, key *[32]byte) (*VideoRecording, error) {
+	if !u.CanViewRooms() {
+		return nil, config.PermissionDenied
+	}
+	if r.DateCreated.Valid == false {
+		return nil, errors.New("Invalid DateCreated for video recording")
+	}
+	if !u.CanViewResource(r.DateCreated.Time, p.MaxResourceAge()) {
+		return nil, config.ErrTooOld
+	}
+	if u.IsTooNew(r.DateCreated.Time, p.MinResourceAge()) {
+		return nil, config.ErrTooNew
+	}
+	if u.IsScoped() {
+		return nil, config.ErrOutOfScope
+	}
+	url := services.Opaque(mediaURL(r), key)
+	return &VideoRecording{
+		user:      u,
+		recording: r,
+		// Relative, so the recording is fetched with the credentials of the
+		// account the page belongs to.
+		url: "video/" + url,
+	}, nil
+}
+
+func NewVideoRecordingPage(vrp *twilio.VideoRecordingPage, p *config.Permission, u *config.User, key *[32]byte) (*VideoRecordingPage, error) {
+	recordings := make([]*VideoRecording, 0)
+	for _, trecording := range vrp.Recordings {
+		recording, err := NewVideoRecording(trecording, p, u, key)
+		if err == config.ErrTooOld || err == config.ErrTooNew || err == config.PermissionDenied || err == config.ErrOutOfScope {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, recording)
+	}
+	return &VideoRecordingPage{recordings: recordings, nextPageURI: vrp.Meta.NextPageURL}, nil
+}
+
+func secondsToDuration(secs uint) twilio.TwilioDuration {
+	return twilio.TwilioDuration(time.Duration(secs) * time.Second)
+}